@@ -1,20 +1,31 @@
 package main
 
 import (
+	"context"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"time"
 
+	"github.com/muandane/estrois/internal/cache"
 	"github.com/muandane/estrois/internal/config"
 	"github.com/muandane/estrois/internal/handlers"
 	"github.com/muandane/estrois/internal/router"
 	"github.com/muandane/estrois/internal/storage"
+	"github.com/muandane/estrois/internal/tracing"
+	"github.com/redis/go-redis/v9"
 )
 
+// setupLogger builds the application logger from LOG_LEVEL and LOG_FORMAT
 func setupLogger() *slog.Logger {
+	return newLogger(os.Stdout, config.GetLoggingConfig())
+}
+
+// newLogger writes logs of at least logConfig.Level to w in logConfig.Format
+func newLogger(w io.Writer, logConfig *config.LoggingConfig) *slog.Logger {
 	opts := &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+		Level: logConfig.Level,
 		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
 			if a.Key == slog.TimeKey {
 				return slog.Attr{
@@ -25,21 +36,86 @@ func setupLogger() *slog.Logger {
 			return a
 		},
 	}
-	handler := slog.NewJSONHandler(os.Stdout, opts)
+	var handler slog.Handler = slog.NewJSONHandler(w, opts)
+	if logConfig.Format == config.LogFormatText {
+		handler = slog.NewTextHandler(w, opts)
+	}
 	return slog.New(handler)
 }
 
+// newCacheStore returns a Redis-backed cache when REDIS_ADDR is set, fronted
+// by an in-memory L1 when CACHE_L1_SIZE is set, and an in-memory cache otherwise
+func newCacheStore(logger *slog.Logger) cache.Store {
+	redisConfig := config.GetRedisConfig()
+	if redisConfig.Addr == "" {
+		store := cache.NewMemoryStore(cache.MaxCacheSize)
+		store.StartCleanup()
+		return store
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     redisConfig.Addr,
+		Password: redisConfig.Password,
+		DB:       redisConfig.DB,
+	})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		logger.Warn("redis cache unreachable, requests will miss until it recovers", "addr", redisConfig.Addr, "error", err)
+	}
+	logger.Info("using redis cache", "addr", redisConfig.Addr, "db", redisConfig.DB)
+	redisStore := cache.NewRedisStore(client, logger)
+
+	if cache.L1CacheSize > 0 {
+		logger.Info("using in-memory L1 cache", "size", cache.L1CacheSize)
+		l1 := cache.NewMemoryStore(cache.L1CacheSize)
+		l1.StartCleanup()
+		return cache.NewTieredStore(l1, redisStore)
+	}
+	return redisStore
+}
+
+// newServer returns an HTTP server for handler on addr with the configured
+// connection timeouts
+func newServer(addr string, handler http.Handler, serverConfig *config.ServerConfig) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: serverConfig.ReadHeaderTimeout,
+		ReadTimeout:       serverConfig.ReadTimeout,
+		WriteTimeout:      serverConfig.WriteTimeout,
+		IdleTimeout:       serverConfig.IdleTimeout,
+	}
+}
+
 func main() {
 	// Setup logger
 	logger := setupLogger()
 	slog.SetDefault(logger)
 	logger.Info("starting application")
+	if err := config.Validate(); err != nil {
+		logger.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		logger.Error("failed to initialize tracing", "error", err)
+		os.Exit(1)
+	}
+	if tracing.Enabled {
+		logger.Info("tracing enabled")
+	}
 	// Initialize storage client
 	storage.InitMinioClient(config.GetStorageConfig())
+	if err := storage.InitBackends(config.GetBackendConfigs(), config.GetBucketBackends()); err != nil {
+		logger.Error("failed to initialize storage backends", "error", err)
+		os.Exit(1)
+	}
 	logger.Info("storage client initialized")
 
-	// Create object handler
-	objectHandler, err := handlers.NewObjectHandler(storage.GetMinioClient(), logger)
+	// Create the cache and the handlers sharing it
+	store := newCacheStore(logger)
+	statsHandler := handlers.NewStatsHandler(store)
+	purgeHandler := handlers.NewPurgeHandler(store, logger)
+	objectHandler, err := handlers.NewObjectHandler(storage.GetBackends(), store, statsHandler, logger)
 	if err != nil {
 		logger.Error("failed to create object handler", "error", err)
 		os.Exit(1)
@@ -47,18 +123,34 @@ func main() {
 
 	// Setup router with middleware
 	r := router.NewRouter(logger)
-	handler := r.Setup(objectHandler)
+	backends := make(map[string]handlers.BucketLister)
+	for name, client := range storage.GetBackends().Clients() {
+		backends[name] = client
+	}
+	readyHandler := handlers.NewReadyHandler(backends, logger)
+	handler := r.Setup(objectHandler, statsHandler, purgeHandler, readyHandler)
 
 	// Start server
 	addr := ":8080"
-	server := &http.Server{
-		Addr:    addr,
-		Handler: handler,
+	serverConfig := config.GetServerConfig()
+	server := newServer(addr, handler, serverConfig)
+
+	// Admin endpoints get their own server when ADMIN_ADDR separates them
+	if adminHandler := r.AdminHandler(); adminHandler != nil {
+		adminServer := newServer(serverConfig.AdminAddr, adminHandler, serverConfig)
+		go func() {
+			logger.Info("admin server starting", "addr", serverConfig.AdminAddr)
+			if err := adminServer.ListenAndServe(); err != nil {
+				logger.Error("admin server failed", "error", err)
+				os.Exit(1)
+			}
+		}()
 	}
 
 	logger.Info("server starting", "addr", addr)
 	if err := server.ListenAndServe(); err != nil {
 		logger.Error("server failed", "error", err)
+		shutdownTracing(context.Background())
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/muandane/estrois/internal/config"
+)
+
+func TestSlowHeadersAreDropped(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newServer(listener.Addr().String(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), &config.ServerConfig{
+		ReadHeaderTimeout: 100 * time.Millisecond,
+	})
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Send part of the headers and stall, as a slowloris client would
+	if _, err := io.WriteString(conn, "GET /health HTTP/1.1\r\nHost: estrois\r\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	io.Copy(io.Discard, conn)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("stalled client kept its connection for %s, want it dropped after the 100ms header timeout", elapsed)
+	}
+}
+
+func TestLoggerFiltersByLevel(t *testing.T) {
+	tests := []struct {
+		level     slog.Level
+		wantDebug bool
+		wantInfo  bool
+	}{
+		{slog.LevelDebug, true, true},
+		{slog.LevelInfo, false, true},
+		{slog.LevelWarn, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := newLogger(&buf, &config.LoggingConfig{Level: tt.level, Format: config.LogFormatJSON})
+			logger.Debug("debug line")
+			logger.Info("info line")
+			if got := strings.Contains(buf.String(), "debug line"); got != tt.wantDebug {
+				t.Errorf("debug line logged = %v, want %v", got, tt.wantDebug)
+			}
+			if got := strings.Contains(buf.String(), "info line"); got != tt.wantInfo {
+				t.Errorf("info line logged = %v, want %v", got, tt.wantInfo)
+			}
+		})
+	}
+}
+
+func TestLoggerFormats(t *testing.T) {
+	var buf bytes.Buffer
+	newLogger(&buf, &config.LoggingConfig{Level: slog.LevelInfo, Format: config.LogFormatJSON}).Info("hello", "bucket", "photos")
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("json format wrote %q: %v", buf.String(), err)
+	}
+	if record["msg"] != "hello" || record["bucket"] != "photos" {
+		t.Errorf("json record = %v", record)
+	}
+	if _, err := time.Parse(time.RFC3339, record["time"].(string)); err != nil {
+		t.Errorf("time = %v, want RFC 3339", record["time"])
+	}
+
+	buf.Reset()
+	newLogger(&buf, &config.LoggingConfig{Level: slog.LevelInfo, Format: config.LogFormatText}).Info("hello", "bucket", "photos")
+	if line := buf.String(); !strings.Contains(line, "msg=hello") || !strings.Contains(line, "bucket=photos") {
+		t.Errorf("text format wrote %q", line)
+	}
+}
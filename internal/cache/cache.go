@@ -1,110 +1,242 @@
 package cache
 
 import (
-	"fmt"
-	"sync"
+	"context"
+	"strconv"
+	"strings"
 	"time"
-)
 
-var (
-	cache     sync.Map
-	cacheSize int64
-	cacheMux  sync.Mutex
+	"golang.org/x/sync/singleflight"
 )
 
-func AddToCache(cacheKey string, data []byte, contentType string, size int64, lastModified time.Time, etag string) {
-	cacheMux.Lock()
-	defer cacheMux.Unlock()
+// fetchGroup collapses concurrent storage fetches for the same cache key
+var fetchGroup singleflight.Group
+
+// NewCacheEntry builds an entry for data, precomputing gzip and brotli
+// variants when the content type is worth compressing. With
+// StoreCompressedOnly the uncompressed data is not kept once gzip succeeds.
+func NewCacheEntry(data []byte, contentType string, lastModified time.Time, etag string, userMetadata map[string]string, ttl time.Duration) *CacheEntry {
+	entry := newUncompressedEntry(data, contentType, lastModified, etag, userMetadata, ttl)
+	if ShouldCompress(contentType, entry.Size) {
+		return entry.compress()
+	}
+	return entry
+}
+
+// SetEntry stores an entry for data under key. Objects of at least
+// BackgroundCompressionSize are stored uncompressed first, so requests can be
+// served from the cache while their compressed variants are computed; the
+// compressed entry then replaces the uncompressed one unless it has been
+// overwritten or deleted meanwhile. Stores that cannot replace entries
+// conditionally get the compressed entry straight away.
+func SetEntry(store Store, key string, data []byte, contentType string, lastModified time.Time, etag string, userMetadata map[string]string, ttl time.Duration) {
+	setEntry(store, key, data, contentType, lastModified, etag, userMetadata, ttl, func(entry *CacheEntry) bool {
+		store.Set(key, entry)
+		return true
+	})
+}
 
-	if int64(len(data)) > MaxCacheSize {
+// SetFetchedEntry is SetEntry for data read from storage after
+// FillGeneration(key) returned generation. Nothing is stored once the object
+// has been invalidated since.
+func SetFetchedEntry(store Store, generation uint64, key string, data []byte, contentType string, lastModified time.Time, etag string, userMetadata map[string]string, ttl time.Duration) {
+	setEntry(store, key, data, contentType, lastModified, etag, userMetadata, ttl, func(entry *CacheEntry) bool {
+		return SetIfCurrent(store, generation, key, entry)
+	})
+}
+
+// setEntry builds the entry for data and stores it with set, then compresses
+// it in place when compression was deferred
+func setEntry(store Store, key string, data []byte, contentType string, lastModified time.Time, etag string, userMetadata map[string]string, ttl time.Duration, set func(entry *CacheEntry) bool) {
+	swapper, ok := store.(interface {
+		CompareAndSwap(key string, old, replacement *CacheEntry) bool
+	})
+	size := int64(len(data))
+	if !ok || BackgroundCompressionSize <= 0 || size < BackgroundCompressionSize || !ShouldCompress(contentType, size) {
+		set(NewCacheEntry(data, contentType, lastModified, etag, userMetadata, ttl))
 		return
 	}
 
-	var compressedData []byte
-	var isCompressed bool
-	var finalSize int64 = size
+	entry := newUncompressedEntry(data, contentType, lastModified, etag, userMetadata, ttl)
+	if set(entry) {
+		swapper.CompareAndSwap(key, entry, entry.compress())
+	}
+}
+
+func newUncompressedEntry(data []byte, contentType string, lastModified time.Time, etag string, userMetadata map[string]string, ttl time.Duration) *CacheEntry {
+	now := time.Now()
+	return &CacheEntry{
+		Data:          data,
+		ContentType:   contentType,
+		Size:          int64(len(data)),
+		LastModified:  lastModified,
+		ETag:          etag,
+		UserMetadata:  userMetadata,
+		ExpiresAt:     now.Add(ttl),
+		StoredAt:      now,
+		accountedSize: int64(len(data)),
+		usage:         &entryUsage{},
+	}
+}
 
-	if ShouldCompress(contentType, size) {
-		var err error
-		compressedData, err = CompressData(data)
-		if err == nil && int64(len(compressedData)) < size {
-			isCompressed = true
-			finalSize = int64(len(compressedData))
-		}
+// compress returns a copy of an uncompressed entry with its gzip and brotli
+// variants, keeping only those smaller than the object so hits never serve
+// an encoding larger than identity. Entries are never modified once stored,
+// so readers holding the uncompressed entry keep a consistent view. Every
+// variant kept counts against the cache, as it does in RedisStore.
+func (e *CacheEntry) compress() *CacheEntry {
+	compressed := *e
+	if gzipData, err := CompressData(e.Data); err == nil && int64(len(gzipData)) < e.Size {
+		compressed.CompressedData = gzipData
+		compressed.CompressedSize = int64(len(gzipData))
+		compressed.IsCompressed = true
+	}
+	if brotliData, err := CompressBrotli(e.Data); err == nil && int64(len(brotliData)) < e.Size {
+		compressed.BrotliData = brotliData
 	}
 
-	cleanupCacheIfNeeded(finalSize)
-
-	entry := &CacheEntry{
-		Data:           data,
-		CompressedData: compressedData,
-		ContentType:    contentType,
-		Size:           size,
-		CompressedSize: int64(len(compressedData)),
-		LastModified:   lastModified,
-		ETag:           etag,
-		ExpiresAt:      time.Now().Add(DefaultCacheDuration),
-		IsCompressed:   isCompressed,
+	if compressed.IsCompressed && StoreCompressedOnly {
+		compressed.Data = nil
 	}
-	cache.Store(cacheKey, entry)
-	cacheSize += finalSize
+	compressed.accountedSize = int64(len(compressed.Data) + len(compressed.CompressedData) + len(compressed.BrotliData))
+	return &compressed
 }
 
-// GetFromCache retrieves an object from the cache
-func GetFromCache(cacheKey string) (*CacheEntry, bool) {
-	if entry, ok := cache.Load(cacheKey); ok {
-		cacheEntry := entry.(*CacheEntry)
-		if time.Now().Before(cacheEntry.ExpiresAt) {
-			return cacheEntry, true
-		}
-		DeleteFromCache(cacheKey)
+// NewMetadataEntry builds an entry holding an object's metadata but not its
+// data. Size is the object's size; only the metadata counts against the cache.
+func NewMetadataEntry(size int64, contentType string, lastModified time.Time, etag string, userMetadata map[string]string, ttl time.Duration) *CacheEntry {
+	accounted := int64(len(contentType) + len(etag))
+	for k, v := range userMetadata {
+		accounted += int64(len(k) + len(v))
+	}
+
+	now := time.Now()
+	return &CacheEntry{
+		ContentType:   contentType,
+		Size:          size,
+		LastModified:  lastModified,
+		ETag:          etag,
+		UserMetadata:  userMetadata,
+		ExpiresAt:     now.Add(ttl),
+		StoredAt:      now,
+		MetadataOnly:  true,
+		accountedSize: accounted,
+		usage:         &entryUsage{},
 	}
-	return nil, false
 }
 
-// DeleteFromCache removes an object from the cache
-func DeleteFromCache(cacheKey string) {
-	if entry, ok := cache.LoadAndDelete(cacheKey); ok {
-		cacheMux.Lock()
-		cacheSize -= entry.(*CacheEntry).Size
-		cacheMux.Unlock()
+// BucketTTL returns the cache duration configured for bucket, falling back to
+// DefaultCacheDuration
+func BucketTTL(bucket string) time.Duration {
+	if ttl, ok := BucketCacheTTLs[bucket]; ok {
+		return ttl
 	}
+	return DefaultCacheDuration
 }
 
-// InitCache starts the cache cleanup routine
-func InitCache() {
-	go cleanupCacheRoutine()
+// MaxCacheableSize returns the largest object in bucket that gets cached. It
+// defaults to half the cache size so one object cannot evict everything.
+func MaxCacheableSize(bucket string) int64 {
+	if size, ok := BucketMaxCacheableSizes[bucket]; ok {
+		return size
+	}
+	return MaxCacheSize / 2
 }
 
-func cleanupCacheIfNeeded(newSize int64) {
-	if cacheSize+newSize > MaxCacheSize {
-		var keysToDelete []interface{}
-		cache.Range(func(key, value interface{}) bool {
-			keysToDelete = append(keysToDelete, key)
-			entry := value.(*CacheEntry)
-			cacheSize -= entry.Size
-			return cacheSize+newSize > MaxCacheSize
-		})
-		for _, key := range keysToDelete {
-			cache.Delete(key)
+// CacheTTL derives how long an object in bucket may be cached from its
+// Cache-Control header. s-maxage and max-age override the bucket's TTL, while
+// no-store, no-cache or a zero max-age make the object uncacheable.
+func CacheTTL(bucket, cacheControl string) (time.Duration, bool) {
+	ttl := BucketTTL(bucket)
+	var maxAge, sMaxAge = -1, -1
+
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache":
+			return 0, false
+		case "max-age":
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && seconds >= 0 {
+				maxAge = seconds
+			}
+		case "s-maxage":
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && seconds >= 0 {
+				sMaxAge = seconds
+			}
 		}
 	}
+
+	switch {
+	case sMaxAge >= 0:
+		ttl = time.Duration(sMaxAge) * time.Second
+	case maxAge >= 0:
+		ttl = time.Duration(maxAge) * time.Second
+	}
+	return ttl, ttl > 0
 }
 
-func cleanupCacheRoutine() {
-	ticker := time.NewTicker(CleanupInterval)
-	for range ticker.C {
-		now := time.Now()
-		cache.Range(func(key, value interface{}) bool {
-			entry := value.(*CacheEntry)
-			if now.After(entry.ExpiresAt) {
-				DeleteFromCache(key.(string))
-			}
-			return true
-		})
+// FetchOnce runs fetch for cacheKey, sharing its result with any concurrent
+// callers for the same key. Errors are returned to every waiting caller but
+// are never remembered, so the next call fetches again. A caller stops
+// waiting once ctx is done, while the fetch carries on for the others.
+func FetchOnce[T any](ctx context.Context, cacheKey string, fetch func() (T, error)) (T, bool, error) {
+	var zero T
+	select {
+	case result := <-fetchGroup.DoChan(cacheKey, func() (interface{}, error) {
+		return fetch()
+	}):
+		if result.Err != nil {
+			return zero, result.Shared, result.Err
+		}
+		return result.Val.(T), result.Shared, nil
+	case <-ctx.Done():
+		return zero, false, ctx.Err()
 	}
 }
 
+// GetCacheKey returns the cache key of an object as "bucket/key". "%" and "#"
+// in the key, and "/" in the bucket, are percent-encoded so no two objects or
+// variants share a key: ("a", "b/c") and ("a/b", "c") differ, and so do an
+// object named "k#version=1" and version 1 of "k". The encoding keeps prefixes,
+// so bucket and key prefixes still select cache keys, and is stable across
+// restarts for shared caches. Keys are bounded by storage.MaxObjectKeyLength.
 func GetCacheKey(bucket, key string) string {
-	return fmt.Sprintf("%s/%s", bucket, key)
+	return bucketKeyEscaper.Replace(bucket) + "/" + objectKeyEscaper.Replace(key)
+}
+
+// ParseCacheKey splits a key built by GetCacheKey or GetVariantKey into the
+// bucket, object key and variant it was built from
+func ParseCacheKey(cacheKey string) (bucket, key, variant string) {
+	bucket, key, _ = strings.Cut(cacheKey, "/")
+	key, variant, _ = strings.Cut(key, variantSeparator)
+	return cacheKeyUnescaper.Replace(bucket), cacheKeyUnescaper.Replace(key), variant
+}
+
+var (
+	objectKeyEscaper  = strings.NewReplacer("%", "%25", variantSeparator, "%23")
+	bucketKeyEscaper  = strings.NewReplacer("%", "%25", variantSeparator, "%23", "/", "%2F")
+	cacheKeyUnescaper = strings.NewReplacer("%25", "%", "%23", variantSeparator, "%2F", "/")
+)
+
+// variantSeparator joins an object's cache key and a variant name
+const variantSeparator = "#"
+
+// GetVariantKey returns the cache key for a variant of an object, such as an
+// encoding or a range, as "bucket/key#variant"
+func GetVariantKey(bucket, key, variant string) string {
+	return GetCacheKey(bucket, key) + variantSeparator + variant
+}
+
+// DeleteFromCacheByObject removes an object's entry and every variant of it
+// from store, returning how many entries were removed. Fills of the object
+// that read it from storage before the call store nothing.
+func DeleteFromCacheByObject(store Store, bucket, key string) int {
+	return invalidateObject(store, GetCacheKey(bucket, key))
+}
+
+// variantObject returns the cache key of the object a variant key belongs
+// to, and false for keys that are not variants
+func variantObject(key string) (string, bool) {
+	object, _, ok := strings.Cut(key, variantSeparator)
+	return object, ok
 }
@@ -0,0 +1,361 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewCacheEntryAccountsEveryVariant(t *testing.T) {
+	setMinSizeForCompression(t, 0)
+	data := bytes.Repeat([]byte("compressible text "), 1000)
+
+	entry := NewCacheEntry(data, "text/plain", time.Now(), `"etag"`, nil, time.Minute)
+	if !entry.IsCompressed || entry.BrotliData == nil || entry.Data == nil {
+		t.Fatalf("entry variants: gzip=%v br=%v identity=%v", entry.IsCompressed, entry.BrotliData != nil, entry.Data != nil)
+	}
+	want := int64(len(entry.Data) + len(entry.CompressedData) + len(entry.BrotliData))
+	if entry.accountedSize != want {
+		t.Errorf("accountedSize = %d, want %d", entry.accountedSize, want)
+	}
+
+	StoreCompressedOnly = true
+	t.Cleanup(func() { StoreCompressedOnly = false })
+	entry = NewCacheEntry(data, "text/plain", time.Now(), `"etag"`, nil, time.Minute)
+	if entry.Data != nil {
+		t.Fatal("StoreCompressedOnly kept the uncompressed data")
+	}
+	want = int64(len(entry.CompressedData) + len(entry.BrotliData))
+	if entry.accountedSize != want {
+		t.Errorf("compressed only: accountedSize = %d, want %d", entry.accountedSize, want)
+	}
+}
+
+func TestAccountedSizeReturnsToZero(t *testing.T) {
+	setMinSizeForCompression(t, 0)
+	store := NewMemoryStore(1 << 30)
+	var keys []string
+	for i := range 20 {
+		key := fmt.Sprintf("key-%d", i)
+		keys = append(keys, key)
+		if i%2 == 0 {
+			store.Set(key, NewCacheEntry(bytes.Repeat([]byte("compressible "), 100*(i+1)), "text/plain", time.Now(), `"etag"`, nil, time.Minute))
+		} else {
+			store.Set(key, testEntry(1000*(i+1), time.Minute))
+		}
+	}
+	if store.Stats().CurrentSize == 0 {
+		t.Fatal("nothing was accounted")
+	}
+
+	rand.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	for _, key := range keys {
+		if !store.Delete(key) {
+			t.Fatalf("%s was not cached", key)
+		}
+	}
+	if size := store.size.Load(); size != 0 {
+		t.Errorf("size = %d after deleting every entry, want 0", size)
+	}
+	for i, sh := range store.shards {
+		if sh.size != 0 {
+			t.Errorf("shard %d size = %d, want 0", i, sh.size)
+		}
+	}
+}
+
+func TestNewCacheEntryAccountingMatchesRedis(t *testing.T) {
+	setMinSizeForCompression(t, 0)
+	data := bytes.Repeat([]byte("<p>hello</p>"), 500)
+	entry := NewCacheEntry(data, "text/html", time.Now(), `"etag"`, nil, time.Minute)
+
+	encoded, err := encodeEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeEntry(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.accountedSize != entry.accountedSize {
+		t.Errorf("memory accounts %d bytes, redis %d", entry.accountedSize, decoded.accountedSize)
+	}
+}
+
+func setMinSizeForCompression(t *testing.T, size int64) {
+	previous := MinSizeForCompression
+	MinSizeForCompression = size
+	t.Cleanup(func() { MinSizeForCompression = previous })
+}
+
+func TestSetEntryCompressesInBackground(t *testing.T) {
+	setMinSizeForCompression(t, 0)
+	previous := BackgroundCompressionSize
+	BackgroundCompressionSize = 1
+	t.Cleanup(func() { BackgroundCompressionSize = previous })
+
+	store := NewMemoryStore(64 << 20)
+	data := bytes.Repeat([]byte("background compression "), 20000)
+	const key = "bucket/large.txt"
+
+	// Readers check every entry they see is whole while it is replaced
+	done := make(chan struct{})
+	torn := make(chan string, 1)
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				entry, status := store.Get(key)
+				if status == StatusMiss {
+					continue
+				}
+				if reason := tornEntry(entry, data); reason != "" {
+					select {
+					case torn <- reason:
+					default:
+					}
+					return
+				}
+			}
+		}()
+	}
+
+	go SetEntry(store, key, data, "text/plain", time.Now(), `"etag"`, nil, time.Minute)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		entry, status := store.Get(key)
+		if status == StatusHit && entry.IsCompressed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("entry was never replaced by its compressed form")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(done)
+	wg.Wait()
+
+	select {
+	case reason := <-torn:
+		t.Fatalf("torn entry read: %s", reason)
+	default:
+	}
+
+	entry, _ := store.Get(key)
+	if got, err := DecompressData(entry.CompressedData); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("compressed entry does not decode to the object: %v", err)
+	}
+	if got := store.Stats().CurrentSize; got != entry.accountedSize {
+		t.Errorf("store size = %d, want the compressed entry's %d", got, entry.accountedSize)
+	}
+}
+
+// tornEntry describes how entry is inconsistent with the object data, or
+// returns "" when it is whole
+func tornEntry(entry *CacheEntry, data []byte) string {
+	switch {
+	case entry.Size != int64(len(data)):
+		return "size does not match the object"
+	case entry.Data != nil && len(entry.Data) != len(data):
+		return "partial uncompressed data"
+	case entry.IsCompressed && (entry.CompressedData == nil || entry.CompressedSize != int64(len(entry.CompressedData))):
+		return "marked compressed without matching gzip data"
+	case !entry.IsCompressed && (entry.CompressedData != nil || entry.BrotliData != nil):
+		return "compressed variants on an uncompressed entry"
+	case entry.Data == nil && !entry.IsCompressed:
+		return "no data"
+	case entry.accountedSize != int64(len(entry.Data)+len(entry.CompressedData)+len(entry.BrotliData)):
+		return "accounted size does not match its variants"
+	}
+	return ""
+}
+
+func TestDefaultMaxCacheSizeHoldsLargeObjects(t *testing.T) {
+	store := NewMemoryStore(MaxCacheSize)
+	data := make([]byte, 5<<20)
+	SetEntry(store, "large.bin", data, "application/octet-stream", time.Now(), `"etag"`, nil, time.Minute)
+
+	entry, status := store.Get("large.bin")
+	if status != StatusHit {
+		t.Fatalf("a 5MB object was not cached under a %d byte limit: %s", MaxCacheSize, status)
+	}
+	if entry.Size != int64(len(data)) {
+		t.Errorf("cached size = %d, want %d", entry.Size, len(data))
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	previous := BucketCacheTTLs
+	BucketCacheTTLs = map[string]time.Duration{"long": time.Hour}
+	t.Cleanup(func() { BucketCacheTTLs = previous })
+
+	tests := []struct {
+		bucket        string
+		cacheControl  string
+		wantTTL       time.Duration
+		wantCacheable bool
+	}{
+		{"any", "", DefaultCacheDuration, true},
+		{"long", "", time.Hour, true},
+		{"any", "public, max-age=3600", time.Hour, true},
+		{"long", "max-age=60", time.Minute, true},
+		{"any", "max-age=60, s-maxage=120", 2 * time.Minute, true},
+		{"any", "max-age=0", 0, false},
+		{"any", "no-store", 0, false},
+		{"any", "private, No-Cache", 0, false},
+		{"any", "max-age=soon", DefaultCacheDuration, true},
+	}
+	for _, tt := range tests {
+		ttl, cacheable := CacheTTL(tt.bucket, tt.cacheControl)
+		if ttl != tt.wantTTL || cacheable != tt.wantCacheable {
+			t.Errorf("CacheTTL(%q, %q) = %s, %v, want %s, %v", tt.bucket, tt.cacheControl, ttl, cacheable, tt.wantTTL, tt.wantCacheable)
+		}
+	}
+}
+
+func TestFetchOnceForgetsErrors(t *testing.T) {
+	var calls int
+	failing := func() (string, error) {
+		calls++
+		return "", fmt.Errorf("storage unavailable")
+	}
+	if _, _, err := FetchOnce(context.Background(), "fetch-once/key", failing); err == nil {
+		t.Fatal("expected the fetch error")
+	}
+	value, _, err := FetchOnce(context.Background(), "fetch-once/key", func() (string, error) {
+		calls++
+		return "value", nil
+	})
+	if err != nil || value != "value" || calls != 2 {
+		t.Errorf("after an error: value %q, err %v, %d calls, want a new fetch", value, err, calls)
+	}
+}
+
+func TestFetchOnceStopsWaitingWithContext(t *testing.T) {
+	release := make(chan struct{})
+	fetched := make(chan string, 1)
+	fetch := func() (string, error) {
+		<-release
+		fetched <- "value"
+		return "value", nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := FetchOnce(ctx, "fetch-once/slow", fetch); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+
+	// The fetch is still in flight and is shared with the next caller
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		value, shared, err := FetchOnce(context.Background(), "fetch-once/slow", func() (string, error) {
+			return "second fetch", nil
+		})
+		if err != nil || value != "value" || !shared {
+			t.Errorf("second caller: value %q, shared %v, err %v, want the first fetch", value, shared, err)
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	<-done
+	if got := <-fetched; got != "value" {
+		t.Errorf("fetched %q", got)
+	}
+}
+
+func TestMaxCacheableSize(t *testing.T) {
+	previous := BucketMaxCacheableSizes
+	BucketMaxCacheableSizes = map[string]int64{"videos": 5 << 20}
+	t.Cleanup(func() { BucketMaxCacheableSizes = previous })
+
+	if got := MaxCacheableSize("videos"); got != 5<<20 {
+		t.Errorf("MaxCacheableSize(videos) = %d, want 5MB", got)
+	}
+	if got := MaxCacheableSize("photos"); got != MaxCacheSize/2 {
+		t.Errorf("MaxCacheableSize(photos) = %d, want half the cache", got)
+	}
+}
+
+func TestGetCacheKey(t *testing.T) {
+	// Keys are shared through Redis, so their format must not change
+	if got := GetCacheKey("photos", "2024/cat.jpg"); got != "photos/2024/cat.jpg" {
+		t.Errorf("GetCacheKey() = %q, want photos/2024/cat.jpg", got)
+	}
+	if got := GetVariantKey("photos", "cat.jpg", "version=1"); got != "photos/cat.jpg#version=1" {
+		t.Errorf("GetVariantKey() = %q, want photos/cat.jpg#version=1", got)
+	}
+
+	distinct := [][2][3]string{
+		{{"a", "b/c", ""}, {"a/b", "c", ""}},
+		{{"a", "k#version=1", ""}, {"a", "k", "version=1"}},
+		{{"a", "b%2Fc", ""}, {"a", "b/c", ""}},
+		{{"a%2Fb", "c", ""}, {"a/b", "c", ""}},
+		{{"a", "k%23v", ""}, {"a", "k", "v"}},
+	}
+	key := func(parts [3]string) string {
+		if parts[2] == "" {
+			return GetCacheKey(parts[0], parts[1])
+		}
+		return GetVariantKey(parts[0], parts[1], parts[2])
+	}
+	for _, pair := range distinct {
+		if a, b := key(pair[0]), key(pair[1]); a == b {
+			t.Errorf("%q and %q share the cache key %q", pair[0], pair[1], a)
+		}
+		for _, parts := range pair {
+			bucket, objectKey, variant := ParseCacheKey(key(parts))
+			if got := [3]string{bucket, objectKey, variant}; got != parts {
+				t.Errorf("ParseCacheKey(%q) = %q, want %q", key(parts), got, parts)
+			}
+		}
+	}
+
+	// Prefixes of buckets and keys still select their cache keys
+	if !strings.HasPrefix(GetVariantKey("a", "docs/readme.md", "br"), GetCacheKey("a", "docs/")) {
+		t.Error("a key prefix does not select the keys under it")
+	}
+}
+
+func TestFillsReadBeforeAnInvalidationAreDropped(t *testing.T) {
+	store := NewMemoryStore(1 << 20)
+	key := GetCacheKey("bucket", "file.txt")
+
+	generation := FillGeneration(key)
+	if !SetIfCurrent(store, generation, key, testEntry(8, time.Minute)) {
+		t.Fatal("a fill with no invalidation since was dropped")
+	}
+
+	// Variants of the object are invalidated along with it
+	variant := GetVariantKey("bucket", "file.txt", "version=1")
+	generation, variantGeneration := FillGeneration(key), FillGeneration(variant)
+	DeleteFromCacheByObject(store, "bucket", "file.txt")
+	SetFetchedEntry(store, generation, key, []byte("stale"), "text/plain", time.Now(), `"etag"`, nil, time.Minute)
+	if SetIfCurrent(store, variantGeneration, variant, testEntry(8, time.Minute)) {
+		t.Error("a variant read before the invalidation was stored")
+	}
+	for _, key := range []string{key, variant} {
+		if _, status := store.Get(key); status != StatusMiss {
+			t.Errorf("%s: status %s after the invalidation, want MISS", key, status)
+		}
+	}
+
+	SetFetchedEntry(store, FillGeneration(key), key, []byte("fresh"), "text/plain", time.Now(), `"etag"`, nil, time.Minute)
+	if entry, status := store.Get(key); status != StatusHit || string(entry.Data) != "fresh" {
+		t.Errorf("a fill read after the invalidation was not stored")
+	}
+}
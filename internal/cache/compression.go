@@ -3,37 +3,97 @@ package cache
 import (
 	"bytes"
 	"compress/gzip"
+	"errors"
 	"io"
+	"log"
 	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/muandane/estrois/internal/config"
 )
 
+// DefaultCompressibleTypes are the content type prefixes compressed when
+// COMPRESSIBLE_TYPES is not set
+var DefaultCompressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/yaml",
+	"image/svg",
+}
+
+// CompressibleTypes holds the content type prefixes eligible for compression
+var CompressibleTypes = config.GetEnvWithDefaultList("COMPRESSIBLE_TYPES", DefaultCompressibleTypes)
+
+// DefaultIncompressibleTypes are the content type prefixes that are already
+// compressed, used when INCOMPRESSIBLE_TYPES is not set
+var DefaultIncompressibleTypes = []string{
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"image/jpeg",
+	"image/png",
+	"image/webp",
+	"video/mp4",
+}
+
+// IncompressibleTypes holds the content type prefixes never compressed, even
+// when they match CompressibleTypes
+var IncompressibleTypes = config.GetEnvWithDefaultList("INCOMPRESSIBLE_TYPES", DefaultIncompressibleTypes)
+
 // ShouldCompress determines if content should be compressed based on type and size
 func ShouldCompress(contentType string, size int64) bool {
-	compressibleTypes := map[string]bool{
-		"text/":                  true,
-		"application/json":       true,
-		"application/javascript": true,
-		"application/xml":        true,
-		"application/yaml":       true,
-		"image/svg":              true,
-	}
-
 	if size < MinSizeForCompression {
 		return false
 	}
 
-	for t := range compressibleTypes {
-		if strings.HasPrefix(contentType, t) {
+	// Media types are case-insensitive, in headers and in configured lists
+	lowerType := strings.ToLower(contentType)
+	for _, t := range IncompressibleTypes {
+		if strings.HasPrefix(lowerType, strings.ToLower(t)) {
+			return false
+		}
+	}
+
+	for _, t := range CompressibleTypes {
+		if strings.HasPrefix(lowerType, strings.ToLower(t)) {
 			return true
 		}
 	}
 	return false
 }
 
-// CompressData compresses byte data using gzip
+// GzipLevel is the gzip compression level, from gzip.HuffmanOnly to
+// gzip.BestCompression, set by GZIP_LEVEL (default gzip.BestSpeed)
+var GzipLevel = gzipLevel()
+
+func gzipLevel() int {
+	level := config.GetEnvWithDefaultInt("GZIP_LEVEL", gzip.BestSpeed)
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		log.Printf("Invalid gzip level %d, using default %d", level, gzip.BestSpeed)
+		return gzip.BestSpeed
+	}
+	return int(level)
+}
+
+// gzipWriters reuses gzip writers, which are costly to allocate, across calls
+// to CompressData
+var gzipWriters = sync.Pool{
+	New: func() any {
+		gzipWriter, _ := gzip.NewWriterLevel(nil, GzipLevel)
+		return gzipWriter
+	},
+}
+
+// CompressData compresses byte data using gzip at GzipLevel
 func CompressData(data []byte) ([]byte, error) {
 	var compressed bytes.Buffer
-	gzipWriter := gzip.NewWriter(&compressed)
+	gzipWriter := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(gzipWriter)
+	gzipWriter.Reset(&compressed)
 
 	if _, err := gzipWriter.Write(data); err != nil {
 		return nil, err
@@ -56,3 +116,46 @@ func DecompressData(data []byte) ([]byte, error) {
 
 	return io.ReadAll(gzipReader)
 }
+
+// ErrDecompressedTooLarge is returned when decompressed data exceeds its limit
+var ErrDecompressedTooLarge = errors.New("decompressed data exceeds size limit")
+
+// DecompressDataLimited decompresses gzipped byte data, failing with
+// ErrDecompressedTooLarge rather than expanding past max bytes
+func DecompressDataLimited(data []byte, max int64) ([]byte, error) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+
+	decompressed, err := io.ReadAll(io.LimitReader(gzipReader, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decompressed)) > max {
+		return nil, ErrDecompressedTooLarge
+	}
+	return decompressed, nil
+}
+
+// CompressBrotli compresses byte data using brotli
+func CompressBrotli(data []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	brotliWriter := brotli.NewWriter(&compressed)
+
+	if _, err := brotliWriter.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := brotliWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	return compressed.Bytes(), nil
+}
+
+// DecompressBrotli decompresses brotli byte data
+func DecompressBrotli(data []byte) ([]byte, error) {
+	return io.ReadAll(brotli.NewReader(bytes.NewReader(data)))
+}
@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"name":"estrois","tags":["cache","s3"]}`), 200)
+
+	gzipped, err := CompressData(data)
+	if err != nil {
+		t.Fatalf("CompressData: %v", err)
+	}
+	if got, err := DecompressData(gzipped); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("gzip round trip: err = %v, equal = %v", err, bytes.Equal(got, data))
+	}
+
+	brotliData, err := CompressBrotli(data)
+	if err != nil {
+		t.Fatalf("CompressBrotli: %v", err)
+	}
+	if got, err := DecompressBrotli(brotliData); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("brotli round trip: err = %v, equal = %v", err, bytes.Equal(got, data))
+	}
+	if len(brotliData) >= len(data) || len(gzipped) >= len(data) {
+		t.Errorf("compressed sizes gzip=%d br=%d, want less than %d", len(gzipped), len(brotliData), len(data))
+	}
+}
+
+func TestShouldCompress(t *testing.T) {
+	setMinSizeForCompression(t, 100)
+	tests := []struct {
+		contentType string
+		size        int64
+		want        bool
+	}{
+		{"text/html; charset=utf-8", 100, true},
+		{"application/json", 1000, true},
+		{"image/svg+xml", 1000, true},
+		{"text/plain", 99, false},
+		{"application/wasm", 1000, false},
+		{"image/png", 1000, false},
+		{"application/octet-stream", 1000, false},
+		// Media types are case-insensitive
+		{"Text/HTML; charset=UTF-8", 1000, true},
+		{"APPLICATION/JSON", 1000, true},
+		{"Application/GZIP", 1000, false},
+		{"Image/PNG", 1000, false},
+	}
+	for _, tt := range tests {
+		if got := ShouldCompress(tt.contentType, tt.size); got != tt.want {
+			t.Errorf("ShouldCompress(%q, %d) = %v, want %v", tt.contentType, tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestShouldCompressCustomTypes(t *testing.T) {
+	setMinSizeForCompression(t, 0)
+	previous := CompressibleTypes
+	CompressibleTypes = []string{"application/wasm", "Application/VND."}
+	t.Cleanup(func() { CompressibleTypes = previous })
+
+	for contentType, want := range map[string]bool{
+		"application/wasm":         true,
+		"application/vnd.api+json": true,
+		"text/plain":               false,
+		"application/json":         false,
+		"application/octet-stream": false,
+	} {
+		if got := ShouldCompress(contentType, 1000); got != want {
+			t.Errorf("ShouldCompress(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
+
+func TestDecompressDataLimited(t *testing.T) {
+	// A few kilobytes that expand to 64MB
+	bomb, err := CompressData(make([]byte, 64<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecompressDataLimited(bomb, 1<<20); !errors.Is(err, ErrDecompressedTooLarge) {
+		t.Errorf("DecompressDataLimited(bomb) = %v, want ErrDecompressedTooLarge", err)
+	}
+
+	data := bytes.Repeat([]byte("a"), 1024)
+	gzipped, err := CompressData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := DecompressDataLimited(gzipped, 1024); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("DecompressDataLimited at the limit: err = %v, equal = %v", err, bytes.Equal(got, data))
+	}
+	if _, err := DecompressDataLimited(gzipped, 1023); !errors.Is(err, ErrDecompressedTooLarge) {
+		t.Errorf("DecompressDataLimited one byte over = %v, want ErrDecompressedTooLarge", err)
+	}
+	if _, err := DecompressDataLimited([]byte("not gzip"), 1024); err == nil || errors.Is(err, ErrDecompressedTooLarge) {
+		t.Errorf("DecompressDataLimited(invalid) = %v, want a gzip error", err)
+	}
+}
+
+func TestShouldCompressSkipsCompressedTypes(t *testing.T) {
+	setMinSizeForCompression(t, 0)
+	previous := CompressibleTypes
+	// A misconfigured prefix covering archives and images as well as JSON
+	CompressibleTypes = []string{"application/", "image/", "video/"}
+	t.Cleanup(func() { CompressibleTypes = previous })
+
+	for contentType, want := range map[string]bool{
+		"application/json":   true,
+		"application/gzip":   false,
+		"application/x-gzip": false,
+		"application/zip":    false,
+		"Application/GZIP":   false,
+		"image/jpeg":         false,
+		"image/png":          false,
+		"image/webp":         false,
+		"video/mp4":          false,
+		"image/bmp":          true,
+	} {
+		if got := ShouldCompress(contentType, 1000); got != want {
+			t.Errorf("ShouldCompress(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+	"sync"
+
+	"github.com/muandane/estrois/internal/config"
+)
+
+// EvictionPolicy chooses which entries a MemoryStore evicts once it is full.
+// Implementations are safe for concurrent use.
+type EvictionPolicy interface {
+	// RecordAccess notes that key was stored or read, tracking it if it is new
+	RecordAccess(key string)
+	// Remove stops tracking key once it has left the cache
+	Remove(key string)
+	// Evict returns up to n keys to evict, in order, and stops tracking them
+	Evict(n int) []string
+}
+
+// NewEvictionPolicy returns the policy named by one of the config.Eviction
+// constants, or nil for config.EvictionRandom, which evicts entries in no
+// particular order without tracking accesses
+func NewEvictionPolicy(name string) EvictionPolicy {
+	switch name {
+	case config.EvictionLRU:
+		return newListPolicy(true)
+	case config.EvictionLFU:
+		return newLFUPolicy()
+	case config.EvictionFIFO:
+		return newListPolicy(false)
+	}
+	return nil
+}
+
+// listPolicy evicts the keys at the back of a list. New keys go to the front;
+// with moveOnAccess, so do keys read again, making it LRU rather than FIFO.
+type listPolicy struct {
+	mu           sync.Mutex
+	order        *list.List
+	elements     map[string]*list.Element
+	moveOnAccess bool
+}
+
+func newListPolicy(moveOnAccess bool) *listPolicy {
+	return &listPolicy{order: list.New(), elements: make(map[string]*list.Element), moveOnAccess: moveOnAccess}
+}
+
+func (p *listPolicy) RecordAccess(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if element, ok := p.elements[key]; ok {
+		if p.moveOnAccess {
+			p.order.MoveToFront(element)
+		}
+		return
+	}
+	p.elements[key] = p.order.PushFront(key)
+}
+
+func (p *listPolicy) Remove(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if element, ok := p.elements[key]; ok {
+		p.order.Remove(element)
+		delete(p.elements, key)
+	}
+}
+
+func (p *listPolicy) Evict(n int) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var keys []string
+	for len(keys) < n && p.order.Len() > 0 {
+		key := p.order.Remove(p.order.Back()).(string)
+		delete(p.elements, key)
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// lfuPolicy evicts the least frequently accessed keys, the least recently
+// tracked first among keys accessed equally often
+type lfuPolicy struct {
+	mu      sync.Mutex
+	entries lfuHeap
+	byKey   map[string]*lfuEntry
+	clock   uint64
+}
+
+type lfuEntry struct {
+	key   string
+	hits  uint64
+	added uint64
+	index int
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{byKey: make(map[string]*lfuEntry)}
+}
+
+func (p *lfuPolicy) RecordAccess(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if entry, ok := p.byKey[key]; ok {
+		entry.hits++
+		heap.Fix(&p.entries, entry.index)
+		return
+	}
+	p.clock++
+	entry := &lfuEntry{key: key, hits: 1, added: p.clock}
+	p.byKey[key] = entry
+	heap.Push(&p.entries, entry)
+}
+
+func (p *lfuPolicy) Remove(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if entry, ok := p.byKey[key]; ok {
+		heap.Remove(&p.entries, entry.index)
+		delete(p.byKey, key)
+	}
+}
+
+func (p *lfuPolicy) Evict(n int) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var keys []string
+	for len(keys) < n && p.entries.Len() > 0 {
+		entry := heap.Pop(&p.entries).(*lfuEntry)
+		delete(p.byKey, entry.key)
+		keys = append(keys, entry.key)
+	}
+	return keys
+}
+
+// lfuHeap orders entries by hits, then by when they were first tracked
+type lfuHeap []*lfuEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].hits != h[j].hits {
+		return h[i].hits < h[j].hits
+	}
+	return h[i].added < h[j].added
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x any) {
+	entry := x.(*lfuEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *lfuHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
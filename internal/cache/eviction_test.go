@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/muandane/estrois/internal/config"
+)
+
+// Keys a to e are stored in order, then a is read three times, then b and c
+// once each. a is the oldest key but the most frequently read, and d and e
+// were never read.
+var evictionPattern = []string{"a", "b", "c", "d", "e", "a", "a", "a", "b", "c"}
+
+func TestEvictionPolicies(t *testing.T) {
+	tests := []struct {
+		policy      string
+		wantVictims []string
+	}{
+		{config.EvictionLRU, []string{"d", "e", "a"}},
+		{config.EvictionLFU, []string{"d", "e", "b"}},
+		{config.EvictionFIFO, []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			policy := NewEvictionPolicy(tt.policy)
+			for _, key := range evictionPattern {
+				policy.RecordAccess(key)
+			}
+			if victims := policy.Evict(3); !reflect.DeepEqual(victims, tt.wantVictims) {
+				t.Errorf("Evict(3) = %v, want %v", victims, tt.wantVictims)
+			}
+
+			// Evicted and removed keys are no longer tracked
+			policy.RecordAccess("f")
+			policy.Remove("f")
+			if victims := policy.Evict(5); len(victims) != 2 {
+				t.Errorf("Evict(5) = %v, want the two keys left of a to e", victims)
+			}
+		})
+	}
+
+	if policy := NewEvictionPolicy(config.EvictionRandom); policy != nil {
+		t.Errorf("random eviction has policy %T, want none", policy)
+	}
+}
+
+func TestMemoryStoreEvictsByPolicy(t *testing.T) {
+	setMaxCacheEntries(t, 5)
+	tests := []struct {
+		policy     string
+		wantVictim string
+	}{
+		{config.EvictionLRU, "d"},
+		{config.EvictionLFU, "d"},
+		{config.EvictionFIFO, "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			previous := CacheEvictionPolicy
+			CacheEvictionPolicy = tt.policy
+			t.Cleanup(func() { CacheEvictionPolicy = previous })
+			store := NewMemoryStore(1 << 20)
+
+			for _, key := range evictionPattern {
+				if _, status := store.Get(key); status == StatusMiss {
+					store.Set(key, testEntry(8, time.Minute))
+				}
+			}
+			store.Set("f", testEntry(8, time.Minute))
+
+			for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+				_, status := store.Get(key)
+				if evicted := status == StatusMiss; evicted != (key == tt.wantVictim) {
+					t.Errorf("%s: status %s, want only %s evicted", key, status, tt.wantVictim)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"hash/maphash"
+	"sync"
+)
+
+// fillStripes orders cache fills from storage against invalidations of the
+// same object. Each object maps to one stripe, whose generation counts the
+// invalidations of its objects; objects sharing a stripe only cost each other
+// the occasional skipped fill.
+var fillStripes [256]struct {
+	mu         sync.Mutex
+	generation uint64
+}
+
+var fillSeed = maphash.MakeSeed()
+
+// fillStripe returns the index of the stripe of the object cacheKey belongs to
+func fillStripe(cacheKey string) int {
+	if object, ok := variantObject(cacheKey); ok {
+		cacheKey = object
+	}
+	return int(maphash.String(fillSeed, cacheKey) % uint64(len(fillStripes)))
+}
+
+// FillGeneration returns the invalidation generation of the object cacheKey
+// belongs to. Read it before reading the object from storage, and store what
+// was read with SetIfCurrent.
+func FillGeneration(cacheKey string) uint64 {
+	stripe := &fillStripes[fillStripe(cacheKey)]
+	stripe.mu.Lock()
+	defer stripe.mu.Unlock()
+	return stripe.generation
+}
+
+// SetIfCurrent stores entry under key unless the object has been invalidated
+// since FillGeneration returned generation, as an entry read from storage
+// before a write or delete would be stale. It reports whether entry was stored.
+func SetIfCurrent(store Store, generation uint64, key string, entry *CacheEntry) bool {
+	stripe := &fillStripes[fillStripe(key)]
+	stripe.mu.Lock()
+	defer stripe.mu.Unlock()
+	if stripe.generation != generation {
+		return false
+	}
+	store.Set(key, entry)
+	return true
+}
+
+// invalidateObject removes the entries of the object with cache key
+// objectKey from store, and keeps fills that read the object before from
+// storing it. Requests made from now on fetch the object again rather than
+// share a fetch already in flight.
+func invalidateObject(store Store, objectKey string) int {
+	stripe := &fillStripes[fillStripe(objectKey)]
+	stripe.mu.Lock()
+	defer stripe.mu.Unlock()
+	stripe.generation++
+	fetchGroup.Forget(objectKey)
+	return store.DeleteObject(objectKey)
+}
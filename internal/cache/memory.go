@@ -0,0 +1,425 @@
+package cache
+
+import (
+	"hash/maphash"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// memoryShard is one stripe of a MemoryStore with its own lock and size
+type memoryShard struct {
+	mu      sync.RWMutex
+	entries map[string]*CacheEntry
+	size    int64
+}
+
+// MemoryStore is an in-process Store bounded by a maximum size in bytes and,
+// with MaxCacheEntries, a maximum number of entries; CacheEvictionPolicy
+// picks the entries evicted to stay within them. Keys are spread over
+// CacheShards stripes so concurrent writers rarely contend on the same lock;
+// the limits apply to all stripes together.
+type MemoryStore struct {
+	shards      []*memoryShard
+	seed        maphash.Seed
+	size        atomic.Int64
+	entries     atomic.Int64
+	maxSize     int64
+	maxEntries  int64
+	policy      EvictionPolicy
+	lastCleanup atomic.Int64 // unix nanoseconds
+	nextEvict   atomic.Uint32
+
+	// variants indexes the variant keys held for each object's cache key, so
+	// DeleteObject need not scan every shard
+	variantsMu sync.Mutex
+	variants   map[string]map[string]struct{}
+}
+
+// NewMemoryStore creates an in-memory store holding at most maxSize bytes
+func NewMemoryStore(maxSize int64) *MemoryStore {
+	shardCount := int(CacheShards)
+	if shardCount < 1 {
+		shardCount = 1
+	}
+	s := &MemoryStore{
+		shards:     make([]*memoryShard, shardCount),
+		seed:       maphash.MakeSeed(),
+		maxSize:    maxSize,
+		maxEntries: MaxCacheEntries,
+		policy:     NewEvictionPolicy(CacheEvictionPolicy),
+		variants:   make(map[string]map[string]struct{}),
+	}
+	for i := range s.shards {
+		s.shards[i] = &memoryShard{entries: make(map[string]*CacheEntry)}
+	}
+	return s
+}
+
+func (s *MemoryStore) shard(key string) *memoryShard {
+	return s.shards[maphash.String(s.seed, key)%uint64(len(s.shards))]
+}
+
+func (s *MemoryStore) Get(key string) (*CacheEntry, Status) {
+	sh := s.shard(key)
+	sh.mu.RLock()
+	entry, ok := sh.entries[key]
+	// Accesses are recorded under the lock, so a concurrent delete cannot
+	// leave the policy tracking a key the store no longer holds
+	if ok && s.policy != nil {
+		s.policy.RecordAccess(key)
+	}
+	sh.mu.RUnlock()
+	if !ok {
+		return nil, StatusMiss
+	}
+	if time.Now().Before(entry.ExpiresAt) {
+		return entry, StatusHit
+	}
+	if entry.markExpired(false) {
+		recordExpirations(1)
+	}
+	return entry, StatusExpired
+}
+
+// Set stores entry under key, evicting other entries if the store would grow
+// past its maximum size or number of entries. Entries larger than the maximum
+// size are not stored, unless they only hold metadata.
+func (s *MemoryStore) Set(key string, entry *CacheEntry) {
+	if (entry.Size > s.maxSize && !entry.MetadataOnly) || entry.accountedSize > s.maxSize {
+		return
+	}
+
+	sh := s.shard(key)
+	sh.mu.Lock()
+	delta := entry.accountedSize
+	if previous, ok := sh.entries[key]; ok {
+		delta -= previous.accountedSize
+	} else {
+		s.entries.Add(1)
+		s.trackVariant(key)
+	}
+	sh.entries[key] = entry
+	sh.size += delta
+	if s.policy != nil {
+		s.policy.RecordAccess(key)
+	}
+	sh.mu.Unlock()
+
+	s.size.Add(delta)
+	if s.full() {
+		s.evict(key)
+	}
+	s.recordSize()
+}
+
+// CompareAndSwap replaces the entry stored under key with replacement, only if
+// old is still the entry stored there
+func (s *MemoryStore) CompareAndSwap(key string, old, replacement *CacheEntry) bool {
+	if replacement.accountedSize > s.maxSize {
+		return false
+	}
+
+	sh := s.shard(key)
+	sh.mu.Lock()
+	if sh.entries[key] != old {
+		sh.mu.Unlock()
+		return false
+	}
+	delta := replacement.accountedSize - old.accountedSize
+	sh.entries[key] = replacement
+	sh.size += delta
+	sh.mu.Unlock()
+
+	s.size.Add(delta)
+	if s.full() {
+		s.evict(key)
+	}
+	s.recordSize()
+	return true
+}
+
+func (s *MemoryStore) Delete(key string) bool {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	entry, ok := sh.entries[key]
+	if !ok {
+		sh.mu.Unlock()
+		return false
+	}
+	delete(sh.entries, key)
+	sh.size -= entry.accountedSize
+	if s.policy != nil {
+		s.policy.Remove(key)
+	}
+	s.untrackVariant(key)
+	sh.mu.Unlock()
+
+	s.size.Add(-entry.accountedSize)
+	s.entries.Add(-1)
+	s.recordSize()
+	return true
+}
+
+// DeleteObject removes key and the variants indexed for it
+func (s *MemoryStore) DeleteObject(key string) int {
+	s.variantsMu.Lock()
+	variants := s.variants[key]
+	delete(s.variants, key)
+	s.variantsMu.Unlock()
+
+	var removed int
+	if s.Delete(key) {
+		removed++
+	}
+	for variant := range variants {
+		if s.Delete(variant) {
+			removed++
+		}
+	}
+	return removed
+}
+
+func (s *MemoryStore) DeleteByPrefix(prefix string) int {
+	var purged int
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for key, entry := range sh.entries {
+			if strings.HasPrefix(key, prefix) {
+				delete(sh.entries, key)
+				sh.size -= entry.accountedSize
+				s.size.Add(-entry.accountedSize)
+				if s.policy != nil {
+					s.policy.Remove(key)
+				}
+				s.untrackVariant(key)
+				purged++
+			}
+		}
+		sh.mu.Unlock()
+	}
+	s.entries.Add(-int64(purged))
+	s.recordSize()
+	return purged
+}
+
+func (s *MemoryStore) Range(prefix string, fn func(key string, entry *CacheEntry) bool) {
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for key, entry := range sh.entries {
+			if strings.HasPrefix(key, prefix) && !fn(key, entry) {
+				sh.mu.RUnlock()
+				return
+			}
+		}
+		sh.mu.RUnlock()
+	}
+}
+
+func (s *MemoryStore) Stats() Stats {
+	var entryCount int
+	var totalOriginalSize int64
+	var totalCompressedSize int64
+
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for _, entry := range sh.entries {
+			entryCount++
+			if entry.IsCompressed {
+				totalOriginalSize += entry.Size
+				totalCompressedSize += int64(len(entry.CompressedData))
+			}
+		}
+		sh.mu.RUnlock()
+	}
+
+	var compressionRatio float64
+	if totalOriginalSize > 0 {
+		compressionRatio = float64(totalCompressedSize) / float64(totalOriginalSize)
+	}
+
+	var lastCleanup time.Time
+	if nanos := s.lastCleanup.Load(); nanos != 0 {
+		lastCleanup = time.Unix(0, nanos)
+	}
+
+	return Stats{
+		CurrentSize:      s.size.Load(),
+		MaxSize:          s.maxSize,
+		EntryCount:       entryCount,
+		LastCleanupTime:  lastCleanup,
+		CompressionRatio: compressionRatio,
+	}
+}
+
+// StartCleanup removes stale entries every CleanupInterval
+func (s *MemoryStore) StartCleanup() {
+	if CleanupInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(CleanupInterval)
+		for range ticker.C {
+			removed := s.cleanup(time.Now())
+			slog.Debug("cache cleanup finished", "evicted", removed)
+		}
+	}()
+}
+
+// cleanup removes entries that expired more than staleRetention before now,
+// records the sweep time and returns how many entries were removed. Recently
+// expired entries are kept so they can still be revalidated.
+func (s *MemoryStore) cleanup(now time.Time) int {
+	var removed, expired int
+	cutoff := now.Add(-staleRetention)
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for key, entry := range sh.entries {
+			if cutoff.After(entry.ExpiresAt) {
+				delete(sh.entries, key)
+				sh.size -= entry.accountedSize
+				s.size.Add(-entry.accountedSize)
+				if s.policy != nil {
+					s.policy.Remove(key)
+				}
+				s.untrackVariant(key)
+				removed++
+				if entry.markExpired(true) {
+					expired++
+				}
+			}
+		}
+		sh.mu.Unlock()
+	}
+	s.lastCleanup.Store(now.UnixNano())
+	s.entries.Add(-int64(removed))
+	recordExpirations(expired)
+	s.recordSize()
+	return removed
+}
+
+// full reports whether the store holds more than its maximum size or
+// number of entries
+func (s *MemoryStore) full() bool {
+	return s.size.Load() > s.maxSize || (s.maxEntries > 0 && s.entries.Load() > s.maxEntries)
+}
+
+// evict removes entries other than keep until the store fits its maximum
+// size and number of entries. Victims come from the eviction policy, if any.
+// Otherwise, or once the policy has no more, shards are visited in turn, one
+// lock at a time, starting where the previous eviction left off.
+func (s *MemoryStore) evict(keep string) {
+	var evicted int
+	defer func() {
+		recordEvictions(evicted)
+	}()
+
+	if s.policy != nil {
+		evicted += s.evictByPolicy(keep)
+	}
+
+	start := int(s.nextEvict.Add(1))
+	for i := range s.shards {
+		if !s.full() {
+			return
+		}
+		sh := s.shards[(start+i)%len(s.shards)]
+		sh.mu.Lock()
+		for key, entry := range sh.entries {
+			if key == keep {
+				continue
+			}
+			delete(sh.entries, key)
+			sh.size -= entry.accountedSize
+			s.size.Add(-entry.accountedSize)
+			s.entries.Add(-1)
+			if s.policy != nil {
+				s.policy.Remove(key)
+			}
+			s.untrackVariant(key)
+			evicted++
+			if !s.full() {
+				break
+			}
+		}
+		sh.mu.Unlock()
+	}
+}
+
+// evictByPolicy removes the entries chosen by the eviction policy, other than
+// keep, until the store fits or the policy has none left, and returns how
+// many it removed
+func (s *MemoryStore) evictByPolicy(keep string) int {
+	var evicted int
+	keptVictim := false
+	for s.full() {
+		victims := s.policy.Evict(1)
+		if len(victims) == 0 {
+			break
+		}
+		key := victims[0]
+		if key == keep {
+			keptVictim = true
+			continue
+		}
+		sh := s.shard(key)
+		sh.mu.Lock()
+		if entry, ok := sh.entries[key]; ok {
+			delete(sh.entries, key)
+			sh.size -= entry.accountedSize
+			s.size.Add(-entry.accountedSize)
+			s.entries.Add(-1)
+			// The key may have been stored again since the policy gave it up
+			s.policy.Remove(key)
+			s.untrackVariant(key)
+			evicted++
+		}
+		sh.mu.Unlock()
+	}
+	if keptVictim {
+		sh := s.shard(keep)
+		sh.mu.Lock()
+		if _, ok := sh.entries[keep]; ok {
+			s.policy.RecordAccess(keep)
+		}
+		sh.mu.Unlock()
+	}
+	return evicted
+}
+
+// trackVariant indexes key under its object if it is a variant key
+func (s *MemoryStore) trackVariant(key string) {
+	object, ok := variantObject(key)
+	if !ok {
+		return
+	}
+	s.variantsMu.Lock()
+	defer s.variantsMu.Unlock()
+	if s.variants[object] == nil {
+		s.variants[object] = make(map[string]struct{})
+	}
+	s.variants[object][key] = struct{}{}
+}
+
+// untrackVariant drops key from the index once it has left the store
+func (s *MemoryStore) untrackVariant(key string) {
+	object, ok := variantObject(key)
+	if !ok {
+		return
+	}
+	s.variantsMu.Lock()
+	defer s.variantsMu.Unlock()
+	if variants := s.variants[object]; variants != nil {
+		delete(variants, key)
+		if len(variants) == 0 {
+			delete(s.variants, object)
+		}
+	}
+}
+
+// recordSize reports the current size to the metrics sink
+func (s *MemoryStore) recordSize() {
+	recordSize(s.size.Load(), s.entries.Load())
+}
@@ -0,0 +1,242 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/muandane/estrois/internal/config"
+)
+
+func testEntry(size int, ttl time.Duration) *CacheEntry {
+	return newUncompressedEntry(make([]byte, size), "application/octet-stream", time.Now(), `"etag"`, nil, ttl)
+}
+
+func TestDeleteFromCacheByObjectRemovesVariants(t *testing.T) {
+	store := NewMemoryStore(1 << 20)
+	store.Set(GetCacheKey("bucket", "other.txt"), testEntry(10, time.Minute))
+	sizeBefore := store.Stats().CurrentSize
+
+	store.Set(GetCacheKey("bucket", "file.txt"), testEntry(100, time.Minute))
+	store.Set(GetVariantKey("bucket", "file.txt", "version=1"), testEntry(200, time.Minute))
+	store.Set(GetVariantKey("bucket", "file.txt", "version=2"), testEntry(300, time.Minute))
+
+	if removed := DeleteFromCacheByObject(store, "bucket", "file.txt"); removed != 3 {
+		t.Errorf("removed %d entries, want 3", removed)
+	}
+	for _, key := range []string{
+		GetCacheKey("bucket", "file.txt"),
+		GetVariantKey("bucket", "file.txt", "version=1"),
+		GetVariantKey("bucket", "file.txt", "version=2"),
+	} {
+		if _, status := store.Get(key); status != StatusMiss {
+			t.Errorf("%s is still cached", key)
+		}
+	}
+	if _, status := store.Get(GetCacheKey("bucket", "other.txt")); status != StatusHit {
+		t.Error("another object was removed")
+	}
+	stats := store.Stats()
+	if stats.CurrentSize != sizeBefore || stats.EntryCount != 1 {
+		t.Errorf("size = %d with %d entries, want %d with 1", stats.CurrentSize, stats.EntryCount, sizeBefore)
+	}
+	if len(store.variants) != 0 {
+		t.Errorf("variant index still holds %v", store.variants)
+	}
+}
+
+func TestVariantIndexFollowsRemovals(t *testing.T) {
+	store := NewMemoryStore(1 << 20)
+	variant := GetVariantKey("bucket", "file.txt", "version=1")
+
+	store.Set(variant, testEntry(10, time.Minute))
+	store.Delete(variant)
+	if len(store.variants) != 0 {
+		t.Errorf("Delete left %v indexed", store.variants)
+	}
+
+	store.Set(variant, testEntry(10, -time.Hour))
+	store.cleanup(time.Now())
+	if len(store.variants) != 0 {
+		t.Errorf("cleanup left %v indexed", store.variants)
+	}
+
+	store.Set(variant, testEntry(10, time.Minute))
+	store.DeleteByPrefix(GetCacheKey("bucket", ""))
+	if len(store.variants) != 0 {
+		t.Errorf("DeleteByPrefix left %v indexed", store.variants)
+	}
+}
+
+func setMaxCacheEntries(t *testing.T, entries int64) {
+	previous := MaxCacheEntries
+	MaxCacheEntries = entries
+	t.Cleanup(func() { MaxCacheEntries = previous })
+}
+
+func TestMaxCacheEntriesEvictsTinyEntries(t *testing.T) {
+	setMaxCacheEntries(t, 100)
+	store := NewMemoryStore(1 << 30)
+
+	for i := range 1000 {
+		store.Set(fmt.Sprintf("bucket/tiny-%d", i), testEntry(8, time.Minute))
+	}
+
+	stats := store.Stats()
+	if stats.EntryCount != 100 {
+		t.Errorf("EntryCount = %d, want 100", stats.EntryCount)
+	}
+	if stats.CurrentSize != 100*8 {
+		t.Errorf("CurrentSize = %d, want %d", stats.CurrentSize, 100*8)
+	}
+	// The byte limit is nowhere near, so the count alone caused evictions
+	if stats.CurrentSize*1000 > stats.MaxSize {
+		t.Errorf("CurrentSize = %d is not small next to MaxSize %d", stats.CurrentSize, stats.MaxSize)
+	}
+	// LRU, the default policy, kept the most recent entries
+	for i := 900; i < 1000; i++ {
+		if _, status := store.Get(fmt.Sprintf("bucket/tiny-%d", i)); status != StatusHit {
+			t.Fatalf("recent entry tiny-%d was evicted", i)
+		}
+	}
+}
+
+func TestDefaultEvictionPolicyIsLRU(t *testing.T) {
+	if CacheEvictionPolicy != config.EvictionLRU {
+		t.Errorf("CacheEvictionPolicy = %q, want %q", CacheEvictionPolicy, config.EvictionLRU)
+	}
+}
+
+// pausingPolicy holds RecordAccess calls until released, once paused
+type pausingPolicy struct {
+	EvictionPolicy
+	paused   bool
+	entered  chan struct{}
+	released chan struct{}
+}
+
+func (p *pausingPolicy) RecordAccess(key string) {
+	if p.paused {
+		p.entered <- struct{}{}
+		<-p.released
+	}
+	p.EvictionPolicy.RecordAccess(key)
+}
+
+func TestReadsDoNotTrackDeletedKeys(t *testing.T) {
+	policy := &pausingPolicy{
+		EvictionPolicy: NewEvictionPolicy(config.EvictionLRU),
+		entered:        make(chan struct{}),
+		released:       make(chan struct{}),
+	}
+	store := NewMemoryStore(1 << 20)
+	store.policy = policy
+	store.Set("bucket/key", testEntry(8, time.Minute))
+
+	// A delete racing a read either waits for the read to record its access
+	// or happens first, and the key ends up untracked either way
+	policy.paused = true
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		store.Get("bucket/key")
+	}()
+	<-policy.entered
+	deleted := make(chan struct{})
+	go func() {
+		defer close(deleted)
+		store.Delete("bucket/key")
+	}()
+	select {
+	case <-deleted:
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(policy.released)
+	<-read
+	<-deleted
+
+	if ghosts := policy.Evict(1); len(ghosts) != 0 {
+		t.Errorf("policy still tracks deleted keys %v", ghosts)
+	}
+
+	// Nor does reading a missing key start tracking it
+	store.Get("bucket/missing")
+	if ghosts := policy.Evict(1); len(ghosts) != 0 {
+		t.Errorf("policy tracks a key never stored: %v", ghosts)
+	}
+}
+
+func TestCleanupRecordsEachSweep(t *testing.T) {
+	store := NewMemoryStore(1 << 20)
+	if last := store.Stats().LastCleanupTime; !last.IsZero() {
+		t.Fatalf("LastCleanupTime = %s before any sweep, want zero", last)
+	}
+	store.Set(GetCacheKey("bucket", "fresh.txt"), testEntry(10, time.Hour))
+	store.Set(GetCacheKey("bucket", "stale.txt"), testEntry(10, time.Minute))
+
+	start := time.Now()
+	var previous time.Time
+	for i := range 3 {
+		now := start.Add(time.Duration(i) * time.Second)
+		store.cleanup(now)
+		last := store.Stats().LastCleanupTime
+		if !last.Equal(now) || !last.After(previous) {
+			t.Errorf("sweep %d: LastCleanupTime = %s, want %s", i, last, now)
+		}
+		previous = last
+	}
+
+	// Entries are only swept once they are staleRetention past expiry
+	if removed := store.cleanup(start.Add(time.Minute + staleRetention + time.Second)); removed != 1 {
+		t.Errorf("sweep past the stale entry's retention removed %d entries, want 1", removed)
+	}
+	if _, status := store.Get(GetCacheKey("bucket", "fresh.txt")); status != StatusHit {
+		t.Errorf("fresh entry status = %s after the sweep, want HIT", status)
+	}
+	if stats := store.Stats(); stats.EntryCount != 1 {
+		t.Errorf("entry count = %d after the sweep, want 1", stats.EntryCount)
+	}
+}
+
+func TestStatsMatchInsertedEntries(t *testing.T) {
+	store := NewMemoryStore(1 << 20)
+	text := []byte(strings.Repeat("compressible text ", 200))
+	compressed := newUncompressedEntry(text, "text/plain", time.Now(), `"text"`, nil, time.Hour).compress()
+	if !compressed.IsCompressed {
+		t.Fatal("text entry was not compressed")
+	}
+	entries := map[string]*CacheEntry{
+		GetCacheKey("bucket", "a.bin"):    testEntry(100, time.Hour),
+		GetCacheKey("bucket", "b.bin"):    testEntry(200, time.Hour),
+		GetCacheKey("bucket", "text.txt"): compressed,
+	}
+	for key, entry := range entries {
+		store.Set(key, entry)
+	}
+	// Overwriting and deleting must not leave stale sizes behind
+	store.Set(GetCacheKey("bucket", "a.bin"), testEntry(300, time.Hour))
+	entries[GetCacheKey("bucket", "a.bin")] = testEntry(300, time.Hour)
+	store.Set(GetCacheKey("bucket", "gone.bin"), testEntry(50, time.Hour))
+	store.Delete(GetCacheKey("bucket", "gone.bin"))
+
+	var wantSize int64
+	for _, entry := range entries {
+		wantSize += entry.accountedSize
+	}
+	wantRatio := float64(len(compressed.CompressedData)) / float64(len(text))
+
+	stats := store.Stats()
+	if stats.EntryCount != len(entries) {
+		t.Errorf("EntryCount = %d, want %d", stats.EntryCount, len(entries))
+	}
+	if stats.CurrentSize != wantSize {
+		t.Errorf("CurrentSize = %d, want %d", stats.CurrentSize, wantSize)
+	}
+	if stats.MaxSize != 1<<20 {
+		t.Errorf("MaxSize = %d, want %d", stats.MaxSize, 1<<20)
+	}
+	if stats.CompressionRatio != wantRatio {
+		t.Errorf("CompressionRatio = %v, want %v", stats.CompressionRatio, wantRatio)
+	}
+}
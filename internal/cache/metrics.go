@@ -0,0 +1,41 @@
+package cache
+
+import "sync/atomic"
+
+// MetricsSink receives cache housekeeping events, e.g. for metrics, so the
+// cache can report them without depending on a metrics package
+type MetricsSink interface {
+	// RecordEvictions counts entries removed to make room for new ones
+	RecordEvictions(n int)
+	// RecordExpirations counts entries found expired, once each, whether by
+	// a read or by the cleanup sweep
+	RecordExpirations(n int)
+	// RecordSize reports the in-memory cache's size after it changed
+	RecordSize(bytes, entries int64)
+}
+
+// metricsSink is the sink set by SetMetricsSink, if any
+var metricsSink atomic.Pointer[MetricsSink]
+
+// SetMetricsSink reports in-memory cache events to sink
+func SetMetricsSink(sink MetricsSink) {
+	metricsSink.Store(&sink)
+}
+
+func recordEvictions(n int) {
+	if sink := metricsSink.Load(); sink != nil && n > 0 {
+		(*sink).RecordEvictions(n)
+	}
+}
+
+func recordExpirations(n int) {
+	if sink := metricsSink.Load(); sink != nil && n > 0 {
+		(*sink).RecordExpirations(n)
+	}
+}
+
+func recordSize(bytes, entries int64) {
+	if sink := metricsSink.Load(); sink != nil {
+		(*sink).RecordSize(bytes, entries)
+	}
+}
@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSink counts the events reported to it
+type recordingSink struct {
+	mu          sync.Mutex
+	evictions   int
+	expirations int
+}
+
+func (s *recordingSink) RecordEvictions(n int) {
+	s.mu.Lock()
+	s.evictions += n
+	s.mu.Unlock()
+}
+
+func (s *recordingSink) RecordExpirations(n int) {
+	s.mu.Lock()
+	s.expirations += n
+	s.mu.Unlock()
+}
+
+func (s *recordingSink) RecordSize(bytes, entries int64) {}
+
+func (s *recordingSink) counts() (evictions, expirations int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.evictions, s.expirations
+}
+
+// useRecordingSink reports cache events to a new recordingSink for the
+// duration of the test
+func useRecordingSink(t *testing.T) *recordingSink {
+	previous := metricsSink.Load()
+	sink := &recordingSink{}
+	SetMetricsSink(sink)
+	t.Cleanup(func() { metricsSink.Store(previous) })
+	return sink
+}
+
+func TestExpirationsCountedOnce(t *testing.T) {
+	sink := useRecordingSink(t)
+	store := NewMemoryStore(1 << 20)
+	store.Set("read", testEntry(10, -time.Hour))
+	store.Set("swept", testEntry(10, -time.Hour))
+
+	for range 3 {
+		if _, status := store.Get("read"); status != StatusExpired {
+			t.Fatalf("status = %s, want %s", status, StatusExpired)
+		}
+	}
+	if _, expirations := sink.counts(); expirations != 1 {
+		t.Errorf("after repeated reads: %d expirations, want 1", expirations)
+	}
+
+	if removed := store.cleanup(time.Now()); removed != 2 {
+		t.Fatalf("cleanup removed %d entries, want 2", removed)
+	}
+	if _, expirations := sink.counts(); expirations != 2 {
+		t.Errorf("after the sweep: %d expirations, want 2", expirations)
+	}
+}
+
+func TestRefreshedEntryExpiryCountedAgain(t *testing.T) {
+	sink := useRecordingSink(t)
+	store := NewMemoryStore(1 << 20)
+	entry := testEntry(10, -time.Hour)
+	store.Set("key", entry)
+	store.Get("key")
+
+	store.Set("key", entry.Refresh(-time.Minute))
+	store.Get("key")
+	if _, expirations := sink.counts(); expirations != 2 {
+		t.Errorf("%d expirations, want 2", expirations)
+	}
+}
+
+func TestEvictionsCounted(t *testing.T) {
+	sink := useRecordingSink(t)
+	store := NewMemoryStore(1000)
+	for i := range 10 {
+		store.Set(string(rune('a'+i)), testEntry(200, time.Minute))
+	}
+	evictions, _ := sink.counts()
+	if entries := store.Stats().EntryCount; evictions != 10-int(entries) {
+		t.Errorf("%d evictions with %d of 10 entries left", evictions, entries)
+	}
+	if evictions == 0 {
+		t.Error("no evictions counted")
+	}
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/muandane/estrois/internal/config"
+)
+
+// Negative cache configuration
+var (
+	NegativeCacheTTL        = config.GetEnvWithDefaultDuration("NEGATIVE_CACHE_TTL", 10*time.Second)
+	NegativeCacheMaxEntries = config.GetEnvWithDefaultInt("NEGATIVE_CACHE_MAX_ENTRIES", 10000)
+)
+
+// negativeCache remembers keys that recently returned NoSuchKey so repeated
+// lookups for missing objects don't go back to storage. It is bounded
+// separately from the object cache.
+var negativeCache = struct {
+	sync.Mutex
+	entries map[string]time.Time
+}{entries: make(map[string]time.Time)}
+
+// AddNegative records that cacheKey does not exist in storage
+func AddNegative(cacheKey string) {
+	if NegativeCacheTTL <= 0 || NegativeCacheMaxEntries <= 0 {
+		return
+	}
+
+	negativeCache.Lock()
+	defer negativeCache.Unlock()
+
+	if _, exists := negativeCache.entries[cacheKey]; !exists && int64(len(negativeCache.entries)) >= NegativeCacheMaxEntries {
+		now := time.Now()
+		for key, expiresAt := range negativeCache.entries {
+			if now.After(expiresAt) {
+				delete(negativeCache.entries, key)
+			}
+		}
+		// Still full: drop an arbitrary entry to make room
+		for key := range negativeCache.entries {
+			if int64(len(negativeCache.entries)) < NegativeCacheMaxEntries {
+				break
+			}
+			delete(negativeCache.entries, key)
+		}
+	}
+	negativeCache.entries[cacheKey] = time.Now().Add(NegativeCacheTTL)
+}
+
+// IsNegative reports whether cacheKey is known to be missing from storage
+func IsNegative(cacheKey string) bool {
+	negativeCache.Lock()
+	defer negativeCache.Unlock()
+
+	expiresAt, ok := negativeCache.entries[cacheKey]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expiresAt) {
+		delete(negativeCache.entries, cacheKey)
+		return false
+	}
+	return true
+}
+
+// DeleteNegative forgets a negative entry, e.g. after the object is written
+func DeleteNegative(cacheKey string) {
+	negativeCache.Lock()
+	delete(negativeCache.entries, cacheKey)
+	negativeCache.Unlock()
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNegativeCacheExpires(t *testing.T) {
+	previous := NegativeCacheTTL
+	NegativeCacheTTL = 20 * time.Millisecond
+	t.Cleanup(func() { NegativeCacheTTL = previous })
+
+	AddNegative("negative/expires")
+	if !IsNegative("negative/expires") {
+		t.Fatal("a missing key was not remembered")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if IsNegative("negative/expires") {
+		t.Error("a missing key was remembered past its TTL")
+	}
+
+	AddNegative("negative/deleted")
+	DeleteNegative("negative/deleted")
+	if IsNegative("negative/deleted") {
+		t.Error("a deleted negative entry was remembered")
+	}
+}
+
+func TestNegativeCacheIsBounded(t *testing.T) {
+	previous := NegativeCacheMaxEntries
+	NegativeCacheMaxEntries = 5
+	t.Cleanup(func() { NegativeCacheMaxEntries = previous })
+
+	for i := range 20 {
+		AddNegative(fmt.Sprintf("negative/bounded-%d", i))
+	}
+	negativeCache.Lock()
+	entries := len(negativeCache.entries)
+	negativeCache.Unlock()
+	if entries > 5 {
+		t.Errorf("%d negative entries, want at most 5", entries)
+	}
+	if !IsNegative("negative/bounded-19") {
+		t.Error("the latest missing key was not remembered")
+	}
+}
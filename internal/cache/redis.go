@@ -0,0 +1,220 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix namespaces cache entries so the Redis database can be shared
+const redisKeyPrefix = "estrois:cache:"
+
+// redisVariantsPrefix namespaces the sets indexing the variant keys cached
+// for each object
+const redisVariantsPrefix = "estrois:variants:"
+
+// setVariantScript stores a variant entry and indexes it in its object's set
+// of variants, extending the set's expiry to outlive the entry
+var setVariantScript = redis.NewScript(`
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+redis.call("SADD", KEYS[2], ARGV[3])
+if redis.call("PTTL", KEYS[2]) < tonumber(ARGV[2]) then
+	redis.call("PEXPIRE", KEYS[2], ARGV[2])
+end
+return 1
+`)
+
+// RedisStore is a Store shared by every instance pointing at the same Redis.
+// Entries are gob encoded together with their compressed variants and are
+// removed through native Redis TTLs, staleRetention after they expire. Redis errors are logged and treated as misses so
+// an unavailable Redis never fails a request.
+type RedisStore struct {
+	client *redis.Client
+	logger *slog.Logger
+}
+
+func NewRedisStore(client *redis.Client, logger *slog.Logger) *RedisStore {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &RedisStore{client: client, logger: logger}
+}
+
+func (s *RedisStore) Get(key string) (*CacheEntry, Status) {
+	data, err := s.client.Get(context.Background(), redisKeyPrefix+key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			s.logger.Error("redis cache get failed", "key", key, "error", err)
+		}
+		return nil, StatusMiss
+	}
+
+	entry, err := decodeEntry(data)
+	if err != nil {
+		s.logger.Error("invalid redis cache entry", "key", key, "error", err)
+		s.Delete(key)
+		return nil, StatusMiss
+	}
+	if !time.Now().Before(entry.ExpiresAt) {
+		return entry, StatusExpired
+	}
+	return entry, StatusHit
+}
+
+func (s *RedisStore) Set(key string, entry *CacheEntry) {
+	ttl := time.Until(entry.ExpiresAt)
+	if ttl <= 0 {
+		return
+	}
+
+	data, err := encodeEntry(entry)
+	if err != nil {
+		s.logger.Error("failed to encode cache entry", "key", key, "error", err)
+		return
+	}
+	// Keep the key past its expiry so it can still be revalidated
+	expiration := ttl + staleRetention
+	if object, ok := variantObject(key); ok {
+		err = setVariantScript.Run(context.Background(), s.client,
+			[]string{redisKeyPrefix + key, redisVariantsPrefix + object},
+			data, expiration.Milliseconds(), key,
+		).Err()
+	} else {
+		err = s.client.Set(context.Background(), redisKeyPrefix+key, data, expiration).Err()
+	}
+	if err != nil {
+		s.logger.Error("redis cache set failed", "key", key, "error", err)
+	}
+}
+
+func (s *RedisStore) Delete(key string) bool {
+	deleted, err := s.client.Del(context.Background(), redisKeyPrefix+key).Result()
+	if err != nil {
+		s.logger.Error("redis cache delete failed", "key", key, "error", err)
+		return false
+	}
+	return deleted > 0
+}
+
+// DeleteObject deletes key and the variants listed in its set of variants,
+// without scanning the keyspace
+func (s *RedisStore) DeleteObject(key string) int {
+	ctx := context.Background()
+	index := redisVariantsPrefix + key
+	variants, err := s.client.SMembers(ctx, index).Result()
+	if err != nil {
+		s.logger.Error("redis cache variants lookup failed", "key", key, "error", err)
+	}
+
+	keys := []string{redisKeyPrefix + key}
+	for _, variant := range variants {
+		keys = append(keys, redisKeyPrefix+variant)
+	}
+	pipe := s.client.TxPipeline()
+	deleted := pipe.Del(ctx, keys...)
+	if len(variants) > 0 {
+		members := make([]any, len(variants))
+		for i, variant := range variants {
+			members[i] = variant
+		}
+		// Variants cached since the lookup stay indexed
+		pipe.SRem(ctx, index, members...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		s.logger.Error("redis cache delete failed", "key", key, "error", err)
+		return 0
+	}
+	return int(deleted.Val())
+}
+
+func (s *RedisStore) DeleteByPrefix(prefix string) int {
+	ctx := context.Background()
+	var purged int
+	iter := s.client.Scan(ctx, 0, redisKeyPrefix+escapeRedisPattern(prefix)+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		deleted, err := s.client.Del(ctx, iter.Val()).Result()
+		if err != nil {
+			s.logger.Error("redis cache delete failed", "key", iter.Val(), "error", err)
+			continue
+		}
+		purged += int(deleted)
+	}
+	if err := iter.Err(); err != nil {
+		s.logger.Error("redis cache scan failed", "prefix", prefix, "error", err)
+	}
+	return purged
+}
+
+// Range fetches and decodes each matching entry, so it is only meant for
+// inspecting the cache
+func (s *RedisStore) Range(prefix string, fn func(key string, entry *CacheEntry) bool) {
+	ctx := context.Background()
+	iter := s.client.Scan(ctx, 0, redisKeyPrefix+escapeRedisPattern(prefix)+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		data, err := s.client.Get(ctx, iter.Val()).Bytes()
+		if err != nil {
+			// Keys may expire between the scan and the read
+			if !errors.Is(err, redis.Nil) {
+				s.logger.Error("redis cache get failed", "key", iter.Val(), "error", err)
+			}
+			continue
+		}
+		entry, err := decodeEntry(data)
+		if err != nil {
+			s.logger.Error("invalid redis cache entry", "key", iter.Val(), "error", err)
+			continue
+		}
+		if !fn(strings.TrimPrefix(iter.Val(), redisKeyPrefix), entry) {
+			return
+		}
+	}
+	if err := iter.Err(); err != nil {
+		s.logger.Error("redis cache scan failed", "prefix", prefix, "error", err)
+	}
+}
+
+// Stats counts the entries in Redis. Sizes are not tracked, since Redis
+// enforces its own memory limits.
+func (s *RedisStore) Stats() Stats {
+	ctx := context.Background()
+	var entryCount int
+	iter := s.client.Scan(ctx, 0, redisKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		entryCount++
+	}
+	if err := iter.Err(); err != nil {
+		s.logger.Error("redis cache scan failed", "error", err)
+	}
+	return Stats{
+		MaxSize:    MaxCacheSize,
+		EntryCount: entryCount,
+	}
+}
+
+func encodeEntry(entry *CacheEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeEntry(data []byte) (*CacheEntry, error) {
+	var entry CacheEntry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry); err != nil {
+		return nil, err
+	}
+	entry.accountedSize = int64(len(entry.Data) + len(entry.CompressedData) + len(entry.BrotliData))
+	return &entry, nil
+}
+
+// escapeRedisPattern escapes glob characters so prefix matches literally in SCAN
+func escapeRedisPattern(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`).Replace(prefix)
+}
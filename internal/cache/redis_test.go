@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedisStore(t *testing.T) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisStore(client, slog.New(slog.NewTextHandler(io.Discard, nil))), server
+}
+
+func TestRedisDeleteObjectRemovesIndexedVariants(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	object := GetCacheKey("bucket", "file.txt")
+	store.Set(object, testEntry(10, time.Minute))
+	store.Set(GetVariantKey("bucket", "file.txt", "version=1"), testEntry(10, time.Minute))
+	store.Set(GetVariantKey("bucket", "file.txt", "version=2"), testEntry(10, time.Hour))
+	store.Set(GetCacheKey("bucket", "file.txt.bak"), testEntry(10, time.Minute))
+
+	index := redisVariantsPrefix + object
+	if members, _ := server.SMembers(index); len(members) != 2 {
+		t.Fatalf("variant index = %v, want 2 members", members)
+	}
+	// The index outlives the longest lived variant
+	if ttl := server.TTL(index); ttl < time.Hour {
+		t.Errorf("variant index expires in %s, want at least 1h", ttl)
+	}
+
+	if removed := store.DeleteObject(object); removed != 3 {
+		t.Errorf("removed %d entries, want 3", removed)
+	}
+	if server.Exists(index) {
+		t.Error("variant index was not emptied")
+	}
+	for _, key := range []string{object, GetVariantKey("bucket", "file.txt", "version=1"), GetVariantKey("bucket", "file.txt", "version=2")} {
+		if _, status := store.Get(key); status != StatusMiss {
+			t.Errorf("%s is still cached", key)
+		}
+	}
+	if _, status := store.Get(GetCacheKey("bucket", "file.txt.bak")); status != StatusHit {
+		t.Error("an object sharing the key prefix was removed")
+	}
+}
+
+func TestRedisStoreRoundTrip(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	key := GetCacheKey("bucket", "file.txt")
+	if _, status := store.Get(key); status != StatusMiss {
+		t.Fatalf("cold store: status = %s, want MISS", status)
+	}
+
+	data := bytes.Repeat([]byte("compressible "), 100)
+	entry := newUncompressedEntry(data, "text/plain", time.Now().Truncate(time.Second), `"etag"`, map[string]string{"Owner": "reports"}, time.Minute).compress()
+	store.Set(key, entry)
+
+	got, status := store.Get(key)
+	if status != StatusHit {
+		t.Fatalf("status = %s, want HIT", status)
+	}
+	body, err := got.Body()
+	if err != nil || !bytes.Equal(body, data) {
+		t.Errorf("body = %q, %v", body, err)
+	}
+	if got.ContentType != "text/plain" || got.ETag != `"etag"` || got.UserMetadata["Owner"] != "reports" || !got.LastModified.Equal(entry.LastModified) {
+		t.Errorf("entry = %+v, want the stored metadata", got)
+	}
+	if !bytes.Equal(got.Encoded("gzip"), entry.Encoded("gzip")) || len(got.Encoded("gzip")) == 0 {
+		t.Error("compressed variant did not round trip")
+	}
+	if got.accountedSize != entry.accountedSize {
+		t.Errorf("accounted size = %d, want %d", got.accountedSize, entry.accountedSize)
+	}
+
+	if !store.Delete(key) {
+		t.Error("Delete reported a cached key as absent")
+	}
+	if _, status := store.Get(key); status != StatusMiss {
+		t.Errorf("after Delete: status = %s, want MISS", status)
+	}
+	if store.Delete(key) {
+		t.Error("Delete reported a deleted key as present")
+	}
+}
+
+func TestRedisStoreExpiry(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	key := GetCacheKey("bucket", "file.txt")
+	store.Set(key, testEntry(10, 50*time.Millisecond))
+
+	// Expired entries are kept for revalidation until their Redis TTL runs out
+	if ttl := server.TTL(redisKeyPrefix + key); ttl <= staleRetention {
+		t.Errorf("Redis TTL = %s, want more than %s", ttl, staleRetention)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, status := store.Get(key); status != StatusExpired {
+		t.Errorf("after expiry: status = %s, want EXPIRED", status)
+	}
+	server.FastForward(staleRetention + time.Second)
+	if _, status := store.Get(key); status != StatusMiss {
+		t.Errorf("after the Redis TTL: status = %s, want MISS", status)
+	}
+
+	store.Set(key, testEntry(10, -time.Second))
+	if server.Exists(redisKeyPrefix + key) {
+		t.Error("an already expired entry was stored")
+	}
+}
+
+func TestRedisStoreUnavailableIsAMiss(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	key := GetCacheKey("bucket", "file.txt")
+	store.Set(key, testEntry(10, time.Minute))
+	server.Close()
+
+	if _, status := store.Get(key); status != StatusMiss {
+		t.Errorf("status = %s with Redis down, want MISS", status)
+	}
+	store.Set(key, testEntry(10, time.Minute))
+	if store.Delete(key) {
+		t.Error("Delete succeeded with Redis down")
+	}
+}
@@ -0,0 +1,32 @@
+package cache
+
+import "time"
+
+// Store is a cache backend holding object entries by cache key
+type Store interface {
+	// Get returns the entry for key, reporting a miss when there is none.
+	// Expired entries are returned with StatusExpired while they are still
+	// held, so callers can revalidate them against storage.
+	Get(key string) (*CacheEntry, Status)
+	Set(key string, entry *CacheEntry)
+	// Delete removes key and reports whether it was present
+	Delete(key string) bool
+	// DeleteObject removes key and every variant of it, the keys built by
+	// GetVariantKey for the same object, and returns how many were removed
+	DeleteObject(key string) int
+	// DeleteByPrefix removes every key starting with prefix and returns how
+	// many were removed
+	DeleteByPrefix(prefix string) int
+	// Range calls fn for each entry whose key starts with prefix, in no
+	// particular order, until fn returns false
+	Range(prefix string, fn func(key string, entry *CacheEntry) bool)
+	Stats() Stats
+}
+
+type Stats struct {
+	CurrentSize      int64
+	MaxSize          int64
+	EntryCount       int
+	LastCleanupTime  time.Time
+	CompressionRatio float64
+}
@@ -0,0 +1,62 @@
+package cache
+
+// TieredStore serves from a fast local L1 and falls back to a shared L2,
+// promoting L2 hits into L1. Writes and deletes go to both tiers. Stores
+// report L2 failures as misses, so an unavailable L2 leaves the L1 working.
+//
+// L1 entries are not invalidated by writes made through other instances, so
+// they may serve stale data until they expire.
+type TieredStore struct {
+	l1 Store
+	l2 Store
+}
+
+func NewTieredStore(l1, l2 Store) *TieredStore {
+	return &TieredStore{l1: l1, l2: l2}
+}
+
+func (s *TieredStore) Get(key string) (*CacheEntry, Status) {
+	l1Entry, l1Status := s.l1.Get(key)
+	if l1Status == StatusHit {
+		return l1Entry, l1Status
+	}
+
+	entry, status := s.l2.Get(key)
+	switch {
+	case status == StatusHit:
+		s.l1.Set(key, entry)
+	case entry == nil && l1Entry != nil:
+		return l1Entry, l1Status
+	}
+	return entry, status
+}
+
+func (s *TieredStore) Set(key string, entry *CacheEntry) {
+	s.l1.Set(key, entry)
+	s.l2.Set(key, entry)
+}
+
+func (s *TieredStore) Delete(key string) bool {
+	inL1 := s.l1.Delete(key)
+	inL2 := s.l2.Delete(key)
+	return inL1 || inL2
+}
+
+func (s *TieredStore) DeleteObject(key string) int {
+	return max(s.l1.DeleteObject(key), s.l2.DeleteObject(key))
+}
+
+func (s *TieredStore) DeleteByPrefix(prefix string) int {
+	return max(s.l1.DeleteByPrefix(prefix), s.l2.DeleteByPrefix(prefix))
+}
+
+// Range lists the local L1, which holds what this instance may serve without
+// asking L2
+func (s *TieredStore) Range(prefix string, fn func(key string, entry *CacheEntry) bool) {
+	s.l1.Range(prefix, fn)
+}
+
+// Stats reports the local L1, which is what bounds this instance's memory
+func (s *TieredStore) Stats() Stats {
+	return s.l1.Stats()
+}
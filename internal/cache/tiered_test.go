@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTieredStorePromotesL2Hits(t *testing.T) {
+	l1, l2 := NewMemoryStore(1<<20), NewMemoryStore(1<<20)
+	store := NewTieredStore(l1, l2)
+	key := GetCacheKey("bucket", "file.txt")
+	l2.Set(key, testEntry(10, time.Minute))
+
+	if _, status := l1.Get(key); status != StatusMiss {
+		t.Fatalf("L1 status = %s before the read, want MISS", status)
+	}
+	if _, status := store.Get(key); status != StatusHit {
+		t.Fatalf("status = %s, want HIT from L2", status)
+	}
+	if _, status := l1.Get(key); status != StatusHit {
+		t.Errorf("L1 status = %s after an L2 hit, want the entry promoted", status)
+	}
+}
+
+func TestTieredStoreWritesBothTiers(t *testing.T) {
+	l1, l2 := NewMemoryStore(1<<20), NewMemoryStore(1<<20)
+	store := NewTieredStore(l1, l2)
+	key := GetCacheKey("bucket", "file.txt")
+
+	store.Set(key, testEntry(10, time.Minute))
+	for name, tier := range map[string]Store{"L1": l1, "L2": l2} {
+		if _, status := tier.Get(key); status != StatusHit {
+			t.Errorf("%s status = %s after Set, want HIT", name, status)
+		}
+	}
+
+	if !store.Delete(key) {
+		t.Error("Delete reported a cached key as absent")
+	}
+	for name, tier := range map[string]Store{"L1": l1, "L2": l2} {
+		if _, status := tier.Get(key); status != StatusMiss {
+			t.Errorf("%s status = %s after Delete, want MISS", name, status)
+		}
+	}
+}
+
+func TestTieredStoreKeepsExpiredL1EntryOnL2Miss(t *testing.T) {
+	l1, l2 := NewMemoryStore(1<<20), NewMemoryStore(1<<20)
+	store := NewTieredStore(l1, l2)
+	key := GetCacheKey("bucket", "file.txt")
+	l1.Set(key, testEntry(10, time.Minute).Refresh(-time.Second))
+
+	// The expired entry is still returned so it can be revalidated
+	if entry, status := store.Get(key); status != StatusExpired || entry == nil {
+		t.Errorf("status = %s, entry = %v, want the expired L1 entry", status, entry)
+	}
+}
+
+func TestTieredStoreDegradesToL1WhenL2Fails(t *testing.T) {
+	l2, server := newTestRedisStore(t)
+	l1 := NewMemoryStore(1 << 20)
+	store := NewTieredStore(l1, l2)
+	server.Close()
+
+	key := GetCacheKey("bucket", "file.txt")
+	if _, status := store.Get(key); status != StatusMiss {
+		t.Errorf("cold status = %s with L2 down, want MISS", status)
+	}
+	store.Set(key, testEntry(10, time.Minute))
+	if _, status := store.Get(key); status != StatusHit {
+		t.Errorf("status = %s with L2 down, want HIT from L1", status)
+	}
+	if !store.Delete(key) {
+		t.Error("Delete with L2 down did not report the L1 entry")
+	}
+}
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"sync/atomic"
 	"time"
 
 	"github.com/muandane/estrois/internal/config"
@@ -13,17 +14,214 @@ type CacheEntry struct {
 	ContentType    string
 	Size           int64
 	CompressedSize int64
+	BrotliData     []byte
 	LastModified   time.Time
 	ETag           string
+	UserMetadata   map[string]string
 	ExpiresAt      time.Time
-	IsCompressed   bool
+	StoredAt       time.Time
+	// IsCompressed records that gzip shrank the object. CompressedData and
+	// BrotliData are only kept when smaller than the object.
+	IsCompressed bool
+	// MetadataOnly marks an entry holding an object's metadata without its
+	// data, so it can answer HEAD and conditional requests but never a body
+	MetadataOnly bool
+	// Stale marks an expired entry kept in service because storage could
+	// not be reached to revalidate it
+	Stale bool
+
+	// accountedSize is the number of bytes this entry contributes to the
+	// running cache size, so additions and removals always balance.
+	accountedSize int64
+	// usage counts hits until the entry is refreshed and records that its
+	// expiry was counted. It is nil for entries decoded from a shared cache,
+	// which are never refreshed ahead.
+	usage *entryUsage
+}
+
+// entryUsage is shared by an entry and the copies made of it until its
+// expiry is renewed
+type entryUsage struct {
+	hits       atomic.Int64
+	refreshing atomic.Bool
+	expired    atomic.Bool
+}
+
+// markExpired reports whether this is the first time the entry's expiry is
+// seen, so each expiry is counted once by whichever of a read or the cleanup
+// sweep sees it first. Entries without usage are only counted by the sweep.
+func (e *CacheEntry) markExpired(sweep bool) bool {
+	if e.usage == nil {
+		return sweep
+	}
+	return e.usage.expired.CompareAndSwap(false, true)
+}
+
+// Age returns how long ago the entry was stored
+func (e *CacheEntry) Age() time.Duration {
+	return time.Since(e.StoredAt)
+}
+
+// Body returns the uncompressed object. Entries kept only in compressed form
+// are decompressed on every call.
+func (e *CacheEntry) Body() ([]byte, error) {
+	if e.Data != nil || !e.IsCompressed {
+		return e.Data, nil
+	}
+	return DecompressData(e.CompressedData)
+}
+
+// Encoded returns the entry's variant in encoding, br or gzip, or nil when
+// the entry holds none because it did not pay off
+func (e *CacheEntry) Encoded(encoding string) []byte {
+	switch encoding {
+	case "br":
+		return e.BrotliData
+	case "gzip":
+		if e.IsCompressed {
+			return e.CompressedData
+		}
+	}
+	return nil
+}
+
+// Refresh returns a copy of the entry that expires after ttl, for when
+// storage confirms the cached object has not changed
+func (e *CacheEntry) Refresh(ttl time.Duration) *CacheEntry {
+	refreshed := *e
+	refreshed.StoredAt = time.Now()
+	refreshed.ExpiresAt = refreshed.StoredAt.Add(ttl)
+	refreshed.Stale = false
+	refreshed.usage = &entryUsage{}
+	return &refreshed
+}
+
+// ServeStale returns a copy of the entry marked stale that stays in service
+// for ttl, for when storage fails while revalidating it
+func (e *CacheEntry) ServeStale(ttl time.Duration) *CacheEntry {
+	stale := *e
+	stale.ExpiresAt = time.Now().Add(ttl)
+	stale.Stale = true
+	return &stale
 }
 
+// RefreshAhead records a hit and reports whether the entry should be
+// revalidated now, before it expires: it must have had RefreshAheadHits hits
+// and be within the last RefreshAheadWindow percent of its TTL. It reports
+// true at most once per entry so a single refresh is started.
+func (e *CacheEntry) RefreshAhead() bool {
+	if RefreshAheadHits <= 0 || e.usage == nil || e.Stale {
+		return false
+	}
+	if e.usage.hits.Add(1) < RefreshAheadHits {
+		return false
+	}
+	ttl := e.ExpiresAt.Sub(e.StoredAt)
+	if time.Until(e.ExpiresAt) > ttl*time.Duration(RefreshAheadWindow)/100 {
+		return false
+	}
+	return e.usage.refreshing.CompareAndSwap(false, true)
+}
+
+// Status describes the outcome of a cache lookup, as reported in X-Cache
+type Status string
+
+const (
+	StatusHit     Status = "HIT"
+	StatusMiss    Status = "MISS"
+	StatusExpired Status = "EXPIRED"
+	// StatusRevalidated marks an expired entry that storage confirmed unchanged
+	StatusRevalidated Status = "REVALIDATED"
+	// StatusStale marks an expired entry served because storage failed
+	// while revalidating it
+	StatusStale Status = "STALE"
+	// StatusBypass marks a response served from storage without using the cache
+	StatusBypass Status = "BYPASS"
+)
+
 // Cache configuration
 const (
-	DefaultCacheDuration  = 5 * time.Minute
-	CleanupInterval       = 1 * time.Minute
-	MinSizeForCompression = 1 * 1024 * 1024 // Only compress files larger than 1MB
+	DefaultCacheDuration = 5 * time.Minute
 )
 
-var MaxCacheSize = config.GetEnvWithDefaultInt("MAX_CACHE_SIZE", 300)
+// staleRetention is how long stores keep an entry after it expires, giving
+// readers a chance to revalidate it instead of downloading it again
+const staleRetention = DefaultCacheDuration
+
+// CleanupInterval is how often the in-memory cache sweeps out entries past
+// their stale retention, set by CACHE_CLEANUP_INTERVAL (default 1m, 0 disables)
+var CleanupInterval = config.GetEnvWithDefaultDuration("CACHE_CLEANUP_INTERVAL", time.Minute)
+
+// BucketCacheTTLs overrides DefaultCacheDuration per bucket, set by BUCKET_CACHE_TTL
+var BucketCacheTTLs = config.GetBucketCacheTTLs()
+
+// BucketMaxCacheableSizes overrides MaxCacheableSize per bucket, set by
+// BUCKET_MAX_CACHEABLE_SIZE
+var BucketMaxCacheableSizes = config.GetBucketMaxCacheableSizes()
+
+// MinSizeForCompression is the smallest object size in bytes that gets
+// compressed, set by MIN_COMPRESSION_SIZE (default 1MB)
+var MinSizeForCompression = config.GetEnvWithDefaultSize("MIN_COMPRESSION_SIZE", 1)
+
+// BackgroundCompressionSize is the object size in bytes from which cached
+// objects are stored before their compressed variants are computed, set by
+// CACHE_BACKGROUND_COMPRESSION_SIZE (default 4MB, 0 disables)
+var BackgroundCompressionSize = config.GetEnvWithDefaultOptionalSize("CACHE_BACKGROUND_COMPRESSION_SIZE", 4)
+
+// MaxCacheSize is the maximum cache size in bytes. MAX_CACHE_SIZE accepts a
+// value in megabytes ("300") or with a unit suffix ("256MB", "1GB").
+var MaxCacheSize = config.GetEnvWithDefaultSize("MAX_CACHE_SIZE", 300)
+
+// MaxCacheEntries bounds the number of entries in an in-memory cache, however
+// small they are, set by MAX_CACHE_ENTRIES (default 0, unlimited)
+var MaxCacheEntries = config.GetEnvWithDefaultInt("MAX_CACHE_ENTRIES", 0)
+
+// CacheEvictionPolicy names the EvictionPolicy of in-memory caches, set by
+// CACHE_EVICTION_POLICY (default lru)
+var CacheEvictionPolicy = config.GetCacheEvictionPolicy()
+
+// StoreCompressedOnly drops the uncompressed copy of entries that compress
+// well, set by CACHE_STORE_COMPRESSED_ONLY (default false). Clients that do
+// not accept a compressed encoding are then served data decompressed on the fly.
+var StoreCompressedOnly = config.GetEnvWithDefaultBool("CACHE_STORE_COMPRESSED_ONLY", false)
+
+// CacheHeadMetadata caches the metadata of objects looked up by HEAD
+// requests, set by CACHE_HEAD_METADATA (default false)
+var CacheHeadMetadata = config.GetEnvWithDefaultBool("CACHE_HEAD_METADATA", false)
+
+// ServeStaleOnError serves an expired entry, marked stale, when storage fails
+// while revalidating it, set by CACHE_SERVE_STALE_ON_ERROR (default false)
+var ServeStaleOnError = config.GetEnvWithDefaultBool("CACHE_SERVE_STALE_ON_ERROR", false)
+
+// StaleOnErrorTTL is how long an entry served stale is kept in service before
+// storage is tried again, set by CACHE_STALE_ON_ERROR_TTL (default 30s)
+var StaleOnErrorTTL = config.GetEnvWithDefaultDuration("CACHE_STALE_ON_ERROR_TTL", 30*time.Second)
+
+// RefreshAheadHits is the number of hits after which an entry is revalidated
+// in the background before it expires, so popular objects never go cold, set
+// by CACHE_REFRESH_AHEAD_HITS (default 0, disabled)
+var RefreshAheadHits = config.GetEnvWithDefaultInt("CACHE_REFRESH_AHEAD_HITS", 0)
+
+// RefreshAheadWindow is the final share of an entry's TTL, in percent, during
+// which a hit may refresh it ahead, set by CACHE_REFRESH_AHEAD_WINDOW
+// (default 20)
+var RefreshAheadWindow = config.GetEnvWithDefaultInt("CACHE_REFRESH_AHEAD_WINDOW", 20)
+
+// CacheShards is the number of independently locked stripes in the
+// in-memory cache, set by CACHE_SHARDS (default 16)
+var CacheShards = config.GetEnvWithDefaultInt("CACHE_SHARDS", 16)
+
+// L1CacheSize is the size in bytes of the in-memory cache kept in front of a
+// shared Redis cache, set by CACHE_L1_SIZE (default 0, disabled)
+var L1CacheSize = config.GetEnvWithDefaultOptionalSize("CACHE_L1_SIZE", 0)
+
+// StreamThreshold is the object size in bytes above which objects are streamed
+// to clients instead of being read into memory. Such objects are not cached
+// unless they fit StreamFillSize.
+var StreamThreshold = config.GetEnvWithDefaultSize("STREAM_THRESHOLD", 10)
+
+// StreamFillSize is the largest streamed object that is cached as it is sent,
+// from a copy kept while streaming and stored once the whole object has been
+// read. Set by CACHE_STREAM_FILL_SIZE (default 0, streamed objects are never
+// cached).
+var StreamFillSize = config.GetEnvWithDefaultOptionalSize("CACHE_STREAM_FILL_SIZE", 0)
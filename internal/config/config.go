@@ -2,10 +2,14 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"log"
-	"os"
+	"log/slog"
+	"mime"
+	"net"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type StorageConfig struct {
@@ -15,28 +19,144 @@ type StorageConfig struct {
 	AllowedBuckets       map[string]string
 	EnableBucketPolicies bool
 	UseSSL               bool
+	// Region is sent with requests instead of looking up each bucket's
+	// region; empty leaves the lookup to the client
+	Region string
+	// BucketLookup selects path-style or virtual-host (dns) addressing, one
+	// of the BucketLookup constants
+	BucketLookup string
+	// CredsProvider selects where credentials come from, one of the
+	// CredsProvider constants. AccessKeyID and SecretAccessKey are only used
+	// by CredsProviderStatic.
+	CredsProvider string
+	// STSEndpoint, STSTokenFile and STSRoleARN configure CredsProviderSTS,
+	// which exchanges the web identity token read from STSTokenFile for
+	// temporary credentials
+	STSEndpoint  string
+	STSTokenFile string
+	STSRoleARN   string
 }
 
+// Credential providers accepted in S3_CREDS_PROVIDER
+const (
+	// CredsProviderStatic uses S3_ACCESS_KEY and S3_SECRET_KEY
+	CredsProviderStatic = "static"
+	// CredsProviderIAM uses the IAM role of the instance, task or pod,
+	// including EKS service accounts
+	CredsProviderIAM = "iam"
+	// CredsProviderEnv reads AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY or
+	// MINIO_ACCESS_KEY/MINIO_SECRET_KEY
+	CredsProviderEnv = "env"
+	// CredsProviderSTS assumes a role with a web identity token
+	CredsProviderSTS = "sts"
+)
+
+// Bucket addressing styles accepted in S3_BUCKET_LOOKUP
+const (
+	BucketLookupAuto = "auto"
+	BucketLookupPath = "path"
+	BucketLookupDNS  = "dns"
+)
+
+type RateLimitConfig struct {
+	RequestsPerSecond float64
+	Burst             int
+	PerBucket         bool
+}
+
+func GetRateLimitConfig() *RateLimitConfig {
+	rps, err := strconv.ParseFloat(getEnv("RATE_LIMIT_RPS", "0"), 64)
+	if err != nil {
+		log.Printf("Invalid RATE_LIMIT_RPS value: %q, rate limiting disabled", lookupEnv("RATE_LIMIT_RPS"))
+		rps = 0
+	}
+	return &RateLimitConfig{
+		RequestsPerSecond: rps,
+		Burst:             int(GetEnvWithDefaultInt("RATE_LIMIT_BURST", 20)),
+		PerBucket:         getEnv("RATE_LIMIT_PER_BUCKET", "false") == "true",
+	}
+}
+
+// defaultAllowedBuckets is the bucket access policy used when ALLOWED_BUCKETS is unset
+const defaultAllowedBuckets = "public:read,private:all,local:all"
+
+// accessLevels are the access values accepted in ALLOWED_BUCKETS
+var accessLevels = map[string]bool{"read": true, "write": true, "all": true}
+
+// GetAllowedBuckets returns the bucket access policy from ALLOWED_BUCKETS. An
+// invalid policy grants access to no bucket; Validate reports its errors.
 func GetAllowedBuckets() *StorageConfig {
-	bucketAccess, err := parseBucketAccess(getEnv("ALLOWED_BUCKETS", "public:read,private:all,local:all"))
+	bucketAccess, err := parseBucketAccess(getEnv("ALLOWED_BUCKETS", defaultAllowedBuckets))
 	if err != nil {
-		log.Printf("Error parsing bucket access: %v", err)
-		log.Printf("Raw ALLOWED_BUCKETS value: %s", os.Getenv("ALLOWED_BUCKETS"))
-		log.Printf("Parsed Bucket Access: %+v", bucketAccess)
-		log.Fatal(err)
+		log.Printf("Error parsing ALLOWED_BUCKETS, no bucket is accessible: %v", err)
+		bucketAccess = map[string]string{}
 	}
 	return &StorageConfig{
 		AllowedBuckets: bucketAccess,
 	}
 }
 
+// PolicyError describes an invalid pair in a bucket access policy such as
+// ALLOWED_BUCKETS. Position counts pairs from 1.
+type PolicyError struct {
+	Position int
+	Pair     string
+	Message  string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("pair %d %q: %s", e.Position, e.Pair, e.Message)
+}
+
 func GetStorageConfig() *StorageConfig {
 	return &StorageConfig{
 		Endpoint:        getEnv("S3_ENDPOINT", "localhost:9000"),
 		AccessKeyID:     getEnv("S3_ACCESS_KEY", "minioadmin"),
 		SecretAccessKey: getEnv("S3_SECRET_KEY", "minioadmin"),
 		UseSSL:          getEnv("S3_USE_SSL", "false") == "true",
+		Region:          getEnv("S3_REGION", ""),
+		BucketLookup:    bucketLookup(getEnv("S3_BUCKET_LOOKUP", BucketLookupAuto)),
+		CredsProvider:   credsProvider(getEnv("S3_CREDS_PROVIDER", CredsProviderStatic)),
+		STSEndpoint:     getEnv("S3_STS_ENDPOINT", ""),
+		STSTokenFile:    getEnv("S3_STS_TOKEN_FILE", ""),
+		STSRoleARN:      getEnv("S3_STS_ROLE_ARN", ""),
+	}
+}
+
+// credsProvider returns the credentials provider in value, falling back to
+// CredsProviderStatic when it is invalid; Validate reports the error
+func credsProvider(value string) string {
+	provider, err := parseCredsProvider(value)
+	if err != nil {
+		return CredsProviderStatic
+	}
+	return provider
+}
+
+func parseCredsProvider(value string) (string, error) {
+	switch provider := strings.ToLower(strings.TrimSpace(value)); provider {
+	case CredsProviderStatic, CredsProviderIAM, CredsProviderEnv, CredsProviderSTS:
+		return provider, nil
+	}
+	return "", fmt.Errorf("unknown credentials provider %q, expected static, iam, env or sts", value)
+}
+
+// bucketLookup returns the addressing style in value, falling back to
+// BucketLookupAuto when it is invalid; Validate reports the error
+func bucketLookup(value string) string {
+	lookup, err := parseBucketLookup(value)
+	if err != nil {
+		return BucketLookupAuto
+	}
+	return lookup
+}
+
+func parseBucketLookup(value string) (string, error) {
+	switch lookup := strings.ToLower(strings.TrimSpace(value)); lookup {
+	case BucketLookupAuto, BucketLookupPath, BucketLookupDNS:
+		return lookup, nil
 	}
+	return "", fmt.Errorf("unknown bucket lookup %q, expected auto, path or dns", value)
 }
 
 func GetBucketConfig() *StorageConfig {
@@ -45,36 +165,751 @@ func GetBucketConfig() *StorageConfig {
 	}
 }
 
+// GetBucketCacheTTLs returns per-bucket cache durations from BUCKET_CACHE_TTL,
+// e.g. "artifacts:1h,config:10s". Invalid entries are logged and skipped.
+func GetBucketCacheTTLs() map[string]time.Duration {
+	ttls := make(map[string]time.Duration)
+	for _, entry := range GetEnvWithDefaultList("BUCKET_CACHE_TTL", nil) {
+		bucket, value, _ := strings.Cut(entry, ":")
+		bucket = strings.TrimSpace(bucket)
+		ttl, err := time.ParseDuration(strings.TrimSpace(value))
+		if bucket == "" || err != nil || ttl < 0 {
+			log.Printf("Invalid BUCKET_CACHE_TTL entry: %q, ignoring", entry)
+			continue
+		}
+		ttls[bucket] = ttl
+	}
+	return ttls
+}
+
+// GetBucketMaxCacheableSizes returns per-bucket limits on the size of objects
+// that get cached from BUCKET_MAX_CACHEABLE_SIZE, e.g. "videos:5MB,thumbnails:50MB".
+// Sizes use the ParseSize format. Invalid entries are logged and skipped.
+func GetBucketMaxCacheableSizes() map[string]int64 {
+	sizes := make(map[string]int64)
+	for _, entry := range GetEnvWithDefaultList("BUCKET_MAX_CACHEABLE_SIZE", nil) {
+		bucket, value, _ := strings.Cut(entry, ":")
+		bucket = strings.TrimSpace(bucket)
+		size, err := ParseSize(value)
+		if bucket == "" || err != nil || size < 0 {
+			log.Printf("Invalid BUCKET_MAX_CACHEABLE_SIZE entry: %q, ignoring", entry)
+			continue
+		}
+		sizes[bucket] = size
+	}
+	return sizes
+}
+
+// GetBucketIndexDocuments returns the index document served for
+// directory-style keys of each bucket, from BUCKET_INDEX_DOCUMENT pairs such as
+// "site:index.html"
+func GetBucketIndexDocuments() map[string]string {
+	return getBucketDocuments("BUCKET_INDEX_DOCUMENT")
+}
+
+// GetBucketErrorDocuments returns the object served with missing objects'
+// 404 responses in each bucket, from BUCKET_ERROR_DOCUMENT pairs such as
+// "site:404.html"
+func GetBucketErrorDocuments() map[string]string {
+	return getBucketDocuments("BUCKET_ERROR_DOCUMENT")
+}
+
+// getBucketDocuments parses "bucket:key" pairs naming an object per bucket.
+// Invalid entries are logged and skipped.
+func getBucketDocuments(name string) map[string]string {
+	documents := make(map[string]string)
+	for _, entry := range GetEnvWithDefaultList(name, nil) {
+		bucket, document, _ := strings.Cut(entry, ":")
+		bucket, document = strings.TrimSpace(bucket), strings.TrimSpace(document)
+		if bucket == "" || document == "" || strings.HasPrefix(document, "/") {
+			log.Printf("Invalid %s entry: %q, ignoring", name, entry)
+			continue
+		}
+		documents[bucket] = document
+	}
+	return documents
+}
+
+// GetNoCompressionBuckets returns the buckets listed in BUCKET_NO_COMPRESSION,
+// whose objects are served uncompressed unless a request asks otherwise
+func GetNoCompressionBuckets() map[string]bool {
+	buckets := make(map[string]bool)
+	for _, bucket := range GetEnvWithDefaultList("BUCKET_NO_COMPRESSION", nil) {
+		buckets[bucket] = true
+	}
+	return buckets
+}
+
+// GetTrustedProxies returns the IPs or CIDR ranges of proxies whose
+// X-Forwarded-For headers are trusted
+func GetTrustedProxies() []string {
+	return GetEnvWithDefaultList("TRUSTED_PROXIES", nil)
+}
+
+// GetBucketAllowedIPs returns the IPs or CIDR ranges each bucket may be
+// reached from when ENABLE_BUCKET_POLICIES is true, from BUCKET_ALLOWED_IPS
+// pairs such as "private:10.0.0.0/8|192.168.1.7". Invalid pairs are reported
+// by Validate.
+func GetBucketAllowedIPs() map[string][]string {
+	ranges, err := parseBucketAllowedIPs(GetEnvWithDefaultList("BUCKET_ALLOWED_IPS", nil))
+	if err != nil {
+		return nil
+	}
+	return ranges
+}
+
+func parseBucketAllowedIPs(entries []string) (map[string][]string, error) {
+	ranges := make(map[string][]string, len(entries))
+	for _, entry := range entries {
+		bucket, list, _ := strings.Cut(entry, ":")
+		bucket = strings.TrimSpace(bucket)
+		if bucket == "" || strings.TrimSpace(list) == "" {
+			return nil, fmt.Errorf("invalid entry %q, expected bucket:range|range", entry)
+		}
+		for _, r := range strings.Split(list, "|") {
+			r = strings.TrimSpace(r)
+			if _, _, err := net.ParseCIDR(r); err != nil && net.ParseIP(r) == nil {
+				return nil, fmt.Errorf("bucket %s: invalid IP or CIDR range %q", bucket, r)
+			}
+			ranges[bucket] = append(ranges[bucket], r)
+		}
+	}
+	return ranges, nil
+}
+
+// GetAPIKeys returns the API keys allowed to call the service, each mapped to
+// the buckets it is scoped to. A key with no buckets may access every bucket.
+// API_KEYS has the form "key1,key2:bucketA|bucketB"; when empty, API key
+// authentication is disabled. Invalid keys are reported by Validate, which
+// keeps the service from starting with them.
+func GetAPIKeys() map[string][]string {
+	keys, err := parseAPIKeys(lookupEnv("API_KEYS"))
+	if err != nil {
+		return nil
+	}
+	return keys
+}
+
+// GetBackendConfigs returns the storage backends listed in S3_BACKENDS next to
+// the default one, as "name=endpoint" pairs such as "archive=archive:9000".
+// Each backend reads S3_BACKEND_<NAME>_ACCESS_KEY, _SECRET_KEY, _USE_SSL,
+// _REGION and _BUCKET_LOOKUP, falling back to the default backend's settings.
+// Backends share the default backend's credentials provider. Invalid
+// backends are reported by Validate.
+func GetBackendConfigs() map[string]*StorageConfig {
+	backends, err := parseBackends(GetEnvWithDefaultList("S3_BACKENDS", nil))
+	if err != nil {
+		return nil
+	}
+	return backends
+}
+
+// GetBucketBackends returns the backend each bucket is served by, from
+// BUCKET_BACKENDS pairs such as "logs:archive". Other buckets use the default
+// backend. Invalid pairs are reported by Validate.
+func GetBucketBackends() map[string]string {
+	routes, err := parseBucketBackends(GetEnvWithDefaultList("BUCKET_BACKENDS", nil))
+	if err != nil {
+		return nil
+	}
+	return routes
+}
+
+// GetAPIKeyTenants returns the tenant each API key belongs to, from
+// API_KEY_TENANTS pairs such as "key1:acme". Object keys of a tenant are
+// stored under a "tenant/" prefix. Invalid pairs are reported by Validate.
+func GetAPIKeyTenants() map[string]string {
+	tenants, err := parseAPIKeyTenants(GetEnvWithDefaultList("API_KEY_TENANTS", nil))
+	if err != nil {
+		return nil
+	}
+	return tenants
+}
+
+// GetContentTypes returns content types by file extension from CONTENT_TYPES
+// pairs such as ".md:text/markdown", used for uploads without a Content-Type
+// ahead of the system MIME table. Invalid pairs are reported by Validate.
+func GetContentTypes() map[string]string {
+	types, err := parseContentTypes(GetEnvWithDefaultList("CONTENT_TYPES", nil))
+	if err != nil {
+		return nil
+	}
+	return types
+}
+
+// GetTenantHeader returns the request header naming the tenant for requests
+// whose API key has none, from TENANT_HEADER. Clients can send any header, so
+// it must only be set when a trusted proxy overwrites the header on every
+// request; when empty, tenants come from API keys only.
+func GetTenantHeader() string {
+	return lookupEnv("TENANT_HEADER")
+}
+
+// RedisConfig locates the Redis server used as a shared cache
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+}
+
+// GetRedisConfig reads REDIS_ADDR, REDIS_PASSWORD and REDIS_DB; an empty
+// address keeps the cache in memory
+func GetRedisConfig() *RedisConfig {
+	return &RedisConfig{
+		Addr:     lookupEnv("REDIS_ADDR"),
+		Password: lookupEnv("REDIS_PASSWORD"),
+		DB:       int(GetEnvWithDefaultInt("REDIS_DB", 0)),
+	}
+}
+
+// SignatureConfig holds the shared secret used to verify signed requests
+type SignatureConfig struct {
+	Secret       string
+	MaxClockSkew time.Duration
+}
+
+// GetSignatureConfig reads HMAC_SECRET and HMAC_MAX_CLOCK_SKEW; an empty
+// secret disables request signature verification
+func GetSignatureConfig() *SignatureConfig {
+	return &SignatureConfig{
+		Secret:       lookupEnv("HMAC_SECRET"),
+		MaxClockSkew: GetEnvWithDefaultDuration("HMAC_MAX_CLOCK_SKEW", 5*time.Minute),
+	}
+}
+
+// ServerConfig holds the HTTP server's connection timeouts, where a zero
+// timeout is disabled, and the optional address of the admin server
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	AdminAddr         string
+}
+
+// GetServerConfig reads SERVER_READ_HEADER_TIMEOUT, SERVER_READ_TIMEOUT,
+// SERVER_WRITE_TIMEOUT and SERVER_IDLE_TIMEOUT. Read and write timeouts cover
+// the whole request and response, so they are disabled by default to let
+// large uploads and downloads finish; those are bounded by S3_OP_TIMEOUT once
+// they stall. ADMIN_ADDR, such as ":9090", serves the admin endpoints on a
+// separate listener; when empty they share the main one.
+func GetServerConfig() *ServerConfig {
+	return &ServerConfig{
+		ReadHeaderTimeout: GetEnvWithDefaultDuration("SERVER_READ_HEADER_TIMEOUT", 10*time.Second),
+		ReadTimeout:       GetEnvWithDefaultDuration("SERVER_READ_TIMEOUT", 0),
+		WriteTimeout:      GetEnvWithDefaultDuration("SERVER_WRITE_TIMEOUT", 0),
+		IdleTimeout:       GetEnvWithDefaultDuration("SERVER_IDLE_TIMEOUT", 2*time.Minute),
+		AdminAddr:         lookupEnv("ADMIN_ADDR"),
+	}
+}
+
+// ResponseCompressionConfig controls gzip compression of admin responses
+type ResponseCompressionConfig struct {
+	Enabled bool
+	MinSize int64
+}
+
+// GetResponseCompressionConfig reads RESPONSE_COMPRESSION (default true) and
+// RESPONSE_COMPRESSION_MIN_SIZE, a size such as "1KB" (default 1KB)
+func GetResponseCompressionConfig() *ResponseCompressionConfig {
+	minSize := kilobyte
+	if sizeStr := lookupEnv("RESPONSE_COMPRESSION_MIN_SIZE"); sizeStr != "" {
+		if size, err := ParseSize(sizeStr); err == nil {
+			minSize = size
+		} else {
+			log.Printf("Invalid size value for RESPONSE_COMPRESSION_MIN_SIZE: %q, using default 1KB", sizeStr)
+		}
+	}
+	return &ResponseCompressionConfig{
+		Enabled: GetEnvWithDefaultBool("RESPONSE_COMPRESSION", true),
+		MinSize: minSize,
+	}
+}
+
+// Log formats accepted in LOG_FORMAT
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// LoggingConfig selects the level and output format of the application log
+type LoggingConfig struct {
+	Level  slog.Level
+	Format string
+}
+
+// GetLoggingConfig reads LOG_LEVEL (debug, info, warn or error; default info)
+// and LOG_FORMAT (json or text; default json). Unknown values fall back to
+// the defaults here and are reported by Validate.
+func GetLoggingConfig() *LoggingConfig {
+	level, err := parseLogLevel(getEnv("LOG_LEVEL", "info"))
+	if err != nil {
+		level = slog.LevelInfo
+	}
+	format, err := parseLogFormat(getEnv("LOG_FORMAT", LogFormatJSON))
+	if err != nil {
+		format = LogFormatJSON
+	}
+	return &LoggingConfig{Level: level, Format: format}
+}
+
+func parseLogLevel(value string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown level %q, expected debug, info, warn or error", value)
+}
+
+func parseLogFormat(value string) (string, error) {
+	switch format := strings.ToLower(strings.TrimSpace(value)); format {
+	case LogFormatJSON, LogFormatText:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown format %q, expected json or text", value)
+}
+
+// Eviction policies accepted in CACHE_EVICTION_POLICY
+const (
+	EvictionRandom = "random"
+	EvictionLRU    = "lru"
+	EvictionLFU    = "lfu"
+	EvictionFIFO   = "fifo"
+)
+
+// GetCacheEvictionPolicy reads CACHE_EVICTION_POLICY (random, lru, lfu or
+// fifo; default lru). Unknown values fall back to lru here and are reported
+// by Validate.
+func GetCacheEvictionPolicy() string {
+	policy, err := parseEvictionPolicy(getEnv("CACHE_EVICTION_POLICY", EvictionLRU))
+	if err != nil {
+		return EvictionLRU
+	}
+	return policy
+}
+
+func parseEvictionPolicy(value string) (string, error) {
+	switch policy := strings.ToLower(strings.TrimSpace(value)); policy {
+	case EvictionRandom, EvictionLRU, EvictionLFU, EvictionFIFO:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown eviction policy %q, expected random, lru, lfu or fifo", value)
+}
+
+// Validate checks the configuration once at startup and reports every problem
+// found in a single error, so a misconfigured instance fails before serving.
+// Outside DEV_MODE the S3 credentials must be set explicitly rather than
+// falling back to the MinIO defaults.
+func Validate() error {
+	var errs []error
+	if fileErr != nil {
+		errs = append(errs, fileErr)
+	}
+
+	if err := validateEndpoint(getEnv("S3_ENDPOINT", "localhost:9000")); err != nil {
+		errs = append(errs, fmt.Errorf("S3_ENDPOINT: %w", err))
+	}
+	if _, err := parseBucketLookup(getEnv("S3_BUCKET_LOOKUP", BucketLookupAuto)); err != nil {
+		errs = append(errs, fmt.Errorf("S3_BUCKET_LOOKUP: %w", err))
+	}
+	provider, err := parseCredsProvider(getEnv("S3_CREDS_PROVIDER", CredsProviderStatic))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("S3_CREDS_PROVIDER: %w", err))
+	}
+	if provider == CredsProviderStatic && getEnv("DEV_MODE", "false") != "true" {
+		for _, key := range []string{"S3_ACCESS_KEY", "S3_SECRET_KEY"} {
+			if lookupEnv(key) == "" {
+				errs = append(errs, fmt.Errorf("%s: must be set unless DEV_MODE=true", key))
+			}
+		}
+	}
+	if provider == CredsProviderSTS {
+		for _, key := range []string{"S3_STS_ENDPOINT", "S3_STS_TOKEN_FILE"} {
+			if lookupEnv(key) == "" {
+				errs = append(errs, fmt.Errorf("%s: must be set when S3_CREDS_PROVIDER=sts", key))
+			}
+		}
+	}
+	if _, err := parseBucketAccess(getEnv("ALLOWED_BUCKETS", defaultAllowedBuckets)); err != nil {
+		errs = append(errs, fmt.Errorf("ALLOWED_BUCKETS: %w", err))
+	}
+	if _, err := parseAPIKeys(lookupEnv("API_KEYS")); err != nil {
+		errs = append(errs, fmt.Errorf("API_KEYS: %w", err))
+	}
+	if _, err := parseBucketAllowedIPs(GetEnvWithDefaultList("BUCKET_ALLOWED_IPS", nil)); err != nil {
+		errs = append(errs, fmt.Errorf("BUCKET_ALLOWED_IPS: %w", err))
+	}
+	if _, err := parseAPIKeyTenants(GetEnvWithDefaultList("API_KEY_TENANTS", nil)); err != nil {
+		errs = append(errs, fmt.Errorf("API_KEY_TENANTS: %w", err))
+	}
+	if _, err := parseContentTypes(GetEnvWithDefaultList("CONTENT_TYPES", nil)); err != nil {
+		errs = append(errs, fmt.Errorf("CONTENT_TYPES: %w", err))
+	}
+	if _, err := parseLogLevel(getEnv("LOG_LEVEL", "info")); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL: %w", err))
+	}
+	if _, err := parseLogFormat(getEnv("LOG_FORMAT", LogFormatJSON)); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT: %w", err))
+	}
+	if _, err := parseEvictionPolicy(getEnv("CACHE_EVICTION_POLICY", EvictionLRU)); err != nil {
+		errs = append(errs, fmt.Errorf("CACHE_EVICTION_POLICY: %w", err))
+	}
+	// Storage calls run under a context bounded by S3_OP_TIMEOUT, which
+	// fails every call at once unless it is positive
+	if GetEnvWithDefaultDuration("S3_OP_TIMEOUT", time.Second) <= 0 {
+		errs = append(errs, errors.New("S3_OP_TIMEOUT: must be a positive duration"))
+	}
+
+	backends, err := parseBackends(GetEnvWithDefaultList("S3_BACKENDS", nil))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("S3_BACKENDS: %w", err))
+	}
+	for name, backend := range backends {
+		if err := validateEndpoint(backend.Endpoint); err != nil {
+			errs = append(errs, fmt.Errorf("S3_BACKENDS: backend %s: %w", name, err))
+		}
+		prefix := backendEnvPrefix(name)
+		if value := lookupEnv(prefix + "BUCKET_LOOKUP"); value != "" {
+			if _, err := parseBucketLookup(value); err != nil {
+				errs = append(errs, fmt.Errorf("%sBUCKET_LOOKUP: %w", prefix, err))
+			}
+		}
+	}
+	routes, err := parseBucketBackends(GetEnvWithDefaultList("BUCKET_BACKENDS", nil))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("BUCKET_BACKENDS: %w", err))
+	}
+	for bucket, name := range routes {
+		if _, ok := backends[name]; !ok && name != defaultBackend {
+			errs = append(errs, fmt.Errorf("BUCKET_BACKENDS: bucket %s is routed to unknown backend %s", bucket, name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateEndpoint accepts a "host" or "host:port" endpoint without a scheme
+// or path, as expected by the MinIO client
+func validateEndpoint(endpoint string) error {
+	if strings.Contains(endpoint, "://") {
+		return fmt.Errorf("%q must not include a scheme, use S3_USE_SSL instead", endpoint)
+	}
+	if strings.ContainsAny(endpoint, "/ ") {
+		return fmt.Errorf("%q must be a host or host:port", endpoint)
+	}
+
+	host := endpoint
+	if strings.Contains(endpoint, ":") {
+		var port string
+		var err error
+		host, port, err = net.SplitHostPort(endpoint)
+		if err != nil {
+			return fmt.Errorf("%q must be a host or host:port", endpoint)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("%q has an invalid port", endpoint)
+		}
+	}
+	if host == "" {
+		return fmt.Errorf("%q has no host", endpoint)
+	}
+	return nil
+}
+
+// defaultBackend names the backend configured by S3_ENDPOINT; it can be used
+// in BUCKET_BACKENDS but not redefined in S3_BACKENDS
+const defaultBackend = "default"
+
+func parseBackends(entries []string) (map[string]*StorageConfig, error) {
+	defaults := GetStorageConfig()
+	backends := make(map[string]*StorageConfig, len(entries))
+	for _, entry := range entries {
+		name, endpoint, _ := strings.Cut(entry, "=")
+		name, endpoint = strings.TrimSpace(name), strings.TrimSpace(endpoint)
+		if name == "" || endpoint == "" {
+			return nil, fmt.Errorf("invalid backend %q, expected name=endpoint", entry)
+		}
+		if name == defaultBackend {
+			return nil, fmt.Errorf("backend name %q is reserved for S3_ENDPOINT", name)
+		}
+		prefix := backendEnvPrefix(name)
+		backends[name] = &StorageConfig{
+			Endpoint:        endpoint,
+			AccessKeyID:     getEnv(prefix+"ACCESS_KEY", defaults.AccessKeyID),
+			SecretAccessKey: getEnv(prefix+"SECRET_KEY", defaults.SecretAccessKey),
+			UseSSL:          getEnv(prefix+"USE_SSL", strconv.FormatBool(defaults.UseSSL)) == "true",
+			Region:          getEnv(prefix+"REGION", defaults.Region),
+			BucketLookup:    bucketLookup(getEnv(prefix+"BUCKET_LOOKUP", defaults.BucketLookup)),
+			CredsProvider:   defaults.CredsProvider,
+			STSEndpoint:     defaults.STSEndpoint,
+			STSTokenFile:    defaults.STSTokenFile,
+			STSRoleARN:      defaults.STSRoleARN,
+		}
+	}
+	return backends, nil
+}
+
+// backendEnvPrefix returns the prefix of the variables configuring the named
+// backend, such as S3_BACKEND_ARCHIVE_
+func backendEnvPrefix(name string) string {
+	return "S3_BACKEND_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+}
+
+func parseBucketBackends(entries []string) (map[string]string, error) {
+	routes := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		bucket, name, _ := strings.Cut(entry, ":")
+		bucket, name = strings.TrimSpace(bucket), strings.TrimSpace(name)
+		if bucket == "" || name == "" {
+			return nil, fmt.Errorf("invalid route %q, expected bucket:backend", entry)
+		}
+		routes[bucket] = name
+	}
+	return routes, nil
+}
+
+func parseAPIKeyTenants(entries []string) (map[string]string, error) {
+	tenants := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		key, tenant, _ := strings.Cut(entry, ":")
+		key, tenant = strings.TrimSpace(key), strings.TrimSpace(tenant)
+		if key == "" || tenant == "" {
+			return nil, fmt.Errorf("invalid tenant %q, expected key:tenant", entry)
+		}
+		if !ValidTenant(tenant) {
+			return nil, fmt.Errorf("invalid tenant name %q: use at most %d letters, digits, dots, hyphens and underscores", tenant, maxTenantLength)
+		}
+		tenants[key] = tenant
+	}
+	return tenants, nil
+}
+
+// maxTenantLength bounds tenant names, which become the first segment of
+// every object key the tenant stores
+const maxTenantLength = 63
+
+// ValidTenant accepts letters, digits, dots, hyphens and underscores, so a
+// tenant is always exactly one key segment
+func ValidTenant(tenant string) bool {
+	if tenant == "" || len(tenant) > maxTenantLength || tenant == "." || tenant == ".." {
+		return false
+	}
+	for i := 0; i < len(tenant); i++ {
+		c := tenant[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func parseContentTypes(entries []string) (map[string]string, error) {
+	types := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		ext, contentType, _ := strings.Cut(entry, ":")
+		ext, contentType = strings.ToLower(strings.TrimSpace(ext)), strings.TrimSpace(contentType)
+		if ext == "" || contentType == "" {
+			return nil, fmt.Errorf("invalid content type %q, expected .ext:type", entry)
+		}
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return nil, fmt.Errorf("invalid content type %q for %s: %w", contentType, ext, err)
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		types[ext] = contentType
+	}
+	return types, nil
+}
+
+func parseAPIKeys(value string) (map[string][]string, error) {
+	keys := make(map[string][]string)
+	for _, entry := range strings.Split(value, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		key, scope, scoped := strings.Cut(entry, ":")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, errors.New("API key cannot be empty")
+		}
+		var buckets []string
+		if scoped {
+			for _, bucket := range strings.Split(scope, "|") {
+				if bucket = strings.TrimSpace(bucket); bucket != "" {
+					buckets = append(buckets, bucket)
+				}
+			}
+			if len(buckets) == 0 {
+				return nil, errors.New("API key scope cannot be empty")
+			}
+		}
+		keys[key] = buckets
+	}
+	return keys, nil
+}
+
 func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+	if value := lookupEnv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
 
+// parseBucketAccess parses "bucket:access" pairs. It checks every pair and
+// returns a *PolicyError for each invalid or duplicate one, joined.
 func parseBucketAccess(policy string) (map[string]string, error) {
 	bucketAccessMap := make(map[string]string)
-	policyPairs := strings.Split(policy, ",")
-	for _, policyPair := range policyPairs {
+	positions := make(map[string]int)
+	var errs []error
+	for i, policyPair := range strings.Split(policy, ",") {
+		invalid := func(format string, args ...any) {
+			errs = append(errs, &PolicyError{Position: i + 1, Pair: policyPair, Message: fmt.Sprintf(format, args...)})
+		}
 		parts := strings.Split(policyPair, ":")
 		if len(parts) != 2 {
-			return nil, errors.New("invalid bucket access policy format")
+			invalid("expected bucket:access")
+			continue
 		}
 		bucket := strings.TrimSpace(parts[0])
 		access := strings.TrimSpace(parts[1])
-		if bucket == "" || access == "" {
-			return nil, errors.New("bucket name or access level cannot be empty")
+		switch {
+		case bucket == "":
+			invalid("bucket name cannot be empty")
+		case access == "":
+			invalid("access level cannot be empty")
+		case !accessLevels[access]:
+			invalid("unknown access level %q, expected read, write or all", access)
+		case positions[bucket] != 0:
+			invalid("bucket %q already listed in pair %d", bucket, positions[bucket])
+		default:
+			positions[bucket] = i + 1
+			bucketAccessMap[bucket] = access
 		}
-		bucketAccessMap[bucket] = access
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
 	}
 	return bucketAccessMap, nil
 }
 
 func GetEnvWithDefaultInt(key string, defaultValue int64) int64 {
-	if sizeStr := os.Getenv(key); sizeStr != "" {
-		if size, err := strconv.ParseInt(sizeStr, 10, 64); err == nil {
-			return size * 1024 * 1024
+	if valueStr := lookupEnv(key); valueStr != "" {
+		if value, err := strconv.ParseInt(valueStr, 10, 64); err == nil {
+			return value
+		}
+		log.Printf("Invalid integer value for %s: %q, using default %d", key, valueStr, defaultValue)
+	}
+	return defaultValue
+}
+
+// GetEnvWithDefaultBool reads a boolean such as "true" or "0" from the environment
+func GetEnvWithDefaultBool(key string, defaultValue bool) bool {
+	if valueStr := lookupEnv(key); valueStr != "" {
+		if value, err := strconv.ParseBool(valueStr); err == nil {
+			return value
 		}
+		log.Printf("Invalid boolean value for %s: %q, using default %t", key, valueStr, defaultValue)
+	}
+	return defaultValue
+}
+
+// GetEnvWithDefaultDuration reads a Go duration such as "10s" or "5m" from the environment
+func GetEnvWithDefaultDuration(key string, defaultValue time.Duration) time.Duration {
+	if valueStr := lookupEnv(key); valueStr != "" {
+		if value, err := time.ParseDuration(valueStr); err == nil {
+			return value
+		}
+		log.Printf("Invalid duration value for %s: %q, using default %s", key, valueStr, defaultValue)
+	}
+	return defaultValue
+}
+
+// GetEnvWithDefaultList reads a comma-separated list from the environment,
+// trimming whitespace and dropping empty items
+func GetEnvWithDefaultList(key string, defaultValue []string) []string {
+	var items []string
+	for _, item := range strings.Split(lookupEnv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return defaultValue
+	}
+	return items
+}
+
+// GetEnvWithDefaultSize reads a byte size from the environment. Plain numbers
+// are interpreted as megabytes, and KB/MB/GB suffixes are also accepted.
+// defaultValue is given in megabytes.
+func GetEnvWithDefaultSize(key string, defaultValue int64) int64 {
+	if sizeStr := lookupEnv(key); sizeStr != "" {
+		if size, err := ParseSize(sizeStr); err == nil {
+			return size
+		}
+		log.Printf("Invalid size value for %s: %q, using default %dMB", key, sizeStr, defaultValue)
+	}
+	return defaultValue * megabyte
+}
+
+// GetEnvWithDefaultOptionalSize is GetEnvWithDefaultSize for settings that 0
+// turns off, so it also accepts a size of 0
+func GetEnvWithDefaultOptionalSize(key string, defaultValue int64) int64 {
+	if sizeStr := lookupEnv(key); sizeStr != "" {
+		if size, err := ParseSize(sizeStr); err == nil {
+			return size
+		}
+		if size, err := strconv.ParseInt(strings.TrimSpace(sizeStr), 10, 64); err == nil && size == 0 {
+			return 0
+		}
+		log.Printf("Invalid size value for %s: %q, using default %dMB", key, sizeStr, defaultValue)
+	}
+	return defaultValue * megabyte
+}
+
+const (
+	kilobyte int64 = 1024
+	megabyte       = 1024 * kilobyte
+	gigabyte       = 1024 * megabyte
+)
+
+// ParseSize converts a human readable size such as "300", "256MB" or "1GB"
+// into bytes. Values without a unit are treated as megabytes.
+func ParseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := megabyte
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"GB", gigabyte},
+		{"MB", megabyte},
+		{"KB", kilobyte},
+		{"G", gigabyte},
+		{"M", megabyte},
+		{"K", kilobyte},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	size, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", value, err)
+	}
+	if size <= 0 {
+		return 0, fmt.Errorf("invalid size %q: must be positive", value)
 	}
-	return defaultValue * 1024 * 1024
+	return size * multiplier, nil
 }
@@ -0,0 +1,508 @@
+package config
+
+import (
+	"errors"
+	"log/slog"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{"300", 300 * megabyte, false},
+		{"256MB", 256 * megabyte, false},
+		{"1GB", gigabyte, false},
+		{"1gb", gigabyte, false},
+		{"512K", 512 * kilobyte, false},
+		{"100B", 100, false},
+		{" 64 MB ", 64 * megabyte, false},
+		{"lots", 0, true},
+		{"1TB", 0, true},
+		{"0", 0, true},
+		{"-5MB", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSize(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestGetEnvWithDefaultSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"", 300 * megabyte},
+		{"300", 300 * megabyte},
+		{"256MB", 256 * megabyte},
+		{"1GB", gigabyte},
+		{"three hundred", 300 * megabyte},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_SIZE", tt.value)
+		if got := GetEnvWithDefaultSize("TEST_SIZE", 300); got != tt.want {
+			t.Errorf("GetEnvWithDefaultSize(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestGetEnvWithDefaultList(t *testing.T) {
+	defaults := []string{"text/", "application/json"}
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", defaults},
+		{" , ", defaults},
+		{"application/wasm", []string{"application/wasm"}},
+		{"application/wasm, application/vnd.,", []string{"application/wasm", "application/vnd."}},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_LIST", tt.value)
+		if got := GetEnvWithDefaultList("TEST_LIST", defaults); !slices.Equal(got, tt.want) {
+			t.Errorf("GetEnvWithDefaultList(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestGetEnvWithDefaultOptionalSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"", 4 * megabyte},
+		{"0", 0},
+		{" 0 ", 0},
+		{"2", 2 * megabyte},
+		{"512KB", 512 * kilobyte},
+		{"-1", 4 * megabyte},
+		{"lots", 4 * megabyte},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_OPTIONAL_SIZE", tt.value)
+		if got := GetEnvWithDefaultOptionalSize("TEST_OPTIONAL_SIZE", 4); got != tt.want {
+			t.Errorf("GetEnvWithDefaultOptionalSize(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestGetEnvWithDefaultSizeRejectsZero(t *testing.T) {
+	t.Setenv("TEST_SIZE", "0")
+	if got := GetEnvWithDefaultSize("TEST_SIZE", 4); got != 4*megabyte {
+		t.Errorf("GetEnvWithDefaultSize(\"0\") = %d, want the default", got)
+	}
+}
+
+func TestParseAPIKeyTenants(t *testing.T) {
+	tenants, err := parseAPIKeyTenants([]string{"k1:acme", " k2 : globex.eu "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenants["k1"] != "acme" || tenants["k2"] != "globex.eu" {
+		t.Errorf("tenants = %v", tenants)
+	}
+
+	for _, entry := range []string{"k1", "k1:", ":acme", "k1:acme/photos", "k1:..", "k1:" + strings.Repeat("a", maxTenantLength+1)} {
+		if _, err := parseAPIKeyTenants([]string{entry}); err == nil {
+			t.Errorf("parseAPIKeyTenants(%q) accepted an invalid tenant", entry)
+		}
+	}
+}
+
+func TestValidateReportsInvalidTenants(t *testing.T) {
+	t.Setenv("API_KEY_TENANTS", "k1:acme,k2:../other")
+	err := Validate()
+	if err == nil || !strings.Contains(err.Error(), "API_KEY_TENANTS") {
+		t.Fatalf("Validate() = %v, want an API_KEY_TENANTS error", err)
+	}
+	if tenants := GetAPIKeyTenants(); tenants != nil {
+		t.Errorf("GetAPIKeyTenants() = %v, want nil for an invalid setting", tenants)
+	}
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := parseAPIKeys(" admin , photos:photos| thumbs ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys["admin"] != nil || !slices.Equal(keys["photos"], []string{"photos", "thumbs"}) {
+		t.Errorf("keys = %q", keys)
+	}
+
+	for _, value := range []string{":photos", "k1:", "k1:|"} {
+		if _, err := parseAPIKeys(value); err == nil {
+			t.Errorf("parseAPIKeys(%q) accepted an invalid key", value)
+		}
+	}
+}
+
+func TestValidateReportsInvalidAPIKeys(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("API_KEYS", "admin,photos:")
+	err := Validate()
+	if err == nil || !strings.Contains(err.Error(), "API_KEYS") {
+		t.Fatalf("Validate() = %v, want an API_KEYS error", err)
+	}
+	if keys := GetAPIKeys(); keys != nil {
+		t.Errorf("GetAPIKeys() = %v, want nil for an invalid setting", keys)
+	}
+}
+
+func TestValidateReportsNonPositiveOpTimeout(t *testing.T) {
+	for _, value := range []string{"0", "0s", "-5s"} {
+		t.Run(value, func(t *testing.T) {
+			setValidEnv(t)
+			t.Setenv("S3_OP_TIMEOUT", value)
+			if err := Validate(); err == nil || !strings.Contains(err.Error(), "S3_OP_TIMEOUT") {
+				t.Errorf("Validate() = %v, want an S3_OP_TIMEOUT error", err)
+			}
+		})
+	}
+}
+
+func TestGetBucketCacheTTLs(t *testing.T) {
+	t.Setenv("BUCKET_CACHE_TTL", "artifacts:1h, config : 10s,broken,:5m,negative:-1s,typo:1x")
+	want := map[string]time.Duration{"artifacts": time.Hour, "config": 10 * time.Second}
+	if got := GetBucketCacheTTLs(); !maps.Equal(got, want) {
+		t.Errorf("GetBucketCacheTTLs() = %v, want %v", got, want)
+	}
+}
+
+// setValidEnv sets a complete production configuration
+func setValidEnv(t *testing.T) {
+	t.Helper()
+	for key, value := range map[string]string{
+		"S3_ENDPOINT":     "minio.internal:9000",
+		"S3_ACCESS_KEY":   "access",
+		"S3_SECRET_KEY":   "secret",
+		"DEV_MODE":        "false",
+		"ALLOWED_BUCKETS": "public:read,uploads:write,private:all",
+	} {
+		t.Setenv(key, value)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	setValidEnv(t)
+	if err := Validate(); err != nil {
+		t.Fatalf("Validate() = %v for a valid configuration", err)
+	}
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		wantErrs []string
+	}{
+		{"endpoint with scheme", map[string]string{"S3_ENDPOINT": "http://minio:9000"}, []string{"S3_ENDPOINT"}},
+		{"endpoint with bad port", map[string]string{"S3_ENDPOINT": "minio:99999"}, []string{"S3_ENDPOINT"}},
+		{"missing credentials", map[string]string{"S3_ACCESS_KEY": "", "S3_SECRET_KEY": ""}, []string{"S3_ACCESS_KEY", "S3_SECRET_KEY"}},
+		{"unknown access", map[string]string{"ALLOWED_BUCKETS": "public:readonly"}, []string{"ALLOWED_BUCKETS"}},
+		{"malformed policy", map[string]string{"ALLOWED_BUCKETS": "public"}, []string{"ALLOWED_BUCKETS"}},
+		{"every problem at once", map[string]string{"S3_ENDPOINT": "minio/path", "S3_SECRET_KEY": "", "ALLOWED_BUCKETS": "public:none", "LOG_LEVEL": "loud"}, []string{"S3_ENDPOINT", "S3_SECRET_KEY", "ALLOWED_BUCKETS", "LOG_LEVEL"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setValidEnv(t)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			err := Validate()
+			if err == nil {
+				t.Fatal("Validate() = nil, want an error")
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() = %v, want it to mention %s", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateAllowsMissingCredentialsInDevMode(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("S3_ACCESS_KEY", "")
+	t.Setenv("S3_SECRET_KEY", "")
+	t.Setenv("DEV_MODE", "true")
+	if err := Validate(); err != nil {
+		t.Errorf("Validate() = %v in dev mode without credentials", err)
+	}
+}
+
+func TestGetBackendConfigs(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("S3_BACKENDS", "archive=archive.internal:9000, eu = eu.internal:9000")
+	t.Setenv("S3_BACKEND_ARCHIVE_ACCESS_KEY", "archive-access")
+	t.Setenv("BUCKET_BACKENDS", "old-logs:archive,photos-eu:eu")
+
+	backends := GetBackendConfigs()
+	if archive := backends["archive"]; archive == nil || archive.Endpoint != "archive.internal:9000" || archive.AccessKeyID != "archive-access" || archive.SecretAccessKey != "secret" {
+		t.Errorf("archive backend = %+v, want its own access key and the default secret", archive)
+	}
+	if eu := backends["eu"]; eu == nil || eu.Endpoint != "eu.internal:9000" || eu.AccessKeyID != "access" {
+		t.Errorf("eu backend = %+v, want the default credentials", eu)
+	}
+	if routes := GetBucketBackends(); !maps.Equal(routes, map[string]string{"old-logs": "archive", "photos-eu": "eu"}) {
+		t.Errorf("routes = %v", routes)
+	}
+	if err := Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	t.Setenv("BUCKET_BACKENDS", "old-logs:missing")
+	if err := Validate(); err == nil || !strings.Contains(err.Error(), "unknown backend missing") {
+		t.Errorf("Validate() = %v, want an unknown backend error", err)
+	}
+	t.Setenv("S3_BACKENDS", "default=other:9000")
+	if err := Validate(); err == nil || !strings.Contains(err.Error(), "S3_BACKENDS") {
+		t.Errorf("Validate() = %v, want the reserved default name rejected", err)
+	}
+}
+
+func TestValidateReportsInvalidBackends(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("S3_BACKENDS", "archive")
+	t.Setenv("BUCKET_BACKENDS", "old-logs")
+	err := Validate()
+	if err == nil || !strings.Contains(err.Error(), "S3_BACKENDS") || !strings.Contains(err.Error(), "BUCKET_BACKENDS") {
+		t.Fatalf("Validate() = %v, want S3_BACKENDS and BUCKET_BACKENDS errors", err)
+	}
+	if backends := GetBackendConfigs(); backends != nil {
+		t.Errorf("GetBackendConfigs() = %v, want nil for an invalid setting", backends)
+	}
+	if routes := GetBucketBackends(); routes != nil {
+		t.Errorf("GetBucketBackends() = %v, want nil for an invalid setting", routes)
+	}
+}
+
+func TestGetServerConfig(t *testing.T) {
+	for _, key := range []string{"SERVER_READ_HEADER_TIMEOUT", "SERVER_READ_TIMEOUT", "SERVER_WRITE_TIMEOUT", "SERVER_IDLE_TIMEOUT"} {
+		t.Setenv(key, "")
+	}
+	defaults := GetServerConfig()
+	if defaults.ReadHeaderTimeout != 10*time.Second || defaults.IdleTimeout != 2*time.Minute {
+		t.Errorf("defaults = %+v, want 10s header and 2m idle timeouts", defaults)
+	}
+	// Streaming uploads and downloads must not be cut off by default
+	if defaults.ReadTimeout != 0 || defaults.WriteTimeout != 0 {
+		t.Errorf("defaults = %+v, want read and write timeouts disabled", defaults)
+	}
+
+	t.Setenv("SERVER_READ_HEADER_TIMEOUT", "2s")
+	t.Setenv("SERVER_WRITE_TIMEOUT", "10m")
+	if got := GetServerConfig(); got.ReadHeaderTimeout != 2*time.Second || got.WriteTimeout != 10*time.Minute {
+		t.Errorf("GetServerConfig() = %+v, want the configured timeouts", got)
+	}
+}
+
+func TestGetBucketMaxCacheableSizes(t *testing.T) {
+	t.Setenv("BUCKET_MAX_CACHEABLE_SIZE", "videos:5MB, thumbnails:50MB,broken,images:lots")
+	want := map[string]int64{"videos": 5 * megabyte, "thumbnails": 50 * megabyte}
+	if got := GetBucketMaxCacheableSizes(); !maps.Equal(got, want) {
+		t.Errorf("GetBucketMaxCacheableSizes() = %v, want %v", got, want)
+	}
+}
+
+func TestGetLoggingConfig(t *testing.T) {
+	tests := []struct {
+		level, format string
+		want          LoggingConfig
+		wantErrs      []string
+	}{
+		{"", "", LoggingConfig{slog.LevelInfo, LogFormatJSON}, nil},
+		{"debug", "text", LoggingConfig{slog.LevelDebug, LogFormatText}, nil},
+		{" WARN ", "JSON", LoggingConfig{slog.LevelWarn, LogFormatJSON}, nil},
+		{"error", "json", LoggingConfig{slog.LevelError, LogFormatJSON}, nil},
+		{"loud", "xml", LoggingConfig{slog.LevelInfo, LogFormatJSON}, []string{"LOG_LEVEL", "LOG_FORMAT"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level+"/"+tt.format, func(t *testing.T) {
+			setValidEnv(t)
+			t.Setenv("LOG_LEVEL", tt.level)
+			t.Setenv("LOG_FORMAT", tt.format)
+			if got := GetLoggingConfig(); *got != tt.want {
+				t.Errorf("GetLoggingConfig() = %+v, want %+v", *got, tt.want)
+			}
+			err := Validate()
+			if len(tt.wantErrs) == 0 && err != nil {
+				t.Errorf("Validate() = %v, want nil", err)
+			}
+			for _, name := range tt.wantErrs {
+				if err == nil || !strings.Contains(err.Error(), name) {
+					t.Errorf("Validate() = %v, want an error naming %s", err, name)
+				}
+			}
+		})
+	}
+}
+
+func TestGetStorageConfigAddressing(t *testing.T) {
+	tests := []struct {
+		region, lookup string
+		wantLookup     string
+		wantErr        bool
+	}{
+		{"", "", BucketLookupAuto, false},
+		{"us-east-1", "path", BucketLookupPath, false},
+		{"eu-west-3", " DNS ", BucketLookupDNS, false},
+		{"", "virtual", BucketLookupAuto, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lookup, func(t *testing.T) {
+			setValidEnv(t)
+			t.Setenv("S3_REGION", tt.region)
+			t.Setenv("S3_BUCKET_LOOKUP", tt.lookup)
+			cfg := GetStorageConfig()
+			if cfg.Region != tt.region || cfg.BucketLookup != tt.wantLookup {
+				t.Errorf("region %q, lookup %q, want %q, %q", cfg.Region, cfg.BucketLookup, tt.region, tt.wantLookup)
+			}
+			err := Validate()
+			if gotErr := err != nil && strings.Contains(err.Error(), "S3_BUCKET_LOOKUP"); gotErr != tt.wantErr {
+				t.Errorf("Validate() = %v, want an S3_BUCKET_LOOKUP error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCredsProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		wantErrs []string
+	}{
+		{"iam needs no keys", map[string]string{"S3_CREDS_PROVIDER": "iam", "S3_ACCESS_KEY": "", "S3_SECRET_KEY": ""}, nil},
+		{"env needs no keys", map[string]string{"S3_CREDS_PROVIDER": "ENV", "S3_ACCESS_KEY": ""}, nil},
+		{"static needs keys", map[string]string{"S3_CREDS_PROVIDER": "static", "S3_SECRET_KEY": ""}, []string{"S3_SECRET_KEY"}},
+		{"sts needs endpoint and token", map[string]string{"S3_CREDS_PROVIDER": "sts"}, []string{"S3_STS_ENDPOINT", "S3_STS_TOKEN_FILE"}},
+		{"sts", map[string]string{"S3_CREDS_PROVIDER": "sts", "S3_STS_ENDPOINT": "https://sts.example.com", "S3_STS_TOKEN_FILE": "/var/run/token"}, nil},
+		{"unknown provider", map[string]string{"S3_CREDS_PROVIDER": "kerberos"}, []string{"S3_CREDS_PROVIDER"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setValidEnv(t)
+			t.Setenv("S3_STS_ENDPOINT", "")
+			t.Setenv("S3_STS_TOKEN_FILE", "")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			err := Validate()
+			if len(tt.wantErrs) == 0 && err != nil {
+				t.Errorf("Validate() = %v, want nil", err)
+			}
+			for _, name := range tt.wantErrs {
+				if err == nil || !strings.Contains(err.Error(), name) {
+					t.Errorf("Validate() = %v, want an error naming %s", err, name)
+				}
+			}
+		})
+	}
+}
+
+func TestParseBucketAccess(t *testing.T) {
+	got, err := parseBucketAccess(" public:read, uploads:write ,private:all")
+	want := map[string]string{"public": "read", "uploads": "write", "private": "all"}
+	if err != nil || !maps.Equal(got, want) {
+		t.Errorf("good policy: %v, %v, want %v", got, err, want)
+	}
+
+	tests := []struct {
+		name   string
+		policy string
+		want   []PolicyError
+	}{
+		{"duplicate", "a:read,b:write,a:all", []PolicyError{{Position: 3, Pair: "a:all", Message: `bucket "a" already listed in pair 1`}}},
+		{"unknown access", "a:read,b:admin", []PolicyError{{Position: 2, Pair: "b:admin", Message: `unknown access level "admin", expected read, write or all`}}},
+		{"missing separator", "a", []PolicyError{{Position: 1, Pair: "a", Message: "expected bucket:access"}}},
+		{"empty parts", ":read,b:", []PolicyError{
+			{Position: 1, Pair: ":read", Message: "bucket name cannot be empty"},
+			{Position: 2, Pair: "b:", Message: "access level cannot be empty"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			access, err := parseBucketAccess(tt.policy)
+			if access != nil {
+				t.Errorf("access = %v, want nil on error", access)
+			}
+			var got []PolicyError
+			for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+				var policyErr *PolicyError
+				if !errors.As(err, &policyErr) {
+					t.Fatalf("error %v is not a *PolicyError", err)
+				}
+				got = append(got, *policyErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("errors = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAllowedBucketsWithInvalidPolicy(t *testing.T) {
+	t.Setenv("ALLOWED_BUCKETS", "a:read,a:write")
+	// An invalid policy grants nothing instead of exiting; Validate reports it
+	if got := GetAllowedBuckets().AllowedBuckets; len(got) != 0 {
+		t.Errorf("AllowedBuckets = %v, want none", got)
+	}
+}
+
+func TestGetBucketIndexDocuments(t *testing.T) {
+	t.Setenv("BUCKET_INDEX_DOCUMENT", "site:index.html, docs : default.htm,broken,empty:,abs:/index.html")
+	want := map[string]string{"site": "index.html", "docs": "default.htm"}
+	if got := GetBucketIndexDocuments(); !maps.Equal(got, want) {
+		t.Errorf("GetBucketIndexDocuments() = %v, want %v", got, want)
+	}
+	t.Setenv("BUCKET_INDEX_DOCUMENT", "")
+	if got := GetBucketIndexDocuments(); len(got) != 0 {
+		t.Errorf("GetBucketIndexDocuments() = %v by default, want none", got)
+	}
+}
+
+func TestGetNoCompressionBuckets(t *testing.T) {
+	t.Setenv("BUCKET_NO_COMPRESSION", "lan, internal-assets")
+	want := map[string]bool{"lan": true, "internal-assets": true}
+	if got := GetNoCompressionBuckets(); !maps.Equal(got, want) {
+		t.Errorf("GetNoCompressionBuckets() = %v, want %v", got, want)
+	}
+	t.Setenv("BUCKET_NO_COMPRESSION", "")
+	if got := GetNoCompressionBuckets(); len(got) != 0 {
+		t.Errorf("GetNoCompressionBuckets() = %v by default, want none", got)
+	}
+}
+
+func TestGetBucketAllowedIPs(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("BUCKET_ALLOWED_IPS", "private:10.0.0.0/8 | 192.168.1.7,internal:2001:db8::/32")
+	want := map[string][]string{"private": {"10.0.0.0/8", "192.168.1.7"}, "internal": {"2001:db8::/32"}}
+	if got := GetBucketAllowedIPs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetBucketAllowedIPs() = %v, want %v", got, want)
+	}
+	if err := Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	for _, invalid := range []string{"private", "private:", ":10.0.0.0/8", "private:10.1", "private:10.0.0.0/33"} {
+		t.Setenv("BUCKET_ALLOWED_IPS", invalid)
+		if err := Validate(); err == nil || !strings.Contains(err.Error(), "BUCKET_ALLOWED_IPS") {
+			t.Errorf("Validate() with BUCKET_ALLOWED_IPS=%q = %v, want an error", invalid, err)
+		}
+		if got := GetBucketAllowedIPs(); len(got) != 0 {
+			t.Errorf("GetBucketAllowedIPs() = %v for %q, want none", got, invalid)
+		}
+	}
+}
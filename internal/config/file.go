@@ -0,0 +1,143 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileConfig is the document read from CONFIG_FILE, in YAML or JSON. Storage,
+// bucket policies and bucket cache TTLs have their own sections; Env sets any
+// other variable by name. Environment variables override every file value.
+//
+//	storage:
+//	  endpoint: minio:9000
+//	  access_key: estrois
+//	  secret_key: secret
+//	  use_ssl: true
+//	  region: eu-west-1
+//	buckets:
+//	  public: read
+//	  uploads: write
+//	bucket_cache_ttl:
+//	  public: 1h
+//	bucket_max_cacheable_size:
+//	  public: 5MB
+//	env:
+//	  MAX_CACHE_SIZE: 512MB
+type FileConfig struct {
+	Storage struct {
+		Endpoint     string `yaml:"endpoint"`
+		AccessKey    string `yaml:"access_key"`
+		SecretKey    string `yaml:"secret_key"`
+		UseSSL       *bool  `yaml:"use_ssl"`
+		Region       string `yaml:"region"`
+		BucketLookup string `yaml:"bucket_lookup"`
+	} `yaml:"storage"`
+	Buckets                map[string]string `yaml:"buckets"`
+	BucketCacheTTL         map[string]string `yaml:"bucket_cache_ttl"`
+	BucketMaxCacheableSize map[string]string `yaml:"bucket_max_cacheable_size"`
+	Env                    map[string]string `yaml:"env"`
+}
+
+// fileValues holds the settings loaded from CONFIG_FILE keyed by environment
+// variable name
+var fileValues map[string]string
+
+// fileErr records a CONFIG_FILE that could not be loaded, reported by Validate
+var fileErr error
+
+func init() {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if _, err := LoadFromFile(path); err != nil {
+			log.Printf("Error loading CONFIG_FILE %s: %v", path, err)
+			fileErr = fmt.Errorf("CONFIG_FILE: %w", err)
+		}
+	}
+}
+
+// LoadFromFile reads a YAML or JSON configuration file and makes its values
+// the defaults behind environment variables. It returns the resulting storage
+// configuration, including bucket policies.
+func LoadFromFile(path string) (*StorageConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON documents are valid YAML, so one decoder handles both
+	var file FileConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	fileValues = file.values()
+
+	storageConfig := GetStorageConfig()
+	storageConfig.AllowedBuckets, err = parseBucketAccess(getEnv("ALLOWED_BUCKETS", defaultAllowedBuckets))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bucket policies: %w", err)
+	}
+	return storageConfig, nil
+}
+
+// values flattens the file into environment variable names and values
+func (f *FileConfig) values() map[string]string {
+	values := make(map[string]string, len(f.Env)+6)
+	for key, value := range f.Env {
+		values[key] = value
+	}
+
+	for key, value := range map[string]string{
+		"S3_ENDPOINT":      f.Storage.Endpoint,
+		"S3_ACCESS_KEY":    f.Storage.AccessKey,
+		"S3_SECRET_KEY":    f.Storage.SecretKey,
+		"S3_REGION":        f.Storage.Region,
+		"S3_BUCKET_LOOKUP": f.Storage.BucketLookup,
+	} {
+		if value != "" {
+			values[key] = value
+		}
+	}
+	if f.Storage.UseSSL != nil {
+		values["S3_USE_SSL"] = strconv.FormatBool(*f.Storage.UseSSL)
+	}
+	if len(f.Buckets) > 0 {
+		values["ALLOWED_BUCKETS"] = joinPairs(f.Buckets)
+	}
+	if len(f.BucketCacheTTL) > 0 {
+		values["BUCKET_CACHE_TTL"] = joinPairs(f.BucketCacheTTL)
+	}
+	if len(f.BucketMaxCacheableSize) > 0 {
+		values["BUCKET_MAX_CACHEABLE_SIZE"] = joinPairs(f.BucketMaxCacheableSize)
+	}
+	return values
+}
+
+// joinPairs renders a map in the "key:value,key:value" form used by the
+// environment variables, sorted for stable output
+func joinPairs(m map[string]string) string {
+	pairs := make([]string, 0, len(m))
+	for key, value := range m {
+		pairs = append(pairs, key+":"+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// lookupEnv returns the environment variable key, falling back to the value
+// loaded from CONFIG_FILE
+func lookupEnv(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fileValues[key]
+}
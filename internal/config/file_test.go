@@ -0,0 +1,112 @@
+package config
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const sampleYAML = `
+storage:
+  endpoint: minio.internal:9000
+  access_key: file-access
+  secret_key: file-secret
+  use_ssl: true
+  region: eu-west-1
+buckets:
+  public: read
+  uploads: write
+bucket_cache_ttl:
+  public: 1h
+env:
+  LOG_LEVEL: debug
+`
+
+const sampleJSON = `{
+  "storage": {"endpoint": "minio.internal:9000", "access_key": "file-access", "secret_key": "file-secret", "use_ssl": true, "region": "eu-west-1"},
+  "buckets": {"public": "read", "uploads": "write"},
+  "bucket_cache_ttl": {"public": "1h"},
+  "env": {"LOG_LEVEL": "debug"}
+}`
+
+// loadTestFile writes content to a temporary file, loads it and forgets the
+// loaded values when the test ends
+func loadTestFile(t *testing.T, name, content string) (*StorageConfig, error) {
+	t.Helper()
+	for _, key := range []string{"S3_ENDPOINT", "S3_ACCESS_KEY", "S3_SECRET_KEY", "S3_USE_SSL", "S3_REGION", "ALLOWED_BUCKETS", "BUCKET_CACHE_TTL", "LOG_LEVEL"} {
+		t.Setenv(key, "")
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fileValues = nil })
+	return LoadFromFile(path)
+}
+
+func TestLoadFromFile(t *testing.T) {
+	for name, content := range map[string]string{"config.yaml": sampleYAML, "config.json": sampleJSON} {
+		t.Run(name, func(t *testing.T) {
+			storage, err := loadTestFile(t, name, content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if storage.Endpoint != "minio.internal:9000" || storage.AccessKeyID != "file-access" || storage.SecretAccessKey != "file-secret" || !storage.UseSSL || storage.Region != "eu-west-1" {
+				t.Errorf("storage = %+v, want the file's settings", storage)
+			}
+			if want := map[string]string{"public": "read", "uploads": "write"}; !maps.Equal(storage.AllowedBuckets, want) {
+				t.Errorf("bucket policies = %v, want %v", storage.AllowedBuckets, want)
+			}
+			if ttls := GetBucketCacheTTLs(); ttls["public"] != time.Hour {
+				t.Errorf("bucket cache TTLs = %v, want public:1h", ttls)
+			}
+			if level := lookupEnv("LOG_LEVEL"); level != "debug" {
+				t.Errorf("LOG_LEVEL = %q, want debug from the env section", level)
+			}
+		})
+	}
+}
+
+func TestEnvOverridesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(sampleYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("S3_ENDPOINT", "override:9000")
+	t.Setenv("ALLOWED_BUCKETS", "private:all")
+	t.Setenv("S3_ACCESS_KEY", "")
+	t.Cleanup(func() { fileValues = nil })
+
+	storage, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if storage.Endpoint != "override:9000" {
+		t.Errorf("endpoint = %q, want the environment's", storage.Endpoint)
+	}
+	if want := map[string]string{"private": "all"}; !maps.Equal(storage.AllowedBuckets, want) {
+		t.Errorf("bucket policies = %v, want %v from the environment", storage.AllowedBuckets, want)
+	}
+	if storage.AccessKeyID != "file-access" {
+		t.Errorf("access key = %q, want the file's when the environment has none", storage.AccessKeyID)
+	}
+}
+
+func TestLoadFromFileRejectsInvalidFiles(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown field":  "storage:\n  endpiont: minio:9000\n",
+		"invalid syntax": "storage: [",
+		"invalid policy": "buckets:\n  public: readonly\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadTestFile(t, "config.yaml", content); err == nil {
+				t.Error("LoadFromFile accepted an invalid file")
+			}
+		})
+	}
+	if _, err := LoadFromFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("LoadFromFile accepted a missing file")
+	}
+}
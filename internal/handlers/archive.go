@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/muandane/estrois/internal/middleware"
+	"github.com/muandane/estrois/internal/storage"
+)
+
+// maxArchiveObjects bounds the objects packed into a single archive
+const maxArchiveObjects = 10000
+
+// Archive formats accepted in the format query parameter
+const (
+	archiveFormatZip = "zip"
+	archiveFormatTar = "tar"
+)
+
+var archiveContentTypes = map[string]string{
+	archiveFormatZip: "application/zip",
+	archiveFormatTar: "application/x-tar",
+}
+
+type ArchiveRequest struct{}
+
+// ArchiveHandler returns the handler for GET /archive/{bucket}
+func (h *ObjectHandler) ArchiveHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := h.logger.With(
+			"request_id", middleware.RequestIDFromContext(r.Context()),
+			"method", r.Method,
+			"bucket", r.PathValue("bucket"),
+			"remote_addr", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		)
+		Handle(h.handleArchive, HandlerOptions{Logger: logger})(w, r)
+	}
+}
+
+// handleArchive streams the objects under a prefix as a single zip or tar
+// archive. Objects are listed up front, so a missing bucket or an oversized
+// listing is reported before the response starts, then fetched from storage
+// one at a time while the archive is written.
+func (h *ObjectHandler) handleArchive(ctx context.Context, req *Request, input ArchiveRequest) (*Response, error) {
+	bucket := req.PathParams["bucket"]
+	if err := storage.ValidateBucketName(bucket); err != nil {
+		return nil, &ValidationError{Field: "path", Message: err.Error()}
+	}
+
+	format := strings.ToLower(req.QueryParams["format"])
+	if format == "" {
+		format = archiveFormatZip
+	}
+	contentType, ok := archiveContentTypes[format]
+	if !ok {
+		return nil, &ValidationError{Field: "format", Message: "must be zip or tar"}
+	}
+
+	prefix := req.QueryParams["prefix"]
+	keys, err := h.archiveKeys(ctx, bucket, tenantKey(ctx, prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(h.writeArchive(ctx, writer, format, bucket, keys))
+	}()
+
+	return &Response{
+		StatusCode: http.StatusOK,
+		Headers: http.Header{
+			"Content-Disposition": []string{contentDisposition(archiveName(bucket, prefix) + "." + format)},
+		},
+		Body:        reader,
+		ContentType: contentType,
+		IsStreaming: true,
+	}, nil
+}
+
+// archiveKeys lists the storage keys under prefix, skipping folder markers
+// and keys that are not safe archive entry names
+func (h *ObjectHandler) archiveKeys(ctx context.Context, bucket, prefix string) ([]string, error) {
+	client, err := h.client(bucket)
+	if err != nil {
+		return nil, err
+	}
+	listCtx, cancel := storageContext(ctx)
+	defer cancel()
+
+	var keys []string
+	for obj := range client.ListObjects(listCtx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			if minio.ToErrorResponse(obj.Err).Code == "NoSuchBucket" {
+				return nil, &NotFoundError{Resource: "bucket", ID: bucket}
+			}
+			return nil, obj.Err
+		}
+		if strings.HasSuffix(obj.Key, "/") {
+			continue
+		}
+		// Keys written straight to storage may hold ".." segments or a
+		// leading slash, which would extract outside the client's directory
+		if err := storage.ValidateObjectKey(clientKey(ctx, obj.Key)); err != nil {
+			LoggerFrom(ctx).Warn("object left out of archive", "key", obj.Key, "error", err)
+			continue
+		}
+		if len(keys) == maxArchiveObjects {
+			return nil, &ValidationError{Field: "prefix", Message: fmt.Sprintf("matches more than %d objects", maxArchiveObjects)}
+		}
+		keys = append(keys, obj.Key)
+	}
+	return keys, nil
+}
+
+// writeArchive fetches each object and writes it to w as an archive entry
+// named by its key. Objects deleted since they were listed are left out.
+func (h *ObjectHandler) writeArchive(ctx context.Context, w io.Writer, format, bucket string, keys []string) error {
+	var archive archiveWriter
+	if format == archiveFormatTar {
+		archive = &tarArchive{tar.NewWriter(w)}
+	} else {
+		archive = &zipArchive{zip.NewWriter(w)}
+	}
+
+	written := 0
+	for _, key := range keys {
+		obj, info, err := h.getObject(ctx, bucket, key, "", nil)
+		var notFound *NotFoundError
+		if errors.As(err, &notFound) {
+			LoggerFrom(ctx).Warn("archived object no longer exists", "key", key)
+			continue
+		}
+		if err != nil {
+			LoggerFrom(ctx).Error("archive aborted", "key", key, "error", err)
+			return err
+		}
+		err = archive.add(clientKey(ctx, key), info, obj)
+		obj.Close()
+		if err != nil {
+			LoggerFrom(ctx).Error("archive aborted", "key", key, "error", err)
+			return err
+		}
+		written++
+	}
+
+	LoggerFrom(ctx).Info("archive streamed",
+		"format", format,
+		"objects", written,
+	)
+	return archive.Close()
+}
+
+// archiveName names an archive after the last segment of its prefix, or the
+// bucket when there is none
+func archiveName(bucket, prefix string) string {
+	if name := path.Base(strings.TrimSuffix(prefix, "/")); prefix != "" && name != "." && name != "/" {
+		return name
+	}
+	return bucket
+}
+
+// archiveWriter writes entries in one archive format
+type archiveWriter interface {
+	add(name string, info minio.ObjectInfo, body io.Reader) error
+	Close() error
+}
+
+type zipArchive struct {
+	*zip.Writer
+}
+
+func (a *zipArchive) add(name string, info minio.ObjectInfo, body io.Reader) error {
+	entry, err := a.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: info.LastModified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, body)
+	return err
+}
+
+type tarArchive struct {
+	*tar.Writer
+}
+
+func (a *tarArchive) add(name string, info minio.ObjectInfo, body io.Reader) error {
+	err := a.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     info.Size,
+		Mode:     0o644,
+		ModTime:  info.LastModified,
+		Format:   tar.FormatPAX,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(a.Writer, body)
+	return err
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// readArchive returns the entries of a zip or tar archive by name
+func readArchive(t *testing.T, format string, data []byte) map[string]string {
+	t.Helper()
+	entries := make(map[string]string)
+	if format == archiveFormatTar {
+		r := tar.NewReader(bytes.NewReader(data))
+		for {
+			header, err := r.Next()
+			if err == io.EOF {
+				return entries
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries[header.Name] = string(body)
+		}
+	}
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range r.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[file.Name] = string(body)
+	}
+	return entries
+}
+
+func TestArchive(t *testing.T) {
+	env := newTestEnv(t)
+	env.mux.Handle("GET /archive/{bucket}", env.handler.ArchiveHandler())
+	env.putObject(t, "reports/a.txt", "text/plain", []byte("report a"))
+	env.putObject(t, "reports/2024/b.csv", "text/csv", []byte("x,y\n1,2\n"))
+	env.putObject(t, "reports/empty/", "application/x-directory", nil)
+	env.putObject(t, "other/c.txt", "text/plain", []byte("not in reports"))
+	reports := map[string]string{
+		"reports/a.txt":      "report a",
+		"reports/2024/b.csv": "x,y\n1,2\n",
+	}
+
+	tests := []struct {
+		name            string
+		query           string
+		format          string
+		wantType        string
+		wantDisposition string
+		want            map[string]string
+	}{
+		{"zip by default", "?prefix=reports/", archiveFormatZip, "application/zip", "reports.zip", reports},
+		{"tar", "?prefix=reports/&format=tar", archiveFormatTar, "application/x-tar", "reports.tar", reports},
+		{"whole bucket", "?format=TAR", archiveFormatTar, "application/x-tar", testBucket + ".tar", map[string]string{
+			"reports/a.txt":      "report a",
+			"reports/2024/b.csv": "x,y\n1,2\n",
+			"other/c.txt":        "not in reports",
+		}},
+		{"no matches", "?prefix=missing/", archiveFormatZip, "application/zip", "missing.zip", map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := env.do(http.MethodGet, "/archive/"+testBucket+tt.query, nil, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			if got := w.Header().Get("Content-Disposition"); !strings.HasPrefix(got, "attachment") || !strings.Contains(got, `"`+tt.wantDisposition+`"`) {
+				t.Errorf("Content-Disposition = %q, want an attachment named %s", got, tt.wantDisposition)
+			}
+			if got := readArchive(t, tt.format, w.Body.Bytes()); !maps.Equal(got, tt.want) {
+				t.Errorf("entries = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for query, want := range map[string]int{
+		"/archive/" + testBucket + "?format=rar": http.StatusBadRequest,
+		"/archive/missing-bucket":                http.StatusNotFound,
+	} {
+		if w := env.do(http.MethodGet, query, nil, nil); w.Code != want {
+			t.Errorf("GET %s: status = %d, want %d", query, w.Code, want)
+		}
+	}
+}
+
+func TestArchiveStreamsWhileWriting(t *testing.T) {
+	env := newTestEnv(t)
+	env.mux.Handle("GET /archive/{bucket}", env.handler.ArchiveHandler())
+	large := bytes.Repeat([]byte("streamed "), 1<<17)
+	env.putObject(t, "big/one.bin", "application/octet-stream", large)
+	env.putObject(t, "big/two.bin", "application/octet-stream", large)
+
+	// The response starts before the last object has been fetched
+	reader, writer := io.Pipe()
+	w := &pipeRecorder{ResponseRecorder: httptest.NewRecorder(), body: writer}
+	go func() {
+		env.mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/archive/"+testBucket+"?prefix=big/&format=tar", nil))
+		writer.Close()
+	}()
+	first := make([]byte, 512)
+	if _, err := io.ReadFull(reader, first); err != nil {
+		t.Fatal(err)
+	}
+	if gets := env.objectGets("big/two.bin"); gets != 0 {
+		t.Errorf("second object fetched before the first was streamed")
+	}
+	rest, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := readArchive(t, archiveFormatTar, append(first, rest...))
+	if len(entries) != 2 || entries["big/two.bin"] != string(large) {
+		t.Errorf("archive has %d entries", len(entries))
+	}
+}
+
+// pipeRecorder passes the response body to a pipe as it is written
+type pipeRecorder struct {
+	*httptest.ResponseRecorder
+	body *io.PipeWriter
+}
+
+func (r *pipeRecorder) Write(p []byte) (int, error) {
+	return r.body.Write(p)
+}
+
+func TestArchiveLeavesOutUnsafeNames(t *testing.T) {
+	env := newTestEnv(t)
+	env.mux.Handle("GET /archive/{bucket}", env.handler.ArchiveHandler())
+	env.putObject(t, "site/index.html", "text/html", []byte("safe"))
+	// Written straight to storage, bypassing the handler's key validation
+	for _, key := range []string{"site/../../etc/cron.d/job", "site/./hidden", "/site/absolute"} {
+		env.putObject(t, key, "text/plain", []byte("unsafe"))
+	}
+
+	for _, format := range []string{archiveFormatZip, archiveFormatTar} {
+		w := env.do(http.MethodGet, "/archive/"+testBucket+"?format="+format, nil, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body %s", format, w.Code, w.Body)
+		}
+		want := map[string]string{"site/index.html": "safe"}
+		if got := readArchive(t, format, w.Body.Bytes()); !maps.Equal(got, want) {
+			t.Errorf("%s entries = %v, want %v", format, got, want)
+		}
+	}
+}
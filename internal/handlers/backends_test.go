@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/muandane/estrois/internal/cache"
+	"github.com/muandane/estrois/internal/storage"
+)
+
+// newFakeClient returns a client for a separate in-memory S3 server holding
+// bucket
+func newFakeClient(t *testing.T, bucket string) *minio.Client {
+	t.Helper()
+	server := httptest.NewServer(gofakes3.New(s3mem.New()).Server())
+	t.Cleanup(server.Close)
+	endpoint, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:  credentials.NewStaticV2("key", "secret", ""),
+		Region: "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.MakeBucket(context.Background(), bucket, minio.MakeBucketOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestBucketsRouteToTheirBackends(t *testing.T) {
+	primary := newFakeClient(t, "photos")
+	archive := newFakeClient(t, "old-logs")
+	backends := storage.NewBackends(primary)
+	backends.Add("archive", archive)
+	if err := backends.Route("old-logs", "archive"); err != nil {
+		t.Fatal(err)
+	}
+	handler, err := NewObjectHandler(backends, cache.NewMemoryStore(cache.MaxCacheSize), nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	handler.RegisterRoutes(mux)
+
+	for _, path := range []string{"/objects/photos/cat.jpg", "/objects/old-logs/2019.log"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPut, path, bytes.NewReader([]byte(path))))
+		if w.Code != http.StatusOK {
+			t.Fatalf("PUT %s: status = %d, body %s", path, w.Code, w.Body)
+		}
+	}
+
+	ctx := context.Background()
+	if _, err := primary.StatObject(ctx, "photos", "cat.jpg", minio.StatObjectOptions{}); err != nil {
+		t.Errorf("photos object missing from the default backend: %v", err)
+	}
+	if _, err := archive.StatObject(ctx, "old-logs", "2019.log", minio.StatObjectOptions{}); err != nil {
+		t.Errorf("old-logs object missing from the archive backend: %v", err)
+	}
+	if _, err := primary.StatObject(ctx, "old-logs", "2019.log", minio.StatObjectOptions{}); err == nil {
+		t.Error("old-logs object was written to the default backend")
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/objects/old-logs/2019.log", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "/objects/old-logs/2019.log" {
+		t.Errorf("GET from the archive backend: status = %d, body %q", w.Code, w.Body)
+	}
+}
+
+func TestOpenBreakerFailsFast(t *testing.T) {
+	env := newTestEnv(t)
+	env.putObject(t, "cached.txt", "text/plain", []byte("cached"))
+	env.putObject(t, "uncached.txt", "text/plain", []byte("uncached"))
+	env.do(http.MethodGet, "/objects/"+testBucket+"/cached.txt", nil, nil)
+	env.waitCached(t, "cached.txt")
+
+	backends := storage.NewBackends(env.client)
+	breaker := storage.NewBreaker("handlers-test", 1, time.Hour)
+	backends.SetBreaker(storage.DefaultBackend, breaker)
+	env.handler.clients = backends
+	breaker.Record(true)
+	env.resetRequests()
+
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		if w := env.do(method, "/objects/"+testBucket+"/uncached.txt", bytes.NewReader([]byte("new")), nil); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s with the breaker open: status = %d, want 503", method, w.Code)
+		}
+	}
+	if requests := env.storageRequests(); len(requests) != 0 {
+		t.Errorf("open breaker let requests through to storage: %v", requests)
+	}
+	// Cached objects are still served
+	if w := env.do(http.MethodGet, "/objects/"+testBucket+"/cached.txt", nil, nil); w.Code != http.StatusOK || w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("cached GET with the breaker open: status = %d, X-Cache %q, want a 200 HIT", w.Code, w.Header().Get("X-Cache"))
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/muandane/estrois/internal/middleware"
+	"github.com/muandane/estrois/internal/storage"
+)
+
+type CreateBucketRequest struct{}
+
+type HeadBucketRequest struct{}
+
+type ListBucketsRequest struct{}
+
+type BucketSummary struct {
+	Name         string    `json:"name"`
+	CreationDate time.Time `json:"creation_date"`
+}
+
+// BucketHandler returns the handler for PUT and HEAD /buckets/{bucket}
+func (h *ObjectHandler) BucketHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := h.logger.With(
+			"request_id", middleware.RequestIDFromContext(r.Context()),
+			"method", r.Method,
+			"bucket", r.PathValue("bucket"),
+			"remote_addr", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		)
+		opts := HandlerOptions{Logger: logger}
+
+		switch r.Method {
+		case http.MethodPut:
+			Handle(h.handleCreateBucket, opts)(w, r)
+		case http.MethodHead:
+			Handle(h.handleHeadBucket, opts)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// handleCreateBucket creates a bucket. Creating a bucket we already own
+// succeeds with 200 so the call can be repeated safely.
+func (h *ObjectHandler) handleCreateBucket(ctx context.Context, req *Request, input CreateBucketRequest) (*Response, error) {
+	bucket := req.PathParams["bucket"]
+	if err := storage.ValidateBucketName(bucket); err != nil {
+		return nil, &ValidationError{Field: "path", Message: err.Error()}
+	}
+
+	client, err := h.client(bucket)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := storageContext(ctx)
+	defer cancel()
+
+	err = client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: req.QueryParams["region"]})
+	if err != nil {
+		// Backends differ in how they report an existing bucket, so ask directly
+		if exists, existsErr := client.BucketExists(ctx, bucket); existsErr == nil && exists {
+			LoggerFrom(ctx).Info("bucket already exists")
+			return &Response{StatusCode: http.StatusOK}, nil
+		}
+		return nil, fmt.Errorf("failed to create bucket: %w", err)
+	}
+
+	LoggerFrom(ctx).Info("bucket created", "region", req.QueryParams["region"])
+	return &Response{StatusCode: http.StatusCreated}, nil
+}
+
+func (h *ObjectHandler) handleHeadBucket(ctx context.Context, req *Request, input HeadBucketRequest) (*Response, error) {
+	bucket := req.PathParams["bucket"]
+	if err := storage.ValidateBucketName(bucket); err != nil {
+		return nil, &ValidationError{Field: "path", Message: err.Error()}
+	}
+
+	client, err := h.client(bucket)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := storageContext(ctx)
+	defer cancel()
+
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket: %w", err)
+	}
+	if !exists {
+		return nil, &NotFoundError{Resource: "bucket", ID: bucket}
+	}
+	return &Response{StatusCode: http.StatusOK}, nil
+}
+
+// ListBucketsHandler returns the handler for GET /buckets. Only buckets in
+// bucketAccess are listed, narrowed to the API key's scope, so buckets the
+// service does not manage stay hidden.
+func (h *ObjectHandler) ListBucketsHandler(bucketAccess map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := h.logger.With(
+			"request_id", middleware.RequestIDFromContext(r.Context()),
+			"method", r.Method,
+			"remote_addr", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		)
+		handleList := func(ctx context.Context, req *Request, input ListBucketsRequest) ([]BucketSummary, error) {
+			return h.listBuckets(ctx, bucketAccess, middleware.APIKeyScopeFromContext(ctx))
+		}
+		Handle(handleList, HandlerOptions{Logger: logger})(w, r)
+	}
+}
+
+// listBuckets asks each backend serving a managed bucket for its buckets and
+// keeps the managed ones, so every backend is listed once
+func (h *ObjectHandler) listBuckets(ctx context.Context, bucketAccess map[string]string, scope []string) ([]BucketSummary, error) {
+	managed := make(map[*minio.Client][]string)
+	for bucket := range bucketAccess {
+		if len(scope) > 0 && !slices.Contains(scope, bucket) {
+			continue
+		}
+		client := h.clients.ClientForBucket(bucket)
+		managed[client] = append(managed[client], bucket)
+	}
+
+	ctx, cancel := storageContext(ctx)
+	defer cancel()
+
+	buckets := []BucketSummary{}
+	for client, names := range managed {
+		if err := h.clients.Allow(names[0]); err != nil {
+			return nil, err
+		}
+		infos, err := client.ListBuckets(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list buckets: %w", err)
+		}
+		for _, info := range infos {
+			if slices.Contains(names, info.Name) {
+				buckets = append(buckets, BucketSummary{Name: info.Name, CreationDate: info.CreationDate})
+			}
+		}
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Name < buckets[j].Name })
+	return buckets, nil
+}
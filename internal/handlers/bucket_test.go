@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/muandane/estrois/internal/middleware"
+)
+
+// newBucketEnv returns a testEnv that also serves bucket endpoints
+func newBucketEnv(t *testing.T) *testEnv {
+	env := newTestEnv(t)
+	env.mux.Handle("PUT /buckets/{bucket}", env.handler.BucketHandler())
+	env.mux.Handle("HEAD /buckets/{bucket}", env.handler.BucketHandler())
+	return env
+}
+
+func TestCreateBucket(t *testing.T) {
+	env := newBucketEnv(t)
+
+	if w := env.do(http.MethodHead, "/buckets/new-bucket", nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("HEAD before creation: status = %d, want 404", w.Code)
+	}
+	if w := env.do(http.MethodPut, "/buckets/new-bucket", nil, nil); w.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, body %s", w.Code, w.Body)
+	}
+	if w := env.do(http.MethodHead, "/buckets/new-bucket", nil, nil); w.Code != http.StatusOK {
+		t.Errorf("HEAD after creation: status = %d, want 200", w.Code)
+	}
+	// Creating it again is not an error
+	if w := env.do(http.MethodPut, "/buckets/new-bucket", nil, nil); w.Code != http.StatusOK {
+		t.Errorf("create existing: status = %d, want 200", w.Code)
+	}
+}
+
+func TestBucketEndpointsRejectInvalidNames(t *testing.T) {
+	env := newBucketEnv(t)
+	for _, method := range []string{http.MethodPut, http.MethodHead} {
+		if w := env.do(method, "/buckets/Invalid_Bucket", nil, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", method, w.Code)
+		}
+	}
+}
+
+func TestListBucketsShowsOnlyManagedBuckets(t *testing.T) {
+	env := newTestEnv(t)
+	for _, bucket := range []string{"managed", "unmanaged"} {
+		if err := env.client.MakeBucket(context.Background(), bucket, minio.MakeBucketOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	access := map[string]string{testBucket: "all", "managed": "read", "not-created": "read"}
+	auth := middleware.WithAPIKeyAuth(middleware.APIKeyConfig{
+		Keys: map[string][]string{"admin-key": nil, "managed-key": {"managed"}},
+	}, slog.New(slog.DiscardHandler))
+	env.mux.Handle("GET /buckets", auth(env.handler.ListBucketsHandler(access)))
+
+	for _, tt := range []struct {
+		key  string
+		want []string
+	}{
+		{"admin-key", []string{"managed", testBucket}},
+		{"managed-key", []string{"managed"}},
+	} {
+		w := env.do(http.MethodGet, "/buckets", nil, map[string]string{middleware.APIKeyHeader: tt.key})
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body %s", tt.key, w.Code, w.Body)
+		}
+		var buckets []BucketSummary
+		if err := json.NewDecoder(w.Body).Decode(&buckets); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, bucket := range buckets {
+			names = append(names, bucket.Name)
+			if bucket.CreationDate.IsZero() {
+				t.Errorf("%s: bucket %s has no creation date", tt.key, bucket.Name)
+			}
+		}
+		if !slices.Equal(names, tt.want) {
+			t.Errorf("%s: buckets = %q, want %q", tt.key, names, tt.want)
+		}
+	}
+}
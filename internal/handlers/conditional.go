@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// isNotModified reports whether a GET or HEAD request's If-None-Match or
+// If-Modified-Since headers match the current representation. If-None-Match
+// takes precedence, and a malformed If-Modified-Since date is ignored.
+func isNotModified(headers http.Header, etag string, lastModified time.Time) bool {
+	if inm := headers.Get("If-None-Match"); inm != "" {
+		return etagMatch(etag, inm, false)
+	}
+
+	if ims := headers.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		// HTTP dates have second precision
+		return !lastModified.Truncate(time.Second).After(t)
+	}
+
+	return false
+}
+
+// hasReadConditions reports whether a GET or HEAD request carries a
+// condition isNotModified checks
+func hasReadConditions(headers http.Header) bool {
+	return headers.Get("If-None-Match") != "" || headers.Get("If-Modified-Since") != ""
+}
+
+// failedWritePrecondition returns the conditional header that rules out a
+// write, or "" when the write may proceed. If-Match requires the object to
+// exist with a listed ETag, compared strongly, and If-None-Match requires
+// that it does not, so "If-None-Match: *" only creates new objects.
+func failedWritePrecondition(headers http.Header, exists bool, etag string) string {
+	if im := headers.Get("If-Match"); im != "" && (!exists || !etagMatch(etag, im, true)) {
+		return "If-Match"
+	}
+	if inm := headers.Get("If-None-Match"); inm != "" && exists && etagMatch(etag, inm, false) {
+		return "If-None-Match"
+	}
+	return ""
+}
+
+// entityTag is a parsed entity tag
+type entityTag struct {
+	opaque string // the tag without quotes or weak prefix
+	weak   bool
+}
+
+// etagMatch reports whether candidate, the current representation's tag,
+// matches an If-Match or If-None-Match header value (RFC 7232 section 2.3.2).
+// Strong comparison, used for If-Match, needs both tags to be strong and
+// identical. Weak comparison, used for If-None-Match, ignores the W/ prefix
+// and the encoding suffix of compressed representations. "*" matches any
+// representation; callers check that one exists.
+func etagMatch(candidate, headerValue string, strong bool) bool {
+	if strings.TrimSpace(headerValue) == "*" {
+		return true
+	}
+	current, ok := parseETag(candidate)
+	if !ok {
+		return false
+	}
+	for _, tag := range parseETagList(headerValue) {
+		if strong {
+			if !tag.weak && !current.weak && tag.opaque == current.opaque {
+				return true
+			}
+			continue
+		}
+		if normalizeETag(tag.opaque) == normalizeETag(current.opaque) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseETag parses a single entity tag, quoted or not, such as the ETag
+// storage reports for an object
+func parseETag(etag string) (entityTag, bool) {
+	var tag entityTag
+	etag = strings.TrimSpace(etag)
+	if rest, ok := strings.CutPrefix(etag, "W/"); ok {
+		tag.weak, etag = true, rest
+	}
+	tag.opaque = strings.Trim(etag, `"`)
+	return tag, tag.opaque != ""
+}
+
+// parseETagList parses a comma-separated list of entity tags. Quoted tags may
+// contain commas. Unquoted tags, as some clients send S3 ETags, are accepted
+// up to the next comma. Parsing stops at an unterminated quote.
+func parseETagList(list string) []entityTag {
+	var tags []entityTag
+	for {
+		list = strings.TrimLeft(list, " \t,")
+		if list == "" {
+			return tags
+		}
+
+		var tag entityTag
+		if rest, ok := strings.CutPrefix(list, "W/"); ok {
+			tag.weak, list = true, rest
+		}
+
+		if rest, ok := strings.CutPrefix(list, `"`); ok {
+			opaque, rest, ok := strings.Cut(rest, `"`)
+			if !ok {
+				return tags
+			}
+			tag.opaque, list = opaque, rest
+		} else {
+			end := strings.IndexByte(list, ',')
+			if end < 0 {
+				end = len(list)
+			}
+			tag.opaque, list = strings.TrimSpace(list[:end]), list[end:]
+			if tag.opaque == "" || tag.opaque == "*" {
+				continue
+			}
+		}
+		tags = append(tags, tag)
+	}
+}
+
+// normalizeETag strips the weak prefix, quotes and any encoding suffix so
+// tags can be compared, and the tag of a compressed representation matches
+// the object it was compressed from
+func normalizeETag(etag string) string {
+	etag = strings.TrimSpace(etag)
+	etag = strings.TrimPrefix(etag, "W/")
+	etag = strings.Trim(etag, `"`)
+	for _, encoding := range []string{"br", "gzip"} {
+		if base, ok := strings.CutSuffix(etag, "-"+encoding); ok {
+			return base
+		}
+	}
+	return etag
+}
+
+// encodedETag returns the entity tag of an object's representation in
+// encoding. Compressed representations get a weak tag with the encoding as a
+// suffix, such as W/"abc-gzip", so caches keep them apart from the identity
+// representation, whose tag is the object's own.
+func encodedETag(etag, encoding string) string {
+	if etag == "" || encoding == "" {
+		return etag
+	}
+	return `W/"` + normalizeETag(etag) + "-" + encoding + `"`
+}
+
+// notModifiedResponse builds a 304 response carrying the validators
+func notModifiedResponse(contentType, etag string, lastModified time.Time) *Response {
+	return &Response{
+		StatusCode: http.StatusNotModified,
+		Headers: http.Header{
+			"Last-Modified": []string{lastModified.UTC().Format(http.TimeFormat)},
+			"ETag":          []string{etag},
+		},
+		ContentType: contentType,
+	}
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/muandane/estrois/internal/cache"
+)
+
+func TestConditionalGet(t *testing.T) {
+	env := newTestEnv(t)
+	env.putObject(t, "page.html", "text/html", []byte("<p>hello</p>"))
+	path := "/objects/" + testBucket + "/page.html"
+
+	w := env.do(http.MethodGet, path, nil, nil)
+	etag := responseETag(w)
+	lastModified := w.Header().Get("Last-Modified")
+	if w.Code != http.StatusOK || etag == "" || lastModified == "" {
+		t.Fatalf("GET: status = %d, ETag %q, Last-Modified %q", w.Code, etag, lastModified)
+	}
+	env.waitCached(t, "page.html")
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{"matching etag", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"matching weak etag", map[string]string{"If-None-Match": `"other", W/` + etag}, http.StatusNotModified},
+		{"mismatched etag", map[string]string{"If-None-Match": `"other"`}, http.StatusOK},
+		{"not modified since", map[string]string{"If-Modified-Since": lastModified}, http.StatusNotModified},
+		{"modified since", map[string]string{"If-Modified-Since": time.Unix(0, 0).UTC().Format(http.TimeFormat)}, http.StatusOK},
+		{"malformed date", map[string]string{"If-Modified-Since": "yesterday"}, http.StatusOK},
+		{"etag wins over date", map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": lastModified}, http.StatusOK},
+	}
+	for _, cached := range []bool{true, false} {
+		for _, tt := range tests {
+			name := tt.name + " on a hit"
+			if !cached {
+				name = tt.name + " on a miss"
+			}
+			t.Run(name, func(t *testing.T) {
+				cacheKey := objectCacheKey(testBucket, "page.html", "")
+				if !cached {
+					env.store.Delete(cacheKey)
+				} else if _, status := env.store.Get(cacheKey); status != cache.StatusHit {
+					env.do(http.MethodGet, path, nil, nil)
+					env.waitCached(t, "page.html")
+				}
+				env.resetRequests()
+				w := env.do(http.MethodGet, path, nil, tt.headers)
+				if w.Code != tt.wantStatus {
+					t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+				}
+				if tt.wantStatus == http.StatusNotModified {
+					if w.Body.Len() != 0 {
+						t.Errorf("304 with a body %q", w.Body)
+					}
+					if gets := env.objectGets("page.html"); gets != 0 {
+						t.Errorf("304 downloaded the object %d times", gets)
+					}
+				} else if w.Body.String() != "<p>hello</p>" {
+					t.Errorf("body = %q", w.Body)
+				}
+			})
+		}
+	}
+}
+
+func TestConditionalPut(t *testing.T) {
+	env := newTestEnv(t)
+	env.putObject(t, "doc.txt", "text/plain", []byte("version 1"))
+	path := "/objects/" + testBucket + "/doc.txt"
+	original := responseETag(env.do(http.MethodGet, path, nil, nil))
+
+	put := func(body string, headers map[string]string) int {
+		return env.do(http.MethodPut, path, strings.NewReader(body), headers).Code
+	}
+	if status := put("version 2", map[string]string{"If-Match": original}); status != http.StatusOK {
+		t.Fatalf("PUT with the current ETag: status = %d, want 200", status)
+	}
+	if status := put("lost update", map[string]string{"If-Match": original}); status != http.StatusPreconditionFailed {
+		t.Errorf("PUT with a stale ETag: status = %d, want 412", status)
+	}
+	if status := put("lost update", map[string]string{"If-None-Match": "*"}); status != http.StatusPreconditionFailed {
+		t.Errorf("PUT If-None-Match * over an existing object: status = %d, want 412", status)
+	}
+	if w := env.do(http.MethodGet, path, nil, nil); w.Body.String() != "version 2" {
+		t.Errorf("object = %q after rejected writes, want version 2", w.Body)
+	}
+
+	newPath := "/objects/" + testBucket + "/new.txt"
+	if w := env.do(http.MethodPut, newPath, strings.NewReader("new"), map[string]string{"If-Match": original}); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT If-Match on a missing object: status = %d, want 412", w.Code)
+	}
+	if w := env.do(http.MethodPut, newPath, strings.NewReader("new"), map[string]string{"If-None-Match": "*"}); w.Code != http.StatusOK {
+		t.Errorf("PUT If-None-Match * on a missing object: status = %d, want 200", w.Code)
+	}
+}
+
+func TestConditionalPutUsesStrongComparison(t *testing.T) {
+	env := newTestEnv(t)
+	env.putObject(t, "doc.txt", "text/plain", []byte("version 1"))
+	path := "/objects/" + testBucket + "/doc.txt"
+	etag := responseETag(env.do(http.MethodGet, path, nil, nil))
+
+	tests := []struct {
+		name       string
+		ifMatch    string
+		wantStatus int
+	}{
+		{"weak tag", "W/" + etag, http.StatusPreconditionFailed},
+		{"other tags", `"other", W/` + etag, http.StatusPreconditionFailed},
+		{"list member", `"other", ` + etag, http.StatusOK},
+		{"wildcard", "*", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := env.do(http.MethodPut, path, strings.NewReader("version 1"), map[string]string{"If-Match": tt.ifMatch})
+			if w.Code != tt.wantStatus {
+				t.Errorf("If-Match %s: status = %d, want %d", tt.ifMatch, w.Code, tt.wantStatus)
+			}
+			// Rewriting the same body keeps the ETag, so each case starts alike
+			if got := responseETag(env.do(http.MethodGet, path, nil, nil)); got != etag {
+				t.Fatalf("ETag changed to %s", got)
+			}
+		})
+	}
+}
+
+func TestFailedConditionalPutDropsStaleCacheEntry(t *testing.T) {
+	env := newTestEnv(t)
+	env.putObject(t, "shared.txt", "text/plain", []byte("version 1"))
+	path := "/objects/" + testBucket + "/shared.txt"
+	cached := responseETag(env.do(http.MethodGet, path, nil, nil))
+	env.waitCached(t, "shared.txt")
+
+	// Another instance updates the object behind this one's cache
+	env.putObject(t, "shared.txt", "text/plain", []byte("version 2"))
+	if w := env.do(http.MethodPut, path, strings.NewReader("version 3"), map[string]string{"If-Match": cached}); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("PUT with the cached ETag: status = %d, want 412", w.Code)
+	}
+	if _, status := env.store.Get(cache.GetCacheKey(testBucket, "shared.txt")); status != cache.StatusMiss {
+		t.Errorf("stale entry is still cached, status %s", status)
+	}
+	if w := env.do(http.MethodGet, path, nil, nil); w.Body.String() != "version 2" {
+		t.Errorf("GET = %q, want the current version 2", w.Body)
+	}
+}
+
+func TestHeadMetadataAnswersConditionalGet(t *testing.T) {
+	cache.CacheHeadMetadata = true
+	t.Cleanup(func() { cache.CacheHeadMetadata = false })
+	env := newTestEnv(t)
+	data := []byte("looked up by HEAD")
+	env.putObject(t, "headed.txt", "text/plain", data)
+	path := "/objects/" + testBucket + "/headed.txt"
+
+	w := env.do(http.MethodHead, path, nil, nil)
+	etag := responseETag(w)
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("HEAD: status = %d, ETag %q", w.Code, etag)
+	}
+	entry, status := env.store.Get(objectCacheKey(testBucket, "headed.txt", ""))
+	if status != cache.StatusHit || !entry.MetadataOnly {
+		t.Fatalf("after HEAD: cache status = %s, want a metadata entry", status)
+	}
+
+	env.resetRequests()
+	if w := env.do(http.MethodGet, path, nil, map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Errorf("conditional GET: status = %d, want 304", w.Code)
+	}
+	if requests := env.storageRequests(); len(requests) != 0 {
+		t.Errorf("conditional GET after HEAD reached storage: %v", requests)
+	}
+
+	// A metadata entry never stands in for the body
+	w = env.do(http.MethodGet, path, nil, map[string]string{"If-None-Match": `"other"`})
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Errorf("GET with a stale ETag: status = %d, body %q", w.Code, w.Body.Bytes())
+	}
+	if got := w.Header().Get("X-Cache"); got != "MISS" {
+		t.Errorf("GET with a stale ETag: X-Cache = %q, want MISS", got)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for entry := env.waitCached(t, "headed.txt"); entry.MetadataOnly; entry = env.waitCached(t, "headed.txt") {
+		if time.Now().After(deadline) {
+			t.Fatal("the full GET did not replace the metadata entry")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConditionalHead(t *testing.T) {
+	env := newTestEnv(t)
+	data := []byte("<p>preflight</p>")
+	env.putObject(t, "page.html", "text/html", data)
+	path := "/objects/" + testBucket + "/page.html"
+	cacheKey := objectCacheKey(testBucket, "page.html", "")
+
+	w := env.do(http.MethodHead, path, nil, nil)
+	etag := responseETag(w)
+	lastModified := w.Header().Get("Last-Modified")
+	if w.Code != http.StatusOK || etag == "" || lastModified == "" {
+		t.Fatalf("HEAD: status = %d, ETag %q, Last-Modified %q", w.Code, etag, lastModified)
+	}
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{"matching etag", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"matching weak etag in a list", map[string]string{"If-None-Match": `"other", W/` + etag}, http.StatusNotModified},
+		{"mismatched etag", map[string]string{"If-None-Match": `"other"`}, http.StatusOK},
+		{"not modified since", map[string]string{"If-Modified-Since": lastModified}, http.StatusNotModified},
+		{"modified since", map[string]string{"If-Modified-Since": time.Unix(0, 0).UTC().Format(http.TimeFormat)}, http.StatusOK},
+		{"etag wins over date", map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": lastModified}, http.StatusOK},
+	}
+	for _, cached := range []bool{false, true} {
+		if cached {
+			env.do(http.MethodGet, path, nil, nil)
+			env.waitCached(t, "page.html")
+		}
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s cached=%v", tt.name, cached), func(t *testing.T) {
+				if !cached {
+					env.store.Delete(cacheKey)
+				}
+				w := env.do(http.MethodHead, path, nil, tt.headers)
+				if w.Code != tt.wantStatus {
+					t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+				}
+				if w.Body.Len() != 0 {
+					t.Errorf("HEAD wrote a body %q", w.Body)
+				}
+				if got := responseETag(w); got != etag {
+					t.Errorf("ETag = %q, want %q", got, etag)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+)
+
+func TestPutCopiesFromSource(t *testing.T) {
+	env := newTestEnv(t)
+	data := []byte("copied server side")
+	env.putObject(t, "source.txt", "text/plain", data)
+
+	// A cached destination is replaced by the copy
+	env.putObject(t, "dest.txt", "text/plain", []byte("old"))
+	env.do(http.MethodGet, "/objects/"+testBucket+"/dest.txt", nil, nil)
+	env.waitCached(t, "dest.txt")
+
+	env.resetRequests()
+	w := env.do(http.MethodPut, "/objects/"+testBucket+"/dest.txt", nil, map[string]string{"X-Copy-Source": "/" + testBucket + "/source.txt"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("copy: status = %d, body %s", w.Code, w.Body)
+	}
+	if gets := env.objectGets("source.txt"); gets != 0 {
+		t.Errorf("the source was downloaded %d times for a server-side copy", gets)
+	}
+
+	w = env.do(http.MethodGet, "/objects/"+testBucket+"/dest.txt", nil, nil)
+	if w.Header().Get("X-Cache") != "MISS" || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Errorf("GET after copy: X-Cache = %s, body %q", w.Header().Get("X-Cache"), w.Body.Bytes())
+	}
+}
+
+func TestPutCopyFromMissingSource(t *testing.T) {
+	env := newTestEnv(t)
+	tests := []struct {
+		source string
+		want   int
+	}{
+		{"/" + testBucket + "/missing.txt", http.StatusNotFound},
+		{"/missing-bucket/file.txt", http.StatusNotFound},
+		{"/" + testBucket, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := env.do(http.MethodPut, "/objects/"+testBucket+"/dest.txt", nil, map[string]string{"X-Copy-Source": tt.source})
+		if w.Code != tt.want {
+			t.Errorf("copy from %s: status = %d, want %d", tt.source, w.Code, tt.want)
+		}
+	}
+	if size := env.storedSize(t, "dest.txt"); size != -1 {
+		t.Errorf("a failed copy stored %d bytes", size)
+	}
+}
+
+func TestPutWithoutCopySourceUploadsBody(t *testing.T) {
+	env := newTestEnv(t)
+	data := []byte("uploaded body")
+	if w := env.do(http.MethodPut, "/objects/"+testBucket+"/plain.txt", bytes.NewReader(data), map[string]string{"Content-Type": "text/plain"}); w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if size := env.storedSize(t, "plain.txt"); size != int64(len(data)) {
+		t.Errorf("stored size = %d, want %d", size, len(data))
+	}
+}
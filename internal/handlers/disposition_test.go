@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"report.csv", `attachment; filename="report.csv"`},
+		{"annual report 2024.pdf", `attachment; filename="annual report 2024.pdf"`},
+		{"résumé.pdf", `attachment; filename="r_sum_.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf`},
+		{"报告.txt", `attachment; filename="__.txt"; filename*=UTF-8''%E6%8A%A5%E5%91%8A.txt`},
+		{`say "hi".txt`, `attachment; filename="say _hi_.txt"; filename*=UTF-8''say%20%22hi%22.txt`},
+		{"line\nbreak.txt", `attachment; filename="line_break.txt"; filename*=UTF-8''line%0Abreak.txt`},
+	}
+	for _, tt := range tests {
+		if got := contentDisposition(tt.filename); got != tt.want {
+			t.Errorf("contentDisposition(%q) = %s, want %s", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestGetDownloadSetsContentDisposition(t *testing.T) {
+	env := newTestEnv(t)
+	env.putObject(t, "data/2024.csv", "text/csv", []byte("a,b\n1,2\n"))
+	path := "/objects/" + testBucket + "/data/2024.csv"
+
+	for _, cached := range []bool{false, true} {
+		if cached {
+			env.waitCached(t, "data/2024.csv")
+		}
+		w := env.do(http.MethodGet, path+"?download="+url.QueryEscape("rapport été.csv"), nil, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d", w.Code)
+		}
+		want := `attachment; filename="rapport _t_.csv"; filename*=UTF-8''rapport%20%C3%A9t%C3%A9.csv`
+		if got := w.Header().Get("Content-Disposition"); got != want {
+			t.Errorf("cached=%v: Content-Disposition = %s, want %s", cached, got, want)
+		}
+	}
+
+	if w := env.do(http.MethodGet, path, nil, nil); w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("Content-Disposition = %q without ?download", w.Header().Get("Content-Disposition"))
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/muandane/estrois/internal/cache"
+	"github.com/muandane/estrois/internal/config"
+)
+
+// noCompressionHeader lets a client that would rather spend bandwidth than
+// CPU turn compression off ("1") or back on ("0") for a request
+const noCompressionHeader = "X-No-Compression"
+
+// varyEncoding lists the request headers that select a response's encoding
+const varyEncoding = "Accept-Encoding, " + noCompressionHeader
+
+// noCompressionBuckets serve identity responses by default, set by
+// BUCKET_NO_COMPRESSION
+var noCompressionBuckets = config.GetNoCompressionBuckets()
+
+// acceptEncoding holds the q-value of each coding listed in an Accept-Encoding
+// header
+type acceptEncoding map[string]float64
+
+// parseAcceptEncoding parses an Accept-Encoding header. Codings are matched
+// case-insensitively and x-gzip is treated as gzip.
+func parseAcceptEncoding(header string) acceptEncoding {
+	qualities := make(acceptEncoding)
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		if coding == "x-gzip" {
+			coding = "gzip"
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(name, "q") {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		qualities[coding] = q
+	}
+	return qualities
+}
+
+// requestAcceptEncoding returns the codings a request accepts. A request
+// refusing compression with X-No-Compression, or made to a bucket in
+// BUCKET_NO_COMPRESSION without X-No-Compression: 0, accepts only identity,
+// whatever its Accept-Encoding says.
+func requestAcceptEncoding(bucket string, headers http.Header) acceptEncoding {
+	noCompression := noCompressionBuckets[bucket]
+	if value, err := strconv.ParseBool(headers.Get(noCompressionHeader)); err == nil {
+		noCompression = value
+	}
+	if noCompression {
+		return acceptEncoding{}
+	}
+	return parseAcceptEncoding(headers.Get("Accept-Encoding"))
+}
+
+// listed returns the q-value the header gives coding, directly or through "*"
+func (a acceptEncoding) listed(coding string) (float64, bool) {
+	if q, ok := a[coding]; ok {
+		return q, true
+	}
+	q, ok := a["*"]
+	return q, ok
+}
+
+// quality returns the q-value for coding. Identity stays acceptable unless
+// the header excludes it.
+func (a acceptEncoding) quality(coding string) float64 {
+	if q, ok := a.listed(coding); ok {
+		return q
+	}
+	if coding == "identity" {
+		return 1
+	}
+	return 0
+}
+
+// negotiate picks the content coding to use for a response. available lists
+// the codings the server can produce besides identity, in order of server
+// preference; the client's highest q-value wins and ties go to the earliest
+// one. Identity is only preferred when the client ranks it above every
+// available coding, and otherwise used when none is accepted. An empty string
+// means identity, and false means the client accepts none of the options.
+func (a acceptEncoding) negotiate(available ...string) (string, bool) {
+	best, bestQ := "", 0.0
+	for _, coding := range available {
+		if q := a.quality(coding); q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	if q, ok := a.listed("identity"); ok && q > bestQ {
+		return "", true
+	}
+	if best != "" {
+		return best, true
+	}
+	return "", a.quality("identity") > 0
+}
+
+// negotiateEncoding picks the content coding of a response for an object of
+// contentType and size, the same way whether it is served from the cache or
+// from storage: compressible objects may be sent as br or gzip, others only
+// as identity
+func negotiateEncoding(accepted acceptEncoding, contentType string, size int64) (string, bool) {
+	if cache.ShouldCompress(contentType, size) {
+		return accepted.negotiate("br", "gzip")
+	}
+	return accepted.negotiate()
+}
+
+// compressBody compresses data in encoding, br or gzip
+func compressBody(data []byte, encoding string) ([]byte, error) {
+	if encoding == "br" {
+		return cache.CompressBrotli(data)
+	}
+	return cache.CompressData(data)
+}
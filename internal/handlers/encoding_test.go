@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/muandane/estrois/internal/cache"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		available  []string
+		want       string
+		acceptable bool
+	}{
+		{"no header", "", []string{"br", "gzip"}, "", true},
+		{"prefers br", "gzip, br", []string{"br", "gzip"}, "br", true},
+		{"br refused", "br;q=0, gzip", []string{"br", "gzip"}, "gzip", true},
+		{"q-values win over server order", "br;q=0.5, gzip;q=0.8", []string{"br", "gzip"}, "gzip", true},
+		{"x-gzip", "x-gzip", []string{"br", "gzip"}, "gzip", true},
+		{"wildcard", "*", []string{"br", "gzip"}, "br", true},
+		{"only gzip available", "br", []string{"gzip"}, "", true},
+		{"identity preferred", "identity, gzip;q=0.5", []string{"gzip"}, "", true},
+		{"identity refused", "identity;q=0", nil, "", false},
+		{"wildcard refused", "*;q=0", nil, "", false},
+		{"identity refused with gzip", "gzip, identity;q=0", []string{"gzip"}, "gzip", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseAcceptEncoding(tt.header).negotiate(tt.available...)
+			if got != tt.want || ok != tt.acceptable {
+				t.Errorf("negotiate(%q, %v) = %q, %v, want %q, %v", tt.header, tt.available, got, ok, tt.want, tt.acceptable)
+			}
+		})
+	}
+}
+
+func TestGetNegotiatesEncodingOnMissAndHit(t *testing.T) {
+	setMinSizeForCompression(t, 0)
+	env := newTestEnv(t)
+	data := bytes.Repeat([]byte("negotiated body "), 500)
+	env.putObject(t, "page.txt", "text/plain", data)
+
+	headers := map[string]string{"Accept-Encoding": "br;q=0, gzip"}
+	for _, want := range []string{"MISS", "HIT"} {
+		if want == "HIT" {
+			env.waitCached(t, "page.txt")
+		}
+		w := env.do(http.MethodGet, "/objects/"+testBucket+"/page.txt", nil, headers)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d", want, w.Code)
+		}
+		if got := w.Header().Get("X-Cache"); got != want {
+			t.Errorf("X-Cache = %q, want %q", got, want)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Errorf("%s: Content-Encoding = %q, want gzip", want, got)
+			continue
+		}
+		body, err := cache.DecompressData(w.Body.Bytes())
+		if err != nil || !bytes.Equal(body, data) {
+			t.Errorf("%s: gzip body does not decode to the object: %v", want, err)
+		}
+	}
+}
+
+func TestGetEncodingAgreesOnHitAndMiss(t *testing.T) {
+	setMinSizeForCompression(t, 0)
+	env := newTestEnv(t)
+	compressible := bytes.Repeat([]byte("compressible "), 200)
+	// Too short for compression to pay off, so no variant is cached
+	tiny := []byte("hi")
+
+	tests := []struct {
+		name           string
+		contentType    string
+		data           []byte
+		acceptEncoding string
+		wantStatus     int
+		wantEncoding   string
+	}{
+		{"plain gzip", "text/plain", compressible, "gzip", http.StatusOK, "gzip"},
+		{"gzip refused", "text/plain", compressible, "gzip;q=0", http.StatusOK, ""},
+		{"identity refused", "text/plain", compressible, "identity;q=0, gzip", http.StatusOK, "gzip"},
+		{"identity refused without variants", "text/plain", tiny, "identity;q=0, gzip", http.StatusOK, "gzip"},
+		{"identity preferred without variants", "text/plain", tiny, "gzip", http.StatusOK, ""},
+		{"nothing acceptable without variants", "text/plain", tiny, "identity;q=0", http.StatusNotAcceptable, ""},
+		{"incompressible type", "image/png", compressible, "identity;q=0, gzip", http.StatusNotAcceptable, ""},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := fmt.Sprintf("agree-%d", i)
+			env.putObject(t, key, tt.contentType, tt.data)
+			path := "/objects/" + testBucket + "/" + key
+			headers := map[string]string{"Accept-Encoding": tt.acceptEncoding}
+
+			for _, want := range []string{"MISS", "HIT"} {
+				if want == "HIT" {
+					env.waitCached(t, key)
+				}
+				w := env.do(http.MethodGet, path, nil, headers)
+				if w.Code != tt.wantStatus {
+					t.Fatalf("%s: status = %d, want %d", want, w.Code, tt.wantStatus)
+				}
+				if w.Code != http.StatusOK {
+					continue
+				}
+				if got := w.Header().Get("X-Cache"); got != want {
+					t.Errorf("X-Cache = %q, want %q", got, want)
+				}
+				encoding := w.Header().Get("Content-Encoding")
+				if encoding != tt.wantEncoding {
+					t.Errorf("%s: Content-Encoding = %q, want %q", want, encoding, tt.wantEncoding)
+				}
+				body := w.Body.Bytes()
+				if encoding == "gzip" {
+					var err error
+					if body, err = cache.DecompressData(body); err != nil {
+						t.Fatalf("%s: %v", want, err)
+					}
+				}
+				if !bytes.Equal(body, tt.data) {
+					t.Errorf("%s: body does not match the object", want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompressedOnlyEntryServesIdentityClients(t *testing.T) {
+	setMinSizeForCompression(t, 0)
+	cache.StoreCompressedOnly = true
+	t.Cleanup(func() { cache.StoreCompressedOnly = false })
+	env := newTestEnv(t)
+	data := bytes.Repeat([]byte("kept only compressed "), 500)
+	env.putObject(t, "compressed-only.txt", "text/plain", data)
+	path := "/objects/" + testBucket + "/compressed-only.txt"
+
+	env.do(http.MethodGet, path, nil, nil)
+	cacheKey := objectCacheKey(testBucket, "compressed-only.txt", "")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if entry, _ := env.store.Get(cacheKey); entry != nil && entry.IsCompressed && entry.Data == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("entry was not stored compressed only")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		w := env.do(method, path, nil, map[string]string{"Accept-Encoding": "identity"})
+		if got := w.Header().Get("X-Cache"); got != "HIT" {
+			t.Errorf("%s: X-Cache = %q, want HIT", method, got)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("%s: Content-Encoding = %q, want none", method, got)
+		}
+		if got := w.Header().Get("Content-Length"); got != strconv.Itoa(len(data)) {
+			t.Errorf("%s: Content-Length = %s, want %d", method, got, len(data))
+		}
+		if method == http.MethodGet && !bytes.Equal(w.Body.Bytes(), data) {
+			t.Errorf("GET: body of %d bytes is not the decompressed object", w.Body.Len())
+		}
+	}
+
+	w := env.do(http.MethodGet, path, nil, map[string]string{"Accept-Encoding": "gzip"})
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("gzip client: Content-Encoding = %q, want gzip", got)
+	}
+	if got, err := cache.DecompressData(w.Body.Bytes()); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("gzip client: body does not decompress to the object: %v", err)
+	}
+}
+
+func TestGzipArchivesAreNeverRecompressed(t *testing.T) {
+	setMinSizeForCompression(t, 0)
+	previous := cache.CompressibleTypes
+	cache.CompressibleTypes = []string{"application/"}
+	t.Cleanup(func() { cache.CompressibleTypes = previous })
+	env := newTestEnv(t)
+	archive, err := cache.CompressData(bytes.Repeat([]byte(`{"archived":true}`), 500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.putObject(t, "export.json.gz", "application/gzip", archive)
+
+	for _, want := range []string{"MISS", "HIT"} {
+		if want == "HIT" {
+			env.waitCached(t, "export.json.gz")
+			// Give background compression the chance to run
+			time.Sleep(20 * time.Millisecond)
+			if entry, _ := env.store.Get(objectCacheKey(testBucket, "export.json.gz", "")); entry.IsCompressed || entry.BrotliData != nil {
+				t.Error("gzip archive was compressed in the cache")
+			}
+		}
+		w := env.do(http.MethodGet, "/objects/"+testBucket+"/export.json.gz", nil, map[string]string{"Accept-Encoding": "br, gzip"})
+		if got := w.Header().Get("X-Cache"); got != want {
+			t.Errorf("X-Cache = %q, want %s", got, want)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("%s: Content-Encoding = %q, want the archive served as stored", want, got)
+		}
+		if !bytes.Equal(w.Body.Bytes(), archive) {
+			t.Errorf("%s: body differs from the stored archive", want)
+		}
+	}
+}
+
+func TestVaryOnCompressibleResponses(t *testing.T) {
+	setMinSizeForCompression(t, 0)
+	env := newTestEnv(t)
+	env.putObject(t, "data.json", "application/json", bytes.Repeat([]byte(`{"v":1}`), 100))
+	env.putObject(t, "photo.png", "image/png", bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, 100))
+
+	for _, tt := range []struct {
+		key      string
+		wantVary string
+	}{
+		{"data.json", varyEncoding},
+		{"photo.png", ""},
+	} {
+		for _, cacheStatus := range []string{"MISS", "HIT"} {
+			if cacheStatus == "HIT" {
+				env.waitCached(t, tt.key)
+			}
+			// Vary is needed whether or not this client asked for compression
+			for _, acceptEncoding := range []string{"gzip", "identity"} {
+				w := env.do(http.MethodGet, "/objects/"+testBucket+"/"+tt.key, nil, map[string]string{"Accept-Encoding": acceptEncoding})
+				if got := w.Header().Get("X-Cache"); got != cacheStatus {
+					t.Fatalf("%s: X-Cache = %q, want %s", tt.key, got, cacheStatus)
+				}
+				if got := w.Header().Get("Vary"); got != tt.wantVary {
+					t.Errorf("%s %s with Accept-Encoding %s: Vary = %q, want %q", tt.key, cacheStatus, acceptEncoding, got, tt.wantVary)
+				}
+				// Only the first request misses
+				if cacheStatus == "MISS" {
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestIncompressibleTextIsServedAsIdentity(t *testing.T) {
+	setMinSizeForCompression(t, 0)
+	env := newTestEnv(t)
+	data := make([]byte, 8<<10)
+	rand.NewChaCha8([32]byte{}).Read(data)
+	env.putObject(t, "noise.txt", "text/plain", data)
+	path := "/objects/" + testBucket + "/noise.txt"
+	headers := map[string]string{"Accept-Encoding": "br, gzip"}
+
+	for _, want := range []string{"MISS", "HIT"} {
+		if want == "HIT" {
+			entry := env.waitCached(t, "noise.txt")
+			// The decision is kept with the entry, so hits never compress again
+			if entry.IsCompressed || entry.CompressedData != nil || entry.BrotliData != nil {
+				t.Errorf("cached entry keeps variants larger than the object: gzip %d, br %d bytes", len(entry.CompressedData), len(entry.BrotliData))
+			}
+		}
+		w := env.do(http.MethodGet, path, nil, headers)
+		if got := w.Header().Get("X-Cache"); got != want {
+			t.Fatalf("X-Cache = %q, want %q", got, want)
+		}
+		if encoding := w.Header().Get("Content-Encoding"); encoding != "" {
+			t.Errorf("%s: Content-Encoding = %q, want identity", want, encoding)
+		}
+		if !bytes.Equal(w.Body.Bytes(), data) {
+			t.Errorf("%s: body does not match the object", want)
+		}
+	}
+}
+
+func TestNoCompression(t *testing.T) {
+	setMinSizeForCompression(t, 0)
+	previous := noCompressionBuckets
+	noCompressionBuckets = map[string]bool{"lan-bucket": true}
+	t.Cleanup(func() { noCompressionBuckets = previous })
+	env := newTestEnv(t)
+	if err := env.client.MakeBucket(context.Background(), "lan-bucket", minio.MakeBucketOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte(`{"compressible":true}`), 200)
+	env.putObject(t, "data.json", "application/json", data)
+	if _, err := env.client.PutObject(context.Background(), "lan-bucket", "data.json", bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "application/json"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		bucket        string
+		noCompression string
+		wantEncoding  string
+	}{
+		{"compressed by default", testBucket, "", "gzip"},
+		{"header forces identity", testBucket, "1", ""},
+		{"header keeps compression", testBucket, "0", "gzip"},
+		{"invalid header is ignored", testBucket, "maybe", "gzip"},
+		{"bucket default", "lan-bucket", "", ""},
+		{"bucket default overridden", "lan-bucket", "0", "gzip"},
+		{"bucket default confirmed", "lan-bucket", "true", ""},
+	}
+	for _, cacheStatus := range []string{"MISS", "HIT"} {
+		for _, tt := range tests {
+			headers := map[string]string{"Accept-Encoding": "gzip"}
+			if tt.noCompression != "" {
+				headers[noCompressionHeader] = tt.noCompression
+			}
+			w := env.do(http.MethodGet, "/objects/"+tt.bucket+"/data.json", nil, headers)
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s %s: status = %d", tt.name, cacheStatus, w.Code)
+			}
+			if cacheStatus == "HIT" && w.Header().Get("X-Cache") != "HIT" {
+				t.Errorf("%s: X-Cache = %q, want HIT", tt.name, w.Header().Get("X-Cache"))
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("%s %s: Content-Encoding = %q, want %q", tt.name, cacheStatus, got, tt.wantEncoding)
+			}
+			if got := w.Header().Get("Vary"); got != varyEncoding {
+				t.Errorf("%s %s: Vary = %q, want %q", tt.name, cacheStatus, got, varyEncoding)
+			}
+			if tt.wantEncoding == "" && !bytes.Equal(w.Body.Bytes(), data) {
+				t.Errorf("%s %s: identity body differs from the object", tt.name, cacheStatus)
+			}
+		}
+		if cacheStatus == "MISS" {
+			env.waitCached(t, "data.json")
+			env.waitCachedIn(t, "lan-bucket", "data.json")
+		}
+	}
+}
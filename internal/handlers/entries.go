@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/muandane/estrois/internal/cache"
+	"github.com/muandane/estrois/internal/middleware"
+)
+
+const (
+	defaultEntriesLimit = 100
+	maxEntriesLimit     = 1000
+)
+
+type ListEntriesRequest struct{}
+
+// CacheEntrySummary describes a cached entry without its data
+type CacheEntrySummary struct {
+	Key            string    `json:"key"`
+	Size           int64     `json:"size"`
+	CompressedSize int64     `json:"compressed_size"`
+	ContentType    string    `json:"content_type"`
+	ETag           string    `json:"etag"`
+	StoredAt       time.Time `json:"stored_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	IsCompressed   bool      `json:"is_compressed"`
+}
+
+type ListEntriesResponse struct {
+	Entries   []CacheEntrySummary `json:"entries"`
+	Truncated bool                `json:"truncated"`
+}
+
+// handleListEntries lists cached entries for debugging, optionally for one
+// bucket. At most limit entries are returned, sorted by key; when more exist
+// the page is an arbitrary subset and Truncated is set. Keys scoped to some
+// buckets only see entries of those buckets, and tenants only their own keys.
+func (h *PurgeHandler) handleListEntries(ctx context.Context, req *Request, input ListEntriesRequest) (*ListEntriesResponse, error) {
+	limit := defaultEntriesLimit
+	if v := req.QueryParams["limit"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, &ValidationError{Field: "limit", Message: "must be a positive integer"}
+		}
+		limit = min(n, maxEntriesLimit)
+	}
+
+	var prefix string
+	if bucket := req.QueryParams["bucket"]; bucket != "" {
+		prefix = cache.GetCacheKey(bucket, tenantPrefix(ctx))
+	}
+	scope := middleware.APIKeyScopeFromContext(ctx)
+	tenant := tenantPrefix(ctx)
+
+	resp := &ListEntriesResponse{Entries: []CacheEntrySummary{}}
+	h.store.Range(prefix, func(key string, entry *cache.CacheEntry) bool {
+		bucket, objectKey, variant := cache.ParseCacheKey(key)
+		if len(scope) > 0 && !slices.Contains(scope, bucket) {
+			return true
+		}
+		if !strings.HasPrefix(objectKey, tenant) {
+			return true
+		}
+		if len(resp.Entries) == limit {
+			resp.Truncated = true
+			return false
+		}
+		resp.Entries = append(resp.Entries, CacheEntrySummary{
+			Key:            entryKey(bucket, clientKey(ctx, objectKey), variant),
+			Size:           entry.Size,
+			CompressedSize: entry.CompressedSize,
+			ContentType:    entry.ContentType,
+			ETag:           entry.ETag,
+			StoredAt:       entry.StoredAt,
+			ExpiresAt:      entry.ExpiresAt,
+			IsCompressed:   entry.IsCompressed,
+		})
+		return true
+	})
+	sort.Slice(resp.Entries, func(i, j int) bool { return resp.Entries[i].Key < resp.Entries[j].Key })
+
+	return resp, nil
+}
+
+// entryKey rebuilds the cache key shown for an entry once its object key is
+// mapped back to the client's view
+func entryKey(bucket, key, variant string) string {
+	if variant == "" {
+		return cache.GetCacheKey(bucket, key)
+	}
+	return cache.GetVariantKey(bucket, key, variant)
+}
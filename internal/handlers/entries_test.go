@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/muandane/estrois/internal/cache"
+)
+
+func listEntries(t *testing.T, mux *http.ServeMux, query string) *ListEntriesResponse {
+	t.Helper()
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/cache/entries"+query, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /cache/entries%s: status = %d, body %s", query, w.Code, w.Body)
+	}
+	var resp ListEntriesResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return &resp
+}
+
+func entryKeys(resp *ListEntriesResponse) []string {
+	keys := make([]string, len(resp.Entries))
+	for i, entry := range resp.Entries {
+		keys[i] = entry.Key
+	}
+	return keys
+}
+
+func TestListEntries(t *testing.T) {
+	setMinSizeForCompression(t, 0)
+	store := cache.NewMemoryStore(1 << 20)
+	text := bytes.Repeat([]byte("compressible "), 100)
+	store.Set(cache.GetCacheKey("photos", "a.txt"), cache.NewCacheEntry(text, "text/plain", time.Now(), `"etag-a"`, nil, time.Minute))
+	store.Set(cache.GetCacheKey("photos", "b.jpg"), cache.NewCacheEntry([]byte("JFIF image bytes"), "image/jpeg", time.Now(), `"etag-b"`, nil, time.Minute))
+	store.Set(cache.GetCacheKey("docs", "c.txt"), cacheTestEntry("c"))
+	mux := newPurgeMux(store)
+
+	resp := listEntries(t, mux, "")
+	if keys := entryKeys(resp); len(keys) != 3 || keys[0] != cache.GetCacheKey("docs", "c.txt") {
+		t.Fatalf("entries = %q, want all three sorted by key", keys)
+	}
+	if resp.Truncated {
+		t.Error("complete listing is marked truncated")
+	}
+	a := resp.Entries[1]
+	if a.Key != cache.GetCacheKey("photos", "a.txt") || a.Size != int64(len(text)) || a.ContentType != "text/plain" || a.ETag != `"etag-a"` {
+		t.Errorf("entry = %+v, want the text object's metadata", a)
+	}
+	if !a.IsCompressed || a.CompressedSize <= 0 || a.CompressedSize >= a.Size {
+		t.Errorf("entry is_compressed = %v, compressed size %d, want a smaller gzip variant", a.IsCompressed, a.CompressedSize)
+	}
+	if a.StoredAt.IsZero() || !a.ExpiresAt.After(a.StoredAt) {
+		t.Errorf("entry stored at %s, expires at %s", a.StoredAt, a.ExpiresAt)
+	}
+
+	// The listing never carries object bytes
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/cache/entries", nil))
+	if bytes.Contains(w.Body.Bytes(), []byte("compressible")) || bytes.Contains(w.Body.Bytes(), []byte("JFIF")) {
+		t.Error("listing contains object data")
+	}
+
+	if keys := entryKeys(listEntries(t, mux, "?bucket=photos")); len(keys) != 2 || keys[0] != cache.GetCacheKey("photos", "a.txt") || keys[1] != cache.GetCacheKey("photos", "b.jpg") {
+		t.Errorf("photos entries = %q", keys)
+	}
+	if resp := listEntries(t, mux, "?limit=2"); len(resp.Entries) != 2 || !resp.Truncated {
+		t.Errorf("limit=2 returned %d entries, truncated = %v", len(resp.Entries), resp.Truncated)
+	}
+	for _, query := range []string{"?limit=0", "?limit=ten"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/cache/entries"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEncodedETag(t *testing.T) {
+	tests := []struct {
+		etag, encoding, want string
+	}{
+		{`"abc"`, "", `"abc"`},
+		{`"abc"`, "gzip", `W/"abc-gzip"`},
+		{`"abc"`, "br", `W/"abc-br"`},
+		{`W/"abc"`, "gzip", `W/"abc-gzip"`},
+		{"", "gzip", ""},
+	}
+	for _, tt := range tests {
+		if got := encodedETag(tt.etag, tt.encoding); got != tt.want {
+			t.Errorf("encodedETag(%q, %q) = %q, want %q", tt.etag, tt.encoding, got, tt.want)
+		}
+	}
+}
+
+func TestETagMatch(t *testing.T) {
+	tests := []struct {
+		current, header string
+		strong, want    bool
+	}{
+		{`"abc"`, `"abc"`, true, true},
+		{`"abc"`, `W/"abc"`, true, false},
+		{`"abc"`, `W/"abc-gzip"`, true, false},
+		{`"abc"`, `W/"abc-gzip"`, false, true},
+		{`"abc"`, `W/"abc-br"`, false, true},
+		{`W/"abc-gzip"`, `"abc"`, false, true},
+		{`"abc"`, `"other", "abc"`, true, true},
+		{`"abc"`, `"abcd"`, false, false},
+		{`"abc"`, `abc`, true, true},
+		{`"abc"`, `*`, true, true},
+		{`"abc"`, ` * `, false, true},
+		{`W/"abc"`, `W/"abc"`, true, false},
+		{`W/"abc"`, `W/"abc"`, false, true},
+		{`"abc"`, `W/"x" , "abc" ,"y"`, true, true},
+		{`"abc"`, `"a,b", "abc"`, true, true},
+		{`"a,b"`, `"a,b"`, true, true},
+		{`"abc"`, `"a,b"`, false, false},
+		{`"abc"`, `"other", "abc`, false, false},
+		{`"abc"`, ``, false, false},
+		{``, `"abc"`, false, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatch(tt.current, tt.header, tt.strong); got != tt.want {
+			t.Errorf("etagMatch(%q, %q, strong=%v) = %v, want %v", tt.current, tt.header, tt.strong, got, tt.want)
+		}
+	}
+}
+
+func TestCompressedResponsesHaveTheirOwnETag(t *testing.T) {
+	setMinSizeForCompression(t, 0)
+	env := newTestEnv(t)
+	env.putObject(t, "styles.css", "text/css", bytes.Repeat([]byte("body { margin: 0 } "), 200))
+	path := "/objects/" + testBucket + "/styles.css"
+
+	identity := responseETag(env.do(http.MethodGet, path, nil, map[string]string{"Accept-Encoding": "identity"}))
+	if identity == "" || strings.HasPrefix(identity, "W/") {
+		t.Fatalf("identity ETag = %q, want the object's strong ETag", identity)
+	}
+	env.waitCached(t, "styles.css")
+	gzipETag := `W/"` + strings.Trim(identity, `"`) + `-gzip"`
+
+	for _, tt := range []struct {
+		acceptEncoding string
+		wantETag       string
+	}{
+		{"gzip", gzipETag},
+		{"identity", identity},
+	} {
+		headers := map[string]string{"Accept-Encoding": tt.acceptEncoding}
+		w := env.do(http.MethodGet, path, nil, headers)
+		if got := responseETag(w); got != tt.wantETag {
+			t.Errorf("%s: ETag = %q, want %q", tt.acceptEncoding, got, tt.wantETag)
+		}
+
+		// Either representation's tag validates the client's copy
+		for _, ifNoneMatch := range []string{identity, gzipETag} {
+			headers["If-None-Match"] = ifNoneMatch
+			w := env.do(http.MethodGet, path, nil, headers)
+			if w.Code != http.StatusNotModified {
+				t.Errorf("%s with If-None-Match %s: status = %d, want 304", tt.acceptEncoding, ifNoneMatch, w.Code)
+			}
+			if got := responseETag(w); got != tt.wantETag {
+				t.Errorf("%s 304: ETag = %q, want %q", tt.acceptEncoding, got, tt.wantETag)
+			}
+		}
+	}
+
+	// A compressed representation's weak tag never satisfies If-Match
+	if w := env.do(http.MethodPut, path, strings.NewReader("body {}"), map[string]string{"If-Match": gzipETag}); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT If-Match with the gzip ETag: status = %d, want 412", w.Code)
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import "io"
+
+// fillReader keeps a copy of an object streamed to a client and passes it to
+// commit once exactly size bytes have been read and written to the client.
+// The copy is dropped when a read or write fails or the reader is closed
+// early, as when the client disconnects, so a partial object is never cached.
+type fillReader struct {
+	io.ReadCloser
+	size   int64
+	data   []byte
+	commit func(data []byte)
+}
+
+func newFillReader(r io.ReadCloser, size int64, commit func(data []byte)) *fillReader {
+	return &fillReader{ReadCloser: r, size: size, data: make([]byte, 0, size), commit: commit}
+}
+
+func (r *fillReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if r.data == nil {
+		return n, err
+	}
+	r.data = append(r.data, p[:n]...)
+	if int64(len(r.data)) > r.size || err != nil && err != io.EOF {
+		r.data = nil
+	}
+	return n, err
+}
+
+// WriteTo streams the object to w, committing the copy only once all of it
+// has been written. The last bytes of an object can be read along with
+// io.EOF, so a copy complete on read may still fail to reach the client.
+func (r *fillReader) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.Copy(w, struct{ io.Reader }{r})
+	if err == nil && r.data != nil && int64(len(r.data)) == r.size {
+		r.commit(r.data)
+	}
+	r.data = nil
+	return n, err
+}
+
+func (r *fillReader) Close() error {
+	r.data = nil
+	return r.ReadCloser.Close()
+}
@@ -5,19 +5,28 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/muandane/estrois/internal/storage"
 )
 
 // Request represents the base request structure
 type Request struct {
-	Method      string
-	PathParams  map[string]string
-	QueryParams map[string]string
-	Headers     http.Header
-	Body        []byte
+	Method        string
+	PathParams    map[string]string
+	QueryParams   map[string]string
+	Headers       http.Header
+	Body          []byte
+	BodyStream    io.Reader
+	ContentLength int64
 }
 
 // Response represents the base response structure
@@ -39,10 +48,15 @@ type ErrorResponse struct {
 	Message string `json:"message"`
 }
 
+// defaultMaxBodyBytes caps buffered request bodies when a handler sets no limit
+const defaultMaxBodyBytes = 1 << 20
+
 // HandlerOptions contains configuration for the handler
 type HandlerOptions struct {
 	Logger        *slog.Logger
 	DecodeBody    bool
+	StreamBody    bool  // leave the body unread in Request.BodyStream
+	MaxBodyBytes  int64 // cap on buffered bodies, defaultMaxBodyBytes when zero
 	ValidateInput func(interface{}) error
 }
 
@@ -51,15 +65,46 @@ func Handle[T any, R any](handlerFunc HandlerFunc[T, R], opts HandlerOptions) ht
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger := opts.Logger
 		if logger == nil {
-			logger = slog.Default()
+			logger = LoggerFrom(r.Context())
 		}
+		r = r.WithContext(withLogger(r.Context(), logger))
 
-		req, err := parseRequest(r)
+		req, err := parseRequest(w, r, opts)
 		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				handleError(w, logger, &TooLargeError{Limit: maxBytesErr.Limit})
+				return
+			}
 			sendError(w, logger, http.StatusBadRequest, "failed to parse request", err)
 			return
 		}
 
+		// Name the request's span after the route it matched, such as
+		// "GET /objects/{bucket}/{key...}"
+		span := trace.SpanFromContext(r.Context())
+		if route := r.Pattern; route != "" {
+			if !strings.Contains(route, " ") {
+				route = r.Method + " " + route
+			}
+			span.SetName(route)
+		}
+		if bucket := req.PathParams["bucket"]; bucket != "" {
+			span.SetAttributes(attribute.String("bucket", bucket))
+		}
+		if key := req.PathParams["key"]; key != "" {
+			span.SetAttributes(attribute.String("key", key))
+		}
+
+		if value := req.QueryParams["timeout"]; value != "" {
+			timeout, err := parseOpTimeout(value)
+			if err != nil {
+				handleError(w, logger, err)
+				return
+			}
+			r = r.WithContext(withOpTimeout(r.Context(), timeout))
+		}
+
 		var input T
 		if opts.DecodeBody && len(req.Body) > 0 && r.Header.Get("Content-Type") == "application/json" {
 			if err := json.Unmarshal(req.Body, &input); err != nil {
@@ -85,19 +130,22 @@ func Handle[T any, R any](handlerFunc HandlerFunc[T, R], opts HandlerOptions) ht
 	}
 }
 
-func parseRequest(r *http.Request) (*Request, error) {
+func parseRequest(w http.ResponseWriter, r *http.Request, opts HandlerOptions) (*Request, error) {
 	req := &Request{
-		Method:      r.Method,
-		PathParams:  make(map[string]string),
-		QueryParams: make(map[string]string),
-		Headers:     r.Header,
+		Method:        r.Method,
+		PathParams:    make(map[string]string),
+		QueryParams:   make(map[string]string),
+		Headers:       r.Header,
+		ContentLength: r.ContentLength,
 	}
 
-	// Extract path parameters if they exist
-	for _, param := range []string{"bucket", "key"} {
-		if val := r.PathValue(param); val != "" {
-			req.PathParams[param] = val
-		}
+	// Extract path parameters if they exist. Keys are namespaced by tenant
+	// here so handlers only ever see storage keys.
+	if bucket := r.PathValue("bucket"); bucket != "" {
+		req.PathParams["bucket"] = bucket
+	}
+	if key := r.PathValue("key"); key != "" {
+		req.PathParams["key"] = tenantKey(r.Context(), key)
 	}
 
 	// Parse query parameters
@@ -105,9 +153,27 @@ func parseRequest(r *http.Request) (*Request, error) {
 		req.QueryParams[key] = r.URL.Query().Get(key)
 	}
 
-	// Read and store body if present
+	// Hand the body over unread when streaming; the handler bounds it
+	if opts.StreamBody {
+		req.BodyStream = r.Body
+		return req, nil
+	}
+
+	// Bodies of methods that carry no payload are never read unless decoded
+	if !opts.DecodeBody {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodDelete:
+			return req, nil
+		}
+	}
+
+	// Read and store body if present, up to the configured limit
 	if r.Body != nil {
-		body, err := io.ReadAll(r.Body)
+		maxBodyBytes := opts.MaxBodyBytes
+		if maxBodyBytes <= 0 {
+			maxBodyBytes = defaultMaxBodyBytes
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
 		if err != nil {
 			return nil, err
 		}
@@ -146,9 +212,28 @@ func handleError(w http.ResponseWriter, logger *slog.Logger, err error) {
 	case *ValidationError:
 		code = http.StatusBadRequest
 		message = "validation error"
+	case *TooLargeError:
+		code = http.StatusRequestEntityTooLarge
+		message = "request entity too large"
+	case *PreconditionFailedError:
+		code = http.StatusPreconditionFailed
+		message = "precondition failed"
 	default:
-		code = http.StatusInternalServerError
-		message = "internal server error"
+		// Errors that know their status keep it; anything else is assumed
+		// to come from storage
+		var coder StatusCoder
+		if !errors.As(err, &coder) {
+			coder = storage.NewError(err)
+		}
+		code = coder.StatusCode()
+		switch code {
+		case http.StatusInternalServerError:
+			message = "internal server error"
+		case http.StatusGatewayTimeout:
+			message = "storage operation timed out"
+		default:
+			message = strings.ToLower(http.StatusText(code))
+		}
 	}
 
 	sendError(w, logger, code, message, err)
@@ -193,6 +278,15 @@ func sendResponse(w http.ResponseWriter, logger *slog.Logger, response interface
 			bodyBytes := []byte(body)
 			w.Write(bodyBytes)
 			bodySize = len(bodyBytes)
+		case io.Reader:
+			if closer, ok := body.(io.Closer); ok {
+				defer closer.Close()
+			}
+			n, err := io.Copy(w, body)
+			if err != nil {
+				logger.Error("failed to stream response", "error", err, "bytes_written", n)
+			}
+			bodySize = int(n)
 		default:
 			if body != nil {
 				buf := &bytes.Buffer{}
@@ -231,6 +325,12 @@ func sendResponse(w http.ResponseWriter, logger *slog.Logger, response interface
 	)
 }
 
+// StatusCoder is implemented by errors that carry the HTTP status they
+// should be answered with
+type StatusCoder interface {
+	StatusCode() int
+}
+
 // Custom error types
 type NotFoundError struct {
 	Resource string
@@ -249,3 +349,33 @@ type ValidationError struct {
 func (e *ValidationError) Error() string {
 	return fmt.Sprintf("validation error: %s - %s", e.Field, e.Message)
 }
+
+type TooLargeError struct {
+	Limit int64
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("body exceeds the %d byte limit", e.Limit)
+}
+
+type PreconditionFailedError struct {
+	Header string
+}
+
+func (e *PreconditionFailedError) Error() string {
+	return fmt.Sprintf("%s precondition does not hold", e.Header)
+}
+
+// NotAcceptableError reports that the client accepts none of the content
+// codings a response can be sent with
+type NotAcceptableError struct {
+	AcceptEncoding string
+}
+
+func (e *NotAcceptableError) Error() string {
+	return fmt.Sprintf("no acceptable content coding for Accept-Encoding %q", e.AcceptEncoding)
+}
+
+func (e *NotAcceptableError) StatusCode() int {
+	return http.StatusNotAcceptable
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// trackingReader records whether its body was read
+type trackingReader struct {
+	io.Reader
+	read bool
+}
+
+func (r *trackingReader) Read(p []byte) (int, error) {
+	r.read = true
+	return r.Reader.Read(p)
+}
+
+func TestHandleLimitsBufferedBodies(t *testing.T) {
+	var got []byte
+	handler := Handle(func(ctx context.Context, req *Request, input struct{}) (*Response, error) {
+		got = req.Body
+		return &Response{StatusCode: http.StatusNoContent}, nil
+	}, HandlerOptions{Logger: slog.New(slog.DiscardHandler), MaxBodyBytes: 16})
+
+	tests := []struct {
+		name       string
+		body       []byte
+		wantStatus int
+	}{
+		{"at limit", bytes.Repeat([]byte("a"), 16), http.StatusNoContent},
+		{"over limit", bytes.Repeat([]byte("a"), 17), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusNoContent && !bytes.Equal(got, tt.body) {
+				t.Errorf("handler saw body %q, want %q", got, tt.body)
+			}
+		})
+	}
+}
+
+func TestHandleAppliesDefaultBodyLimit(t *testing.T) {
+	handler := Handle(func(ctx context.Context, req *Request, input struct{}) (*Response, error) {
+		return &Response{StatusCode: http.StatusNoContent}, nil
+	}, HandlerOptions{Logger: slog.New(slog.DiscardHandler)})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(make([]byte, defaultMaxBodyBytes+1))))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d for a body over the default limit, want 413", w.Code)
+	}
+}
+
+func TestHandleNeverReadsBodiesOfReads(t *testing.T) {
+	var got []byte
+	handler := Handle(func(ctx context.Context, req *Request, input struct{}) (*Response, error) {
+		got = req.Body
+		return &Response{StatusCode: http.StatusNoContent}, nil
+	}, HandlerOptions{Logger: slog.New(slog.DiscardHandler), MaxBodyBytes: 16})
+
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodDelete} {
+		body := &trackingReader{Reader: bytes.NewReader(make([]byte, 1024))}
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, "/", body))
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%s: status = %d, want 204 despite the oversized body", method, w.Code)
+		}
+		if body.read || got != nil {
+			t.Errorf("%s: body was read", method)
+		}
+	}
+}
+
+// teapotError carries its own status
+type teapotError struct{}
+
+func (teapotError) Error() string   { return "short and stout" }
+func (teapotError) StatusCode() int { return http.StatusTeapot }
+
+func TestHandleErrorStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantMessage string
+	}{
+		{"access denied", fmt.Errorf("failed to get object: %w", minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusForbidden}), http.StatusForbidden, "forbidden"},
+		{"missing bucket", minio.ErrorResponse{Code: "NoSuchBucket"}, http.StatusNotFound, "not found"},
+		{"storage timeout", fmt.Errorf("failed to get object: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, "storage operation timed out"},
+		{"generic error", errors.New("something broke"), http.StatusInternalServerError, "internal server error"},
+		{"status coder", fmt.Errorf("wrapped: %w", teapotError{}), http.StatusTeapot, "i'm a teapot"},
+		{"validation", &ValidationError{Field: "key", Message: "bad"}, http.StatusBadRequest, "validation error"},
+		{"not found", &NotFoundError{Resource: "object", ID: "k"}, http.StatusNotFound, "resource not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Handle(func(ctx context.Context, req *Request, input struct{}) (*Response, error) {
+				return nil, tt.err
+			}, HandlerOptions{Logger: slog.New(slog.DiscardHandler)})
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+			var resp ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Code != tt.wantStatus || resp.Message != tt.wantMessage || resp.Error != tt.err.Error() {
+				t.Errorf("body = %+v, want code %d, message %q and the error", resp, tt.wantStatus, tt.wantMessage)
+			}
+		})
+	}
+}
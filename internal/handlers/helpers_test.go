@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/muandane/estrois/internal/cache"
+	"github.com/muandane/estrois/internal/storage"
+)
+
+const testBucket = "test-bucket"
+
+// testEnv serves an ObjectHandler backed by an in-memory S3 server and
+// records the requests that reach storage
+type testEnv struct {
+	handler *ObjectHandler
+	mux     *http.ServeMux
+	client  *minio.Client
+	store   *cache.MemoryStore
+
+	mu       sync.Mutex
+	requests []string
+	ranges   []string
+	// cacheControl holds the Cache-Control of uploaded objects, which the
+	// fake server does not keep
+	cacheControl map[string]string
+	// beforeStorage, when set, runs before each request reaches storage
+	beforeStorage func(r *http.Request)
+	// beforeStorageResponse, when set, runs once storage has handled a
+	// request, before its response is sent
+	beforeStorageResponse func(r *http.Request)
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	env := &testEnv{cacheControl: make(map[string]string)}
+	faker := gofakes3.New(s3mem.New()).Server()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		env.mu.Lock()
+		env.requests = append(env.requests, r.Method+" "+r.URL.Path)
+		if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+			env.ranges = append(env.ranges, rangeHeader)
+		}
+		switch r.Method {
+		case http.MethodPut:
+			if cacheControl := r.Header.Get("Cache-Control"); cacheControl != "" {
+				env.cacheControl[r.URL.Path] = cacheControl
+			}
+		case http.MethodGet, http.MethodHead:
+			if cacheControl, ok := env.cacheControl[r.URL.Path]; ok {
+				w.Header().Set("Cache-Control", cacheControl)
+			}
+		}
+		beforeStorage, beforeResponse := env.beforeStorage, env.beforeStorageResponse
+		env.mu.Unlock()
+		if beforeStorage != nil {
+			beforeStorage(r)
+		}
+		if beforeResponse != nil {
+			w = &heldResponseWriter{ResponseWriter: w, hold: func() { beforeResponse(r) }}
+		}
+		faker.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	endpoint, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// V2 signatures keep uploads of unknown length from being sent
+	// aws-chunked, which the fake server would store undecoded
+	env.client, err = minio.New(endpoint.Host, &minio.Options{
+		Creds:  credentials.NewStaticV2("key", "secret", ""),
+		Region: "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.client.MakeBucket(context.Background(), testBucket, minio.MakeBucketOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	env.store = cache.NewMemoryStore(cache.MaxCacheSize)
+	env.handler, err = NewObjectHandler(storage.NewBackends(env.client), env.store, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.mux = http.NewServeMux()
+	env.handler.RegisterRoutes(env.mux)
+	env.resetRequests()
+	return env
+}
+
+// useStore makes the handler cache into store
+func (env *testEnv) useStore(store *cache.MemoryStore) {
+	env.store = store
+	env.handler.store = store
+}
+
+// stopStorage points the handler at a storage server that refuses
+// connections, as when the origin is down
+func (env *testEnv) stopStorage(t *testing.T) {
+	t.Helper()
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	endpoint, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:      credentials.NewStaticV2("key", "secret", ""),
+		Region:     "us-east-1",
+		MaxRetries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.handler.clients = storage.NewBackends(client)
+}
+
+// onStorageRequest runs hook before each later request reaches storage
+func (env *testEnv) onStorageRequest(hook func(r *http.Request)) {
+	env.mu.Lock()
+	env.beforeStorage = hook
+	env.mu.Unlock()
+}
+
+// onStorageResponse runs hook once storage has handled each later request,
+// before the response is sent. A GET has then read the object it returns.
+func (env *testEnv) onStorageResponse(hook func(r *http.Request)) {
+	env.mu.Lock()
+	env.beforeStorageResponse = hook
+	env.mu.Unlock()
+}
+
+// heldResponseWriter runs hold before the response header is written
+type heldResponseWriter struct {
+	http.ResponseWriter
+	hold func()
+	held bool
+}
+
+func (w *heldResponseWriter) WriteHeader(code int) {
+	if !w.held {
+		w.held = true
+		w.hold()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *heldResponseWriter) Write(p []byte) (int, error) {
+	if !w.held {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// putObject stores an object directly in storage, bypassing the handler
+func (env *testEnv) putObject(t *testing.T, key, contentType string, data []byte) {
+	t.Helper()
+	env.putObjectWithOptions(t, key, data, minio.PutObjectOptions{ContentType: contentType})
+}
+
+// putObjectWithOptions stores an object with opts directly in storage
+func (env *testEnv) putObjectWithOptions(t *testing.T, key string, data []byte, opts minio.PutObjectOptions) {
+	t.Helper()
+	if _, err := env.client.PutObject(context.Background(), testBucket, key, bytes.NewReader(data), int64(len(data)), opts); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// do sends a request for path to the handler
+func (env *testEnv) do(method, path string, body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, body)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	return env.serve(req)
+}
+
+// serve sends req to the handler
+func (env *testEnv) serve(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	env.mux.ServeHTTP(w, req)
+	return w
+}
+
+// storageRequests returns the requests made to storage since the last reset
+func (env *testEnv) storageRequests() []string {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	return append([]string(nil), env.requests...)
+}
+
+// storageRanges returns the Range headers sent to storage since the last reset
+func (env *testEnv) storageRanges() []string {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	return append([]string(nil), env.ranges...)
+}
+
+func (env *testEnv) resetRequests() {
+	env.mu.Lock()
+	env.requests = nil
+	env.ranges = nil
+	env.mu.Unlock()
+}
+
+// objectGets counts the GET requests for key that reached storage
+func (env *testEnv) objectGets(key string) int {
+	var gets int
+	for _, request := range env.storageRequests() {
+		if request == "GET /"+testBucket+"/"+key {
+			gets++
+		}
+	}
+	return gets
+}
+
+// waitCached waits for the entry a miss caches in the background for key
+func (env *testEnv) waitCached(t *testing.T, key string) *cache.CacheEntry {
+	t.Helper()
+	return env.waitCachedIn(t, testBucket, key)
+}
+
+// waitCachedIn is waitCached for an object in bucket
+func (env *testEnv) waitCachedIn(t *testing.T, bucket, key string) *cache.CacheEntry {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if entry, status := env.store.Get(objectCacheKey(bucket, key, "")); status != cache.StatusMiss {
+			return entry
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s/%s was not cached", bucket, key)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// setMinSizeForCompression compresses cached objects of at least size bytes
+// for the duration of the test
+func setMinSizeForCompression(t *testing.T, size int64) {
+	previous := cache.MinSizeForCompression
+	cache.MinSizeForCompression = size
+	t.Cleanup(func() { cache.MinSizeForCompression = previous })
+}
+
+// responseETag returns the ETag of a response. Handlers set the header under
+// its usual spelling, which http.Header.Get does not find.
+func responseETag(w *httptest.ResponseRecorder) string {
+	if values := w.Header()["ETag"]; len(values) > 0 {
+		return values[0]
+	}
+	return w.Header().Get("ETag")
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestObjectKeysFromPath(t *testing.T) {
+	env := newTestEnv(t)
+	tests := []struct {
+		name    string
+		path    string
+		wantKey string
+	}{
+		{"nested", "a/b/c.txt", "a/b/c.txt"},
+		{"encoded slash", "dir%2Fname.txt", "dir/name.txt"},
+		{"space", "annual%20report.pdf", "annual report.pdf"},
+		{"plus stays literal", "c++.txt", "c++.txt"},
+		{"percent", "100%25.txt", "100%.txt"},
+		{"unicode", "caf%C3%A9/menu.txt", "café/menu.txt"},
+		{"trailing slash", "folder/", "folder/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/objects/" + testBucket + "/" + tt.path
+			body := "object " + tt.wantKey
+			if w := env.do(http.MethodPut, path, strings.NewReader(body), nil); w.Code != http.StatusOK {
+				t.Fatalf("PUT %s: status = %d, body %s", path, w.Code, w.Body)
+			}
+			if _, err := env.client.StatObject(context.Background(), testBucket, tt.wantKey, minio.StatObjectOptions{}); err != nil {
+				t.Errorf("object not stored under %q: %v", tt.wantKey, err)
+			}
+			if w := env.do(http.MethodGet, path, nil, nil); w.Code != http.StatusOK || w.Body.String() != body {
+				t.Errorf("GET %s: status = %d, body %q", path, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestObjectPathWithoutKey(t *testing.T) {
+	env := newTestEnv(t)
+	for _, path := range []string{"/objects/" + testBucket + "/", "/objects/" + testBucket} {
+		if w := env.do(http.MethodGet, path, nil, nil); w.Code == http.StatusOK {
+			t.Errorf("GET %s: status = %d, want an error without a key", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/muandane/estrois/internal/middleware"
+	"github.com/muandane/estrois/internal/storage"
+)
+
+const (
+	defaultMaxKeys = 1000
+	maxMaxKeys     = 1000
+)
+
+type ListObjectsRequest struct{}
+
+type ObjectSummary struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	ETag         string    `json:"etag"`
+}
+
+type ListObjectsResponse struct {
+	Objects        []ObjectSummary `json:"objects"`
+	CommonPrefixes []string        `json:"common_prefixes,omitempty"`
+	NextToken      string          `json:"next_token,omitempty"`
+}
+
+// ListHandler returns the handler for GET /objects/{bucket}
+func (h *ObjectHandler) ListHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := h.logger.With(
+			"request_id", middleware.RequestIDFromContext(r.Context()),
+			"method", r.Method,
+			"bucket", r.PathValue("bucket"),
+			"remote_addr", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		)
+		Handle(h.handleList, HandlerOptions{Logger: logger})(w, r)
+	}
+}
+
+func (h *ObjectHandler) handleList(ctx context.Context, req *Request, input ListObjectsRequest) (*ListObjectsResponse, error) {
+	bucket := req.PathParams["bucket"]
+	if err := storage.ValidateBucketName(bucket); err != nil {
+		return nil, &ValidationError{Field: "path", Message: err.Error()}
+	}
+
+	maxKeys := defaultMaxKeys
+	if v := req.QueryParams["max-keys"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, &ValidationError{Field: "max-keys", Message: "must be a positive integer"}
+		}
+		maxKeys = min(n, maxMaxKeys)
+	}
+
+	delimiter := req.QueryParams["delimiter"]
+	if delimiter != "" && delimiter != "/" {
+		return nil, &ValidationError{Field: "delimiter", Message: "only \"/\" is supported"}
+	}
+
+	// The continuation token is the last key of the previous page
+	var startAfter string
+	if token := req.QueryParams["continuation-token"]; token != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			return nil, &ValidationError{Field: "continuation-token", Message: "invalid token"}
+		}
+		startAfter = string(decoded)
+	}
+
+	client, err := h.client(bucket)
+	if err != nil {
+		return nil, err
+	}
+	listCtx, cancel := storageContext(ctx)
+	defer cancel()
+
+	resp := &ListObjectsResponse{Objects: []ObjectSummary{}}
+	var lastKey string
+	count := 0
+	for obj := range client.ListObjects(listCtx, bucket, minio.ListObjectsOptions{
+		Prefix:     tenantKey(ctx, req.QueryParams["prefix"]),
+		Recursive:  delimiter == "",
+		StartAfter: startAfter,
+		MaxKeys:    maxKeys,
+	}) {
+		if obj.Err != nil {
+			if minio.ToErrorResponse(obj.Err).Code == "NoSuchBucket" {
+				return nil, &NotFoundError{Resource: "bucket", ID: bucket}
+			}
+			return nil, obj.Err
+		}
+		// Fetch one extra entry to know whether another page exists
+		if count == maxKeys {
+			resp.NextToken = base64.RawURLEncoding.EncodeToString([]byte(lastKey))
+			break
+		}
+		count++
+		lastKey = obj.Key
+
+		// Common prefixes carry only a key. Resume after every key they cover.
+		if delimiter != "" && obj.ETag == "" && strings.HasSuffix(obj.Key, delimiter) {
+			resp.CommonPrefixes = append(resp.CommonPrefixes, clientKey(ctx, obj.Key))
+			lastKey = obj.Key + string(utf8.MaxRune)
+			continue
+		}
+		resp.Objects = append(resp.Objects, ObjectSummary{
+			Key:          clientKey(ctx, obj.Key),
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+			ETag:         obj.ETag,
+		})
+	}
+
+	LoggerFrom(ctx).Info("objects listed",
+		"count", count,
+		"truncated", resp.NextToken != "",
+	)
+
+	return resp, nil
+}
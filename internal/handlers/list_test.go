@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// newListEnv returns a testEnv that also serves bucket listings
+func newListEnv(t *testing.T) *testEnv {
+	env := newTestEnv(t)
+	env.mux.Handle("GET /objects/{bucket}", env.handler.ListHandler())
+	return env
+}
+
+// list lists a bucket through the list handler with the given query
+func (env *testEnv) list(t *testing.T, bucket string, query url.Values) ListObjectsResponse {
+	t.Helper()
+	w := env.do(http.MethodGet, "/objects/"+bucket+"?"+query.Encode(), nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list %s?%s: status = %d, body %s", bucket, query.Encode(), w.Code, w.Body)
+	}
+	var resp ListObjectsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func objectKeys(resp ListObjectsResponse) []string {
+	keys := []string{}
+	for _, obj := range resp.Objects {
+		keys = append(keys, obj.Key)
+	}
+	return keys
+}
+
+func TestListPaginates(t *testing.T) {
+	env := newListEnv(t)
+	for _, key := range []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt"} {
+		env.putObject(t, key, "text/plain", []byte(key))
+	}
+
+	first := env.list(t, testBucket, url.Values{"max-keys": {"3"}})
+	if keys := objectKeys(first); !slices.Equal(keys, []string{"a.txt", "b.txt", "c.txt"}) {
+		t.Errorf("first page = %v", keys)
+	}
+	if first.NextToken == "" {
+		t.Fatal("first page has no next token")
+	}
+	if obj := first.Objects[0]; obj.Size != 5 || obj.ETag == "" || obj.LastModified.IsZero() {
+		t.Errorf("object summary = %+v", obj)
+	}
+
+	second := env.list(t, testBucket, url.Values{"max-keys": {"3"}, "continuation-token": {first.NextToken}})
+	if keys := objectKeys(second); !slices.Equal(keys, []string{"d.txt", "e.txt"}) {
+		t.Errorf("second page = %v", keys)
+	}
+	if second.NextToken != "" {
+		t.Errorf("last page has next token %q", second.NextToken)
+	}
+}
+
+func TestListPrefixAndDelimiter(t *testing.T) {
+	env := newListEnv(t)
+	for _, key := range []string{"docs/a.txt", "docs/img/b.png", "docs/img/c.png", "top.txt"} {
+		env.putObject(t, key, "text/plain", []byte(key))
+	}
+
+	resp := env.list(t, testBucket, url.Values{"prefix": {"docs/"}, "delimiter": {"/"}})
+	if keys := objectKeys(resp); !slices.Equal(keys, []string{"docs/a.txt"}) {
+		t.Errorf("objects = %v, want [docs/a.txt]", keys)
+	}
+	if !slices.Equal(resp.CommonPrefixes, []string{"docs/img/"}) {
+		t.Errorf("common prefixes = %v, want [docs/img/]", resp.CommonPrefixes)
+	}
+}
+
+func TestListEmptyBucket(t *testing.T) {
+	env := newListEnv(t)
+	if err := env.client.MakeBucket(context.Background(), "empty-bucket", minio.MakeBucketOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	w := env.do(http.MethodGet, "/objects/empty-bucket", nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(w.Body).Decode(&raw); err != nil {
+		t.Fatal(err)
+	}
+	if string(raw["objects"]) != "[]" {
+		t.Errorf("objects = %s, want []", raw["objects"])
+	}
+}
+
+func TestListRejectsInvalidParameters(t *testing.T) {
+	env := newListEnv(t)
+	for _, query := range []string{"max-keys=0", "max-keys=many", "delimiter=%7C", "continuation-token=%21%21"} {
+		if w := env.do(http.MethodGet, "/objects/"+testBucket+"?"+query, nil, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+)
+
+type loggerKey struct{}
+
+// withLogger returns a copy of ctx carrying logger
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFrom returns the request-scoped logger stored in ctx by Handle, so
+// log lines share the request's fields such as request_id, bucket and key.
+// It falls back to slog.Default() outside a request.
+func LoggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
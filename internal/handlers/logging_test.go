@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/muandane/estrois/internal/middleware"
+)
+
+func TestAccessLogRecordsCacheOutcome(t *testing.T) {
+	setMinSizeForCompression(t, 0)
+	env := newTestEnv(t)
+	data := bytes.Repeat([]byte(`{"logged":true}`), 200)
+	env.putObject(t, "logged.json", "application/json", data)
+	var logs bytes.Buffer
+	handler := middleware.WithLogging(slog.New(slog.NewJSONHandler(&logs, nil)), nil)(env.mux)
+
+	get := func() map[string]any {
+		logs.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/objects/"+testBucket+"/logged.json", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		var record map[string]any
+		if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+			t.Fatalf("log line %q: %v", logs.String(), err)
+		}
+		return record
+	}
+
+	if record := get(); record["cache_status"] != "MISS" {
+		t.Errorf("first GET logged cache_status %v, want MISS", record["cache_status"])
+	}
+	env.waitCached(t, "logged.json")
+	record := get()
+	for field, want := range map[string]any{
+		"msg":              "http request completed",
+		"cache_status":     "HIT",
+		"content_type":     "application/json",
+		"content_encoding": "gzip",
+		"status":           float64(http.StatusOK),
+	} {
+		if record[field] != want {
+			t.Errorf("cache hit logged %s = %v, want %v", field, record[field], want)
+		}
+	}
+	if size, _ := record["size"].(float64); size <= 0 || size >= float64(len(data)) {
+		t.Errorf("cache hit logged size %v, want the compressed length", record["size"])
+	}
+}
+
+// syncBuffer collects log output written from several goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) records(t *testing.T) []map[string]any {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestRequestLogLinesShareRequestID(t *testing.T) {
+	env := newTestEnv(t)
+	env.putObject(t, "traced.txt", "text/plain", []byte("traced"))
+	var logs syncBuffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	env.handler.logger = logger
+	handler := middleware.WithLogging(logger, nil)(env.mux)
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		req := httptest.NewRequest(method, "/objects/"+testBucket+"/traced.txt", nil)
+		req.Header.Set(middleware.RequestIDHeader, "req-"+method)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if method == http.MethodGet {
+			env.waitCached(t, "traced.txt")
+		}
+
+		records := logs.records(t)
+		logs.mu.Lock()
+		logs.buf.Reset()
+		logs.mu.Unlock()
+		// The handler's own lines plus the access log line
+		if len(records) < 2 {
+			t.Fatalf("%s logged %d lines, want at least 2", method, len(records))
+		}
+		for _, record := range records {
+			if record["request_id"] != "req-"+method {
+				t.Errorf("%s: line %q has request_id %v, want req-%s", method, record["msg"], record["request_id"], method)
+			}
+			if record["msg"] != "http request completed" && (record["bucket"] != testBucket || record["key"] != "traced.txt") {
+				t.Errorf("%s: line %q has bucket %v and key %v", method, record["msg"], record["bucket"], record["key"])
+			}
+		}
+	}
+}
+
+func TestLoggerFromFallsBackToDefault(t *testing.T) {
+	if got := LoggerFrom(t.Context()); got != slog.Default() {
+		t.Error("LoggerFrom() outside a request is not slog.Default()")
+	}
+	logger := slog.New(slog.DiscardHandler)
+	if got := LoggerFrom(withLogger(t.Context(), logger)); got != logger {
+		t.Error("LoggerFrom() did not return the stored logger")
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/muandane/estrois/internal/storage"
+)
+
+// ObjectMetadata describes an object without its body, as returned by
+// GET /objects/{bucket}/{key}?metadata
+type ObjectMetadata struct {
+	Size         int64             `json:"size"`
+	ContentType  string            `json:"content_type"`
+	ETag         string            `json:"etag"`
+	LastModified time.Time         `json:"last_modified"`
+	UserMetadata map[string]string `json:"user_metadata"`
+	// StorageClass is only known when the metadata comes from storage
+	StorageClass string `json:"storage_class,omitempty"`
+}
+
+// handleMetadata serves an object's metadata as JSON, from the cache when
+// possible, so tools need not parse HEAD response headers
+func (h *ObjectHandler) handleMetadata(ctx context.Context, req *Request) (*Response, error) {
+	bucket := req.PathParams["bucket"]
+	key := req.PathParams["key"]
+	if err := storage.ValidateName(bucket, key); err != nil {
+		return nil, &ValidationError{Field: "path", Message: err.Error()}
+	}
+
+	sse, err := customerEncryption(req.Headers)
+	if err != nil {
+		return nil, err
+	}
+	versionID, err := requestVersionID(req)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, entry, cacheStatus, err := h.statObject(ctx, bucket, key, versionID, sse)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.UserMetadata == nil {
+		metadata.UserMetadata = map[string]string{}
+	}
+
+	headers := http.Header{"X-Cache": []string{string(cacheStatus)}}
+	if entry != nil {
+		setCacheHit(headers, entry, cacheStatus)
+	}
+	return &Response{
+		StatusCode:  http.StatusOK,
+		Headers:     headers,
+		Body:        metadata,
+		ContentType: "application/json",
+	}, nil
+}
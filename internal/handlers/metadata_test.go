@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestUserMetadataRoundTrips(t *testing.T) {
+	env := newTestEnv(t)
+	path := "/objects/" + testBucket + "/tagged.txt"
+	w := env.do(http.MethodPut, path, bytes.NewReader([]byte("tagged")), map[string]string{
+		"Content-Type":       "text/plain",
+		"X-Amz-Meta-Owner":   "reports-team",
+		"X-Amz-Meta-Project": "estrois",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT: status = %d, body %s", w.Code, w.Body)
+	}
+
+	for _, tt := range []struct {
+		method string
+		cache  string
+	}{
+		{http.MethodGet, "MISS"},
+		{http.MethodGet, "HIT"},
+		{http.MethodHead, "HIT"},
+	} {
+		if tt.cache == "HIT" {
+			env.waitCached(t, "tagged.txt")
+		}
+		w := env.do(tt.method, path, nil, nil)
+		if got := w.Header().Get("X-Cache"); got != tt.cache {
+			t.Errorf("%s: X-Cache = %q, want %s", tt.method, got, tt.cache)
+		}
+		if owner, project := w.Header().Get("X-Amz-Meta-Owner"), w.Header().Get("X-Amz-Meta-Project"); owner != "reports-team" || project != "estrois" {
+			t.Errorf("%s %s: metadata owner = %q, project = %q", tt.method, tt.cache, owner, project)
+		}
+	}
+}
+
+func TestMetadataQuery(t *testing.T) {
+	env := newTestEnv(t)
+	data := []byte("quarterly numbers")
+	path := "/objects/" + testBucket + "/report.txt"
+	w := env.do(http.MethodPut, path, bytes.NewReader(data), map[string]string{
+		"Content-Type":     "text/plain",
+		"X-Amz-Meta-Owner": "finance",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT: status = %d, body %s", w.Code, w.Body)
+	}
+	info, err := env.client.StatObject(context.Background(), testBucket, "report.txt", minio.StatObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(t *testing.T) (map[string]any, ObjectMetadata) {
+		t.Helper()
+		w := env.do(http.MethodGet, path+"?metadata", nil, nil)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("GET ?metadata: status = %d, Content-Type %q", w.Code, w.Header().Get("Content-Type"))
+		}
+		if bytes.Contains(w.Body.Bytes(), data) {
+			t.Errorf("GET ?metadata returned the object body: %s", w.Body)
+		}
+		var fields map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &fields); err != nil {
+			t.Fatal(err)
+		}
+		var metadata ObjectMetadata
+		if err := json.Unmarshal(w.Body.Bytes(), &metadata); err != nil {
+			t.Fatal(err)
+		}
+		return fields, metadata
+	}
+	check := func(t *testing.T, metadata ObjectMetadata) {
+		t.Helper()
+		if metadata.Size != int64(len(data)) || metadata.ContentType != "text/plain" || metadata.ETag != info.ETag {
+			t.Errorf("metadata = %+v, want size %d, text/plain and ETag %s", metadata, len(data), info.ETag)
+		}
+		if !metadata.LastModified.Equal(info.LastModified) {
+			t.Errorf("last_modified = %s, want %s", metadata.LastModified, info.LastModified)
+		}
+		if metadata.UserMetadata["Owner"] != "finance" {
+			t.Errorf("user_metadata = %v, want Owner=finance", metadata.UserMetadata)
+		}
+	}
+
+	t.Run("uncached", func(t *testing.T) {
+		env.store.Delete(objectCacheKey(testBucket, "report.txt", ""))
+		fields, metadata := get(t)
+		// The fake storage reports no storage class, so it is omitted
+		want := []string{"content_type", "etag", "last_modified", "size", "user_metadata"}
+		if got := slices.Sorted(maps.Keys(fields)); !slices.Equal(got, want) {
+			t.Errorf("fields = %v, want %v", got, want)
+		}
+		check(t, metadata)
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		env.do(http.MethodGet, path, nil, nil)
+		env.waitCached(t, "report.txt")
+		env.resetRequests()
+		_, metadata := get(t)
+		check(t, metadata)
+		if requests := env.storageRequests(); len(requests) != 0 {
+			t.Errorf("cached metadata made storage requests %v", requests)
+		}
+	})
+
+	if w := env.do(http.MethodGet, "/objects/"+testBucket+"/missing.txt?metadata", nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET ?metadata of a missing object: status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/muandane/estrois/internal/middleware"
+)
+
+// scrapeMetrics returns the value of each series on the metrics page
+func scrapeMetrics(t *testing.T, metrics http.Handler) map[string]float64 {
+	t.Helper()
+	w := httptest.NewRecorder()
+	metrics.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	values := make(map[string]float64)
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		separator := strings.LastIndexByte(line, ' ')
+		if separator < 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if value, err := strconv.ParseFloat(line[separator+1:], 64); err == nil {
+			values[line[:separator]] = value
+		}
+	}
+	return values
+}
+
+func TestCacheOutcomesAreCountedPerBucket(t *testing.T) {
+	env := newTestEnv(t)
+	metrics := middleware.NewMetricsMiddleware([]string{testBucket})
+	env.handler.SetCacheRecorder(metrics)
+	env.putObject(t, "metered.txt", "text/plain", []byte("metered"))
+
+	hits := `cache_hits_total{bucket="` + testBucket + `"}`
+	misses := `cache_misses_total{bucket="` + testBucket + `"}`
+	before := scrapeMetrics(t, metrics)
+
+	env.do(http.MethodGet, "/objects/"+testBucket+"/metered.txt", nil, nil)
+	env.waitCached(t, "metered.txt")
+	env.do(http.MethodGet, "/objects/"+testBucket+"/metered.txt", nil, nil)
+
+	after := scrapeMetrics(t, metrics)
+	if got := after[hits] - before[hits]; got != 1 {
+		t.Errorf("%s grew by %v, want 1", hits, got)
+	}
+	if got := after[misses] - before[misses]; got != 1 {
+		t.Errorf("%s grew by %v, want 1", misses, got)
+	}
+	if _, ok := after[`cache_hits_total{bucket="other"}`]; !ok {
+		t.Error("unconfigured buckets have no series")
+	}
+}
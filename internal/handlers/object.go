@@ -1,25 +1,72 @@
 package handlers
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/muandane/estrois/internal/cache"
+	"github.com/muandane/estrois/internal/config"
+	"github.com/muandane/estrois/internal/middleware"
+	"github.com/muandane/estrois/internal/storage"
+	"github.com/muandane/estrois/internal/tracing"
 )
 
+// streamingPartSize is the multipart part size used for uploads of unknown length
+const streamingPartSize = 16 * 1024 * 1024
+
+// maxUploadSize caps the size of uploaded objects, set by MAX_UPLOAD_SIZE (default 50MB)
+var maxUploadSize = config.GetEnvWithDefaultSize("MAX_UPLOAD_SIZE", 50)
+
+// contentTypes maps file extensions to content types, set by CONTENT_TYPES
+var contentTypes = config.GetContentTypes()
+
+// indexDocuments maps buckets to the index document served for directory-style
+// keys, set by BUCKET_INDEX_DOCUMENT
+var indexDocuments = config.GetBucketIndexDocuments()
+
+// errorDocuments maps buckets to the object served as the body of 404
+// responses for missing objects, set by BUCKET_ERROR_DOCUMENT
+var errorDocuments = config.GetBucketErrorDocuments()
+
 // ObjectHandler handles object storage operations
 type ObjectHandler struct {
-	client *minio.Client
-	// cache  *cache.Manager
-	logger *slog.Logger
+	clients  ClientResolver
+	store    cache.Store
+	stats    *StatsHandler
+	recorder CacheRecorder
+	logger   *slog.Logger
+}
+
+// ClientResolver picks the storage client serving a bucket; *storage.Backends
+// implements it
+type ClientResolver interface {
+	ClientForBucket(bucket string) *minio.Client
+	// Allow fails when the backend serving bucket is known to be down
+	Allow(bucket string) error
+}
+
+// CacheRecorder receives per-bucket cache outcomes, e.g. for metrics
+type CacheRecorder interface {
+	RecordCacheHit(bucket string)
+	RecordCacheMiss(bucket string)
 }
 
 // Object request/response types
@@ -53,26 +100,55 @@ type ObjectResponse struct {
 	ETag            string
 }
 
-func NewObjectHandler(client *minio.Client, logger *slog.Logger) (*ObjectHandler, error) {
-	if client == nil {
-		return nil, fmt.Errorf("minio client cannot be nil")
+func NewObjectHandler(clients ClientResolver, store cache.Store, stats *StatsHandler, logger *slog.Logger) (*ObjectHandler, error) {
+	if clients == nil {
+		return nil, fmt.Errorf("storage clients cannot be nil")
+	}
+	if store == nil {
+		store = cache.NewMemoryStore(cache.MaxCacheSize)
+	}
+	if stats == nil {
+		stats = NewStatsHandler(store)
 	}
 	if logger == nil {
 		logger = slog.Default()
 	}
 	return &ObjectHandler{
-		client: client,
-		logger: logger,
+		clients: clients,
+		store:   store,
+		stats:   stats,
+		logger:  logger,
 	}, nil
 }
 
+// SetCacheRecorder reports cache hits and misses to recorder
+func (h *ObjectHandler) SetCacheRecorder(recorder CacheRecorder) {
+	h.recorder = recorder
+}
+
+// client returns the storage client serving bucket, or storage.ErrCircuitOpen when
+// its backend is known to be down so the request fails fast
+func (h *ObjectHandler) client(bucket string) (*minio.Client, error) {
+	if err := h.clients.Allow(bucket); err != nil {
+		return nil, err
+	}
+	return h.clients.ClientForBucket(bucket), nil
+}
+
+// RegisterRoutes serves objects under /objects/{bucket}/{key...}. The key is
+// taken unescaped from the remaining path segments, so it may contain
+// slashes, whether literal or encoded as %2F.
 func (h *ObjectHandler) RegisterRoutes(mux *http.ServeMux) {
-	mux.Handle("/objects/{bucket}/{key}", h.routeRequest())
+	mux.Handle("/objects/{bucket}/{key...}", h)
 }
 
+// objectMethods is the Allow header for /objects/{bucket}/{key}
+const objectMethods = "GET, PUT, DELETE, HEAD, OPTIONS"
+
 func (h *ObjectHandler) routeRequest() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger := h.logger.With(
+			"request_id", middleware.RequestIDFromContext(r.Context()),
 			"method", r.Method,
 			"bucket", r.PathValue("bucket"),
 			"key", r.PathValue("key"),
@@ -93,12 +169,20 @@ func (h *ObjectHandler) routeRequest() http.HandlerFunc {
 			handler = Handle(h.handlePut, HandlerOptions{
 				Logger:     logger,
 				DecodeBody: false,
+				StreamBody: true,
 			})
 		case http.MethodDelete:
 			handler = Handle(h.handleDelete, opts)
 		case http.MethodHead:
 			handler = Handle(h.handleHead, opts)
+		case http.MethodOptions:
+			// Advertise range support to clients probing before a ranged GET
+			w.Header().Set("Allow", objectMethods)
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.WriteHeader(http.StatusNoContent)
+			return
 		default:
+			w.Header().Set("Allow", objectMethods)
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
@@ -115,124 +199,415 @@ func (h *ObjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	handler(rw, r)
 }
 
+// handleGet serves an object, as an attachment named by the download query
+// parameter when one is given, or only its metadata with ?metadata
 func (h *ObjectHandler) handleGet(ctx context.Context, req *Request, input GetObjectRequest) (*Response, error) {
+	if _, ok := req.QueryParams["metadata"]; ok {
+		return h.handleMetadata(ctx, req)
+	}
+	resp, err := h.getIndexedObject(ctx, req, input)
+	var notFound *NotFoundError
+	if errors.As(err, &notFound) && notFound.Resource == "object" {
+		if errResp := h.getErrorDocument(ctx, req, input); errResp != nil {
+			return errResp, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if filename := req.QueryParams["download"]; filename != "" && resp.StatusCode != http.StatusNotModified {
+		if resp.Headers == nil {
+			resp.Headers = http.Header{}
+		}
+		resp.Headers.Set("Content-Disposition", contentDisposition(filename))
+	}
+	return resp, nil
+}
+
+// getIndexedObject serves the object at the requested key. In buckets with an
+// index document, a key ending in "/" serves the index document under it, and
+// so does a key with no object, as for "docs" serving "docs/index.html".
+func (h *ObjectHandler) getIndexedObject(ctx context.Context, req *Request, input GetObjectRequest) (*Response, error) {
+	document, ok := indexDocuments[req.PathParams["bucket"]]
+	if !ok {
+		return h.getObjectResponse(ctx, req, input)
+	}
+
+	key := req.PathParams["key"]
+	if key == "" {
+		key = tenantKey(ctx, "")
+	}
+	if key == "" || strings.HasSuffix(key, "/") {
+		req.PathParams["key"] = key + document
+		return h.getObjectResponse(ctx, req, input)
+	}
+
+	resp, err := h.getObjectResponse(ctx, req, input)
+	var notFound *NotFoundError
+	if !errors.As(err, &notFound) || req.QueryParams["versionId"] != "" {
+		return resp, err
+	}
+	req.PathParams["key"] = key + "/" + document
+	if indexResp, indexErr := h.getObjectResponse(ctx, req, input); !errors.As(indexErr, &notFound) {
+		return indexResp, indexErr
+	}
+	return nil, err
+}
+
+// getErrorDocument returns the bucket's error document as a 404 response, or
+// nil when the bucket has none or it cannot be served. It is fetched like any
+// object, cache included, but without the request's range and conditions,
+// which applied to the missing object.
+func (h *ObjectHandler) getErrorDocument(ctx context.Context, req *Request, input GetObjectRequest) *Response {
+	bucket := req.PathParams["bucket"]
+	document, ok := errorDocuments[bucket]
+	if !ok {
+		return nil
+	}
+
+	headers := req.Headers.Clone()
+	for _, name := range []string{"Range", "If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+		headers.Del(name)
+	}
+	resp, err := h.getObjectResponse(ctx, &Request{
+		Method:      req.Method,
+		PathParams:  map[string]string{"bucket": bucket, "key": tenantKey(ctx, document)},
+		QueryParams: map[string]string{},
+		Headers:     headers,
+	}, input)
+	if err != nil {
+		LoggerFrom(ctx).Warn("error document unavailable", "document", document, "error", err)
+		return nil
+	}
+
+	resp.StatusCode = http.StatusNotFound
+	delete(resp.Headers, "ETag")
+	resp.Headers.Del("Last-Modified")
+	return resp
+}
+
+func (h *ObjectHandler) getObjectResponse(ctx context.Context, req *Request, input GetObjectRequest) (*Response, error) {
 	bucket := req.PathParams["bucket"]
 	key := req.PathParams["key"]
-	if bucket == "" || key == "" {
-		return nil, &ValidationError{Field: "path", Message: "invalid bucket or key"}
+	if err := storage.ValidateName(bucket, key); err != nil {
+		return nil, &ValidationError{Field: "path", Message: err.Error()}
 	}
 
-	cacheKey := cache.GetCacheKey(bucket, key)
-	acceptsGzip := strings.Contains(req.Headers.Get("Accept-Encoding"), "gzip")
+	sse, err := customerEncryption(req.Headers)
+	if err != nil {
+		return nil, err
+	}
+	versionID, err := requestVersionID(req)
+	if err != nil {
+		return nil, err
+	}
+	if sse != nil {
+		return h.getEncrypted(ctx, req, bucket, key, versionID, sse)
+	}
+
+	cacheKey := objectCacheKey(bucket, key, versionID)
+	if cache.IsNegative(cacheKey) {
+		return nil, &NotFoundError{Resource: "object", ID: key}
+	}
+
+	accepted := requestAcceptEncoding(bucket, req.Headers)
+
+	rangeHeader := req.Headers.Get("Range")
 
 	// Fast path: Check cache
-	if entry, found := cache.GetFromCache(cacheKey); found {
-		var responseData []byte
-		var contentEncoding string
-		if acceptsGzip && entry.IsCompressed && entry.CompressedData != nil {
-			responseData = entry.CompressedData
-			contentEncoding = "gzip"
-		} else {
-			responseData = entry.Data
+	entry, cacheStatus := h.lookupCache(ctx, bucket, key, cacheKey)
+	if cacheStatus == cache.StatusExpired && entry != nil {
+		if refreshed, ok := h.revalidate(ctx, bucket, key, versionID, cacheKey, entry); ok {
+			entry, cacheStatus = refreshed, cache.StatusRevalidated
+		}
+	}
+	fresh := cacheStatus == cache.StatusHit || cacheStatus == cache.StatusRevalidated
+
+	// An entry cached by HEAD has no data, but still answers a conditional
+	// request the client's copy satisfies without going to storage
+	if fresh && entry.MetadataOnly {
+		if isNotModified(req.Headers, entry.ETag, entry.LastModified) {
+			h.stats.RecordHit()
+			if h.recorder != nil {
+				h.recorder.RecordCacheHit(bucket)
+			}
+			resp := notModifiedResponse(entry.ContentType, entry.ETag, entry.LastModified)
+			setCacheHit(resp.Headers, entry, cacheStatus)
+			return resp, nil
+		}
+		fresh, cacheStatus = false, cache.StatusMiss
+	}
+	if fresh {
+		h.stats.RecordHit()
+		if h.recorder != nil {
+			h.recorder.RecordCacheHit(bucket)
+		}
+		if cacheStatus == cache.StatusHit && entry.RefreshAhead() {
+			go h.refreshAhead(ctx, bucket, key, versionID, cacheKey, entry)
+		}
+
+		// A variant missing from the entry did not pay off, so identity is
+		// served instead, as on a miss, unless the client refuses it
+		contentEncoding, acceptable := negotiateEncoding(accepted, entry.ContentType, entry.Size)
+		if entry.Encoded(contentEncoding) == nil && accepted.quality("identity") > 0 {
+			contentEncoding = ""
+		}
+
+		if isNotModified(req.Headers, entry.ETag, entry.LastModified) {
+			etag := entry.ETag
+			if rangeHeader == "" {
+				etag = encodedETag(etag, contentEncoding)
+			}
+			resp := notModifiedResponse(entry.ContentType, etag, entry.LastModified)
+			setCacheHit(resp.Headers, entry, cacheStatus)
+			return resp, nil
+		}
+
+		if rangeHeader != "" {
+			ranges, err := parseRange(rangeHeader, entry.Size)
+			switch {
+			case errors.Is(err, errUnsatisfiableRange):
+				return rangeNotSatisfiable(entry.Size), nil
+			case err == nil:
+				headers := http.Header{
+					"Last-Modified": []string{entry.LastModified.UTC().Format(http.TimeFormat)},
+					"ETag":          []string{entry.ETag},
+				}
+				setCacheHit(headers, entry, cacheStatus)
+				setUserMetadata(headers, entry.UserMetadata)
+				data, err := h.entryBody(cacheKey, entry)
+				if err != nil {
+					return nil, err
+				}
+				return rangeResponse(ranges, entry.Size, entry.ContentType, headers, func(r byteRange) (io.ReadCloser, error) {
+					return io.NopCloser(bytes.NewReader(data[r.start : r.start+r.length])), nil
+				})
+			}
+		}
+
+		if !acceptable {
+			return nil, &NotAcceptableError{AcceptEncoding: req.Headers.Get("Accept-Encoding")}
+		}
+		responseData := entry.Encoded(contentEncoding)
+		if responseData == nil {
+			if responseData, err = h.entryBody(cacheKey, entry); err != nil {
+				return nil, err
+			}
+			if contentEncoding != "" {
+				if responseData, err = compressBody(responseData, contentEncoding); err != nil {
+					return nil, err
+				}
+			}
 		}
 
+		headers := http.Header{
+			"Content-Type":     []string{entry.ContentType},
+			"Content-Length":   []string{fmt.Sprintf("%d", len(responseData))},
+			"Last-Modified":    []string{entry.LastModified.UTC().Format(http.TimeFormat)},
+			"ETag":             []string{encodedETag(entry.ETag, contentEncoding)},
+			"Content-Encoding": []string{contentEncoding},
+			"Accept-Ranges":    []string{"bytes"},
+		}
+		setCacheHit(headers, entry, cacheStatus)
+		setUserMetadata(headers, entry.UserMetadata)
+		if cache.ShouldCompress(entry.ContentType, entry.Size) {
+			headers.Set("Vary", varyEncoding)
+		}
 		return &Response{
-			StatusCode: http.StatusOK,
-			Headers: http.Header{
-				"Content-Type":     []string{entry.ContentType},
-				"Content-Length":   []string{fmt.Sprintf("%d", len(responseData))},
-				"Last-Modified":    []string{entry.LastModified.UTC().Format(http.TimeFormat)},
-				"ETag":             []string{entry.ETag},
-				"Content-Encoding": []string{contentEncoding},
-				"X-Cache":          []string{"HIT"},
-			},
+			StatusCode:  http.StatusOK,
+			Headers:     headers,
 			Body:        responseData,
 			ContentType: entry.ContentType,
 		}, nil
 	}
 
-	// Get object stats first
-	obj, err := h.client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
-	if err != nil {
-		return nil, err
+	h.stats.RecordMiss()
+	if h.recorder != nil {
+		h.recorder.RecordCacheMiss(bucket)
 	}
-	defer obj.Close()
 
-	info, err := obj.Stat()
-	if err != nil {
-		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
-			return nil, &NotFoundError{Resource: "object", ID: key}
+	// Objects the bucket never caches are streamed as soon as they are too
+	// big to cache, rather than buffered
+	streamThreshold := min(cache.StreamThreshold, cache.MaxCacheableSize(bucket))
+
+	// A conditional request is checked against the object's metadata, so a
+	// client whose copy is current gets its 304 without the object being
+	// downloaded
+	if hasReadConditions(req.Headers) {
+		metadata, err := h.statFromStorage(ctx, bucket, key, versionID, nil, entry)
+		if err != nil {
+			return nil, err
+		}
+		if isNotModified(req.Headers, metadata.ETag, metadata.LastModified) {
+			// Assume compression pays off for a compressible object, as it
+			// would be served compressed
+			etag := metadata.ETag
+			if rangeHeader == "" && metadata.Size <= streamThreshold && cache.ShouldCompress(metadata.ContentType, metadata.Size) {
+				encoding, _ := accepted.negotiate("br", "gzip")
+				etag = encodedETag(etag, encoding)
+			}
+			resp := notModifiedResponse(metadata.ContentType, etag, metadata.LastModified)
+			resp.Headers.Set("X-Cache", string(cacheStatus))
+			return resp, nil
 		}
-		return nil, err
 	}
 
-	// For very large files, stream directly
-	if info.Size > cache.MaxCacheSize*2 {
-		h.logger.Info("large file detected, streaming response",
-			"size", info.Size,
+	if rangeHeader != "" {
+		if resp, ok, err := h.getRangeFromStorage(ctx, req, bucket, key, versionID, rangeHeader, cacheStatus, nil); ok || err != nil {
+			return resp, err
+		}
+	}
+
+	// Concurrent misses for the same key share a single fetch from storage.
+	// Only the request whose fetch ran sets streamObj. A request that stops
+	// waiting at its own timeout leaves the fetch to the others, and the
+	// stream it would have been handed is closed.
+	var (
+		streamMu  sync.Mutex
+		streamObj io.ReadCloser
+		gaveUp    bool
+	)
+	waitCtx, cancel := storageContext(ctx)
+	defer cancel()
+	fetched, shared, err := cache.FetchOnce(waitCtx, cacheKey, func() (*fetchedObject, error) {
+		generation := cache.FillGeneration(cacheKey)
+		obj, info, err := h.getObject(sharedContext(ctx), bucket, key, versionID, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		// Large files are not buffered; the caller streams them instead
+		if info.Size > streamThreshold {
+			streamMu.Lock()
+			defer streamMu.Unlock()
+			if gaveUp {
+				obj.Close()
+			} else {
+				streamObj = obj
+			}
+			return &fetchedObject{info: info, generation: generation}, nil
+		}
+		defer obj.Close()
+
+		data, err := io.ReadAll(obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read object data: %w", err)
+		}
+
+		LoggerFrom(ctx).Info("object retrieved from storage",
+			"size", len(data),
 			"content_type", info.ContentType,
 		)
-		headers := http.Header{
-			"Content-Type":  []string{info.ContentType},
-			"Last-Modified": []string{info.LastModified.UTC().Format(http.TimeFormat)},
-			"ETag":          []string{info.ETag},
-			"X-Cache":       []string{"BYPASS"},
+
+		// Cache smaller files in a goroutine, honoring the object's Cache-Control
+		ttl, cacheable := cache.CacheTTL(bucket, info.Metadata.Get("Cache-Control"))
+		if cacheable && int64(len(data)) <= cache.MaxCacheableSize(bucket) {
+			go func() {
+				cache.SetFetchedEntry(h.store, generation, cacheKey, data, info.ContentType, info.LastModified, info.ETag, info.UserMetadata, ttl)
+			}()
 		}
 
-		if acceptsGzip && cache.ShouldCompress(info.ContentType, info.Size) {
-			return &Response{
-				StatusCode:  http.StatusOK,
-				Headers:     headers,
-				Body:        obj,
-				ContentType: info.ContentType,
-				IsStreaming: true,
-			}, nil
+		return &fetchedObject{info: info, data: data, generation: generation}, nil
+	})
+	if waitCtx.Err() != nil && err != nil {
+		streamMu.Lock()
+		gaveUp = true
+		if streamObj != nil {
+			streamObj.Close()
 		}
+		streamMu.Unlock()
+		return nil, fmt.Errorf("waiting for storage: %w", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if shared {
+		LoggerFrom(ctx).Info("shared in-flight fetch from storage")
+	}
+
+	info, data, generation := fetched.info, fetched.data, fetched.generation
+
+	// Large files are streamed straight to the client, and cached only up to
+	// CACHE_STREAM_FILL_SIZE. The object reader is closed once the response
+	// has been written.
+	if info.Size > streamThreshold {
+		if _, ok := accepted.negotiate(); !ok {
+			if streamObj != nil {
+				streamObj.Close()
+			}
+			return nil, &NotAcceptableError{AcceptEncoding: req.Headers.Get("Accept-Encoding")}
+		}
+		if streamObj == nil {
+			generation = cache.FillGeneration(cacheKey)
+			if streamObj, info, err = h.getObject(ctx, bucket, key, versionID, nil); err != nil {
+				return nil, err
+			}
+		}
+		LoggerFrom(ctx).Info("large file detected, streaming response",
+			"size", info.Size,
+			"content_type", info.ContentType,
+		)
 
-		headers.Set("Content-Length", fmt.Sprintf("%d", info.Size))
+		// Objects small enough are cached from a copy kept while streaming
+		streamStatus := cache.StatusBypass
+		ttl, cacheable := cache.CacheTTL(bucket, info.Metadata.Get("Cache-Control"))
+		if cacheable && info.Size <= min(cache.StreamFillSize, cache.MaxCacheableSize(bucket)) {
+			streamObj = newFillReader(streamObj, info.Size, func(data []byte) {
+				go cache.SetFetchedEntry(h.store, generation, cacheKey, data, info.ContentType, info.LastModified, info.ETag, info.UserMetadata, ttl)
+			})
+			streamStatus = cacheStatus
+		}
+		headers := http.Header{
+			"Content-Type":   []string{info.ContentType},
+			"Content-Length": []string{fmt.Sprintf("%d", info.Size)},
+			"Last-Modified":  []string{info.LastModified.UTC().Format(http.TimeFormat)},
+			"ETag":           []string{info.ETag},
+			"Accept-Ranges":  []string{"bytes"},
+			"X-Cache":        []string{string(streamStatus)},
+		}
+		setUserMetadata(headers, info.UserMetadata)
 		return &Response{
 			StatusCode:  http.StatusOK,
 			Headers:     headers,
-			Body:        obj,
+			Body:        streamObj,
 			ContentType: info.ContentType,
 			IsStreaming: true,
 		}, nil
 	}
 
-	// For smaller files, read into memory
-	data, err := io.ReadAll(obj)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read object data: %w", err)
-	}
-
-	h.logger.Info("object retrieved from storage",
-		"size", len(data),
-		"content_type", info.ContentType,
-	)
-
-	// Cache smaller files in a goroutine
-	if int64(len(data)) <= cache.MaxCacheSize/2 {
-		go func() {
-			cache.AddToCache(cacheKey, data, info.ContentType, int64(len(data)), info.LastModified, info.ETag)
-		}()
-	}
-
 	headers := http.Header{
 		"Content-Type":  []string{info.ContentType},
 		"Last-Modified": []string{info.LastModified.UTC().Format(http.TimeFormat)},
 		"ETag":          []string{info.ETag},
-		"X-Cache":       []string{"MISS"},
+		"Accept-Ranges": []string{"bytes"},
+		"X-Cache":       []string{string(cacheStatus)},
+	}
+	setUserMetadata(headers, info.UserMetadata)
+
+	// Shared caches must not serve one client's encoding to another, even
+	// when compression ends up not paying off for this object
+	if cache.ShouldCompress(info.ContentType, int64(len(data))) {
+		headers.Set("Vary", varyEncoding)
+	}
+	encoding, ok := negotiateEncoding(accepted, info.ContentType, int64(len(data)))
+	if !ok {
+		return nil, &NotAcceptableError{AcceptEncoding: req.Headers.Get("Accept-Encoding")}
 	}
 
+	// Compression is skipped when it does not pay off, unless the client
+	// refuses uncompressed data
 	responseData := data
-	if acceptsGzip && cache.ShouldCompress(info.ContentType, int64(len(data))) {
-		if compressedData, err := cache.CompressData(data); err == nil && len(compressedData) < len(data) {
-			h.logger.Info("serving compressed data",
+	if encoding != "" {
+		compressedData, err := compressBody(data, encoding)
+		if err == nil && (len(compressedData) < len(data) || accepted.quality("identity") == 0) {
+			LoggerFrom(ctx).Info("serving compressed data",
+				"encoding", encoding,
 				"original_size", len(data),
 				"compressed_size", len(compressedData),
 			)
 			responseData = compressedData
-			headers.Set("Content-Encoding", "gzip")
+			headers.Set("Content-Encoding", encoding)
+			headers["ETag"] = []string{encodedETag(info.ETag, encoding)}
 		}
 	}
 
@@ -246,22 +621,408 @@ func (h *ObjectHandler) handleGet(ctx context.Context, req *Request, input GetOb
 	}, nil
 }
 
+// entryBody returns a cached entry's uncompressed data. An entry that fails
+// to decompress is dropped so the next request fetches from storage.
+func (h *ObjectHandler) entryBody(cacheKey string, entry *cache.CacheEntry) ([]byte, error) {
+	data, err := entry.Body()
+	if err != nil {
+		h.store.Delete(cacheKey)
+		return nil, fmt.Errorf("failed to decompress cached object: %w", err)
+	}
+	return data, nil
+}
+
+// setCacheHit marks a response as served from the cache, either as a plain
+// hit or after revalidating an expired entry. Stale entries are reported as
+// STALE with a Warning header.
+func setCacheHit(headers http.Header, entry *cache.CacheEntry, status cache.Status) {
+	if entry.Stale {
+		status = cache.StatusStale
+		headers.Set("Warning", `110 - "Response is Stale"`)
+	}
+	headers.Set("X-Cache", string(status))
+	headers.Set("X-Cache-Age", strconv.Itoa(int(entry.Age().Seconds())))
+}
+
+// userMetadataPrefix marks request and response headers carrying user metadata
+const userMetadataPrefix = "X-Amz-Meta-"
+
+// setUserMetadata echoes stored user metadata as X-Amz-Meta-* headers
+func setUserMetadata(headers http.Header, metadata map[string]string) {
+	for k, v := range metadata {
+		headers.Set(userMetadataPrefix+k, v)
+	}
+}
+
+// userMetadata collects X-Amz-Meta-* request headers, keyed without the prefix
+func userMetadata(headers http.Header) map[string]string {
+	metadata := make(map[string]string)
+	for k, v := range headers {
+		if name, ok := strings.CutPrefix(http.CanonicalHeaderKey(k), userMetadataPrefix); ok && name != "" && len(v) > 0 {
+			metadata[name] = v[0]
+		}
+	}
+	return metadata
+}
+
+// objectNotFound remembers a missing object in the negative cache and
+// returns the matching NotFoundError
+func objectNotFound(bucket, key string) error {
+	cache.AddNegative(cache.GetCacheKey(bucket, key))
+	return &NotFoundError{Resource: "object", ID: key}
+}
+
+// revalidate checks an expired cache entry against storage. When the object's
+// ETag is unchanged the entry is stored again with a fresh expiry and returned,
+// so the object is not downloaded again. Otherwise the entry is dropped and the
+// caller falls back to a normal fetch. When storage fails and
+// ServeStaleOnError is set, the entry is kept in service marked stale.
+func (h *ObjectHandler) revalidate(ctx context.Context, bucket, key, versionID, cacheKey string, entry *cache.CacheEntry) (*cache.CacheEntry, bool) {
+	if entry.ETag == "" {
+		return nil, false
+	}
+
+	refreshed, err := h.revalidateEntry(ctx, bucket, key, versionID, cacheKey, entry)
+	if err != nil {
+		LoggerFrom(ctx).Warn("cache revalidation failed",
+			"error", err,
+			"serve_stale", cache.ServeStaleOnError,
+		)
+		if !cache.ServeStaleOnError {
+			return nil, false
+		}
+		stale := entry.ServeStale(cache.StaleOnErrorTTL)
+		h.store.Set(cacheKey, stale)
+		return stale, true
+	}
+	if refreshed == nil {
+		return nil, false
+	}
+
+	LoggerFrom(ctx).Info("cache entry revalidated",
+		"etag", entry.ETag,
+	)
+	return refreshed, true
+}
+
+// revalidateEntry stats the object behind entry and stores a refreshed copy
+// of the entry when its ETag is unchanged. It returns nil after dropping the
+// entry when the object changed, is gone or is no longer cacheable.
+func (h *ObjectHandler) revalidateEntry(ctx context.Context, bucket, key, versionID, cacheKey string, entry *cache.CacheEntry) (*cache.CacheEntry, error) {
+	waitCtx, cancel := storageContext(ctx)
+	defer cancel()
+	refreshed, _, err := cache.FetchOnce(waitCtx, "revalidate:"+cacheKey, func() (*cache.CacheEntry, error) {
+		client, err := h.client(bucket)
+		if err != nil {
+			return nil, err
+		}
+		statCtx, cancel := storageContext(sharedContext(ctx))
+		defer cancel()
+
+		generation := cache.FillGeneration(cacheKey)
+		info, err := client.StatObject(statCtx, bucket, key, minio.StatObjectOptions{VersionID: versionID})
+		if err != nil {
+			if _, missing := missingObject(err, bucket, key, versionID); missing {
+				h.store.Delete(cacheKey)
+				return nil, nil
+			}
+			return nil, err
+		}
+		ttl, cacheable := cache.CacheTTL(bucket, info.Metadata.Get("Cache-Control"))
+		if info.ETag != entry.ETag || !cacheable {
+			h.store.Delete(cacheKey)
+			return nil, nil
+		}
+
+		// An object written or deleted since the stat is fetched again
+		refreshed := entry.Refresh(ttl)
+		if !cache.SetIfCurrent(h.store, generation, cacheKey, refreshed) {
+			return nil, nil
+		}
+		return refreshed, nil
+	})
+	return refreshed, err
+}
+
+// refreshAhead revalidates a popular entry in the background before it
+// expires, so its next hits do not wait on storage. An object that changed is
+// cached again. Failures leave the entry to expire as usual.
+func (h *ObjectHandler) refreshAhead(ctx context.Context, bucket, key, versionID, cacheKey string, entry *cache.CacheEntry) {
+	if entry.ETag == "" {
+		return
+	}
+	ctx = sharedContext(ctx)
+
+	refreshed, err := h.revalidateEntry(ctx, bucket, key, versionID, cacheKey, entry)
+	if err != nil {
+		LoggerFrom(ctx).Warn("cache refresh ahead of expiry failed",
+			"error", err,
+		)
+		return
+	}
+	if refreshed != nil {
+		LoggerFrom(ctx).Info("cache entry refreshed ahead of expiry",
+			"etag", entry.ETag,
+		)
+		return
+	}
+
+	if versionID != "" {
+		return
+	}
+	if status, err := h.warmObject(ctx, bucket, key, h.cacheRoom()); err != nil {
+		LoggerFrom(ctx).Warn("changed object not cached again ahead of expiry",
+			"status", status,
+			"error", err,
+		)
+	}
+}
+
+// getEncrypted serves an object stored with a customer-provided key straight
+// from storage. The decrypted object is never cached or shared with other
+// requests.
+func (h *ObjectHandler) getEncrypted(ctx context.Context, req *Request, bucket, key, versionID string, sse encrypt.ServerSide) (*Response, error) {
+	if rangeHeader := req.Headers.Get("Range"); rangeHeader != "" {
+		if resp, ok, err := h.getRangeFromStorage(ctx, req, bucket, key, versionID, rangeHeader, cache.StatusBypass, sse); ok || err != nil {
+			return resp, err
+		}
+	}
+
+	obj, info, err := h.getObject(ctx, bucket, key, versionID, sse)
+	if err != nil {
+		return nil, err
+	}
+	if isNotModified(req.Headers, info.ETag, info.LastModified) {
+		obj.Close()
+		resp := notModifiedResponse(info.ContentType, info.ETag, info.LastModified)
+		resp.Headers.Set("X-Cache", string(cache.StatusBypass))
+		return resp, nil
+	}
+
+	LoggerFrom(ctx).Info("serving encrypted object from storage",
+		"size", info.Size,
+		"content_type", info.ContentType,
+	)
+	headers := http.Header{
+		"Content-Type":   []string{info.ContentType},
+		"Content-Length": []string{fmt.Sprintf("%d", info.Size)},
+		"Last-Modified":  []string{info.LastModified.UTC().Format(http.TimeFormat)},
+		"ETag":           []string{info.ETag},
+		"Accept-Ranges":  []string{"bytes"},
+		"X-Cache":        []string{string(cache.StatusBypass)},
+	}
+	setUserMetadata(headers, info.UserMetadata)
+	return &Response{
+		StatusCode:  http.StatusOK,
+		Headers:     headers,
+		Body:        obj,
+		ContentType: info.ContentType,
+		IsStreaming: true,
+	}, nil
+}
+
+// fetchedObject is the result of a storage fetch shared between concurrent
+// requests, read at the object's cache.FillGeneration generation
+type fetchedObject struct {
+	info       minio.ObjectInfo
+	data       []byte
+	generation uint64
+}
+
+// getObject opens an object in storage and stats it, decrypting it with sse
+// when set. An empty versionID opens the current version. The caller must
+// close the returned reader. Reads fail once the backend stalls for longer
+// than the storage timeout.
+func (h *ObjectHandler) getObject(ctx context.Context, bucket, key, versionID string, sse encrypt.ServerSide) (_ io.ReadCloser, info minio.ObjectInfo, err error) {
+	ctx, span := startSpan(ctx, "storage.get", bucket, key)
+	defer func() {
+		if err == nil {
+			span.SetAttributes(attribute.Int64("bytes", info.Size))
+		}
+		tracing.End(span, err)
+	}()
+
+	client, err := h.client(bucket)
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+	release, err := acquireRead(ctx)
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+	timeout := newIdleTimeout(ctx)
+	obj, err := client.GetObject(timeout.ctx, bucket, key, minio.GetObjectOptions{ServerSideEncryption: sse, VersionID: versionID})
+	if err != nil {
+		timeout.stop()
+		release()
+		return nil, minio.ObjectInfo{}, timeout.err(err)
+	}
+
+	info, err = obj.Stat()
+	if err != nil {
+		obj.Close()
+		timeout.stop()
+		release()
+		if err, missing := missingObject(err, bucket, key, versionID); missing {
+			return nil, minio.ObjectInfo{}, err
+		}
+		return nil, minio.ObjectInfo{}, timeout.err(err)
+	}
+	timeout.touch()
+	return &idleReader{ReadCloser: obj, timeout: timeout, release: release}, info, nil
+}
+
+// getRangeFromStorage serves a ranged GET directly from storage. Ranged responses
+// are never compressed or cached. ok is false when the Range header is malformed
+// and the request should be served in full instead.
+func (h *ObjectHandler) getRangeFromStorage(ctx context.Context, req *Request, bucket, key, versionID, rangeHeader string, cacheStatus cache.Status, sse encrypt.ServerSide) (*Response, bool, error) {
+	client, err := h.client(bucket)
+	if err != nil {
+		return nil, false, err
+	}
+	statCtx, cancel := storageContext(ctx)
+	info, err := client.StatObject(statCtx, bucket, key, minio.StatObjectOptions{ServerSideEncryption: sse, VersionID: versionID})
+	cancel()
+	if err != nil {
+		err, _ = missingObject(err, bucket, key, versionID)
+		return nil, false, err
+	}
+
+	if isNotModified(req.Headers, info.ETag, info.LastModified) {
+		resp := notModifiedResponse(info.ContentType, info.ETag, info.LastModified)
+		resp.Headers.Set("X-Cache", string(cacheStatus))
+		return resp, true, nil
+	}
+
+	ranges, err := parseRange(rangeHeader, info.Size)
+	switch {
+	case errors.Is(err, errUnsatisfiableRange):
+		return rangeNotSatisfiable(info.Size), true, nil
+	case err != nil:
+		return nil, false, nil
+	}
+
+	LoggerFrom(ctx).Info("serving range from storage",
+		"size", info.Size,
+		"ranges", len(ranges),
+	)
+
+	headers := http.Header{
+		"Last-Modified": []string{info.LastModified.UTC().Format(http.TimeFormat)},
+		"ETag":          []string{info.ETag},
+		"X-Cache":       []string{string(cacheStatus)},
+	}
+	setUserMetadata(headers, info.UserMetadata)
+	resp, err := rangeResponse(ranges, info.Size, info.ContentType, headers, func(r byteRange) (io.ReadCloser, error) {
+		return h.getObjectRange(ctx, client, bucket, key, versionID, sse, r)
+	})
+	return resp, true, err
+}
+
+// getObjectRange opens a reader over one range of an object in storage. It
+// holds a read slot until the reader is closed, and fails once the backend
+// stalls for longer than the storage timeout.
+func (h *ObjectHandler) getObjectRange(ctx context.Context, client *minio.Client, bucket, key, versionID string, sse encrypt.ServerSide, r byteRange) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{ServerSideEncryption: sse, VersionID: versionID}
+	if err := opts.SetRange(r.start, r.end()); err != nil {
+		return nil, err
+	}
+	release, err := acquireRead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, span := startSpan(ctx, "storage.get", bucket, key)
+	span.SetAttributes(attribute.Int64("bytes", r.length))
+	timeout := newIdleTimeout(ctx)
+	obj, err := client.GetObject(timeout.ctx, bucket, key, opts)
+	tracing.End(span, err)
+	if err != nil {
+		timeout.stop()
+		release()
+		return nil, timeout.err(err)
+	}
+	return &idleReader{ReadCloser: obj, timeout: timeout, release: release}, nil
+}
+
 func (h *ObjectHandler) handlePut(ctx context.Context, req *Request, input PutObjectRequest) (*Response, error) {
 	bucket := req.PathParams["bucket"]
 	key := req.PathParams["key"]
 
-	if bucket == "" || key == "" {
-		return nil, &ValidationError{Field: "path", Message: "invalid bucket or key"}
+	if err := storage.ValidateName(bucket, key); err != nil {
+		return nil, &ValidationError{Field: "path", Message: err.Error()}
+	}
+
+	sse, err := customerEncryption(req.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.checkWritePreconditions(ctx, req.Headers, bucket, key, sse); err != nil {
+		return nil, err
+	}
+
+	if copySource := req.Headers.Get("X-Copy-Source"); copySource != "" {
+		return h.handleCopy(ctx, bucket, key, copySource)
+	}
+
+	client, err := h.client(bucket)
+	if err != nil {
+		return nil, err
 	}
 
 	cacheKey := cache.GetCacheKey(bucket, key)
-	cache.DeleteFromCache(cacheKey)
+	cache.DeleteFromCacheByObject(h.store, bucket, key)
+
+	if input.ContentType == "" {
+		input.ContentType = req.Headers.Get("Content-Type")
+	}
+	if input.ContentEncoding == "" {
+		input.ContentEncoding = req.Headers.Get("Content-Encoding")
+	}
+
+	size := req.ContentLength
+	if size > maxUploadSize {
+		return nil, &TooLargeError{Limit: maxUploadSize}
+	}
 
-	data := req.Body
+	// Uploads of unknown length, and gzip bodies once decompressed, are
+	// checked against the limit as they are read, so a gzip body expanding
+	// past the limit is rejected rather than buffered.
+	body := req.BodyStream
+	if body == nil {
+		body = bytes.NewReader(req.Body)
+	}
+	limited := []*limitedReader{{r: body, remaining: maxUploadSize}}
+	body = limited[0]
+
+	if input.ContentEncoding == "gzip" {
+		gzipReader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, &ValidationError{Field: "body", Message: "failed to decompress data"}
+		}
+		defer gzipReader.Close()
+		limited = append(limited, &limitedReader{r: gzipReader, remaining: maxUploadSize})
+		body = limited[1]
+		size = -1
+		LoggerFrom(ctx).Info("decompressing request body on the fly")
+	}
 
+	// Without a Content-Type the key's extension decides, then the start of
+	// the body, peeked at so it can be sniffed without buffering the upload
+	bufferedBody := bufio.NewReaderSize(body, 512)
 	contentType := input.ContentType
 	if contentType == "" {
-		contentType = http.DetectContentType(data)
+		contentType = contentTypeByExtension(key)
+	}
+	if contentType == "" {
+		head, err := bufferedBody.Peek(512)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			if err := uploadLimitError(limited); err != nil {
+				return nil, err
+			}
+			return nil, &ValidationError{Field: "body", Message: "failed to read request body"}
+		}
+		contentType = http.DetectContentType(head)
 	}
 	if strings.Contains(contentType, "application/json") {
 		switch {
@@ -278,29 +1039,46 @@ func (h *ObjectHandler) handlePut(ctx context.Context, req *Request, input PutOb
 		}
 	}
 
-	if input.ContentEncoding == "gzip" {
-		var err error
-		data, err = cache.DecompressData(data)
-		if err != nil {
-			return nil, &ValidationError{Field: "body", Message: "failed to decompress data"}
-		}
-		h.logger.Info("decompressed request body", "decompressed_size", len(data))
+	// With an unknown size MinIO uploads in parts; cap the part size so
+	// memory stays bounded per upload
+	opts := minio.PutObjectOptions{
+		ContentType:          contentType,
+		UserMetadata:         userMetadata(req.Headers),
+		ServerSideEncryption: sse,
+	}
+	if size < 0 {
+		opts.PartSize = streamingPartSize
 	}
 
-	_, err := h.client.PutObject(
-		ctx,
+	// Uploads run as long as data keeps moving, either from the client
+	// or to storage
+	spanCtx, span := startSpan(ctx, "storage.put", bucket, key)
+	timeout := newIdleTimeout(spanCtx)
+	defer timeout.stop()
+	opts.Progress = timeout
+
+	info, err := client.PutObject(
+		timeout.ctx,
 		bucket,
 		key,
-		bytes.NewReader(data),
-		int64(len(data)),
-		minio.PutObjectOptions{ContentType: contentType},
+		&idleReader{ReadCloser: io.NopCloser(bufferedBody), timeout: timeout},
+		size,
+		opts,
 	)
+	span.SetAttributes(attribute.Int64("bytes", info.Size))
+	tracing.End(span, err)
 	if err != nil {
-		return nil, fmt.Errorf("failed to store object: %w", err)
+		if err := uploadLimitError(limited); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to store object: %w", timeout.err(err))
 	}
+	// Drop what GETs in flight during the upload cached of the old object
+	cache.DeleteFromCacheByObject(h.store, bucket, key)
+	cache.DeleteNegative(cacheKey)
 
-	h.logger.Info("object stored successfully",
-		"size", len(data),
+	LoggerFrom(ctx).Info("object stored successfully",
+		"size", info.Size,
 		"content_type", contentType,
 	)
 
@@ -309,24 +1087,206 @@ func (h *ObjectHandler) handlePut(ctx context.Context, req *Request, input PutOb
 	}, nil
 }
 
+// checkWritePreconditions enforces If-Match and If-None-Match on a write to
+// bucket/key, so a client cannot overwrite changes it has not seen. The object
+// is only looked up when one of the headers is present. A failed check also
+// drops a cached copy that no longer matches storage.
+func (h *ObjectHandler) checkWritePreconditions(ctx context.Context, headers http.Header, bucket, key string, sse encrypt.ServerSide) error {
+	if headers.Get("If-Match") == "" && headers.Get("If-None-Match") == "" {
+		return nil
+	}
+
+	client, err := h.client(bucket)
+	if err != nil {
+		return err
+	}
+	statCtx, cancel := storageContext(ctx)
+	defer cancel()
+
+	exists := true
+	info, err := client.StatObject(statCtx, bucket, key, minio.StatObjectOptions{ServerSideEncryption: sse})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+			return fmt.Errorf("failed to check write preconditions: %w", err)
+		}
+		exists = false
+	}
+
+	failed := failedWritePrecondition(headers, exists, info.ETag)
+	if failed == "" {
+		return nil
+	}
+
+	cacheKey := cache.GetCacheKey(bucket, key)
+	if entry, _ := h.store.Get(cacheKey); entry != nil && (!exists || entry.ETag != info.ETag) {
+		h.store.Delete(cacheKey)
+	}
+
+	LoggerFrom(ctx).Info("write precondition failed",
+		"header", failed,
+		"exists", exists,
+		"etag", info.ETag,
+	)
+	return &PreconditionFailedError{Header: failed}
+}
+
+// contentTypeByExtension returns the content type of key's file extension,
+// from CONTENT_TYPES or the system MIME table, or "" when it is unknown
+func contentTypeByExtension(key string) string {
+	ext := strings.ToLower(path.Ext(key))
+	if ext == "" {
+		return ""
+	}
+	if contentType, ok := contentTypes[ext]; ok {
+		return contentType
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// errUploadTooLarge is returned by limitedReader once the limit is passed
+var errUploadTooLarge = errors.New("upload exceeds size limit")
+
+// limitedReader fails reads once more than remaining bytes have been read
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, errUploadTooLarge
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.remaining {
+		l.exceeded = true
+		return int(l.remaining), errUploadTooLarge
+	}
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// uploadLimitError returns a TooLargeError once an upload has passed the
+// limit, either as sent or, for a gzip body, once decompressed
+func uploadLimitError(readers []*limitedReader) error {
+	for _, reader := range readers {
+		if reader.exceeded {
+			return &TooLargeError{Limit: maxUploadSize}
+		}
+	}
+	return nil
+}
+
+// handleCopy performs a server-side copy into bucket/key from an
+// X-Copy-Source header of the form "/srcBucket/srcKey"
+func (h *ObjectHandler) handleCopy(ctx context.Context, bucket, key, copySource string) (*Response, error) {
+	srcBucket, srcKey, err := parseCopySource(copySource)
+	if err != nil {
+		return nil, &ValidationError{Field: "X-Copy-Source", Message: err.Error()}
+	}
+	srcKey = tenantKey(ctx, srcKey)
+
+	// Server-side copies only work within a single backend
+	client := h.clients.ClientForBucket(bucket)
+	if h.clients.ClientForBucket(srcBucket) != client {
+		return nil, &ValidationError{Field: "X-Copy-Source", Message: "copy source is on a different storage backend"}
+	}
+	if err := h.clients.Allow(bucket); err != nil {
+		return nil, err
+	}
+
+	copyCtx, cancel := storageContext(ctx)
+	defer cancel()
+
+	info, err := client.CopyObject(copyCtx,
+		minio.CopyDestOptions{Bucket: bucket, Object: key},
+		minio.CopySrcOptions{Bucket: srcBucket, Object: srcKey},
+	)
+	if err != nil {
+		switch minio.ToErrorResponse(err).Code {
+		case "NoSuchKey":
+			return nil, objectNotFound(srcBucket, srcKey)
+		case "NoSuchBucket":
+			return nil, &NotFoundError{Resource: "bucket", ID: srcBucket}
+		}
+		return nil, fmt.Errorf("failed to copy object: %w", err)
+	}
+
+	cache.DeleteFromCacheByObject(h.store, bucket, key)
+	cache.DeleteNegative(cache.GetCacheKey(bucket, key))
+
+	LoggerFrom(ctx).Info("object copied successfully",
+		"source_bucket", srcBucket,
+		"source_key", srcKey,
+		"size", info.Size,
+	)
+
+	headers := http.Header{}
+	if info.ETag != "" {
+		headers["ETag"] = []string{info.ETag}
+	}
+
+	return &Response{
+		StatusCode: http.StatusOK,
+		Headers:    headers,
+	}, nil
+}
+
+// parseCopySource splits an X-Copy-Source header value into bucket and key.
+// The value may be URL-encoded and the leading slash is optional.
+func parseCopySource(copySource string) (string, string, error) {
+	source, err := url.PathUnescape(copySource)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid copy source encoding")
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	if bucket == "" || key == "" {
+		return "", "", fmt.Errorf("copy source must be /bucket/key")
+	}
+	if err := storage.ValidateName(bucket, key); err != nil {
+		return "", "", err
+	}
+	return bucket, key, nil
+}
+
 func (h *ObjectHandler) handleDelete(ctx context.Context, req *Request, input DeleteObjectRequest) (*Response, error) {
 	bucket := req.PathParams["bucket"]
 	key := req.PathParams["key"]
 
-	if bucket == "" || key == "" {
-		return nil, &ValidationError{Field: "path", Message: "invalid bucket or key"}
+	if err := storage.ValidateName(bucket, key); err != nil {
+		return nil, &ValidationError{Field: "path", Message: err.Error()}
+	}
+	versionID, err := requestVersionID(req)
+	if err != nil {
+		return nil, err
 	}
 
-	cacheKey := cache.GetCacheKey(bucket, key)
-	cache.DeleteFromCache(cacheKey)
-	h.logger.Info("cache entry deleted")
+	client, err := h.client(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deleting any version may change the current one, so every cached
+	// version of the object is dropped
+	cache.DeleteFromCacheByObject(h.store, bucket, key)
+	LoggerFrom(ctx).Info("cache entry deleted")
 
-	err := h.client.RemoveObject(ctx, bucket, key, minio.RemoveObjectOptions{})
+	spanCtx, span := startSpan(ctx, "storage.delete", bucket, key)
+	removeCtx, cancel := storageContext(spanCtx)
+	defer cancel()
+
+	err = client.RemoveObject(removeCtx, bucket, key, minio.RemoveObjectOptions{VersionID: versionID})
+	tracing.End(span, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to delete object: %w", err)
 	}
+	// Drop what GETs in flight during the delete cached of the object
+	cache.DeleteFromCacheByObject(h.store, bucket, key)
 
-	h.logger.Info("object deleted successfully")
+	LoggerFrom(ctx).Info("object deleted successfully")
 	return &Response{
 		StatusCode: http.StatusNoContent,
 	}, nil
@@ -336,50 +1296,134 @@ func (h *ObjectHandler) handleHead(ctx context.Context, req *Request, input Head
 	bucket := req.PathParams["bucket"]
 	key := req.PathParams["key"]
 
-	if bucket == "" || key == "" {
-		return nil, &ValidationError{Field: "path", Message: "invalid bucket or key"}
+	if err := storage.ValidateName(bucket, key); err != nil {
+		return nil, &ValidationError{Field: "path", Message: err.Error()}
 	}
 
-	cacheKey := cache.GetCacheKey(bucket, key)
+	sse, err := customerEncryption(req.Headers)
+	if err != nil {
+		return nil, err
+	}
+	versionID, err := requestVersionID(req)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, entry, cacheStatus, err := h.statObject(ctx, bucket, key, versionID, sse)
+	if err != nil {
+		return nil, err
+	}
+
+	// A preflight answers 304 like GET when the client's copy is current
+	if isNotModified(req.Headers, metadata.ETag, metadata.LastModified) {
+		resp := notModifiedResponse(metadata.ContentType, metadata.ETag, metadata.LastModified)
+		resp.Headers.Set("X-Cache", string(cacheStatus))
+		if entry != nil {
+			setCacheHit(resp.Headers, entry, cacheStatus)
+		}
+		return resp, nil
+	}
+
+	headers := http.Header{
+		"Content-Type":   []string{metadata.ContentType},
+		"Content-Length": []string{fmt.Sprintf("%d", metadata.Size)},
+		"Last-Modified":  []string{metadata.LastModified.UTC().Format(http.TimeFormat)},
+		"ETag":           []string{metadata.ETag},
+		"Accept-Ranges":  []string{"bytes"},
+		"X-Cache":        []string{string(cacheStatus)},
+	}
+	if entry != nil {
+		setCacheHit(headers, entry, cacheStatus)
+	}
+	setUserMetadata(headers, metadata.UserMetadata)
+
+	return &Response{
+		StatusCode: http.StatusOK,
+		Headers:    headers,
+	}, nil
+}
+
+// statObject returns an object's metadata, from the cache when a fresh entry
+// exists and from storage otherwise. The entry is returned when the cache
+// served the metadata. With CacheHeadMetadata set, a metadata entry is cached
+// on a miss.
+func (h *ObjectHandler) statObject(ctx context.Context, bucket, key, versionID string, sse encrypt.ServerSide) (*ObjectMetadata, *cache.CacheEntry, cache.Status, error) {
+	cacheKey := objectCacheKey(bucket, key, versionID)
+	if cache.IsNegative(cacheKey) {
+		return nil, nil, cache.StatusMiss, &NotFoundError{Resource: "object", ID: key}
+	}
 
-	if entry, found := cache.GetFromCache(cacheKey); found {
-		h.logger.Info("serving head from cache",
+	// Encrypted objects are never cached, so they are always checked in storage
+	var entry *cache.CacheEntry
+	cacheStatus := cache.StatusBypass
+	if sse == nil {
+		entry, cacheStatus = h.lookupCache(ctx, bucket, key, cacheKey)
+	}
+	if cacheStatus == cache.StatusExpired && entry != nil {
+		if refreshed, ok := h.revalidate(ctx, bucket, key, versionID, cacheKey, entry); ok {
+			entry, cacheStatus = refreshed, cache.StatusRevalidated
+		}
+	}
+	if cacheStatus == cache.StatusHit || cacheStatus == cache.StatusRevalidated {
+		LoggerFrom(ctx).Info("serving metadata from cache",
 			"content_type", entry.ContentType,
 			"size", entry.Size,
 		)
-		return &Response{
-			StatusCode: http.StatusOK,
-			Headers: http.Header{
-				"Content-Type":   []string{entry.ContentType},
-				"Content-Length": []string{fmt.Sprintf("%d", entry.Size)},
-				"Last-Modified":  []string{entry.LastModified.UTC().Format(http.TimeFormat)},
-				"ETag":           []string{entry.ETag},
-			},
-		}, nil
+		return &ObjectMetadata{
+			Size:         entry.Size,
+			ContentType:  entry.ContentType,
+			ETag:         entry.ETag,
+			LastModified: entry.LastModified,
+			UserMetadata: entry.UserMetadata,
+		}, entry, cacheStatus, nil
 	}
 
-	info, err := h.client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	metadata, err := h.statFromStorage(ctx, bucket, key, versionID, sse, entry)
+	return metadata, nil, cacheStatus, err
+}
+
+// statFromStorage returns an object's metadata from storage. With
+// CacheHeadMetadata set, the metadata of an unencrypted object is cached
+// unless cached, the entry found in the cache if any, is still held: a full
+// entry may be cached concurrently by a GET, so only a missing entry is
+// replaced.
+func (h *ObjectHandler) statFromStorage(ctx context.Context, bucket, key, versionID string, sse encrypt.ServerSide, cached *cache.CacheEntry) (*ObjectMetadata, error) {
+	client, err := h.client(bucket)
 	if err != nil {
-		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
-			return nil, &NotFoundError{Resource: "object", ID: key}
-		}
 		return nil, err
 	}
+	spanCtx, span := startSpan(ctx, "storage.stat", bucket, key)
+	statCtx, cancel := storageContext(spanCtx)
+	defer cancel()
 
-	h.logger.Info("object stats retrieved",
+	cacheKey := objectCacheKey(bucket, key, versionID)
+	generation := cache.FillGeneration(cacheKey)
+	info, err := client.StatObject(statCtx, bucket, key, minio.StatObjectOptions{ServerSideEncryption: sse, VersionID: versionID})
+	tracing.End(span, err)
+	if err != nil {
+		err, _ = missingObject(err, bucket, key, versionID)
+		return nil, err
+	}
+
+	LoggerFrom(ctx).Info("object stats retrieved",
 		"size", info.Size,
 		"content_type", info.ContentType,
 		"last_modified", info.LastModified,
 	)
 
-	return &Response{
-		StatusCode: http.StatusOK,
-		Headers: http.Header{
-			"Content-Type":   []string{info.ContentType},
-			"Content-Length": []string{fmt.Sprintf("%d", info.Size)},
-			"Last-Modified":  []string{info.LastModified.UTC().Format(http.TimeFormat)},
-			"ETag":           []string{info.ETag},
-		},
+	if sse == nil && cache.CacheHeadMetadata && cached == nil {
+		if ttl, cacheable := cache.CacheTTL(bucket, info.Metadata.Get("Cache-Control")); cacheable {
+			cache.SetIfCurrent(h.store, generation, cacheKey, cache.NewMetadataEntry(info.Size, info.ContentType, info.LastModified, info.ETag, info.UserMetadata, ttl))
+		}
+	}
+
+	return &ObjectMetadata{
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+		UserMetadata: info.UserMetadata,
+		StorageClass: info.StorageClass,
 	}, nil
 }
 
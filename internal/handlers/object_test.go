@@ -0,0 +1,614 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/muandane/estrois/internal/cache"
+)
+
+// setStreamThreshold streams objects larger than size bytes for the duration
+// of the test
+func setStreamThreshold(t *testing.T, size int64) {
+	previous := cache.StreamThreshold
+	cache.StreamThreshold = size
+	t.Cleanup(func() { cache.StreamThreshold = previous })
+}
+
+func TestGetStreamsLargeObjectsWithoutCaching(t *testing.T) {
+	setStreamThreshold(t, 1024)
+	env := newTestEnv(t)
+	data := bytes.Repeat([]byte("0123456789abcdef"), 256)
+	env.putObject(t, "large.bin", "application/octet-stream", data)
+
+	for range 2 {
+		w := env.do(http.MethodGet, "/objects/"+testBucket+"/large.bin", nil, nil)
+		if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+			t.Fatalf("status = %d, body length %d", w.Code, w.Body.Len())
+		}
+		if got := w.Header().Get("X-Cache"); got != string(cache.StatusBypass) {
+			t.Errorf("X-Cache = %q, want %s", got, cache.StatusBypass)
+		}
+	}
+	// Give a background fill the chance to run, were there one
+	time.Sleep(50 * time.Millisecond)
+	if _, status := env.store.Get(objectCacheKey(testBucket, "large.bin", "")); status != cache.StatusMiss {
+		t.Errorf("a streamed object was cached, status %s", status)
+	}
+	if gets := env.objectGets("large.bin"); gets != 2 {
+		t.Errorf("%d storage reads, want 2", gets)
+	}
+
+	// Objects at the threshold are still cached
+	env.putObject(t, "small.bin", "application/octet-stream", data[:1024])
+	env.do(http.MethodGet, "/objects/"+testBucket+"/small.bin", nil, nil)
+	env.waitCached(t, "small.bin")
+}
+
+// setStreamFillSize caches streamed objects up to size bytes for the duration
+// of the test
+func setStreamFillSize(t *testing.T, size int64) {
+	previous := cache.StreamFillSize
+	cache.StreamFillSize = size
+	t.Cleanup(func() { cache.StreamFillSize = previous })
+}
+
+func TestStreamFill(t *testing.T) {
+	setStreamThreshold(t, 1024)
+	setStreamFillSize(t, 8192)
+	env := newTestEnv(t)
+	data := bytes.Repeat([]byte("0123456789abcdef"), 256)
+	env.putObject(t, "filled.bin", "application/octet-stream", data)
+	env.putObject(t, "dropped.bin", "application/octet-stream", data)
+	env.putObject(t, "too-large.bin", "application/octet-stream", bytes.Repeat(data, 3))
+
+	// A client reading the whole object fills the cache
+	w := env.do(http.MethodGet, "/objects/"+testBucket+"/filled.bin", nil, nil)
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Fatalf("status = %d, body length %d", w.Code, w.Body.Len())
+	}
+	if got := w.Header().Get("X-Cache"); got != string(cache.StatusMiss) {
+		t.Errorf("X-Cache = %q, want %s", got, cache.StatusMiss)
+	}
+	if entry := env.waitCached(t, "filled.bin"); !bytes.Equal(entry.Data, data) {
+		t.Errorf("cached %d bytes, want the whole %d byte object", len(entry.Data), len(data))
+	}
+
+	// A client disconnecting mid-stream caches nothing
+	req := httptest.NewRequest(http.MethodGet, "/objects/"+testBucket+"/dropped.bin", nil)
+	disconnected := &disconnectingWriter{ResponseRecorder: httptest.NewRecorder(), limit: 1000}
+	env.mux.ServeHTTP(disconnected, req)
+	if disconnected.Body.Len() != 1000 {
+		t.Fatalf("client received %d bytes before disconnecting, want 1000", disconnected.Body.Len())
+	}
+
+	// Objects above CACHE_STREAM_FILL_SIZE are streamed without caching
+	w = env.do(http.MethodGet, "/objects/"+testBucket+"/too-large.bin", nil, nil)
+	if got := w.Header().Get("X-Cache"); got != string(cache.StatusBypass) {
+		t.Errorf("X-Cache = %q above the fill size, want %s", got, cache.StatusBypass)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	for _, key := range []string{"dropped.bin", "too-large.bin"} {
+		if _, status := env.store.Get(objectCacheKey(testBucket, key, "")); status != cache.StatusMiss {
+			t.Errorf("%s was cached, status %s", key, status)
+		}
+	}
+}
+
+// disconnectingWriter fails writes past limit bytes, as when the client
+// closes the connection mid-response
+type disconnectingWriter struct {
+	*httptest.ResponseRecorder
+	limit int
+}
+
+func (w *disconnectingWriter) Write(p []byte) (int, error) {
+	room := w.limit - w.Body.Len()
+	if len(p) <= room {
+		return w.ResponseRecorder.Write(p)
+	}
+	n, _ := w.ResponseRecorder.Write(p[:room])
+	return n, syscall.ECONNRESET
+}
+
+func TestGetHonorsStoredCacheControl(t *testing.T) {
+	env := newTestEnv(t)
+	data := []byte("cache control")
+	env.putObjectWithOptions(t, "hour.txt", data, minio.PutObjectOptions{ContentType: "text/plain", CacheControl: "max-age=3600"})
+	env.putObjectWithOptions(t, "never.txt", data, minio.PutObjectOptions{ContentType: "text/plain", CacheControl: "no-store"})
+	env.putObject(t, "default.txt", "text/plain", data)
+
+	for _, key := range []string{"hour.txt", "never.txt", "default.txt"} {
+		if w := env.do(http.MethodGet, "/objects/"+testBucket+"/"+key, nil, nil); w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d", key, w.Code)
+		}
+	}
+
+	if entry := env.waitCached(t, "hour.txt"); !approximately(time.Until(entry.ExpiresAt), time.Hour) {
+		t.Errorf("max-age=3600 cached for %s", time.Until(entry.ExpiresAt))
+	}
+	if entry := env.waitCached(t, "default.txt"); !approximately(time.Until(entry.ExpiresAt), cache.DefaultCacheDuration) {
+		t.Errorf("no Cache-Control cached for %s, want %s", time.Until(entry.ExpiresAt), cache.DefaultCacheDuration)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, status := env.store.Get(objectCacheKey(testBucket, "never.txt", "")); status != cache.StatusMiss {
+		t.Errorf("no-store object was cached, status %s", status)
+	}
+}
+
+func TestGetUsesBucketCacheTTL(t *testing.T) {
+	previous := cache.BucketCacheTTLs
+	t.Cleanup(func() { cache.BucketCacheTTLs = previous })
+
+	env := newTestEnv(t)
+	env.putObject(t, "artifact.bin", "application/octet-stream", []byte("artifact"))
+	env.putObject(t, "unlisted.bin", "application/octet-stream", []byte("unlisted"))
+
+	cache.BucketCacheTTLs = map[string]time.Duration{testBucket: time.Hour}
+	env.do(http.MethodGet, "/objects/"+testBucket+"/artifact.bin", nil, nil)
+	if entry := env.waitCached(t, "artifact.bin"); !approximately(time.Until(entry.ExpiresAt), time.Hour) {
+		t.Errorf("bucket with a 1h TTL cached for %s", time.Until(entry.ExpiresAt))
+	}
+
+	cache.BucketCacheTTLs = map[string]time.Duration{"other-bucket": time.Hour}
+	env.do(http.MethodGet, "/objects/"+testBucket+"/unlisted.bin", nil, nil)
+	if entry := env.waitCached(t, "unlisted.bin"); !approximately(time.Until(entry.ExpiresAt), cache.DefaultCacheDuration) {
+		t.Errorf("unlisted bucket cached for %s, want %s", time.Until(entry.ExpiresAt), cache.DefaultCacheDuration)
+	}
+}
+
+func TestBucketMaxCacheableSize(t *testing.T) {
+	previous := cache.BucketMaxCacheableSizes
+	cache.BucketMaxCacheableSizes = map[string]int64{testBucket: 1024}
+	t.Cleanup(func() { cache.BucketMaxCacheableSizes = previous })
+	env := newTestEnv(t)
+	large := bytes.Repeat([]byte("v"), 4096)
+	env.putObject(t, "large.bin", "application/octet-stream", large)
+	env.putObject(t, "small.bin", "application/octet-stream", []byte("small"))
+
+	for i := range 2 {
+		w := env.do(http.MethodGet, "/objects/"+testBucket+"/large.bin", nil, nil)
+		if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), large) {
+			t.Fatalf("GET %d of the large object: status = %d, %d bytes", i, w.Code, w.Body.Len())
+		}
+		if got := w.Header().Get("X-Cache"); got != string(cache.StatusBypass) {
+			t.Errorf("GET %d of the large object: X-Cache = %q, want %s", i, got, cache.StatusBypass)
+		}
+	}
+	env.do(http.MethodGet, "/objects/"+testBucket+"/small.bin", nil, nil)
+	env.waitCached(t, "small.bin")
+	if _, status := env.store.Get(objectCacheKey(testBucket, "large.bin", "")); status != cache.StatusMiss {
+		t.Errorf("object over the bucket's ceiling was cached, status %s", status)
+	}
+	if gets := env.objectGets("large.bin"); gets != 2 {
+		t.Errorf("large object fetched %d times, want every GET from storage", gets)
+	}
+}
+
+// approximately reports whether got is within a few seconds of want
+func approximately(got, want time.Duration) bool {
+	return got > want-5*time.Second && got <= want
+}
+
+func TestConcurrentMissesShareOneFetch(t *testing.T) {
+	env := newTestEnv(t)
+	data := []byte("popular object")
+	env.putObject(t, "popular.txt", "text/plain", data)
+
+	fetching := make(chan struct{}, 1)
+	release := make(chan struct{})
+	env.onStorageRequest(func(r *http.Request) {
+		if r.Method == http.MethodGet {
+			fetching <- struct{}{}
+			<-release
+		}
+	})
+
+	const clients = 20
+	var wg sync.WaitGroup
+	codes := make([]int, clients)
+	bodies := make([][]byte, clients)
+	for i := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := env.do(http.MethodGet, "/objects/"+testBucket+"/popular.txt", nil, nil)
+			codes[i], bodies[i] = w.Code, w.Body.Bytes()
+		}()
+	}
+	// Hold the first fetch until the other clients have joined it
+	<-fetching
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i := range clients {
+		if codes[i] != http.StatusOK || !bytes.Equal(bodies[i], data) {
+			t.Errorf("client %d: status = %d, body %q", i, codes[i], bodies[i])
+		}
+	}
+	if gets := env.objectGets("popular.txt"); gets != 1 {
+		t.Errorf("%d storage reads for %d concurrent misses, want 1", gets, clients)
+	}
+}
+
+func TestNotFoundIsRememberedUntilPut(t *testing.T) {
+	env := newTestEnv(t)
+	path := "/objects/" + testBucket + "/negative/missing.txt"
+
+	if w := env.do(http.MethodGet, path, nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("first GET: status = %d, want 404", w.Code)
+	}
+	env.resetRequests()
+	if w := env.do(http.MethodGet, path, nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("second GET: status = %d, want 404", w.Code)
+	}
+	if w := env.do(http.MethodHead, path, nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("HEAD: status = %d, want 404", w.Code)
+	}
+	if requests := env.storageRequests(); len(requests) != 0 {
+		t.Errorf("a remembered 404 reached storage: %v", requests)
+	}
+
+	data := []byte("created")
+	if w := env.do(http.MethodPut, path, bytes.NewReader(data), map[string]string{"Content-Type": "text/plain"}); w.Code != http.StatusOK {
+		t.Fatalf("PUT: status = %d, body %s", w.Code, w.Body)
+	}
+	if w := env.do(http.MethodGet, path, nil, nil); w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Errorf("GET after PUT: status = %d, body %q", w.Code, w.Body.Bytes())
+	}
+}
+
+func TestWriteDuringFetchLeavesNoStaleEntry(t *testing.T) {
+	updated := []byte("updated")
+	tests := []struct {
+		method   string
+		body     []byte
+		wantCode int
+	}{
+		{http.MethodPut, updated, http.StatusOK},
+		{http.MethodDelete, nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.putObject(t, "racy.txt", "text/plain", []byte("original"))
+			path := "/objects/" + testBucket + "/racy.txt"
+
+			// Hold the GET's response once storage has read the old object
+			read, release := make(chan struct{}), make(chan struct{})
+			var once sync.Once
+			env.onStorageResponse(func(r *http.Request) {
+				if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/racy.txt") {
+					once.Do(func() {
+						close(read)
+						<-release
+					})
+				}
+			})
+			fetched := make(chan struct{})
+			go func() {
+				defer close(fetched)
+				env.do(http.MethodGet, path, nil, nil)
+			}()
+			<-read
+
+			var body io.Reader
+			if tt.body != nil {
+				body = bytes.NewReader(tt.body)
+			}
+			if w := env.do(tt.method, path, body, map[string]string{"Content-Type": "text/plain"}); w.Code >= 300 {
+				t.Fatalf("%s: status = %d", tt.method, w.Code)
+			}
+			close(release)
+			<-fetched
+			// Give the background fill the chance to run
+			time.Sleep(50 * time.Millisecond)
+
+			if entry, status := env.store.Get(objectCacheKey(testBucket, "racy.txt", "")); status != cache.StatusMiss {
+				t.Errorf("the object read before the %s was cached: %q", tt.method, entry.Data)
+			}
+			w := env.do(http.MethodGet, path, nil, nil)
+			if w.Code != tt.wantCode {
+				t.Fatalf("GET after the %s: status = %d, want %d", tt.method, w.Code, tt.wantCode)
+			}
+			if tt.body != nil && !bytes.Equal(w.Body.Bytes(), tt.body) {
+				t.Errorf("GET after the %s = %q, want %q", tt.method, w.Body, tt.body)
+			}
+		})
+	}
+}
+
+func TestCacheStatusHeaders(t *testing.T) {
+	env := newTestEnv(t)
+	data := []byte("short lived")
+	env.putObject(t, "short.txt", "text/plain", data)
+	path := "/objects/" + testBucket + "/short.txt"
+
+	w := env.do(http.MethodGet, path, nil, nil)
+	if got := w.Header().Get("X-Cache"); got != "MISS" {
+		t.Errorf("first GET: X-Cache = %q, want MISS", got)
+	}
+	if got := w.Header().Get("X-Cache-Age"); got != "" {
+		t.Errorf("first GET: X-Cache-Age = %q, want none", got)
+	}
+	entry := env.waitCached(t, "short.txt")
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		w = env.do(method, path, nil, nil)
+		if got := w.Header().Get("X-Cache"); got != "HIT" {
+			t.Errorf("cached %s: X-Cache = %q, want HIT", method, got)
+		}
+		if got := w.Header().Get("X-Cache-Age"); got != "0" {
+			t.Errorf("cached %s: X-Cache-Age = %q, want 0", method, got)
+		}
+	}
+
+	// An expired entry whose object changed is fetched again
+	env.store.Set(objectCacheKey(testBucket, "short.txt", ""), entry.Refresh(-time.Second))
+	data = []byte("changed since")
+	env.putObject(t, "short.txt", "text/plain", data)
+	w = env.do(http.MethodGet, path, nil, nil)
+	if got := w.Header().Get("X-Cache"); got != "EXPIRED" {
+		t.Errorf("GET after the TTL: X-Cache = %q, want EXPIRED", got)
+	}
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Errorf("GET after the TTL: status = %d, body %q", w.Code, w.Body.Bytes())
+	}
+}
+
+func TestExpiredEntryRevalidatesByETag(t *testing.T) {
+	env := newTestEnv(t)
+	data := []byte("rarely changes")
+	env.putObject(t, "stable.txt", "text/plain", data)
+	path := "/objects/" + testBucket + "/stable.txt"
+	cacheKey := objectCacheKey(testBucket, "stable.txt", "")
+
+	env.do(http.MethodGet, path, nil, nil)
+	entry := env.waitCached(t, "stable.txt")
+
+	// An unchanged object is served from the cache after a HEAD to storage
+	env.store.Set(cacheKey, entry.Refresh(-time.Second))
+	env.resetRequests()
+	w := env.do(http.MethodGet, path, nil, nil)
+	if got := w.Header().Get("X-Cache"); got != "REVALIDATED" {
+		t.Errorf("unchanged object: X-Cache = %q, want REVALIDATED", got)
+	}
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Errorf("unchanged object: status = %d, body %q", w.Code, w.Body.Bytes())
+	}
+	if gets := env.objectGets("stable.txt"); gets != 0 {
+		t.Errorf("unchanged object downloaded %d times, want 0; storage saw %v", gets, env.storageRequests())
+	}
+	if refreshed, status := env.store.Get(cacheKey); status != cache.StatusHit || !approximately(time.Until(refreshed.ExpiresAt), cache.DefaultCacheDuration) {
+		t.Errorf("unchanged object: cache status = %s, want a refreshed entry", status)
+	}
+
+	// A changed object is downloaded again
+	entry, _ = env.store.Get(cacheKey)
+	env.store.Set(cacheKey, entry.Refresh(-time.Second))
+	data = []byte("changed after all")
+	env.putObject(t, "stable.txt", "text/plain", data)
+	env.resetRequests()
+	w = env.do(http.MethodGet, path, nil, nil)
+	if got := w.Header().Get("X-Cache"); got != "EXPIRED" {
+		t.Errorf("changed object: X-Cache = %q, want EXPIRED", got)
+	}
+	if !bytes.Equal(w.Body.Bytes(), data) {
+		t.Errorf("changed object: body = %q, want %q", w.Body.Bytes(), data)
+	}
+	if gets := env.objectGets("stable.txt"); gets != 1 {
+		t.Errorf("changed object downloaded %d times, want 1", gets)
+	}
+}
+
+func TestInvalidNamesNeverReachStorage(t *testing.T) {
+	env := newTestEnv(t)
+	env.resetRequests()
+	for _, path := range []string{
+		"/objects/Bad_Bucket/file.txt",
+		"/objects/" + testBucket + "/line%0Abreak.txt",
+		"/objects/" + testBucket + "/" + strings.Repeat("k", 1025),
+	} {
+		for _, method := range []string{http.MethodGet, http.MethodPut} {
+			if w := env.do(method, path, strings.NewReader("data"), nil); w.Code != http.StatusBadRequest {
+				t.Errorf("%s %.60s: status = %d, want 400", method, path, w.Code)
+			}
+		}
+	}
+	if requests := env.storageRequests(); len(requests) != 0 {
+		t.Errorf("invalid names reached storage: %v", requests)
+	}
+}
+
+func TestObjectLifecycle(t *testing.T) {
+	setMaxUploadSize(t, 1024)
+	env := newTestEnv(t)
+	path := "/objects/" + testBucket + "/docs/lifecycle.txt"
+	data := []byte("put, read, delete")
+
+	if w := env.do(http.MethodPut, path, bytes.NewReader(data), map[string]string{"Content-Type": "text/plain"}); w.Code != http.StatusOK {
+		t.Fatalf("PUT: status = %d, body %s", w.Code, w.Body)
+	}
+
+	w := env.do(http.MethodGet, path, nil, nil)
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Fatalf("GET: status = %d, body %q", w.Code, w.Body.Bytes())
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/plain" {
+		t.Errorf("GET: Content-Type = %q", got)
+	}
+
+	w = env.do(http.MethodHead, path, nil, nil)
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("HEAD: status = %d, body length %d", w.Code, w.Body.Len())
+	}
+	if got := w.Header().Get("Content-Length"); got != strconv.Itoa(len(data)) {
+		t.Errorf("HEAD: Content-Length = %q, want %d", got, len(data))
+	}
+
+	if w := env.do(http.MethodDelete, path, nil, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: status = %d, want 204", w.Code)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		if w := env.do(method, path, nil, nil); w.Code != http.StatusNotFound {
+			t.Errorf("%s after DELETE: status = %d, want 404", method, w.Code)
+		}
+	}
+
+	// The upload limit applies on this path too
+	if w := env.do(http.MethodPut, path, bytes.NewReader(make([]byte, 1025)), nil); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("PUT over the limit: status = %d, want 413", w.Code)
+	}
+}
+
+func TestServeStaleOnError(t *testing.T) {
+	for _, serveStale := range []bool{true, false} {
+		t.Run(fmt.Sprintf("serve stale %v", serveStale), func(t *testing.T) {
+			previous := cache.ServeStaleOnError
+			cache.ServeStaleOnError = serveStale
+			t.Cleanup(func() { cache.ServeStaleOnError = previous })
+			env := newTestEnv(t)
+			data := []byte("still useful")
+			env.putObject(t, "stale.txt", "text/plain", data)
+			path := "/objects/" + testBucket + "/stale.txt"
+			cacheKey := objectCacheKey(testBucket, "stale.txt", "")
+			env.do(http.MethodGet, path, nil, nil)
+			entry := env.waitCached(t, "stale.txt")
+
+			env.store.Set(cacheKey, entry.Refresh(-time.Second))
+			env.stopStorage(t)
+			for _, method := range []string{http.MethodGet, http.MethodHead} {
+				w := env.do(method, path, nil, nil)
+				if !serveStale {
+					if w.Code < 500 {
+						t.Errorf("%s with storage down: status = %d, want a server error", method, w.Code)
+					}
+					continue
+				}
+				if w.Code != http.StatusOK || w.Header().Get("X-Cache") != "STALE" {
+					t.Errorf("%s with storage down: status = %d, X-Cache %q, want 200 STALE", method, w.Code, w.Header().Get("X-Cache"))
+				}
+				if warning := w.Header().Get("Warning"); !strings.HasPrefix(warning, "110 ") {
+					t.Errorf("%s with storage down: Warning = %q, want 110", method, warning)
+				}
+				if method == http.MethodGet && !bytes.Equal(w.Body.Bytes(), data) {
+					t.Errorf("GET with storage down: body %q, want the stale entry", w.Body.Bytes())
+				}
+			}
+			if !serveStale {
+				return
+			}
+			// The stale entry stays in service only briefly
+			stale, status := env.store.Get(cacheKey)
+			if status != cache.StatusHit || !stale.Stale || !approximately(time.Until(stale.ExpiresAt), cache.StaleOnErrorTTL) {
+				t.Errorf("cache status = %s, want a stale entry kept for %s", status, cache.StaleOnErrorTTL)
+			}
+		})
+	}
+}
+
+func TestObjectMethods(t *testing.T) {
+	env := newTestEnv(t)
+	path := "/objects/" + testBucket + "/any.txt"
+
+	w := env.do(http.MethodOptions, path, nil, nil)
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("OPTIONS: status = %d, body %q, want an empty 204", w.Code, w.Body)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, PUT, DELETE, HEAD, OPTIONS" {
+		t.Errorf("OPTIONS: Allow = %q", allow)
+	}
+	if requests := env.storageRequests(); len(requests) != 0 {
+		t.Errorf("OPTIONS reached storage: %v", requests)
+	}
+
+	for _, method := range []string{http.MethodPost, http.MethodPatch, "PROPFIND"} {
+		w := env.do(method, path, nil, nil)
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s: status = %d, want 405", method, w.Code)
+		}
+		if allow := w.Header().Get("Allow"); allow != "GET, PUT, DELETE, HEAD, OPTIONS" {
+			t.Errorf("%s: Allow = %q", method, allow)
+		}
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	previousHits, previousWindow := cache.RefreshAheadHits, cache.RefreshAheadWindow
+	cache.RefreshAheadHits, cache.RefreshAheadWindow = 3, 20
+	t.Cleanup(func() { cache.RefreshAheadHits, cache.RefreshAheadWindow = previousHits, previousWindow })
+
+	tests := []struct {
+		name        string
+		hits        int
+		remaining   int // percent of the TTL left
+		wantRefresh bool
+	}{
+		{"hot entry near expiry", 3, 10, true},
+		{"cold entry near expiry", 2, 10, false},
+		{"hot entry far from expiry", 5, 50, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.putObject(t, "popular.txt", "text/plain", []byte("popular"))
+			path := "/objects/" + testBucket + "/popular.txt"
+			cacheKey := objectCacheKey(testBucket, "popular.txt", "")
+			env.do(http.MethodGet, path, nil, nil)
+			ttl := cache.DefaultCacheDuration
+			entry := env.waitCached(t, "popular.txt").Refresh(ttl * time.Duration(tt.remaining) / 100)
+			entry.StoredAt = entry.ExpiresAt.Add(-ttl)
+			env.store.Set(cacheKey, entry)
+			env.resetRequests()
+
+			for i := range tt.hits {
+				if w := env.do(http.MethodGet, path, nil, nil); w.Header().Get("X-Cache") != "HIT" {
+					t.Fatalf("GET %d: X-Cache = %q, want HIT", i, w.Header().Get("X-Cache"))
+				}
+			}
+
+			if !tt.wantRefresh {
+				// Give a wrongly started refresh time to land
+				time.Sleep(50 * time.Millisecond)
+			}
+			deadline := time.Now().Add(time.Second)
+			for {
+				current, _ := env.store.Get(cacheKey)
+				refreshed := current.StoredAt.After(entry.StoredAt)
+				if refreshed != tt.wantRefresh && time.Now().Before(deadline) {
+					time.Sleep(time.Millisecond)
+					continue
+				}
+				if refreshed != tt.wantRefresh {
+					t.Fatalf("entry refreshed = %v, want %v", refreshed, tt.wantRefresh)
+				}
+				if refreshed && !approximately(time.Until(current.ExpiresAt), cache.DefaultCacheDuration) {
+					t.Errorf("refreshed entry expires in %s, want %s", time.Until(current.ExpiresAt), cache.DefaultCacheDuration)
+				}
+				break
+			}
+			// Refreshing only checks the ETag, the object is not downloaded
+			if gets := env.objectGets("popular.txt"); gets != 0 {
+				t.Errorf("storage GETs = %d, want 0", gets)
+			}
+			if !tt.wantRefresh {
+				if requests := env.storageRequests(); len(requests) != 0 {
+					t.Errorf("entry not due for a refresh reached storage: %v", requests)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/muandane/estrois/internal/middleware"
+	"github.com/muandane/estrois/internal/storage"
+)
+
+const (
+	defaultPresignExpiry = 15 * time.Minute
+	minPresignExpiry     = 1 * time.Second
+	maxPresignExpiry     = 7 * 24 * time.Hour
+)
+
+type PresignRequest struct{}
+
+type PresignResponse struct {
+	URL string `json:"url"`
+}
+
+// PresignHandler returns the handler for GET /presign/{bucket}/{key...}
+func (h *ObjectHandler) PresignHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := h.logger.With(
+			"request_id", middleware.RequestIDFromContext(r.Context()),
+			"method", r.Method,
+			"bucket", r.PathValue("bucket"),
+			"key", r.PathValue("key"),
+			"remote_addr", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		)
+		Handle(h.handlePresign, HandlerOptions{Logger: logger})(w, r)
+	}
+}
+
+func (h *ObjectHandler) handlePresign(ctx context.Context, req *Request, input PresignRequest) (*PresignResponse, error) {
+	bucket := req.PathParams["bucket"]
+	key := req.PathParams["key"]
+	if err := storage.ValidateName(bucket, key); err != nil {
+		return nil, &ValidationError{Field: "path", Message: err.Error()}
+	}
+
+	expiry := defaultPresignExpiry
+	if v := req.QueryParams["expiry"]; v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, &ValidationError{Field: "expiry", Message: "must be a number of seconds"}
+		}
+		expiry = time.Duration(seconds) * time.Second
+		if expiry < minPresignExpiry || expiry > maxPresignExpiry {
+			return nil, &ValidationError{Field: "expiry", Message: "must be between 1 second and 7 days"}
+		}
+	}
+
+	method := strings.ToUpper(req.QueryParams["method"])
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	// Presigning may look up the bucket region in storage
+	client, err := h.client(bucket)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := storageContext(ctx)
+	defer cancel()
+
+	var presigned *url.URL
+	switch method {
+	case http.MethodGet:
+		presigned, err = client.PresignedGetObject(ctx, bucket, key, expiry, nil)
+	case http.MethodPut:
+		presigned, err = client.PresignedPutObject(ctx, bucket, key, expiry)
+	default:
+		return nil, &ValidationError{Field: "method", Message: "must be GET or PUT"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign url: %w", err)
+	}
+
+	LoggerFrom(ctx).Info("presigned url generated",
+		"presign_method", method,
+		"expiry", expiry.String(),
+	)
+
+	return &PresignResponse{URL: presigned.String()}, nil
+}
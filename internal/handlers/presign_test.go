@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newPresignEnv returns a testEnv that also serves presigned URLs
+func newPresignEnv(t *testing.T) *testEnv {
+	env := newTestEnv(t)
+	env.mux.Handle("GET /presign/{bucket}/{key...}", env.handler.PresignHandler())
+	return env
+}
+
+// presign returns the URL presigned for method on key
+func (env *testEnv) presign(t *testing.T, key, query string) *url.URL {
+	t.Helper()
+	w := env.do(http.MethodGet, "/presign/"+testBucket+"/"+key+"?"+query, nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("presign %s?%s: status = %d, body %s", key, query, w.Code, w.Body)
+	}
+	var resp PresignResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	presigned, err := url.Parse(resp.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return presigned
+}
+
+// expiresIn returns how long a presigned URL remains valid
+func expiresIn(t *testing.T, presigned *url.URL) time.Duration {
+	t.Helper()
+	expires, err := strconv.ParseInt(presigned.Query().Get("Expires"), 10, 64)
+	if err != nil {
+		t.Fatalf("presigned URL %s has no expiry", presigned)
+	}
+	return time.Until(time.Unix(expires, 0))
+}
+
+func TestPresignGet(t *testing.T) {
+	env := newPresignEnv(t)
+	data := []byte("presigned download")
+	env.putObject(t, "dir/file.txt", "text/plain", data)
+
+	presigned := env.presign(t, "dir/file.txt", "method=GET&expiry=300")
+	if expiry := expiresIn(t, presigned); !approximately(expiry, 5*time.Minute) {
+		t.Errorf("URL expires in %s, want 5m", expiry)
+	}
+	resp, err := http.Get(presigned.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, data) {
+		t.Errorf("GET presigned URL: status = %d, body %q", resp.StatusCode, body)
+	}
+
+	// Without a method or an expiry, GET URLs last the default time
+	if expiry := expiresIn(t, env.presign(t, "dir/file.txt", "")); !approximately(expiry, defaultPresignExpiry) {
+		t.Errorf("default URL expires in %s, want %s", expiry, defaultPresignExpiry)
+	}
+}
+
+func TestPresignPut(t *testing.T) {
+	env := newPresignEnv(t)
+	data := []byte("presigned upload")
+
+	presigned := env.presign(t, "upload.txt", "method=put&expiry=60")
+	req, err := http.NewRequest(http.MethodPut, presigned.String(), bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT presigned URL: status = %d", resp.StatusCode)
+	}
+	if w := env.do(http.MethodGet, "/objects/"+testBucket+"/upload.txt", nil, nil); !bytes.Equal(w.Body.Bytes(), data) {
+		t.Errorf("uploaded object = %q, want %q", w.Body.Bytes(), data)
+	}
+}
+
+func TestPresignRejectsInvalidRequests(t *testing.T) {
+	env := newPresignEnv(t)
+	for _, query := range []string{
+		"expiry=0",
+		"expiry=604801",
+		"expiry=soon",
+		"method=DELETE",
+	} {
+		if w := env.do(http.MethodGet, "/presign/"+testBucket+"/file.txt?"+query, nil, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+		}
+	}
+	if w := env.do(http.MethodGet, "/presign/"+testBucket+"/file.txt?expiry=604800", nil, nil); w.Code != http.StatusOK {
+		t.Errorf("7 day expiry: status = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/muandane/estrois/internal/cache"
+	"github.com/muandane/estrois/internal/middleware"
+)
+
+// PurgeHandler inspects and removes cache entries without touching storage
+type PurgeHandler struct {
+	store  cache.Store
+	logger *slog.Logger
+}
+
+type PurgeRequest struct{}
+
+type PurgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+func NewPurgeHandler(store cache.Store, logger *slog.Logger) *PurgeHandler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &PurgeHandler{
+		store:  store,
+		logger: logger,
+	}
+}
+
+func (h *PurgeHandler) RegisterRoutes(mux *http.ServeMux) {
+	var opts HandlerOptions
+	mux.Handle("GET /cache/entries", h.withRequestLogger(Handle(h.handleListEntries, opts)))
+	mux.Handle("POST /cache/purge/{bucket}", h.withRequestLogger(Handle(h.handlePurgeBucket, opts)))
+	mux.Handle("POST /cache/purge/{bucket}/{key...}", h.withRequestLogger(Handle(h.handlePurgeObject, opts)))
+}
+
+// withRequestLogger stores a logger carrying the request's fields in its
+// context, where Handle picks it up
+func (h *PurgeHandler) withRequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := h.logger.With(
+			"request_id", middleware.RequestIDFromContext(r.Context()),
+			"method", r.Method,
+			"bucket", r.PathValue("bucket"),
+			"key", r.PathValue("key"),
+			"remote_addr", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		)
+		next.ServeHTTP(w, r.WithContext(withLogger(r.Context(), logger)))
+	})
+}
+
+func (h *PurgeHandler) handlePurgeObject(ctx context.Context, req *Request, input PurgeRequest) (*PurgeResponse, error) {
+	bucket := req.PathParams["bucket"]
+	key := req.PathParams["key"]
+	if bucket == "" || key == "" {
+		return nil, &ValidationError{Field: "path", Message: "invalid bucket or key"}
+	}
+
+	purged := cache.DeleteFromCacheByObject(h.store, bucket, key)
+
+	LoggerFrom(ctx).Info("cache entry purged",
+		"purged", purged,
+	)
+
+	return &PurgeResponse{Purged: purged}, nil
+}
+
+func (h *PurgeHandler) handlePurgeBucket(ctx context.Context, req *Request, input PurgeRequest) (*PurgeResponse, error) {
+	bucket := req.PathParams["bucket"]
+	if bucket == "" {
+		return nil, &ValidationError{Field: "path", Message: "invalid bucket"}
+	}
+
+	// A tenant only purges its own keys
+	purged := h.store.DeleteByPrefix(cache.GetCacheKey(bucket, tenantPrefix(ctx)))
+
+	LoggerFrom(ctx).Info("bucket purged from cache",
+		"purged", purged,
+	)
+
+	return &PurgeResponse{Purged: purged}, nil
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/muandane/estrois/internal/cache"
+)
+
+// newPurgeMux serves a PurgeHandler over store
+func newPurgeMux(store cache.Store) *http.ServeMux {
+	mux := http.NewServeMux()
+	NewPurgeHandler(store, slog.New(slog.NewTextHandler(io.Discard, nil))).RegisterRoutes(mux)
+	return mux
+}
+
+func cacheTestEntry(data string) *cache.CacheEntry {
+	return cache.NewCacheEntry([]byte(data), "text/plain", time.Now(), `"etag"`, nil, time.Minute)
+}
+
+func purge(t *testing.T, mux *http.ServeMux, path string) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST %s: status = %d, body %s", path, w.Code, w.Body)
+	}
+	var resp PurgeResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Purged
+}
+
+func TestPurgeObject(t *testing.T) {
+	store := cache.NewMemoryStore(1 << 20)
+	store.Set(cache.GetCacheKey("photos", "dir/a.txt"), cacheTestEntry("a"))
+	store.Set(cache.GetVariantKey("photos", "dir/a.txt", "version=1"), cacheTestEntry("a1"))
+	store.Set(cache.GetCacheKey("photos", "dir/b.txt"), cacheTestEntry("b"))
+	mux := newPurgeMux(store)
+
+	if purged := purge(t, mux, "/cache/purge/photos/dir/a.txt"); purged != 2 {
+		t.Errorf("purged %d entries, want the object and its variant", purged)
+	}
+	if _, status := store.Get(cache.GetCacheKey("photos", "dir/a.txt")); status != cache.StatusMiss {
+		t.Error("the purged object is still cached")
+	}
+	if _, status := store.Get(cache.GetCacheKey("photos", "dir/b.txt")); status != cache.StatusHit {
+		t.Error("another object was purged")
+	}
+	if purged := purge(t, mux, "/cache/purge/photos/dir/a.txt"); purged != 0 {
+		t.Errorf("purging again purged %d entries, want 0", purged)
+	}
+}
+
+func TestPurgeBucket(t *testing.T) {
+	store := cache.NewMemoryStore(1 << 20)
+	store.Set(cache.GetCacheKey("docs", "keep.txt"), cacheTestEntry("keep"))
+	sizeBefore := store.Stats().CurrentSize
+	for _, key := range []string{"a.txt", "b.txt", "dir/c.txt"} {
+		store.Set(cache.GetCacheKey("photos", key), cacheTestEntry(key))
+	}
+	// A bucket whose name starts with the purged one is left alone
+	store.Set(cache.GetCacheKey("photos-archive", "d.txt"), cacheTestEntry("d"))
+	mux := newPurgeMux(store)
+
+	if purged := purge(t, mux, "/cache/purge/photos"); purged != 3 {
+		t.Errorf("purged %d entries, want 3", purged)
+	}
+	store.Delete(cache.GetCacheKey("photos-archive", "d.txt"))
+	stats := store.Stats()
+	if stats.EntryCount != 1 || stats.CurrentSize != sizeBefore {
+		t.Errorf("%d entries of %d bytes left, want 1 of %d", stats.EntryCount, stats.CurrentSize, sizeBefore)
+	}
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxRanges bounds the ranges served from one Range header once overlapping
+// and adjacent ranges have been merged; requests for more get 416
+const maxRanges = 16
+
+var (
+	// errInvalidRange means the Range header is malformed and should be ignored
+	errInvalidRange = errors.New("invalid range")
+	// errUnsatisfiableRange means none of the requested ranges overlap the object
+	errUnsatisfiableRange = errors.New("requested range not satisfiable")
+)
+
+// byteRange is a resolved byte range within an object
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+func (r byteRange) end() int64 {
+	return r.start + r.length - 1
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.end(), size)
+}
+
+// parseRange parses a "bytes=" Range header against an object of the given size.
+// Ranges that fall entirely outside the object are dropped; if none remain
+// errUnsatisfiableRange is returned. Overlapping and adjacent ranges are
+// merged, so no byte is sent twice, and more than maxRanges ranges are
+// unsatisfiable.
+func parseRange(header string, size int64) ([]byteRange, error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return nil, errInvalidRange
+	}
+
+	var ranges []byteRange
+	noOverlap := false
+	for _, spec := range strings.Split(header[len(prefix):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		startStr, endStr, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, errInvalidRange
+		}
+		startStr, endStr = strings.TrimSpace(startStr), strings.TrimSpace(endStr)
+
+		var r byteRange
+		if startStr == "" {
+			// Suffix range: the last N bytes
+			n, err := strconv.ParseInt(endStr, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errInvalidRange
+			}
+			if n == 0 || size == 0 {
+				noOverlap = true
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r = byteRange{start: size - n, length: n}
+		} else {
+			start, err := strconv.ParseInt(startStr, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errInvalidRange
+			}
+			if start >= size {
+				noOverlap = true
+				continue
+			}
+			end := size - 1
+			if endStr != "" {
+				end, err = strconv.ParseInt(endStr, 10, 64)
+				if err != nil || end < start {
+					return nil, errInvalidRange
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+			r = byteRange{start: start, length: end - start + 1}
+		}
+		ranges = append(ranges, r)
+	}
+
+	if len(ranges) == 0 {
+		if noOverlap {
+			return nil, errUnsatisfiableRange
+		}
+		return nil, errInvalidRange
+	}
+	ranges = mergeRanges(ranges)
+	if len(ranges) > maxRanges {
+		return nil, errUnsatisfiableRange
+	}
+	return ranges, nil
+}
+
+// mergeRanges sorts ranges by start and coalesces those that overlap or touch
+func mergeRanges(ranges []byteRange) []byteRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.start > last.end()+1 {
+			merged = append(merged, r)
+			continue
+		}
+		if r.end() > last.end() {
+			last.length = r.end() - last.start + 1
+		}
+	}
+	return merged
+}
+
+// rangeResponse builds a 206 response for the given ranges, using openRange to
+// open a reader over the bytes of each range. A single range is streamed as
+// the body; multiple ranges are streamed one after the other as
+// multipart/byteranges, so no range is ever held in memory whole.
+func rangeResponse(ranges []byteRange, size int64, contentType string, headers http.Header, openRange func(byteRange) (io.ReadCloser, error)) (*Response, error) {
+	headers.Set("Accept-Ranges", "bytes")
+
+	if len(ranges) == 1 {
+		body, err := openRange(ranges[0])
+		if err != nil {
+			return nil, err
+		}
+		headers.Set("Content-Range", ranges[0].contentRange(size))
+		headers.Set("Content-Length", strconv.FormatInt(ranges[0].length, 10))
+		return &Response{
+			StatusCode:  http.StatusPartialContent,
+			Headers:     headers,
+			Body:        body,
+			ContentType: contentType,
+			IsStreaming: true,
+		}, nil
+	}
+
+	reader, writer := io.Pipe()
+	mw := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(writeRanges(mw, ranges, size, contentType, openRange))
+	}()
+
+	return &Response{
+		StatusCode:  http.StatusPartialContent,
+		Headers:     headers,
+		Body:        reader,
+		ContentType: "multipart/byteranges; boundary=" + mw.Boundary(),
+		IsStreaming: true,
+	}, nil
+}
+
+// writeRanges writes each range as a part of a multipart/byteranges body
+func writeRanges(mw *multipart.Writer, ranges []byteRange, size int64, contentType string, openRange func(byteRange) (io.ReadCloser, error)) error {
+	for _, r := range ranges {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  []string{contentType},
+			"Content-Range": []string{r.contentRange(size)},
+		})
+		if err != nil {
+			return err
+		}
+		body, err := openRange(r)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(part, body)
+		body.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// rangeNotSatisfiable builds a 416 response for an object of the given size
+func rangeNotSatisfiable(size int64) *Response {
+	return &Response{
+		StatusCode: http.StatusRequestedRangeNotSatisfiable,
+		Headers: http.Header{
+			"Content-Range": []string{fmt.Sprintf("bytes */%d", size)},
+		},
+		Body:        "requested range not satisfiable",
+		ContentType: "text/plain",
+	}
+}
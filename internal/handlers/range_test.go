@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/muandane/estrois/internal/cache"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   []byteRange
+		err    error
+	}{
+		{"single", "bytes=0-9", []byteRange{{0, 10}}, nil},
+		{"open ended", "bytes=90-", []byteRange{{90, 10}}, nil},
+		{"suffix", "bytes=-5", []byteRange{{95, 5}}, nil},
+		{"clamped end", "bytes=50-500", []byteRange{{50, 50}}, nil},
+		{"disjoint sorted", "bytes=50-59,0-9", []byteRange{{0, 10}, {50, 10}}, nil},
+		{"overlapping merged", "bytes=0-19,10-29", []byteRange{{0, 30}}, nil},
+		{"adjacent merged", "bytes=0-9,10-19", []byteRange{{0, 20}}, nil},
+		{"contained merged", "bytes=0-49,10-19", []byteRange{{0, 50}}, nil},
+		{"repeated whole object", "bytes=0-,0-,0-,0-", []byteRange{{0, 100}}, nil},
+		{"outside dropped", "bytes=0-9,200-300", []byteRange{{0, 10}}, nil},
+		{"all outside", "bytes=200-300", nil, errUnsatisfiableRange},
+		{"malformed", "items=0-9", nil, errInvalidRange},
+		{"reversed", "bytes=9-0", nil, errInvalidRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRange(tt.header, 100)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("parseRange(%q) error = %v, want %v", tt.header, err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRange(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRangeLimitsRangeCount(t *testing.T) {
+	specs := make([]string, maxRanges+1)
+	for i := range specs {
+		specs[i] = fmt.Sprintf("%d-%d", i*10, i*10+1)
+	}
+	if _, err := parseRange("bytes="+strings.Join(specs[:maxRanges], ","), 1000); err != nil {
+		t.Fatalf("%d ranges: unexpected error %v", maxRanges, err)
+	}
+	if _, err := parseRange("bytes="+strings.Join(specs, ","), 1000); !errors.Is(err, errUnsatisfiableRange) {
+		t.Fatalf("%d ranges: error = %v, want %v", maxRanges+1, err, errUnsatisfiableRange)
+	}
+}
+
+func TestGetRangeMissStreamsFromStorage(t *testing.T) {
+	env := newTestEnv(t)
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	env.putObject(t, "ranged.bin", "application/octet-stream", data)
+
+	w := env.do(http.MethodGet, "/objects/"+testBucket+"/ranged.bin", nil, map[string]string{"Range": "bytes=100-199"})
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want 206", w.Code)
+	}
+	if got := w.Header().Get("Content-Range"); got != "bytes 100-199/10000" {
+		t.Errorf("Content-Range = %q", got)
+	}
+	if got := w.Header().Get("Content-Length"); got != "100" {
+		t.Errorf("Content-Length = %q, want 100", got)
+	}
+	if !bytes.Equal(w.Body.Bytes(), data[100:200]) {
+		t.Errorf("body = %q, want %q", w.Body.Bytes(), data[100:200])
+	}
+}
+
+func TestGetMultipleRangesMergesAndStreamsParts(t *testing.T) {
+	env := newTestEnv(t)
+	data := bytes.Repeat([]byte("abcdefghij"), 100)
+	env.putObject(t, "multi.bin", "application/octet-stream", data)
+
+	// The whole object requested three times is fetched once
+	w := env.do(http.MethodGet, "/objects/"+testBucket+"/multi.bin", nil, map[string]string{"Range": "bytes=0-,0-,0-"})
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Fatalf("repeated ranges: status = %d, body length = %d", w.Code, w.Body.Len())
+	}
+	if gets := env.objectGets("multi.bin"); gets != 1 {
+		t.Errorf("repeated ranges: %d storage reads, want 1", gets)
+	}
+
+	w = env.do(http.MethodGet, "/objects/"+testBucket+"/multi.bin", nil, map[string]string{"Range": "bytes=0-4,900-909,5-9"})
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want 206", w.Code)
+	}
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("Content-Type = %q", w.Header().Get("Content-Type"))
+	}
+	reader := multipart.NewReader(w.Body, params["boundary"])
+	want := []struct {
+		contentRange string
+		body         []byte
+	}{
+		{"bytes 0-9/1000", data[0:10]},
+		{"bytes 900-909/1000", data[900:910]},
+	}
+	for _, part := range want {
+		p, err := reader.NextPart()
+		if err != nil {
+			t.Fatalf("reading part %s: %v", part.contentRange, err)
+		}
+		if got := p.Header.Get("Content-Range"); got != part.contentRange {
+			t.Errorf("Content-Range = %q, want %q", got, part.contentRange)
+		}
+		body, _ := io.ReadAll(p)
+		if !bytes.Equal(body, part.body) {
+			t.Errorf("part %s = %q, want %q", part.contentRange, body, part.body)
+		}
+	}
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Errorf("expected 2 parts, next part error = %v", err)
+	}
+}
+
+func TestGetTooManyRangesIsUnsatisfiable(t *testing.T) {
+	env := newTestEnv(t)
+	env.putObject(t, "many.bin", "application/octet-stream", bytes.Repeat([]byte("x"), 1000))
+
+	specs := make([]string, maxRanges+1)
+	for i := range specs {
+		specs[i] = fmt.Sprintf("%d-%d", i*10, i*10+1)
+	}
+	w := env.do(http.MethodGet, "/objects/"+testBucket+"/many.bin", nil, map[string]string{"Range": "bytes=" + strings.Join(specs, ",")})
+	if w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("status = %d, want 416", w.Code)
+	}
+}
+
+func TestGetRangeHitSlicesCachedObject(t *testing.T) {
+	env := newTestEnv(t)
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	env.putObject(t, "cached.bin", "application/octet-stream", data)
+
+	if w := env.do(http.MethodGet, "/objects/"+testBucket+"/cached.bin", nil, nil); w.Code != http.StatusOK {
+		t.Fatalf("full GET: status = %d", w.Code)
+	}
+	env.waitCached(t, "cached.bin")
+	env.resetRequests()
+
+	w := env.do(http.MethodGet, "/objects/"+testBucket+"/cached.bin", nil, map[string]string{"Range": "bytes=10-19"})
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want 206", w.Code)
+	}
+	if got := w.Header().Get("X-Cache"); got != "HIT" {
+		t.Errorf("X-Cache = %q, want HIT", got)
+	}
+	if got := w.Header().Get("Content-Range"); got != "bytes 10-19/1000" {
+		t.Errorf("Content-Range = %q", got)
+	}
+	if !bytes.Equal(w.Body.Bytes(), data[10:20]) {
+		t.Errorf("body = %q, want %q", w.Body.Bytes(), data[10:20])
+	}
+	if requests := env.storageRequests(); len(requests) != 0 {
+		t.Errorf("range hit reached storage: %v", requests)
+	}
+}
+
+func TestGetRangeMissIsNotCached(t *testing.T) {
+	env := newTestEnv(t)
+	data := bytes.Repeat([]byte("abcdefghij"), 100)
+	env.putObject(t, "cold.bin", "application/octet-stream", data)
+
+	w := env.do(http.MethodGet, "/objects/"+testBucket+"/cold.bin", nil, map[string]string{"Range": "bytes=0-99"})
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), data[:100]) {
+		t.Fatalf("status = %d, body %q", w.Code, w.Body.Bytes())
+	}
+	if ranges := env.storageRanges(); !reflect.DeepEqual(ranges, []string{"bytes=0-99"}) {
+		t.Errorf("storage was asked for %v, want only the requested range", ranges)
+	}
+	// Give a background fill the chance to run, were there one
+	time.Sleep(50 * time.Millisecond)
+	if _, status := env.store.Get(objectCacheKey(testBucket, "cold.bin", "")); status != cache.StatusMiss {
+		t.Errorf("a partial fetch was cached as the object, status %s", status)
+	}
+
+	// Only the requested range was fetched, so a full GET goes to storage
+	env.resetRequests()
+	w = env.do(http.MethodGet, "/objects/"+testBucket+"/cold.bin", nil, nil)
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Fatalf("full GET: status = %d, body length %d", w.Code, w.Body.Len())
+	}
+	if gets := env.objectGets("cold.bin"); gets != 1 {
+		t.Errorf("full GET after a range miss made %d storage reads, want 1", gets)
+	}
+}
+
+func TestAcceptRangesIsAdvertised(t *testing.T) {
+	setStreamThreshold(t, 1024)
+	env := newTestEnv(t)
+	env.putObject(t, "small.txt", "text/plain", []byte("advertised"))
+	env.putObject(t, "large.bin", "application/octet-stream", bytes.Repeat([]byte("0123456789abcdef"), 256))
+	small := "/objects/" + testBucket + "/small.txt"
+
+	check := func(name string, w *httptest.ResponseRecorder, wantStatus int) {
+		t.Helper()
+		if w.Code != wantStatus {
+			t.Errorf("%s: status = %d, want %d", name, w.Code, wantStatus)
+		}
+		if got := w.Header().Get("Accept-Ranges"); got != "bytes" {
+			t.Errorf("%s: Accept-Ranges = %q, want bytes", name, got)
+		}
+	}
+	check("GET miss", env.do(http.MethodGet, small, nil, nil), http.StatusOK)
+	env.waitCached(t, "small.txt")
+	check("GET hit", env.do(http.MethodGet, small, nil, nil), http.StatusOK)
+	check("streamed GET", env.do(http.MethodGet, "/objects/"+testBucket+"/large.bin", nil, nil), http.StatusOK)
+	check("HEAD", env.do(http.MethodHead, small, nil, nil), http.StatusOK)
+	check("OPTIONS", env.do(http.MethodOptions, small, nil, nil), http.StatusNoContent)
+}
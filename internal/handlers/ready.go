@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/muandane/estrois/internal/config"
+)
+
+// readyTimeout bounds the storage check behind /ready, set by READY_TIMEOUT
+var readyTimeout = config.GetEnvWithDefaultDuration("READY_TIMEOUT", 2*time.Second)
+
+// BucketLister is the storage call used to check connectivity; *minio.Client
+// implements it
+type BucketLister interface {
+	ListBuckets(ctx context.Context) ([]minio.BucketInfo, error)
+}
+
+// ReadyResponse reports the slowest backend's latency, and the error of each
+// unreachable backend
+type ReadyResponse struct {
+	Status         string  `json:"status"`
+	StorageLatency float64 `json:"storage_latency_ms"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// ReadyHandler is a readiness probe that answers 503 while any storage
+// backend is unreachable. /health stays a pure liveness probe.
+type ReadyHandler struct {
+	backends map[string]BucketLister
+	logger   *slog.Logger
+}
+
+// NewReadyHandler checks each of backends, by name, on every probe
+func NewReadyHandler(backends map[string]BucketLister, logger *slog.Logger) *ReadyHandler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &ReadyHandler{
+		backends: backends,
+		logger:   logger,
+	}
+}
+
+// backendCheck is the outcome of one backend's readiness check
+type backendCheck struct {
+	name    string
+	latency time.Duration
+	err     error
+}
+
+func (h *ReadyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	// Backends are checked concurrently, so a slow one costs at most the
+	// timeout
+	checks := make(chan backendCheck, len(h.backends))
+	for name, client := range h.backends {
+		go func() {
+			start := time.Now()
+			_, err := client.ListBuckets(ctx)
+			checks <- backendCheck{name: name, latency: time.Since(start), err: err}
+		}()
+	}
+
+	resp := ReadyResponse{Status: "ready"}
+	status := http.StatusOK
+	var failures []string
+	for range h.backends {
+		check := <-checks
+		resp.StorageLatency = max(resp.StorageLatency, float64(check.latency.Microseconds())/1000)
+		if storageReachable(check.err) {
+			continue
+		}
+		failures = append(failures, check.name+": "+check.err.Error())
+		h.logger.Warn("readiness check failed",
+			"backend", check.name,
+			"duration", check.latency.String(),
+			"error", check.err,
+		)
+	}
+	if len(failures) > 0 {
+		slices.Sort(failures)
+		resp.Status = "unavailable"
+		resp.Error = strings.Join(failures, "; ")
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// storageReachable reports whether storage answered. An S3 error below 500,
+// such as AccessDenied for credentials scoped to a few buckets, still proves
+// the backend is up.
+func storageReachable(err error) bool {
+	if err == nil {
+		return true
+	}
+	var errResp minio.ErrorResponse
+	return errors.As(err, &errResp) && errResp.StatusCode > 0 && errResp.StatusCode < http.StatusInternalServerError
+}
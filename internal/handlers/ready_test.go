@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// fakeLister answers ListBuckets with err, or waits for the context to end
+// when hang is set
+type fakeLister struct {
+	err  error
+	hang bool
+}
+
+func (f fakeLister) ListBuckets(ctx context.Context) ([]minio.BucketInfo, error) {
+	if f.hang {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return nil, f.err
+}
+
+func TestReadyHandler(t *testing.T) {
+	previous := readyTimeout
+	readyTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { readyTimeout = previous })
+
+	tests := []struct {
+		name       string
+		client     fakeLister
+		wantStatus int
+		wantState  string
+	}{
+		{"healthy", fakeLister{}, http.StatusOK, "ready"},
+		{"access denied", fakeLister{err: minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusForbidden}}, http.StatusOK, "ready"},
+		{"connection refused", fakeLister{err: errors.New("dial tcp: connection refused")}, http.StatusServiceUnavailable, "unavailable"},
+		{"server error", fakeLister{err: minio.ErrorResponse{Code: "InternalError", StatusCode: http.StatusInternalServerError}}, http.StatusServiceUnavailable, "unavailable"},
+		{"timeout", fakeLister{hang: true}, http.StatusServiceUnavailable, "unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewReadyHandler(map[string]BucketLister{"default": tt.client}, slog.New(slog.DiscardHandler))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var resp ReadyResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != tt.wantState {
+				t.Errorf("status = %q, want %q", resp.Status, tt.wantState)
+			}
+			if (resp.Error != "") != (tt.wantStatus != http.StatusOK) {
+				t.Errorf("error = %q", resp.Error)
+			}
+			if tt.client.hang && resp.StorageLatency < 50 {
+				t.Errorf("storage latency = %vms, want at least the 50ms timeout", resp.StorageLatency)
+			}
+		})
+	}
+}
+
+func TestReadyHandlerChecksEveryBackend(t *testing.T) {
+	down := fakeLister{err: errors.New("dial tcp: connection refused")}
+	tests := []struct {
+		name       string
+		backends   map[string]BucketLister
+		wantStatus int
+		wantError  string
+	}{
+		{"all reachable", map[string]BucketLister{"default": fakeLister{}, "archive": fakeLister{}}, http.StatusOK, ""},
+		{"routed backend down", map[string]BucketLister{"default": fakeLister{}, "archive": down}, http.StatusServiceUnavailable, "archive: dial tcp: connection refused"},
+		{"every backend down", map[string]BucketLister{"default": down, "archive": down}, http.StatusServiceUnavailable, "archive: dial tcp: connection refused; default: dial tcp: connection refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			NewReadyHandler(tt.backends, slog.New(slog.DiscardHandler)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var resp ReadyResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", resp.Error, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestHealthHandlerIgnoresStorage(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewHealthHandler(slog.New(slog.DiscardHandler)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if w.Code != http.StatusOK || w.Body.String() != `{"status":"healthy"}` {
+		t.Errorf("status = %d, body %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+// setBucketDocuments sets the index or error documents of buckets for the
+// duration of the test
+func setBucketDocuments(t *testing.T, documents *map[string]string, value map[string]string) {
+	previous := *documents
+	*documents = value
+	t.Cleanup(func() { *documents = previous })
+}
+
+func TestIndexDocuments(t *testing.T) {
+	env := newTestEnv(t)
+	env.putObject(t, "index.html", "text/html", []byte("home"))
+	env.putObject(t, "docs/index.html", "text/html", []byte("docs index"))
+	env.putObject(t, "docs/page.html", "text/html", []byte("docs page"))
+	env.putObject(t, "empty/other.html", "text/html", []byte("no index here"))
+
+	tests := []struct {
+		name       string
+		key        string
+		wantStatus int
+		wantBody   string
+	}{
+		{"directory", "docs/", http.StatusOK, "docs index"},
+		{"directory without slash", "docs", http.StatusOK, "docs index"},
+		{"bucket root", "", http.StatusOK, "home"},
+		{"plain object", "docs/page.html", http.StatusOK, "docs page"},
+		{"directory without index", "empty/", http.StatusNotFound, ""},
+		{"missing path", "missing/page", http.StatusNotFound, ""},
+	}
+	t.Run("enabled", func(t *testing.T) {
+		setBucketDocuments(t, &indexDocuments, map[string]string{testBucket: "index.html"})
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				w := env.do(http.MethodGet, "/objects/"+testBucket+"/"+tt.key, nil, nil)
+				if w.Code != tt.wantStatus {
+					t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+				}
+				if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+					t.Errorf("body = %q, want %q", w.Body, tt.wantBody)
+				}
+			})
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		setBucketDocuments(t, &indexDocuments, map[string]string{"other-bucket": "index.html"})
+		for _, key := range []string{"docs/", "docs"} {
+			if w := env.do(http.MethodGet, "/objects/"+testBucket+"/"+key, nil, nil); w.Code != http.StatusNotFound {
+				t.Errorf("GET %s without an index document: status = %d, want 404", key, w.Code)
+			}
+		}
+	})
+}
+
+func TestErrorDocuments(t *testing.T) {
+	env := newTestEnv(t)
+	env.putObject(t, "404.html", "text/html", []byte("<h1>Not here</h1>"))
+	env.putObject(t, "page.html", "text/html", []byte("page"))
+	path := "/objects/" + testBucket + "/"
+
+	t.Run("served", func(t *testing.T) {
+		setBucketDocuments(t, &errorDocuments, map[string]string{testBucket: "404.html"})
+		for _, headers := range []map[string]string{nil, {"Range": "bytes=0-1", "If-None-Match": "*"}} {
+			w := env.do(http.MethodGet, path+"missing.html", nil, headers)
+			if w.Code != http.StatusNotFound || w.Body.String() != "<h1>Not here</h1>" {
+				t.Errorf("GET with %v: status = %d, body %q, want the error document with 404", headers, w.Code, w.Body)
+			}
+			if got := w.Header().Get("Content-Type"); got != "text/html" {
+				t.Errorf("Content-Type = %q, want text/html", got)
+			}
+			// Caches must not take the error document for the missing object
+			if etag := responseETag(w); etag != "" {
+				t.Errorf("ETag = %q on the error document", etag)
+			}
+		}
+		if w := env.do(http.MethodGet, path+"page.html", nil, nil); w.Code != http.StatusOK || w.Body.String() != "page" {
+			t.Errorf("existing object: status = %d, body %q", w.Code, w.Body)
+		}
+		// Other requests keep their JSON errors
+		for _, method := range []string{http.MethodHead, http.MethodDelete} {
+			if w := env.do(method, path+"missing.html", nil, nil); w.Body.String() == "<h1>Not here</h1>" {
+				t.Errorf("%s answered with the error document", method)
+			}
+		}
+	})
+
+	for name, documents := range map[string]map[string]string{
+		"not configured":   {},
+		"missing document": {testBucket: "gone.html"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			setBucketDocuments(t, &errorDocuments, documents)
+			w := env.do(http.MethodGet, path+"missing.html", nil, nil)
+			if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("status = %d, Content-Type %q, want a JSON 404", w.Code, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
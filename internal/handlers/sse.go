@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+// customerEncryption reads SSE-C request headers into the encryption passed
+// to storage. It returns nil when the request carries none. Objects read or
+// written with a customer key never enter the cache, which holds plaintext.
+func customerEncryption(headers http.Header) (encrypt.ServerSide, error) {
+	algorithm := headers.Get(encrypt.SseCustomerAlgorithm)
+	key := headers.Get(encrypt.SseCustomerKey)
+	keyMD5 := headers.Get(encrypt.SseCustomerKeyMD5)
+	if algorithm == "" && key == "" && keyMD5 == "" {
+		return nil, nil
+	}
+
+	if algorithm != "AES256" {
+		return nil, &ValidationError{Field: encrypt.SseCustomerAlgorithm, Message: "must be AES256"}
+	}
+	rawKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(rawKey) != 32 {
+		return nil, &ValidationError{Field: encrypt.SseCustomerKey, Message: "must be a base64-encoded 256-bit key"}
+	}
+	if keyMD5 != "" {
+		sum := md5.Sum(rawKey)
+		expected, err := base64.StdEncoding.DecodeString(keyMD5)
+		if err != nil || !bytes.Equal(expected, sum[:]) {
+			return nil, &ValidationError{Field: encrypt.SseCustomerKeyMD5, Message: "does not match the customer key"}
+		}
+	}
+
+	sse, err := encrypt.NewSSEC(rawKey)
+	if err != nil {
+		return nil, &ValidationError{Field: encrypt.SseCustomerKey, Message: err.Error()}
+	}
+	return sse, nil
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+
+	"github.com/muandane/estrois/internal/cache"
+)
+
+// customerKeyHeaders returns SSE-C request headers for a 256-bit key
+func customerKeyHeaders(key []byte) map[string]string {
+	sum := md5.Sum(key)
+	return map[string]string{
+		encrypt.SseCustomerAlgorithm: "AES256",
+		encrypt.SseCustomerKey:       base64.StdEncoding.EncodeToString(key),
+		encrypt.SseCustomerKeyMD5:    base64.StdEncoding.EncodeToString(sum[:]),
+	}
+}
+
+func TestCustomerEncryptionIsForwardedAndNeverCached(t *testing.T) {
+	env := newTestEnv(t)
+	var mu sync.Mutex
+	forwarded := make(map[string]string)
+	env.onStorageRequest(func(r *http.Request) {
+		if r.URL.Path == "/"+testBucket+"/secret.txt" {
+			mu.Lock()
+			forwarded[r.Method] = r.Header.Get(encrypt.SseCustomerKeyMD5)
+			mu.Unlock()
+		}
+	})
+	headers := customerKeyHeaders(bytes.Repeat([]byte("k"), 32))
+	path := "/objects/" + testBucket + "/secret.txt"
+	data := []byte("customer encrypted")
+
+	if w := env.do(http.MethodPut, path, bytes.NewReader(data), headers); w.Code != http.StatusOK {
+		t.Fatalf("PUT: status = %d, body %s", w.Code, w.Body)
+	}
+	for i := range 2 {
+		w := env.do(http.MethodGet, path, nil, headers)
+		if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+			t.Fatalf("GET %d: status = %d, body %q", i, w.Code, w.Body.Bytes())
+		}
+		if got := w.Header().Get("X-Cache"); got != string(cache.StatusBypass) {
+			t.Errorf("GET %d: X-Cache = %q, want %s", i, got, cache.StatusBypass)
+		}
+	}
+
+	mu.Lock()
+	for _, method := range []string{http.MethodPut, http.MethodGet} {
+		if forwarded[method] != headers[encrypt.SseCustomerKeyMD5] {
+			t.Errorf("%s to storage carried key MD5 %q, want %q", method, forwarded[method], headers[encrypt.SseCustomerKeyMD5])
+		}
+	}
+	mu.Unlock()
+	if gets := env.objectGets("secret.txt"); gets != 2 {
+		t.Errorf("storage served %d GETs, want every read to bypass the cache", gets)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, status := env.store.Get(objectCacheKey(testBucket, "secret.txt", "")); status != cache.StatusMiss {
+		t.Errorf("encrypted object was cached, status %s", status)
+	}
+}
+
+func TestInvalidCustomerKeysAreRejected(t *testing.T) {
+	env := newTestEnv(t)
+	valid := customerKeyHeaders(bytes.Repeat([]byte("k"), 32))
+	tests := []struct {
+		name    string
+		headers map[string]string
+	}{
+		{"wrong algorithm", map[string]string{encrypt.SseCustomerAlgorithm: "AES128", encrypt.SseCustomerKey: valid[encrypt.SseCustomerKey]}},
+		{"short key", customerKeyHeaders([]byte("too short"))},
+		{"key not base64", map[string]string{encrypt.SseCustomerAlgorithm: "AES256", encrypt.SseCustomerKey: "not base64!"}},
+		{"mismatched MD5", map[string]string{encrypt.SseCustomerAlgorithm: "AES256", encrypt.SseCustomerKey: valid[encrypt.SseCustomerKey], encrypt.SseCustomerKeyMD5: "AAAAAAAAAAAAAAAAAAAAAA=="}},
+	}
+	env.resetRequests()
+	for _, tt := range tests {
+		for _, method := range []string{http.MethodPut, http.MethodGet} {
+			if w := env.do(method, "/objects/"+testBucket+"/secret.txt", bytes.NewReader([]byte("data")), tt.headers); w.Code != http.StatusBadRequest {
+				t.Errorf("%s %s: status = %d, want 400", tt.name, method, w.Code)
+			}
+		}
+	}
+	if requests := env.storageRequests(); len(requests) != 0 {
+		t.Errorf("invalid keys reached storage: %v", requests)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"sync/atomic"
 	"time"
+
+	"github.com/muandane/estrois/internal/cache"
 )
 
 type CacheStats struct {
@@ -20,40 +22,43 @@ type CacheStats struct {
 	CompressionRatio float64   `json:"compression_ratio"`
 }
 
+// StatsHandler counts cache hits and misses. Everything else it reports is
+// read from the store on each request, so sizes and entry counts are never stale.
 type StatsHandler struct {
-	stats *CacheStats
+	store  cache.Store
+	hits   atomic.Uint64
+	misses atomic.Uint64
 }
 
-func NewStatsHandler() *StatsHandler {
-	return &StatsHandler{
-		stats: &CacheStats{
-			MaxSize: 100 * 1024 * 1024, // 100MB
-		},
-	}
+func NewStatsHandler(store cache.Store) *StatsHandler {
+	return &StatsHandler{store: store}
 }
 
 func (h *StatsHandler) RecordHit() {
-	atomic.AddUint64(&h.stats.Hits, 1)
-	atomic.AddUint64(&h.stats.TotalRequests, 1)
+	h.hits.Add(1)
 }
 
 func (h *StatsHandler) RecordMiss() {
-	atomic.AddUint64(&h.stats.Misses, 1)
-	atomic.AddUint64(&h.stats.TotalRequests, 1)
-}
-
-func (h *StatsHandler) UpdateSize(size int64) {
-	atomic.StoreInt64(&h.stats.CurrentSize, size)
+	h.misses.Add(1)
 }
 
 func (h *StatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	hits := atomic.LoadUint64(&h.stats.Hits)
-	total := atomic.LoadUint64(&h.stats.TotalRequests)
+	cacheStats := h.store.Stats()
 
-	if total > 0 {
-		h.stats.CacheHitRatio = float64(hits) / float64(total) * 100
+	snapshot := CacheStats{
+		Hits:             h.hits.Load(),
+		Misses:           h.misses.Load(),
+		CurrentSize:      cacheStats.CurrentSize,
+		MaxSize:          cacheStats.MaxSize,
+		EntryCount:       cacheStats.EntryCount,
+		LastCleanupTime:  cacheStats.LastCleanupTime,
+		CompressionRatio: cacheStats.CompressionRatio,
+	}
+	snapshot.TotalRequests = snapshot.Hits + snapshot.Misses
+	if snapshot.TotalRequests > 0 {
+		snapshot.CacheHitRatio = float64(snapshot.Hits) / float64(snapshot.TotalRequests) * 100
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(h.stats)
+	json.NewEncoder(w).Encode(snapshot)
 }
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatsReportsHitsAndMisses(t *testing.T) {
+	env := newTestEnv(t)
+	data := []byte("counted")
+	env.putObject(t, "counted.txt", "text/plain", data)
+
+	path := "/objects/" + testBucket + "/counted.txt"
+	if w := env.do(http.MethodGet, path, nil, nil); w.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("first GET: X-Cache = %q, want MISS", w.Header().Get("X-Cache"))
+	}
+	env.waitCached(t, "counted.txt")
+	if w := env.do(http.MethodGet, path, nil, nil); w.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("second GET: X-Cache = %q, want HIT", w.Header().Get("X-Cache"))
+	}
+
+	w := httptest.NewRecorder()
+	env.handler.stats.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var stats CacheStats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Hits != 1 || stats.Misses != 1 || stats.TotalRequests != 2 || stats.CacheHitRatio != 50 {
+		t.Errorf("hits = %d, misses = %d, total = %d, ratio = %v, want 1, 1, 2, 50",
+			stats.Hits, stats.Misses, stats.TotalRequests, stats.CacheHitRatio)
+	}
+	if stats.EntryCount != 1 || stats.CurrentSize < int64(len(data)) {
+		t.Errorf("entry count = %d, size = %d, want the cached object", stats.EntryCount, stats.CurrentSize)
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/muandane/estrois/internal/middleware"
+)
+
+// tenantPrefix returns the key prefix of the request's tenant, such as
+// "acme/", or "" when keys are not namespaced
+func tenantPrefix(ctx context.Context) string {
+	if tenant := middleware.TenantFromContext(ctx); tenant != "" {
+		return tenant + "/"
+	}
+	return ""
+}
+
+// tenantKey maps a key as the client sees it to the key in storage
+func tenantKey(ctx context.Context, key string) string {
+	return tenantPrefix(ctx) + key
+}
+
+// clientKey maps a key in storage back to the key the client sees
+func clientKey(ctx context.Context, key string) string {
+	return strings.TrimPrefix(key, tenantPrefix(ctx))
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/muandane/estrois/internal/middleware"
+)
+
+// tenantHandler serves the object and listing routes for the tenant named in
+// the X-Tenant header
+func (env *testEnv) tenantHandler() http.Handler {
+	mux := http.NewServeMux()
+	env.handler.RegisterRoutes(mux)
+	mux.Handle("GET /objects/{bucket}", env.handler.ListHandler())
+	return middleware.WithTenant(middleware.TenantConfig{Header: "X-Tenant"}, slog.New(slog.NewTextHandler(io.Discard, nil)))(mux)
+}
+
+func TestTenantsIsolateTheSameKey(t *testing.T) {
+	env := newTestEnv(t)
+	handler := env.tenantHandler()
+	do := func(tenant, method, path, body string) *httptest.ResponseRecorder {
+		var reader io.Reader
+		if body != "" {
+			reader = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set("X-Tenant", tenant)
+		if body != "" {
+			req.Header.Set("Content-Type", "text/plain")
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, tenant := range []string{"acme", "globex"} {
+		if w := do(tenant, http.MethodPut, "/objects/"+testBucket+"/cat.txt", "cat of "+tenant); w.Code != http.StatusCreated && w.Code != http.StatusOK {
+			t.Fatalf("PUT as %s: status = %d, body %s", tenant, w.Code, w.Body)
+		}
+	}
+
+	// Each tenant's copy lives under its prefix in storage
+	for _, tenant := range []string{"acme", "globex"} {
+		obj, err := env.client.GetObject(context.Background(), testBucket, tenant+"/cat.txt", minio.GetObjectOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(obj)
+		obj.Close()
+		if err != nil || string(data) != "cat of "+tenant {
+			t.Errorf("storage %s/cat.txt = %q, %v", tenant, data, err)
+		}
+	}
+
+	// Twice, so the second read of each tenant comes from the cache
+	for range 2 {
+		for _, tenant := range []string{"acme", "globex"} {
+			w := do(tenant, http.MethodGet, "/objects/"+testBucket+"/cat.txt", "")
+			if w.Code != http.StatusOK || w.Body.String() != "cat of "+tenant {
+				t.Errorf("GET as %s: status = %d, body %q, X-Cache %s", tenant, w.Code, w.Body, w.Header().Get("X-Cache"))
+			}
+		}
+		env.waitCached(t, "acme/cat.txt")
+		env.waitCached(t, "globex/cat.txt")
+	}
+
+	if w := do("initech", http.MethodGet, "/objects/"+testBucket+"/cat.txt", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET as a tenant without the key: status = %d, want 404", w.Code)
+	}
+
+	w := do("acme", http.MethodGet, "/objects/"+testBucket, "")
+	var listing ListObjectsResponse
+	if err := json.NewDecoder(w.Body).Decode(&listing); err != nil {
+		t.Fatalf("listing: %v", err)
+	}
+	if len(listing.Objects) != 1 || listing.Objects[0].Key != "cat.txt" {
+		t.Errorf("acme listing = %+v, want only cat.txt", listing.Objects)
+	}
+
+	if w := do("acme", http.MethodDelete, "/objects/"+testBucket+"/cat.txt", ""); w.Code >= 300 {
+		t.Fatalf("DELETE as acme: status = %d", w.Code)
+	}
+	if w := do("globex", http.MethodGet, "/objects/"+testBucket+"/cat.txt", ""); w.Body.String() != "cat of globex" {
+		t.Errorf("deleting acme's key affected globex: %q", w.Body)
+	}
+}
+
+func TestUntenantedRequestsAreRejected(t *testing.T) {
+	env := newTestEnv(t)
+	env.putObject(t, "acme/cat.txt", "text/plain", []byte("cat of acme"))
+
+	w := httptest.NewRecorder()
+	env.tenantHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/objects/"+testBucket+"/acme/cat.txt", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("GET without a tenant: status = %d, want 403", w.Code)
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/muandane/estrois/internal/storage"
+)
+
+type opTimeoutKey struct{}
+
+// parseOpTimeout parses the timeout query parameter, which lets a client
+// shorten storage.OpTimeout for its request. Longer values are clamped to
+// storage.OpTimeout.
+func parseOpTimeout(value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, &ValidationError{Field: "timeout", Message: fmt.Sprintf("invalid duration %q, expected a positive Go duration such as 5s", value)}
+	}
+	return min(timeout, storage.OpTimeout), nil
+}
+
+// withOpTimeout returns a copy of ctx whose storage calls are bounded by timeout
+func withOpTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, opTimeoutKey{}, timeout)
+}
+
+// opTimeout returns the storage timeout for ctx: the client's timeout when
+// it set one, storage.OpTimeout otherwise
+func opTimeout(ctx context.Context) time.Duration {
+	if timeout, ok := ctx.Value(opTimeoutKey{}).(time.Duration); ok {
+		return timeout
+	}
+	return storage.OpTimeout
+}
+
+// sharedContext detaches ctx for storage work shared with other requests, so
+// neither the client's cancellation nor its timeout fails the others
+func sharedContext(ctx context.Context) context.Context {
+	return withOpTimeout(context.WithoutCancel(ctx), storage.OpTimeout)
+}
+
+// storageContext bounds a single storage call by the request's storage timeout
+func storageContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, opTimeout(ctx))
+}
+
+// acquireRead waits for a storage read slot for at most the request's storage
+// timeout
+func acquireRead(ctx context.Context) (func(), error) {
+	waitCtx, cancel := storageContext(ctx)
+	defer cancel()
+	release, err := storage.AcquireRead(waitCtx)
+	if err != nil {
+		return nil, fmt.Errorf("waiting for a storage read slot: %w", err)
+	}
+	return release, nil
+}
+
+// idleTimeout bounds transfers whose total duration depends on the object size,
+// such as uploads and streamed downloads. The context is cancelled once no
+// bytes have moved for the request's storage timeout.
+type idleTimeout struct {
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func newIdleTimeout(ctx context.Context) *idleTimeout {
+	timeout := opTimeout(ctx)
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &idleTimeout{
+		ctx:    ctx,
+		cancel: cancel,
+		timer: time.AfterFunc(timeout, func() {
+			cancel(context.DeadlineExceeded)
+		}),
+		timeout: timeout,
+	}
+}
+
+// Read records progress. It lets the timeout be used as a minio Progress reader.
+func (t *idleTimeout) Read(p []byte) (int, error) {
+	t.touch()
+	return len(p), nil
+}
+
+func (t *idleTimeout) touch() {
+	t.timer.Reset(t.timeout)
+}
+
+func (t *idleTimeout) stop() {
+	t.timer.Stop()
+	t.cancel(nil)
+}
+
+// err reports a failure caused by the idle timeout as context.DeadlineExceeded
+func (t *idleTimeout) err(err error) error {
+	if err != nil && errors.Is(context.Cause(t.ctx), context.DeadlineExceeded) {
+		return fmt.Errorf("storage transfer idle for %s: %w", t.timeout, context.DeadlineExceeded)
+	}
+	return err
+}
+
+// idleReader resets its idle timeout on every read and stops it on close,
+// releasing the storage read slot held for it, if any
+type idleReader struct {
+	io.ReadCloser
+	timeout *idleTimeout
+	release func()
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.timeout.touch()
+	}
+	if err != nil && err != io.EOF {
+		err = r.timeout.err(err)
+	}
+	return n, err
+}
+
+func (r *idleReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.timeout.stop()
+	if r.release != nil {
+		r.release()
+	}
+	return err
+}
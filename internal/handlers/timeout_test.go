@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/muandane/estrois/internal/storage"
+)
+
+// setOpTimeout bounds storage calls by timeout for the duration of the test
+func setOpTimeout(t *testing.T, timeout time.Duration) {
+	previous := storage.OpTimeout
+	storage.OpTimeout = timeout
+	t.Cleanup(func() { storage.OpTimeout = previous })
+}
+
+// hangStorage makes storage hang on every later request until the test ends
+// or the caller gives up
+func (env *testEnv) hangStorage(t *testing.T) {
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	env.onStorageRequest(func(r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	})
+}
+
+func TestHungStorageTimesOut(t *testing.T) {
+	setOpTimeout(t, 100*time.Millisecond)
+	env := newTestEnv(t)
+	env.putObject(t, "slow.txt", "text/plain", []byte("slow"))
+	env.hangStorage(t)
+
+	tests := []struct {
+		method string
+		body   []byte
+	}{
+		{http.MethodGet, nil},
+		{http.MethodHead, nil},
+		{http.MethodPut, []byte("new contents")},
+		{http.MethodDelete, nil},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		w := env.do(tt.method, "/objects/"+testBucket+"/slow.txt", bytes.NewReader(tt.body), nil)
+		if w.Code != http.StatusGatewayTimeout {
+			t.Errorf("%s: status = %d, want 504", tt.method, w.Code)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: answered after %s", tt.method, elapsed)
+		}
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	setOpTimeout(t, 300*time.Millisecond)
+	env := newTestEnv(t)
+	env.putObject(t, "slow.txt", "text/plain", []byte("slow"))
+	env.hangStorage(t)
+	path := "/objects/" + testBucket + "/slow.txt"
+
+	tests := []struct {
+		name       string
+		timeout    string
+		wantStatus int
+		maxElapsed time.Duration
+	}{
+		{"shorter than the server's", "20ms", http.StatusGatewayTimeout, 250 * time.Millisecond},
+		{"clamped to the server's", "1h", http.StatusGatewayTimeout, 5 * time.Second},
+		{"invalid", "soon", http.StatusBadRequest, time.Second},
+		{"negative", "-1s", http.StatusBadRequest, time.Second},
+		{"zero", "0s", http.StatusBadRequest, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			w := env.do(http.MethodGet, path+"?timeout="+tt.timeout, nil, nil)
+			elapsed := time.Since(start)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if elapsed > tt.maxElapsed {
+				t.Errorf("answered after %s, want within %s", elapsed, tt.maxElapsed)
+			}
+		})
+	}
+}
+
+func TestParseOpTimeout(t *testing.T) {
+	setOpTimeout(t, 30*time.Second)
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"5s", 5 * time.Second, false},
+		{"250ms", 250 * time.Millisecond, false},
+		{"30s", 30 * time.Second, false},
+		{"10m", 30 * time.Second, false},
+		{"5", 0, true},
+		{"0s", 0, true},
+		{"-5s", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseOpTimeout(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseOpTimeout(%q) = %s, %v, want %s, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
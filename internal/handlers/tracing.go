@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/muandane/estrois/internal/cache"
+	"github.com/muandane/estrois/internal/tracing"
+)
+
+// startSpan starts a child span of the request's span for an operation on
+// bucket/key, such as "storage.get"
+func startSpan(ctx context.Context, name, bucket, key string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, name, attribute.String("bucket", bucket), attribute.String("key", key))
+}
+
+// lookupCache reads cacheKey from the store in a "cache.lookup" span
+func (h *ObjectHandler) lookupCache(ctx context.Context, bucket, key, cacheKey string) (*cache.CacheEntry, cache.Status) {
+	_, span := startSpan(ctx, "cache.lookup", bucket, key)
+	defer span.End()
+	entry, status := h.store.Get(cacheKey)
+	span.SetAttributes(attribute.String("cache_status", string(status)))
+	return entry, status
+}
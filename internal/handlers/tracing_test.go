@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/muandane/estrois/internal/middleware"
+)
+
+// recordSpans installs a tracer provider recording every span and the W3C
+// trace context propagator for the duration of the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+		provider.Shutdown(t.Context())
+	})
+	return recorder
+}
+
+// spanAttr returns the value of the span's attribute key, or "" when unset
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, attr := range span.Attributes() {
+		if attr.Key == key {
+			return attr.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestCacheMissSpanTree(t *testing.T) {
+	env := newTestEnv(t)
+	data := bytes.Repeat([]byte("traced "), 100)
+	env.putObject(t, "traced.txt", "text/plain", data)
+	recorder := recordSpans(t)
+	handler := middleware.WithTracing()(env.mux)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const parentID = "00f067aa0ba902b7"
+	req := httptest.NewRequest(http.MethodGet, "/objects/"+testBucket+"/traced.txt", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("GET returned %d with X-Cache %q, want a 200 MISS", w.Code, w.Header().Get("X-Cache"))
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		for _, span := range recorder.Ended() {
+			spans[span.Name()] = span
+		}
+		if spans["storage.get"] != nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	server := spans["GET /objects/{bucket}/{key...}"]
+	if server == nil {
+		t.Fatalf("no server span named after the route, got spans %v", spanNames(spans))
+	}
+	if got := server.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("server span trace ID = %s, want the incoming %s", got, traceID)
+	}
+	if got := server.Parent().SpanID().String(); got != parentID {
+		t.Errorf("server span parent = %s, want the incoming %s", got, parentID)
+	}
+	if got := spanAttr(server, "cache_status"); got != "MISS" {
+		t.Errorf("server span cache_status = %q, want MISS", got)
+	}
+
+	for _, name := range []string{"cache.lookup", "storage.get"} {
+		span := spans[name]
+		if span == nil {
+			t.Errorf("no %s span, got spans %v", name, spanNames(spans))
+			continue
+		}
+		if span.SpanContext().TraceID() != server.SpanContext().TraceID() {
+			t.Errorf("%s span is in trace %s, want %s", name, span.SpanContext().TraceID(), traceID)
+		}
+		if span.Parent().SpanID() != server.SpanContext().SpanID() {
+			t.Errorf("%s span parent = %s, want the server span %s", name, span.Parent().SpanID(), server.SpanContext().SpanID())
+		}
+		if got := spanAttr(span, "bucket"); got != testBucket {
+			t.Errorf("%s span bucket = %q, want %q", name, got, testBucket)
+		}
+		if got := spanAttr(span, "key"); got != "traced.txt" {
+			t.Errorf("%s span key = %q, want traced.txt", name, got)
+		}
+	}
+	if span := spans["cache.lookup"]; span != nil {
+		if got := spanAttr(span, "cache_status"); got != "MISS" {
+			t.Errorf("cache.lookup span cache_status = %q, want MISS", got)
+		}
+	}
+	if span := spans["storage.get"]; span != nil {
+		if got := spanAttr(span, "bytes"); got != "700" {
+			t.Errorf("storage.get span bytes = %q, want 700", got)
+		}
+	}
+}
+
+func spanNames(spans map[string]sdktrace.ReadOnlySpan) []string {
+	names := make([]string, 0, len(spans))
+	for name := range spans {
+		names = append(names, name)
+	}
+	return names
+}
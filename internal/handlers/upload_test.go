@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func setMaxUploadSize(t *testing.T, size int64) {
+	previous := maxUploadSize
+	maxUploadSize = size
+	t.Cleanup(func() { maxUploadSize = previous })
+}
+
+// storedSize returns the size of key in storage, or -1 when it is missing
+func (env *testEnv) storedSize(t *testing.T, key string) int64 {
+	t.Helper()
+	info, err := env.client.StatObject(context.Background(), testBucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return -1
+	}
+	return info.Size
+}
+
+// unsizedReader hides the length of its data, as a chunked body would
+type unsizedReader struct{ io.Reader }
+
+func TestPutSizeLimit(t *testing.T) {
+	setMaxUploadSize(t, 1024)
+	env := newTestEnv(t)
+
+	atLimit := bytes.Repeat([]byte("a"), 1024)
+	overLimit := bytes.Repeat([]byte("a"), 1025)
+
+	tests := []struct {
+		name       string
+		body       io.Reader
+		length     int64
+		gzip       bool
+		wantStatus int
+		wantSize   int64
+	}{
+		{"declared at limit", bytes.NewReader(atLimit), 1024, false, http.StatusOK, 1024},
+		{"declared over limit", bytes.NewReader(overLimit), 1025, false, http.StatusRequestEntityTooLarge, -1},
+		{"undeclared at limit", unsizedReader{bytes.NewReader(atLimit)}, -1, false, http.StatusOK, 1024},
+		{"undeclared over limit", unsizedReader{bytes.NewReader(overLimit)}, -1, false, http.StatusRequestEntityTooLarge, -1},
+		{"gzip decoded at limit", gzipped(t, atLimit), -1, true, http.StatusOK, 1024},
+		{"gzip decoded over limit", gzipped(t, bytes.Repeat([]byte("a"), 1<<20)), -1, true, http.StatusRequestEntityTooLarge, -1},
+		{"gzip bomb", gzipped(t, make([]byte, 64<<20)), -1, true, http.StatusRequestEntityTooLarge, -1},
+		{"corrupt gzip", bytes.NewReader([]byte("not gzip")), -1, true, http.StatusBadRequest, -1},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := "upload-" + string(rune('a'+i)) + ".bin"
+			req := httptest.NewRequest(http.MethodPut, "/objects/"+testBucket+"/"+key, tt.body)
+			req.ContentLength = tt.length
+			req.Header.Set("Content-Type", "application/octet-stream")
+			if tt.gzip {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+			w := env.serve(req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := env.storedSize(t, key); got != tt.wantSize {
+				t.Errorf("stored size = %d, want %d", got, tt.wantSize)
+			}
+		})
+	}
+}
+
+func gzipped(t *testing.T, data []byte) io.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return unsizedReader{&buf}
+}
+
+func TestPutWithoutContentLengthStreamsToStorage(t *testing.T) {
+	env := newTestEnv(t)
+
+	// A body of unknown length is uploaded in parts of streamingPartSize
+	data := bytes.Repeat([]byte("chunked upload "), (streamingPartSize+streamingPartSize/2)/15)
+	req := httptest.NewRequest(http.MethodPut, "/objects/"+testBucket+"/chunked.bin", unsizedReader{bytes.NewReader(data)})
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if w := env.serve(req); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+
+	var initiated, parts int
+	for _, request := range env.storageRequests() {
+		switch request {
+		case "POST /" + testBucket + "/chunked.bin":
+			initiated++
+		case "PUT /" + testBucket + "/chunked.bin":
+			parts++
+		}
+	}
+	if initiated == 0 || parts < 2 {
+		t.Errorf("storage requests %v, want a multipart upload", env.storageRequests())
+	}
+
+	obj, err := env.client.GetObject(context.Background(), testBucket, "chunked.bin", minio.GetObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+	stored, err := io.ReadAll(obj)
+	if err != nil || !bytes.Equal(stored, data) {
+		t.Errorf("stored object differs from the upload: %d bytes, %v", len(stored), err)
+	}
+}
+
+// patternReader generates size bytes without holding them, counting how many
+// have been read
+type patternReader struct {
+	size int64
+	read atomic.Int64
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	remaining := r.size - r.read.Load()
+	if remaining <= 0 {
+		return 0, io.EOF
+	}
+	n := int(min(int64(len(p)), remaining))
+	for i := range p[:n] {
+		p[i] = byte(i)
+	}
+	r.read.Add(int64(n))
+	return n, nil
+}
+
+func TestPutStreamsLargeBodies(t *testing.T) {
+	size := int64(3 * streamingPartSize)
+	setMaxUploadSize(t, size)
+	env := newTestEnv(t)
+
+	body := &patternReader{size: size}
+	readAtFirstPart := make(chan int64, 1)
+	env.onStorageRequest(func(r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Query().Has("partNumber") {
+			select {
+			case readAtFirstPart <- body.read.Load():
+			default:
+			}
+		}
+	})
+
+	req := httptest.NewRequest(http.MethodPut, "/objects/"+testBucket+"/large.bin", unsizedReader{body})
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if w := env.serve(req); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+
+	select {
+	case read := <-readAtFirstPart:
+		if read >= size {
+			t.Errorf("the whole body was read before the first part was uploaded")
+		}
+	default:
+		t.Fatal("the body was not uploaded in parts")
+	}
+	if got := env.storedSize(t, "large.bin"); got != size {
+		t.Errorf("stored size = %d, want %d", got, size)
+	}
+}
+
+func TestPutDetectsContentType(t *testing.T) {
+	env := newTestEnv(t)
+	previous := contentTypes
+	contentTypes = map[string]string{".log": "text/x-log"}
+	t.Cleanup(func() { contentTypes = previous })
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	tests := []struct {
+		name, key, contentType string
+		body                   []byte
+		want                   string
+	}{
+		{"css by extension", "style.css", "", []byte("body{}"), "text/css"},
+		{"json by extension", "data.json", "", []byte(`{"a":1}`), "application/json"},
+		{"uppercase extension", "STYLE.CSS", "", []byte("body{}"), "text/css"},
+		{"configured extension", "server.log", "", []byte("started"), "text/x-log"},
+		{"sniffed image", "image.unknownext", "", png, "image/png"},
+		{"sniffed text", "notes.unknownext", "", []byte("plain notes"), "text/plain"},
+		{"binary", "blob.unknownext", "", []byte{0x00, 0x01, 0x02, 0xfe}, "application/octet-stream"},
+		{"no extension", "README", "", []byte("read me"), "text/plain"},
+		{"client type wins", "style.css", "text/plain", []byte("body{}"), "text/plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tt.contentType != "" {
+				headers["Content-Type"] = tt.contentType
+			}
+			if w := env.do(http.MethodPut, "/objects/"+testBucket+"/"+tt.key, bytes.NewReader(tt.body), headers); w.Code != http.StatusOK {
+				t.Fatalf("PUT: status = %d, body %s", w.Code, w.Body)
+			}
+			info, err := env.client.StatObject(context.Background(), testBucket, tt.key, minio.StatObjectOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mediaType, _, _ := strings.Cut(info.ContentType, ";"); mediaType != tt.want {
+				t.Errorf("stored Content-Type = %q, want %s", info.ContentType, tt.want)
+			}
+		})
+	}
+}
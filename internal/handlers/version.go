@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/muandane/estrois/internal/cache"
+)
+
+// maxVersionIDLength bounds the versionId query parameter
+const maxVersionIDLength = 1024
+
+// requestVersionID returns the object version a request asks for with
+// ?versionId=, or "" for the current version
+func requestVersionID(req *Request) (string, error) {
+	versionID := req.QueryParams["versionId"]
+	if len(versionID) > maxVersionIDLength {
+		return "", &ValidationError{Field: "versionId", Message: fmt.Sprintf("must be at most %d characters", maxVersionIDLength)}
+	}
+	return versionID, nil
+}
+
+// objectCacheKey returns the cache key of an object, or of one version of it.
+// Versions are cached as variants of the object, so purging or overwriting
+// the object drops them too.
+func objectCacheKey(bucket, key, versionID string) string {
+	if versionID == "" {
+		return cache.GetCacheKey(bucket, key)
+	}
+	return cache.GetVariantKey(bucket, key, "version="+versionID)
+}
+
+// missingObject turns a storage error for a missing object or version into a
+// NotFoundError, and reports whether it did. Only missing current objects
+// are remembered in the negative cache; an old version may still exist after
+// the current one is deleted.
+func missingObject(err error, bucket, key, versionID string) (error, bool) {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NoSuchVersion":
+		if versionID != "" {
+			return &NotFoundError{Resource: "object version", ID: versionID}, true
+		}
+		return objectNotFound(bucket, key), true
+	}
+	return err, false
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/muandane/estrois/internal/cache"
+)
+
+func TestVersionsAreCachedSeparately(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	if err := env.client.EnableVersioning(ctx, testBucket); err != nil {
+		t.Fatal(err)
+	}
+	bodies := []string{"first version", "second version"}
+	versions := make([]string, len(bodies))
+	for i, body := range bodies {
+		info, err := env.client.PutObject(ctx, testBucket, "doc.txt", bytes.NewReader([]byte(body)), int64(len(body)), minio.PutObjectOptions{ContentType: "text/plain"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.VersionID == "" {
+			t.Fatal("storage did not return a version ID")
+		}
+		versions[i] = info.VersionID
+	}
+
+	for i, version := range versions {
+		path := "/objects/" + testBucket + "/doc.txt?versionId=" + url.QueryEscape(version)
+		w := env.do(http.MethodGet, path, nil, nil)
+		if w.Code != http.StatusOK || w.Body.String() != bodies[i] {
+			t.Fatalf("GET version %d: status = %d, body %q, want %q", i, w.Code, w.Body, bodies[i])
+		}
+		entry := waitVersionCached(t, env.store, "doc.txt", version)
+		if entry.Size != int64(len(bodies[i])) {
+			t.Errorf("cached version %d size = %d, want %d", i, entry.Size, len(bodies[i]))
+		}
+	}
+	if cache.GetCacheKey(testBucket, "doc.txt") == objectCacheKey(testBucket, "doc.txt", versions[0]) ||
+		objectCacheKey(testBucket, "doc.txt", versions[0]) == objectCacheKey(testBucket, "doc.txt", versions[1]) {
+		t.Fatal("versions share a cache key")
+	}
+
+	// Both versions are now served from the cache without mixing them up
+	env.resetRequests()
+	for i, version := range versions {
+		path := "/objects/" + testBucket + "/doc.txt?versionId=" + url.QueryEscape(version)
+		w := env.do(http.MethodGet, path, nil, nil)
+		if w.Body.String() != bodies[i] || w.Header().Get("X-Cache") != "HIT" {
+			t.Errorf("GET version %d: body %q, X-Cache %q, want %q from the cache", i, w.Body, w.Header().Get("X-Cache"), bodies[i])
+		}
+	}
+	if gets := env.objectGets("doc.txt"); gets != 0 {
+		t.Errorf("storage GETs = %d for cached versions, want 0", gets)
+	}
+
+	// Without a version the current object is served
+	if w := env.do(http.MethodGet, "/objects/"+testBucket+"/doc.txt", nil, nil); w.Body.String() != bodies[1] {
+		t.Errorf("GET without versionId = %q, want the current version %q", w.Body, bodies[1])
+	}
+}
+
+func TestUnknownVersionIsNotFound(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	if err := env.client.EnableVersioning(ctx, testBucket); err != nil {
+		t.Fatal(err)
+	}
+	env.putObject(t, "doc.txt", "text/plain", []byte("current"))
+	if w := env.do(http.MethodGet, "/objects/"+testBucket+"/doc.txt?versionId=missing", nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET unknown version: status = %d, want 404", w.Code)
+	}
+	// A missing version says nothing about the current object
+	if w := env.do(http.MethodGet, "/objects/"+testBucket+"/doc.txt", nil, nil); w.Code != http.StatusOK {
+		t.Errorf("GET current object: status = %d, want 200", w.Code)
+	}
+}
+
+// waitVersionCached waits for the entry a miss caches for one version of key
+func waitVersionCached(t *testing.T, store cache.Store, key, version string) *cache.CacheEntry {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if entry, status := store.Get(objectCacheKey(testBucket, key, version)); status != cache.StatusMiss && !entry.MetadataOnly {
+			return entry
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("version %s of %s was not cached", version, key)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
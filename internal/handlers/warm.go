@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/muandane/estrois/internal/cache"
+	"github.com/muandane/estrois/internal/middleware"
+	"github.com/muandane/estrois/internal/storage"
+)
+
+const (
+	// maxWarmObjects bounds the objects warmed by a single request
+	maxWarmObjects = 1000
+	// warmWorkers is how many objects are fetched from storage at once
+	warmWorkers = 8
+)
+
+// Outcomes of warming a single object
+const (
+	warmStatusWarmed  = "warmed"
+	warmStatusCached  = "cached"
+	warmStatusSkipped = "skipped"
+	warmStatusFailed  = "failed"
+)
+
+type WarmObject struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+}
+
+// WarmRequest lists the objects to load into the cache
+type WarmRequest []WarmObject
+
+type WarmResult struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type WarmResponse struct {
+	Results []WarmResult `json:"results"`
+}
+
+// WarmHandler returns the handler for POST /cache/warm. Only buckets in
+// bucketAccess, narrowed to the API key's scope, can be warmed.
+func (h *ObjectHandler) WarmHandler(bucketAccess map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := h.logger.With(
+			"request_id", middleware.RequestIDFromContext(r.Context()),
+			"method", r.Method,
+			"remote_addr", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		)
+		handleWarm := func(ctx context.Context, req *Request, input WarmRequest) (*WarmResponse, error) {
+			return h.warm(ctx, input, bucketAccess, middleware.APIKeyScopeFromContext(ctx))
+		}
+		Handle(handleWarm, HandlerOptions{Logger: logger, DecodeBody: true})(w, r)
+	}
+}
+
+// warm fetches each object from storage and caches it, reporting the outcome
+// per object. Objects are fetched by a bounded pool of workers.
+func (h *ObjectHandler) warm(ctx context.Context, objects WarmRequest, bucketAccess map[string]string, scope []string) (*WarmResponse, error) {
+	if len(objects) == 0 {
+		return nil, &ValidationError{Field: "body", Message: "expected a JSON list of {bucket, key} objects"}
+	}
+	if len(objects) > maxWarmObjects {
+		return nil, &ValidationError{Field: "body", Message: fmt.Sprintf("at most %d objects can be warmed at once", maxWarmObjects)}
+	}
+
+	room := h.cacheRoom()
+	results := make([]WarmResult, len(objects))
+	var group errgroup.Group
+	group.SetLimit(warmWorkers)
+	for i, object := range objects {
+		results[i] = WarmResult{Bucket: object.Bucket, Key: object.Key}
+		if _, ok := bucketAccess[object.Bucket]; !ok || (len(scope) > 0 && !slices.Contains(scope, object.Bucket)) {
+			results[i].Status, results[i].Error = warmStatusFailed, "bucket access denied"
+			continue
+		}
+		group.Go(func() error {
+			status, err := h.warmObject(ctx, object.Bucket, tenantKey(ctx, object.Key), room)
+			results[i].Status = status
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+			return nil
+		})
+	}
+	group.Wait()
+
+	warmed := 0
+	for _, result := range results {
+		if result.Status == warmStatusWarmed {
+			warmed++
+		}
+	}
+	LoggerFrom(ctx).Info("cache warmed",
+		"requested", len(objects),
+		"warmed", warmed,
+	)
+
+	return &WarmResponse{Results: results}, nil
+}
+
+// cacheRoom returns the bytes the cache can still take without evicting.
+// Warming never evicts, so objects are only warmed while they fit in the room
+// the cache had left when warming started; the store's size is read once, as
+// computing it may visit every entry.
+func (h *ObjectHandler) cacheRoom() *atomic.Int64 {
+	stats := h.store.Stats()
+	room := new(atomic.Int64)
+	room.Store(stats.MaxSize - stats.CurrentSize)
+	return room
+}
+
+// warmObject caches bucket/key unless it is already cached. Objects that
+// would not be cached on a GET are skipped, as are objects that do not fit in
+// room, the bytes left for warming, which they take up when cached.
+func (h *ObjectHandler) warmObject(ctx context.Context, bucket, key string, room *atomic.Int64) (string, error) {
+	if err := storage.ValidateName(bucket, key); err != nil {
+		return warmStatusFailed, err
+	}
+
+	cacheKey := cache.GetCacheKey(bucket, key)
+	if entry, status := h.store.Get(cacheKey); status == cache.StatusHit && !entry.MetadataOnly && !entry.Stale {
+		return warmStatusCached, nil
+	}
+
+	obj, info, err := h.getObject(ctx, bucket, key, "", nil)
+	if err != nil {
+		return warmStatusFailed, err
+	}
+	defer obj.Close()
+
+	ttl, cacheable := cache.CacheTTL(bucket, info.Metadata.Get("Cache-Control"))
+	switch {
+	case !cacheable:
+		return warmStatusSkipped, fmt.Errorf("object is not cacheable")
+	case info.Size > min(cache.StreamThreshold, cache.MaxCacheableSize(bucket)):
+		return warmStatusSkipped, fmt.Errorf("object is too large to cache")
+	}
+	if room.Add(-info.Size) < 0 {
+		room.Add(info.Size)
+		return warmStatusSkipped, fmt.Errorf("cache is full")
+	}
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		room.Add(info.Size)
+		return warmStatusFailed, fmt.Errorf("failed to read object data: %w", err)
+	}
+
+	h.store.Set(cacheKey, cache.NewCacheEntry(data, info.ContentType, info.LastModified, info.ETag, info.UserMetadata, ttl))
+	cache.DeleteNegative(cacheKey)
+	return warmStatusWarmed, nil
+}
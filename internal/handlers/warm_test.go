@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/muandane/estrois/internal/cache"
+)
+
+func (env *testEnv) warm(t *testing.T, objects WarmRequest) *WarmResponse {
+	t.Helper()
+	body, err := json.Marshal(objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/cache/warm", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.handler.WarmHandler(map[string]string{testBucket: "public"}).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("warm: status = %d, body %s", w.Code, w.Body)
+	}
+	var resp WarmResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return &resp
+}
+
+func TestWarmCachesObjects(t *testing.T) {
+	env := newTestEnv(t)
+	keys := []string{"a.txt", "b.txt", "c.txt"}
+	var objects WarmRequest
+	for _, key := range keys {
+		env.putObject(t, key, "text/plain", []byte("contents of "+key))
+		objects = append(objects, WarmObject{Bucket: testBucket, Key: key})
+	}
+
+	resp := env.warm(t, objects)
+	for i, result := range resp.Results {
+		if result.Key != keys[i] || result.Status != warmStatusWarmed {
+			t.Errorf("result %d = %+v, want %s warmed", i, result, keys[i])
+		}
+	}
+
+	env.resetRequests()
+	for _, key := range keys {
+		w := env.do(http.MethodGet, "/objects/"+testBucket+"/"+key, nil, nil)
+		if got := w.Header().Get("X-Cache"); got != "HIT" {
+			t.Errorf("GET %s: X-Cache = %q, want HIT", key, got)
+		}
+		if w.Body.String() != "contents of "+key {
+			t.Errorf("GET %s: body = %q", key, w.Body)
+		}
+	}
+	if requests := env.storageRequests(); len(requests) != 0 {
+		t.Errorf("warmed objects were fetched again: %v", requests)
+	}
+
+	resp = env.warm(t, objects[:1])
+	if resp.Results[0].Status != warmStatusCached {
+		t.Errorf("warming a cached object: status = %q, want %q", resp.Results[0].Status, warmStatusCached)
+	}
+}
+
+func TestWarmDoesNotEvict(t *testing.T) {
+	env := newTestEnv(t)
+	store := cache.NewMemoryStore(250)
+	env.useStore(store)
+	hot := cache.GetCacheKey(testBucket, "hot.txt")
+	store.Set(hot, cache.NewCacheEntry(bytes.Repeat([]byte("h"), 100), "text/plain", time.Now(), `"hot"`, nil, time.Minute))
+
+	var objects WarmRequest
+	for _, key := range []string{"one.txt", "two.txt", "three.txt"} {
+		env.putObject(t, key, "text/plain", bytes.Repeat([]byte("w"), 60))
+		objects = append(objects, WarmObject{Bucket: testBucket, Key: key})
+	}
+
+	resp := env.warm(t, objects)
+	var warmed, full int
+	for _, result := range resp.Results {
+		switch {
+		case result.Status == warmStatusWarmed:
+			warmed++
+		case result.Status == warmStatusSkipped && strings.Contains(result.Error, "full"):
+			full++
+		default:
+			t.Errorf("unexpected result %+v", result)
+		}
+	}
+	if warmed != 2 || full != 1 {
+		t.Errorf("%d warmed and %d skipped as full, want 2 and 1", warmed, full)
+	}
+	if _, status := store.Get(hot); status != cache.StatusHit {
+		t.Error("warming evicted a cached entry")
+	}
+	if stats := store.Stats(); stats.CurrentSize > stats.MaxSize {
+		t.Errorf("cache holds %d bytes, more than its %d", stats.CurrentSize, stats.MaxSize)
+	}
+}
+
+func TestWarmRejectsUnknownBuckets(t *testing.T) {
+	env := newTestEnv(t)
+	resp := env.warm(t, WarmRequest{{Bucket: "private", Key: "a.txt"}})
+	if resp.Results[0].Status != warmStatusFailed {
+		t.Errorf("status = %q, want %q", resp.Results[0].Status, warmStatusFailed)
+	}
+}
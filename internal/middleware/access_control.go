@@ -1,16 +1,24 @@
 package middleware
 
 import (
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"slices"
 	"strings"
 )
 
 type BucketPolicy struct {
-	AllowedOperations map[string][]string // bucket -> operations
-	AllowedIPs        map[string][]string // bucket -> IP ranges
+	AllowedOperations map[string][]string     // bucket -> operations
+	AllowedIPs        map[string][]*net.IPNet // bucket -> CIDR ranges
+	TrustedProxies    []*net.IPNet            // proxies allowed to set X-Forwarded-For
+	ExcludedPaths     []string                // paths reaching no bucket, such as /health
 }
 
+// WithBucketAccessControl only lets a request reach a bucket with an
+// operation the bucket allows, from a client IP in one of the bucket's
+// ranges. Requests naming no bucket and excluded paths are let through.
 func WithBucketAccessControl(policy BucketPolicy, logger *slog.Logger, enabled bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		if !enabled {
@@ -19,19 +27,18 @@ func WithBucketAccessControl(policy BucketPolicy, logger *slog.Logger, enabled b
 		}
 		logger.Info("Bucket access control middleware enabled")
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			pathSegments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-			if len(pathSegments) < 2 {
-				http.Error(w, "Invalid path", http.StatusBadRequest)
+			bucketName, method := bucketAndMethod(r)
+			if bucketName == "" || slices.Contains(policy.ExcludedPaths, r.URL.Path) {
+				next.ServeHTTP(w, r)
 				return
 			}
-			bucketName := pathSegments[0]
 
-			if !isOperationAllowed(policy, bucketName, r.Method) {
+			if !isOperationAllowed(policy, bucketName, method) {
 				http.Error(w, "Operation not allowed", http.StatusForbidden)
 				return
 			}
 
-			if !isIPAllowed(policy, bucketName, r.RemoteAddr) {
+			if !isIPAllowed(policy, bucketName, ClientIP(r, policy.TrustedProxies)) {
 				http.Error(w, "Access denied", http.StatusForbidden)
 				return
 			}
@@ -41,6 +48,20 @@ func WithBucketAccessControl(policy BucketPolicy, logger *slog.Logger, enabled b
 	}
 }
 
+// BucketOperations lists the methods each bucket's ALLOWED_BUCKETS access
+// permits, as the AllowedOperations of a BucketPolicy
+func BucketOperations(access map[string]string) map[string][]string {
+	operations := make(map[string][]string, len(access))
+	for bucket, policy := range access {
+		for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions} {
+			if isMethodAllowed(policy, method) {
+				operations[bucket] = append(operations[bucket], method)
+			}
+		}
+	}
+	return operations
+}
+
 func isOperationAllowed(policy BucketPolicy, bucketName, method string) bool {
 	if operations, exists := policy.AllowedOperations[bucketName]; exists {
 		for _, operation := range operations {
@@ -53,13 +74,55 @@ func isOperationAllowed(policy BucketPolicy, bucketName, method string) bool {
 }
 
 func isIPAllowed(policy BucketPolicy, bucketName, remoteAddr string) bool {
-	if allowedIPs, exists := policy.AllowedIPs[bucketName]; exists {
-		clientIP := strings.Split(remoteAddr, ":")[0]
-		for _, ipPrefix := range allowedIPs {
-			if strings.HasPrefix(clientIP, ipPrefix) {
-				return true
-			}
+	allowedIPs, exists := policy.AllowedIPs[bucketName]
+	if !exists {
+		return false
+	}
+
+	clientIP := parseIP(remoteAddr)
+	if clientIP == nil {
+		return false
+	}
+	for _, ipNet := range allowedIPs {
+		if ipNet.Contains(clientIP) {
+			return true
 		}
 	}
 	return false
 }
+
+// parseIP extracts the IP from an address that may or may not carry a port
+func parseIP(addr string) net.IP {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return net.ParseIP(strings.Trim(host, "[]"))
+}
+
+// ParseCIDRs parses CIDR ranges for a BucketPolicy. Bare IP addresses are
+// treated as single-host ranges.
+func ParseCIDRs(ranges []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, r := range ranges {
+		r = strings.TrimSpace(r)
+		if !strings.Contains(r, "/") {
+			ip := net.ParseIP(r)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", r)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR range %q: %w", r, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func mustParseCIDRs(t *testing.T, ranges ...string) []*net.IPNet {
+	t.Helper()
+	nets, err := ParseCIDRs(ranges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nets
+}
+
+func TestParseCIDRs(t *testing.T) {
+	nets := mustParseCIDRs(t, "10.1.0.0/16", " 192.168.1.7 ", "2001:db8::/32", "::1")
+	want := []string{"10.1.0.0/16", "192.168.1.7/32", "2001:db8::/32", "::1/128"}
+	for i, ipNet := range nets {
+		if ipNet.String() != want[i] {
+			t.Errorf("range %d = %s, want %s", i, ipNet, want[i])
+		}
+	}
+	for _, invalid := range []string{"10.1", "10.0.0.0/33", "example.com"} {
+		if _, err := ParseCIDRs([]string{invalid}); err == nil {
+			t.Errorf("ParseCIDRs(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestIsIPAllowed(t *testing.T) {
+	policy := BucketPolicy{AllowedIPs: map[string][]*net.IPNet{
+		"photos": mustParseCIDRs(t, "10.1.0.0/16", "2001:db8::/32"),
+	}}
+	tests := []struct {
+		bucket     string
+		remoteAddr string
+		want       bool
+	}{
+		{"photos", "10.1.2.3", true},
+		{"photos", "10.1.2.3:54321", true},
+		// A textual prefix of an allowed range is not in it
+		{"photos", "10.10.0.5:54321", false},
+		{"photos", "10.2.0.1", false},
+		{"photos", "[2001:db8::1]:443", true},
+		{"photos", "2001:db8:ffff::1", true},
+		{"photos", "[2001:db9::1]:443", false},
+		{"photos", "not an address", false},
+		{"other", "10.1.2.3", false},
+	}
+	for _, tt := range tests {
+		if got := isIPAllowed(policy, tt.bucket, tt.remoteAddr); got != tt.want {
+			t.Errorf("isIPAllowed(%s, %s) = %v, want %v", tt.bucket, tt.remoteAddr, got, tt.want)
+		}
+	}
+}
+
+func TestWithBucketAccessControl(t *testing.T) {
+	policy := BucketPolicy{
+		AllowedOperations: map[string][]string{"photos": {http.MethodGet}},
+		AllowedIPs:        map[string][]*net.IPNet{"photos": mustParseCIDRs(t, "10.1.0.0/16", "2001:db8::/32")},
+		ExcludedPaths:     []string{"/metrics"},
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := WithBucketAccessControl(policy, logger, true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		method     string
+		path       string
+		remoteAddr string
+		want       int
+	}{
+		{http.MethodGet, "/objects/photos/a.jpg", "10.1.2.3:1234", http.StatusOK},
+		{http.MethodGet, "/objects/photos/a.jpg", "[2001:db8::5]:1234", http.StatusOK},
+		{http.MethodGet, "/objects/photos/a.jpg", "10.10.0.5:1234", http.StatusForbidden},
+		{http.MethodPut, "/objects/photos/a.jpg", "10.1.2.3:1234", http.StatusForbidden},
+		{http.MethodGet, "/objects/videos/a.mp4", "10.1.2.3:1234", http.StatusForbidden},
+		// Requests reaching no bucket are left to other checks
+		{http.MethodGet, "/", "10.10.0.5:1234", http.StatusOK},
+		{http.MethodGet, "/metrics", "10.10.0.5:1234", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.RemoteAddr = tt.remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s from %s: status = %d, want %d", tt.method, tt.path, tt.remoteAddr, w.Code, tt.want)
+		}
+	}
+}
+
+func TestBucketOperations(t *testing.T) {
+	operations := BucketOperations(map[string]string{"public": "read", "private": "all"})
+	want := map[string][]string{
+		"public":  {http.MethodGet, http.MethodHead, http.MethodOptions},
+		"private": {http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions},
+	}
+	if !reflect.DeepEqual(operations, want) {
+		t.Errorf("BucketOperations() = %v, want %v", operations, want)
+	}
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// APIKeyHeader is the alternative to an "Authorization: Bearer" header
+const APIKeyHeader = "X-API-Key"
+
+type apiKeyScopeKey struct{}
+
+// APIKeyScopeFromContext returns the buckets the request's API key is scoped
+// to, or nil when access is not restricted to particular buckets
+func APIKeyScopeFromContext(ctx context.Context) []string {
+	buckets, _ := ctx.Value(apiKeyScopeKey{}).([]string)
+	return buckets
+}
+
+type APIKeyConfig struct {
+	// Keys maps each API key to the buckets it may access; a key with no
+	// buckets may access all of them
+	Keys          map[string][]string
+	ExcludedPaths []string
+}
+
+// WithAPIKeyAuth rejects requests without a valid API key with 401, and
+// requests for a bucket outside the key's scope with 403. With no keys
+// configured authentication is disabled.
+func WithAPIKeyAuth(config APIKeyConfig, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(config.Keys) == 0 {
+			logger.Info("API key authentication is disabled")
+			return next
+		}
+		logger.Info("API key authentication enabled", "keys", len(config.Keys))
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, path := range config.ExcludedPaths {
+				if r.URL.Path == path {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			buckets, ok := lookupAPIKey(config.Keys, requestAPIKey(r))
+			if !ok {
+				logger.Warn("missing or invalid API key", "path", r.URL.Path)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			// A scoped key must cover both the addressed bucket and any copy source
+			if len(buckets) > 0 {
+				for _, bucket := range []string{authBucket(r), copySourceBucket(r)} {
+					if bucket != "" && !slices.Contains(buckets, bucket) {
+						logger.Warn("API key not allowed for bucket", "bucket", bucket)
+						http.Error(w, "access denied", http.StatusForbidden)
+						return
+					}
+				}
+				r = r.WithContext(context.WithValue(r.Context(), apiKeyScopeKey{}, buckets))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestAPIKey reads the key from "Authorization: Bearer <key>" or X-API-Key
+func requestAPIKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		scheme, token, ok := strings.Cut(auth, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return r.Header.Get(APIKeyHeader)
+}
+
+// lookupAPIKey compares against every key in constant time so response
+// timing does not reveal how much of a key matched
+func lookupAPIKey(keys map[string][]string, key string) ([]string, bool) {
+	if key == "" {
+		return nil, false
+	}
+	var buckets []string
+	found := false
+	for candidate, scope := range keys {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			buckets, found = scope, true
+		}
+	}
+	return buckets, found
+}
+
+// authBucket returns the bucket a request addresses, including cache purges
+func authBucket(r *http.Request) string {
+	if rest, ok := strings.CutPrefix(r.URL.Path, "/cache/purge/"); ok {
+		bucket, _, _ := strings.Cut(rest, "/")
+		return bucket
+	}
+	bucket, _ := bucketAndMethod(r)
+	return bucket
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestWithAPIKeyAuth(t *testing.T) {
+	config := APIKeyConfig{
+		Keys:          map[string][]string{"admin-key": nil, "photos-key": {"photos"}},
+		ExcludedPaths: []string{"/health"},
+	}
+	var scope []string
+	handler := WithAPIKeyAuth(config, slog.New(slog.DiscardHandler))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope = APIKeyScopeFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name       string
+		path       string
+		headers    map[string]string
+		wantStatus int
+		wantScope  []string
+	}{
+		{"bearer key", "/objects/reports/a.txt", map[string]string{"Authorization": "Bearer admin-key"}, http.StatusOK, nil},
+		{"lowercase bearer scheme", "/objects/reports/a.txt", map[string]string{"Authorization": "bearer admin-key"}, http.StatusOK, nil},
+		{"api key header", "/objects/reports/a.txt", map[string]string{APIKeyHeader: "admin-key"}, http.StatusOK, nil},
+		{"missing key", "/objects/reports/a.txt", nil, http.StatusUnauthorized, nil},
+		{"wrong key", "/objects/reports/a.txt", map[string]string{"Authorization": "Bearer admin-kex"}, http.StatusUnauthorized, nil},
+		{"basic auth is not a key", "/objects/reports/a.txt", map[string]string{"Authorization": "Basic admin-key"}, http.StatusUnauthorized, nil},
+		{"scoped key in scope", "/objects/photos/cat.jpg", map[string]string{APIKeyHeader: "photos-key"}, http.StatusOK, []string{"photos"}},
+		{"scoped key out of scope", "/objects/reports/a.txt", map[string]string{APIKeyHeader: "photos-key"}, http.StatusForbidden, nil},
+		{"scoped key purging another bucket", "/cache/purge/reports/a.txt", map[string]string{APIKeyHeader: "photos-key"}, http.StatusForbidden, nil},
+		{"scoped key copying from another bucket", "/objects/photos/copy.txt", map[string]string{APIKeyHeader: "photos-key", "X-Copy-Source": "/reports/a.txt"}, http.StatusForbidden, nil},
+		{"excluded path", "/health", nil, http.StatusOK, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope = nil
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want Bearer", w.Header().Get("WWW-Authenticate"))
+			}
+			if !slices.Equal(scope, tt.wantScope) {
+				t.Errorf("scope = %q, want %q", scope, tt.wantScope)
+			}
+		})
+	}
+}
+
+func TestWithAPIKeyAuthDisabled(t *testing.T) {
+	handler := WithAPIKeyAuth(APIKeyConfig{}, slog.New(slog.DiscardHandler))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/objects/reports/a.txt", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d without keys configured, want 200", w.Code)
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the IP of the client that made the request. When the
+// direct peer is a trusted proxy, X-Forwarded-For is walked from the right and
+// the first address that is not itself a trusted proxy is returned. Headers
+// sent by untrusted peers are ignored so they cannot be spoofed.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	remoteIP := parseIP(r.RemoteAddr)
+	if remoteIP == nil {
+		return r.RemoteAddr
+	}
+	if !isTrusted(remoteIP, trustedProxies) {
+		return remoteIP.String()
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	clientIP := remoteIP
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		clientIP = ip
+		if !isTrusted(ip, trustedProxies) {
+			break
+		}
+	}
+	return clientIP.String()
+}
+
+func isTrusted(ip net.IP, trustedProxies []*net.IPNet) bool {
+	for _, ipNet := range trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := mustParseCIDRs(t, "10.0.0.0/8", "fd00::/8")
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		wantClientIP string
+	}{
+		{"direct connection", "203.0.113.9:5000", nil, "203.0.113.9"},
+		{"direct connection ignores XFF", "203.0.113.9:5000", []string{"198.51.100.1"}, "203.0.113.9"},
+		{"trusted proxy", "10.0.0.2:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"trusted proxy chain", "10.0.0.2:5000", []string{"198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"spoofed entry before the real client", "10.0.0.2:5000", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"several headers", "10.0.0.2:5000", []string{"1.2.3.4", "198.51.100.1"}, "198.51.100.1"},
+		{"trusted proxy without XFF", "10.0.0.2:5000", nil, "10.0.0.2"},
+		{"invalid hop", "10.0.0.2:5000", []string{"198.51.100.1, garbage"}, "10.0.0.2"},
+		{"IPv6 proxy", "[fd00::1]:5000", []string{"2001:db8::7"}, "2001:db8::7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, header := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", header)
+			}
+			if got := ClientIP(req, trusted); got != tt.wantClientIP {
+				t.Errorf("ClientIP = %s, want %s", got, tt.wantClientIP)
+			}
+		})
+	}
+}
+
+func TestAccessControlBehindTrustedProxy(t *testing.T) {
+	policy := BucketPolicy{
+		AllowedOperations: map[string][]string{"photos": {http.MethodGet}},
+		AllowedIPs:        map[string][]*net.IPNet{"photos": mustParseCIDRs(t, "198.51.100.0/24")},
+		TrustedProxies:    mustParseCIDRs(t, "10.0.0.0/8"),
+	}
+	handler := WithBucketAccessControl(policy, slog.New(slog.DiscardHandler), true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, tt := range []struct {
+		remoteAddr string
+		want       int
+	}{
+		{"10.0.0.2:5000", http.StatusOK},
+		// The same header from an untrusted peer is ignored
+		{"203.0.113.9:5000", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/objects/photos/a.jpg", nil)
+		req.RemoteAddr = tt.remoteAddr
+		req.Header.Set("X-Forwarded-For", "198.51.100.1")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("from %s: status = %d, want %d", tt.remoteAddr, w.Code, tt.want)
+		}
+	}
+}
+
+func TestLoggingRecordsClientIP(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+	handler := WithLogging(logger, mustParseCIDRs(t, "10.0.0.0/8"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/objects/photos/a.jpg", nil)
+	req.RemoteAddr = "10.0.0.2:5000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var record map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("log line %q: %v", logs.String(), err)
+	}
+	if record["client_ip"] != "198.51.100.1" || record["remote_addr"] != "10.0.0.2:5000" {
+		t.Errorf("client_ip = %v, remote_addr = %v", record["client_ip"], record["remote_addr"])
+	}
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type CompressionConfig struct {
+	Enabled bool
+	// MinSize is the smallest response body in bytes that gets compressed
+	MinSize int
+}
+
+// WithResponseCompression gzips responses for clients that accept gzip once
+// the body reaches MinSize bytes. Responses that already carry a
+// Content-Encoding are left alone. Vary: Accept-Encoding is always set since
+// the response depends on it.
+func WithResponseCompression(config CompressionConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !config.Enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Not deferred, so a panicking handler leaves nothing written for
+			// the recovery middleware to collide with
+			cw := &compressResponseWriter{ResponseWriter: w, minSize: config.MinSize, status: http.StatusOK}
+			next.ServeHTTP(cw, r)
+			cw.close()
+		})
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip, either
+// by name or through "*", with a non-zero q-value
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "x-gzip" && coding != "*" {
+			continue
+		}
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil || q <= 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressResponseWriter buffers the start of a response until it knows
+// whether the body reaches minSize, then either gzips it or writes it as is
+type compressResponseWriter struct {
+	http.ResponseWriter
+	minSize     int
+	status      int
+	wroteHeader bool
+	// passthrough is set once the response is written uncompressed
+	passthrough bool
+	buf         []byte
+	gz          *gzip.Writer
+}
+
+func (cw *compressResponseWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+	if cw.Header().Get("Content-Encoding") != "" || !bodyAllowed(status) {
+		cw.passthrough = true
+		cw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (cw *compressResponseWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case cw.passthrough:
+		return cw.ResponseWriter.Write(b)
+	case cw.gz != nil:
+		return cw.gz.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) < cw.minSize {
+		return len(b), nil
+	}
+
+	headers := cw.Header()
+	headers.Set("Content-Encoding", "gzip")
+	headers.Del("Content-Length")
+	cw.ResponseWriter.WriteHeader(cw.status)
+	cw.gz = gzip.NewWriter(cw.ResponseWriter)
+	if _, err := cw.gz.Write(cw.buf); err != nil {
+		return 0, err
+	}
+	cw.buf = nil
+	return len(b), nil
+}
+
+// close finishes the gzip stream, or writes a body that stayed below
+// minSize uncompressed
+func (cw *compressResponseWriter) close() {
+	switch {
+	case cw.passthrough:
+	case cw.gz != nil:
+		cw.gz.Close()
+	default:
+		cw.ResponseWriter.WriteHeader(cw.status)
+		if len(cw.buf) > 0 {
+			cw.ResponseWriter.Write(cw.buf)
+		}
+	}
+}
+
+// bodyAllowed reports whether a response with status may carry a body
+func bodyAllowed(status int) bool {
+	return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithResponseCompression(t *testing.T) {
+	large := strings.Repeat(`{"metric":1}`, 200)
+	handler := WithResponseCompression(CompressionConfig{Enabled: true, MinSize: 1024})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			w.Header().Set("Content-Length", "2400")
+			io.WriteString(w, large[:1000])
+			io.WriteString(w, large[1000:])
+		case "/small":
+			io.WriteString(w, `{"ok":true}`)
+		case "/encoded":
+			w.Header().Set("Content-Encoding", "br")
+			io.WriteString(w, large)
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		{"large body", http.MethodGet, "/large", "gzip, deflate", "gzip"},
+		{"wildcard", http.MethodGet, "/large", "*", "gzip"},
+		{"gzip refused", http.MethodGet, "/large", "gzip;q=0, br", ""},
+		{"no accept encoding", http.MethodGet, "/large", "", ""},
+		{"below threshold", http.MethodGet, "/small", "gzip", ""},
+		{"already encoded", http.MethodGet, "/encoded", "gzip", "br"},
+		{"no content", http.MethodGet, "/empty", "gzip", ""},
+		{"head", http.MethodHead, "/large", "gzip", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if tt.wantEncoding != "gzip" {
+				return
+			}
+			if got := w.Header().Get("Content-Length"); got != "" {
+				t.Errorf("Content-Length = %s on a gzipped body", got)
+			}
+			gz, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(gz)
+			if err != nil || string(body) != large {
+				t.Errorf("decompressed body of %d bytes (%v), want the original %d", len(body), err, len(large))
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/small", nil))
+	if w.Body.String() != `{"ok":true}` {
+		t.Errorf("small body = %q, want it unchanged", w.Body)
+	}
+}
+
+func TestWithResponseCompressionDisabled(t *testing.T) {
+	handler := WithResponseCompression(CompressionConfig{Enabled: false, MinSize: 0})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("a", 4096))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "" || w.Header().Get("Vary") != "" || w.Body.Len() != 4096 {
+		t.Errorf("disabled compression changed the response: headers %v, %d bytes", w.Header(), w.Body.Len())
+	}
+}
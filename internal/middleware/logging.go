@@ -1,11 +1,30 @@
 package middleware
 
 import (
+	"context"
 	"log/slog"
+	"net"
 	"net/http"
 	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// RequestIDHeader carries the request ID in requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds incoming request IDs that are reused
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the request ID stored by WithLogging, if any
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
 type loggingResponseWriter struct {
 	http.ResponseWriter
 	statusCode int
@@ -27,23 +46,63 @@ func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
-func WithLogging(logger *slog.Logger) func(http.Handler) http.Handler {
+func WithLogging(logger *slog.Logger, trustedProxies []*net.IPNet) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
+
+			// Reuse the caller's request ID when it looks sane, otherwise generate one
+			requestID := r.Header.Get(RequestIDHeader)
+			if !isValidRequestID(requestID) {
+				requestID = uuid.NewString()
+			}
+			w.Header().Set(RequestIDHeader, requestID)
+			r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, requestID))
+
+			// Capture the path up front, as later middleware may replace the request
+			path := r.URL.Path
 			lrw := newLoggingResponseWriter(w)
 
 			next.ServeHTTP(lrw, r)
 
+			// Handlers report the cache outcome and representation in the
+			// response headers, so read them back for the access log
+			headers := lrw.Header()
 			logger.Info("http request completed",
+				"request_id", requestID,
 				"method", r.Method,
-				"path", r.URL.Path,
+				"path", path,
 				"status", lrw.statusCode,
 				"duration", time.Since(start).String(),
 				"size", lrw.length,
+				"cache_status", headers.Get("X-Cache"),
+				"content_type", headers.Get("Content-Type"),
+				"content_encoding", headers.Get("Content-Encoding"),
 				"remote_addr", r.RemoteAddr,
+				"client_ip", ClientIP(r, trustedProxies),
 				"user_agent", r.UserAgent(),
+				"trace_id", traceID(r.Context()),
 			)
 		})
 	}
 }
+
+// traceID returns the ID of the request's trace, or "" when it is not traced
+func traceID(ctx context.Context) string {
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return ""
+}
+
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// serveLogged serves req through WithLogging and returns the response, the
+// request ID the handler saw and the access log record
+func serveLogged(t *testing.T, req *http.Request) (*httptest.ResponseRecorder, string, map[string]any) {
+	t.Helper()
+	var logs bytes.Buffer
+	var seen string
+	handler := WithLogging(slog.New(slog.NewJSONHandler(&logs, nil)), nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var record map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("log line %q: %v", logs.String(), err)
+	}
+	return w, seen, record
+}
+
+func TestRequestIDRoundTrips(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/objects/photos/a.jpg", nil)
+	req.Header.Set(RequestIDHeader, "upstream-id-42")
+	w, seen, record := serveLogged(t, req)
+
+	if got := w.Header().Get(RequestIDHeader); got != "upstream-id-42" {
+		t.Errorf("response %s = %q, want the incoming ID", RequestIDHeader, got)
+	}
+	if seen != "upstream-id-42" || record["request_id"] != "upstream-id-42" {
+		t.Errorf("handler saw %q and the log %v, want the incoming ID", seen, record["request_id"])
+	}
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	for _, incoming := range []string{"", "has spaces", strings.Repeat("x", maxRequestIDLength+1)} {
+		req := httptest.NewRequest(http.MethodGet, "/objects/photos/a.jpg", nil)
+		if incoming != "" {
+			req.Header.Set(RequestIDHeader, incoming)
+		}
+		w, seen, record := serveLogged(t, req)
+
+		id := w.Header().Get(RequestIDHeader)
+		if _, err := uuid.Parse(id); err != nil {
+			t.Errorf("incoming %q: generated ID %q is not a UUID", incoming, id)
+		}
+		if seen != id || record["request_id"] != id {
+			t.Errorf("incoming %q: handler saw %q and the log %v, want %q", incoming, seen, record["request_id"], id)
+		}
+	}
+}
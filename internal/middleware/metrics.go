@@ -1,42 +1,79 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/metrics"
 )
 
 type MetricsMiddleware struct {
-	requestCounter     *metrics.Counter
+	requestCounters    map[string]*metrics.Counter
 	responseTimeHist   *metrics.Histogram
 	requestSizeHist    *metrics.Histogram
 	responseSizeHist   *metrics.Histogram
 	statusCodeCounters map[int]*metrics.Counter
-	cacheHitCounter    *metrics.Counter
-	cacheMissCounter   *metrics.Counter
-	bucketOpsCounter   *metrics.Counter
+	cacheHitCounters   map[string]*metrics.Counter
+	cacheMissCounters  map[string]*metrics.Counter
+	bucketOpsCounters  map[string]*metrics.Counter
+	cacheEvictions     *metrics.Counter
+	cacheExpirations   *metrics.Counter
+	cacheSize          *metrics.Gauge
+	cacheEntries       *metrics.Gauge
+	peakSize           atomic.Int64
 }
 
-func NewMetricsMiddleware() *MetricsMiddleware {
+const (
+	// otherBucket labels requests for buckets that are not configured,
+	// keeping the number of series bounded
+	otherBucket = "other"
+	// otherMethod labels requests with methods we do not serve
+	otherMethod = "other"
+)
+
+// NewMetricsMiddleware creates the request metrics. Per-bucket series are only
+// created for the given buckets; everything else is counted as "other".
+func NewMetricsMiddleware(buckets []string) *MetricsMiddleware {
 	m := &MetricsMiddleware{
-		requestCounter:     metrics.NewCounter("http_requests_total"),
-		responseTimeHist:   metrics.NewHistogram("http_response_time_seconds"),
-		requestSizeHist:    metrics.NewHistogram("http_request_size_bytes"),
-		responseSizeHist:   metrics.NewHistogram("http_response_size_bytes"),
+		requestCounters:    make(map[string]*metrics.Counter),
+		responseTimeHist:   metrics.GetOrCreateHistogram("http_response_time_seconds"),
+		requestSizeHist:    metrics.GetOrCreateHistogram("http_request_size_bytes"),
+		responseSizeHist:   metrics.GetOrCreateHistogram("http_response_size_bytes"),
 		statusCodeCounters: make(map[int]*metrics.Counter),
-		cacheHitCounter:    metrics.NewCounter("cache_hits_total"),
-		cacheMissCounter:   metrics.NewCounter("cache_misses_total"),
-		bucketOpsCounter:   metrics.NewCounter("bucket_operations_total"),
+		cacheHitCounters:   make(map[string]*metrics.Counter),
+		cacheMissCounters:  make(map[string]*metrics.Counter),
+		bucketOpsCounters:  make(map[string]*metrics.Counter),
+		cacheEvictions:     metrics.GetOrCreateCounter("cache_evictions_total"),
+		cacheExpirations:   metrics.GetOrCreateCounter("cache_expirations_total"),
+		cacheSize:          metrics.GetOrCreateGauge("cache_size_bytes", nil),
+		cacheEntries:       metrics.GetOrCreateGauge("cache_entries", nil),
+	}
+	metrics.GetOrCreateGauge("cache_size_high_watermark_bytes", func() float64 {
+		return float64(m.peakSize.Load())
+	})
+
+	for _, bucket := range append(slices.Clip(buckets), otherBucket) {
+		m.cacheHitCounters[bucket] = metrics.GetOrCreateCounter(fmt.Sprintf("cache_hits_total{bucket=%q}", bucket))
+		m.cacheMissCounters[bucket] = metrics.GetOrCreateCounter(fmt.Sprintf("cache_misses_total{bucket=%q}", bucket))
+		m.bucketOpsCounters[bucket] = metrics.GetOrCreateCounter(fmt.Sprintf("bucket_operations_total{bucket=%q}", bucket))
+	}
+
+	// Methods we serve get their own series; anything else is counted as "other"
+	for _, method := range []string{
+		http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPost,
+		http.MethodDelete, http.MethodOptions, otherMethod,
+	} {
+		m.requestCounters[method] = metrics.GetOrCreateCounter(fmt.Sprintf("http_requests_total{method=%q}", method))
 	}
 
-	// Initialize status code counters for common codes
+	// Initialize status code counters for common codes; others are created on first use
 	for _, code := range []int{200, 201, 204, 400, 401, 403, 404, 500} {
-		m.statusCodeCounters[code] = metrics.NewCounter(
-			"http_response_status_total{code=\"" + strconv.Itoa(code) + "\"}",
-		)
+		m.statusCodeCounters[code] = statusCodeCounter(code)
 	}
 
 	return m
@@ -46,6 +83,9 @@ func (m *MetricsMiddleware) WithMetrics(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
+		// Read the bucket up front, as later middleware may replace the request
+		bucket, isBucketOp := requestBucket(r)
+
 		// Track request size
 		if r.ContentLength > 0 {
 			m.requestSizeHist.Update(float64(r.ContentLength))
@@ -55,7 +95,7 @@ func (m *MetricsMiddleware) WithMetrics(next http.Handler) http.Handler {
 		lrw := newLoggingResponseWriter(w)
 
 		// Process request
-		m.requestCounter.Inc()
+		m.requestCounter(r.Method).Inc()
 		next.ServeHTTP(lrw, r)
 
 		// Record metrics
@@ -64,18 +104,82 @@ func (m *MetricsMiddleware) WithMetrics(next http.Handler) http.Handler {
 
 		if counter, exists := m.statusCodeCounters[lrw.statusCode]; exists {
 			counter.Inc()
+		} else if lrw.statusCode >= 100 && lrw.statusCode <= 599 {
+			// Valid status codes bound the number of series
+			statusCodeCounter(lrw.statusCode).Inc()
 		}
 
 		m.responseSizeHist.Update(float64(lrw.length))
 
 		// Track bucket operations
-		segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-		if len(segments) >= 2 {
-			m.bucketOpsCounter.Inc()
+		if isBucketOp {
+			m.bucketOpsCounters[m.bucketLabel(bucket)].Inc()
 		}
 	})
 }
 
+func (m *MetricsMiddleware) requestCounter(method string) *metrics.Counter {
+	if counter, ok := m.requestCounters[method]; ok {
+		return counter
+	}
+	return m.requestCounters[otherMethod]
+}
+
+func statusCodeCounter(code int) *metrics.Counter {
+	return metrics.GetOrCreateCounter(
+		"http_response_status_total{code=\"" + strconv.Itoa(code) + "\"}",
+	)
+}
+
+// RecordCacheHit counts a cache hit for the bucket
+func (m *MetricsMiddleware) RecordCacheHit(bucket string) {
+	m.cacheHitCounters[m.bucketLabel(bucket)].Inc()
+}
+
+// RecordCacheMiss counts a cache miss for the bucket
+func (m *MetricsMiddleware) RecordCacheMiss(bucket string) {
+	m.cacheMissCounters[m.bucketLabel(bucket)].Inc()
+}
+
+// RecordEvictions counts entries evicted to keep the cache within its size
+func (m *MetricsMiddleware) RecordEvictions(n int) {
+	m.cacheEvictions.Add(n)
+}
+
+// RecordExpirations counts expired entries removed from the cache
+func (m *MetricsMiddleware) RecordExpirations(n int) {
+	m.cacheExpirations.Add(n)
+}
+
+// RecordSize updates the cache size gauges, including the largest size seen
+func (m *MetricsMiddleware) RecordSize(bytes, entries int64) {
+	m.cacheSize.Set(float64(bytes))
+	m.cacheEntries.Set(float64(entries))
+	for peak := m.peakSize.Load(); bytes > peak; peak = m.peakSize.Load() {
+		if m.peakSize.CompareAndSwap(peak, bytes) {
+			return
+		}
+	}
+}
+
+func (m *MetricsMiddleware) bucketLabel(bucket string) string {
+	if _, ok := m.bucketOpsCounters[bucket]; ok {
+		return bucket
+	}
+	return otherBucket
+}
+
+// requestBucket returns the bucket addressed by an object, presign, bucket or
+// archive request
+func requestBucket(r *http.Request) (string, bool) {
+	if !strings.HasPrefix(r.URL.Path, "/objects/") && !strings.HasPrefix(r.URL.Path, "/presign/") &&
+		!strings.HasPrefix(r.URL.Path, "/buckets/") && !strings.HasPrefix(r.URL.Path, "/archive/") {
+		return "", false
+	}
+	bucket, _ := bucketAndMethod(r)
+	return bucket, bucket != ""
+}
+
 func (m *MetricsMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	metrics.WritePrometheus(w, true)
 }
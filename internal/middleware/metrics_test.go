@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/muandane/estrois/internal/cache"
+)
+
+// scrape returns the value of each series on the metrics page
+func scrape(t *testing.T, m *MetricsMiddleware) map[string]float64 {
+	t.Helper()
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	values := make(map[string]float64)
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		separator := strings.LastIndexByte(line, ' ')
+		if separator < 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value := line[:separator], line[separator+1:]
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("series %s: %v", name, err)
+		}
+		values[name] = parsed
+	}
+	return values
+}
+
+// nopSink discards cache events once a test is done with its middleware
+type nopSink struct{}
+
+func (nopSink) RecordEvictions(int)             {}
+func (nopSink) RecordExpirations(int)           {}
+func (nopSink) RecordSize(bytes, entries int64) {}
+
+func TestCacheMetricsScraped(t *testing.T) {
+	m := NewMetricsMiddleware(nil)
+	cache.SetMetricsSink(m)
+	t.Cleanup(func() { cache.SetMetricsSink(nopSink{}) })
+	before := scrape(t, m)
+
+	store := cache.NewMemoryStore(1000)
+	for i := range 10 {
+		entry := cache.NewCacheEntry(make([]byte, 200), "application/octet-stream", time.Now(), `"etag"`, nil, time.Minute)
+		store.Set(fmt.Sprintf("key-%d", i), entry)
+	}
+	stats := store.Stats()
+
+	after := scrape(t, m)
+	if evictions := after["cache_evictions_total"] - before["cache_evictions_total"]; evictions != float64(10-stats.EntryCount) {
+		t.Errorf("cache_evictions_total grew by %v with %d of 10 entries left", evictions, stats.EntryCount)
+	}
+	if got := after["cache_entries"]; got != float64(stats.EntryCount) {
+		t.Errorf("cache_entries = %v, want %d", got, stats.EntryCount)
+	}
+	if got := after["cache_size_bytes"]; got != float64(stats.CurrentSize) {
+		t.Errorf("cache_size_bytes = %v, want %d", got, stats.CurrentSize)
+	}
+	if got := after["cache_size_high_watermark_bytes"]; got < float64(stats.CurrentSize) || got > 1000 {
+		t.Errorf("cache_size_high_watermark_bytes = %v, want between %d and 1000", got, stats.CurrentSize)
+	}
+}
+
+func TestCacheCountersBoundBucketLabels(t *testing.T) {
+	m := NewMetricsMiddleware([]string{"photos"})
+	before := scrape(t, m)
+	m.RecordCacheHit("photos")
+	m.RecordCacheMiss("photos")
+	m.RecordCacheHit("unconfigured-bucket")
+
+	after := scrape(t, m)
+	for series, want := range map[string]float64{
+		`cache_hits_total{bucket="photos"}`:   1,
+		`cache_misses_total{bucket="photos"}`: 1,
+		`cache_hits_total{bucket="other"}`:    1,
+	} {
+		if got := after[series] - before[series]; got != want {
+			t.Errorf("%s grew by %v, want %v", series, got, want)
+		}
+	}
+	if _, ok := after[`cache_hits_total{bucket="unconfigured-bucket"}`]; ok {
+		t.Error("an unconfigured bucket got its own series")
+	}
+}
+
+func TestRequestMetricsByMethodAndStatus(t *testing.T) {
+	m := NewMetricsMiddleware([]string{"photos"})
+	handler := m.WithMetrics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/objects/photos/missing.jpg":
+			w.WriteHeader(http.StatusNotFound)
+		case "/objects/photos/teapot.jpg":
+			w.WriteHeader(http.StatusTeapot)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	before := scrape(t, m)
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/objects/photos/a.jpg"},
+		{http.MethodGet, "/objects/photos/missing.jpg"},
+		{http.MethodPut, "/objects/photos/a.jpg"},
+		{http.MethodGet, "/objects/photos/teapot.jpg"},
+		{"PURGE", "/objects/photos/a.jpg"},
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+
+	after := scrape(t, m)
+	for series, want := range map[string]float64{
+		`http_requests_total{method="GET"}`:        3,
+		`http_requests_total{method="PUT"}`:        1,
+		`http_requests_total{method="other"}`:      1,
+		`http_response_status_total{code="200"}`:   3,
+		`http_response_status_total{code="404"}`:   1,
+		`http_response_status_total{code="418"}`:   1,
+		`bucket_operations_total{bucket="photos"}`: 5,
+	} {
+		if got := after[series] - before[series]; got != want {
+			t.Errorf("%s grew by %v, want %v", series, got, want)
+		}
+	}
+	if _, ok := after[`http_requests_total{method="PURGE"}`]; ok {
+		t.Error("an unknown method got its own series")
+	}
+}
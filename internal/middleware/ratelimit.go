@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// limiterIdleTimeout is how long an unused client limiter is kept around
+const limiterIdleTimeout = 3 * time.Minute
+
+type RateLimitConfig struct {
+	RequestsPerSecond float64
+	Burst             int
+	PerBucket         bool // limit each client separately per bucket
+	ExcludedPaths     []string
+	TrustedProxies    []*net.IPNet
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type rateLimiter struct {
+	config    RateLimitConfig
+	mu        sync.Mutex
+	clients   map[string]*clientLimiter
+	lastSweep time.Time
+}
+
+// WithRateLimit applies a token bucket per client IP (and optionally per
+// bucket). Requests over the limit get 429 with a Retry-After header.
+// A non-positive RequestsPerSecond disables the limiter.
+func WithRateLimit(config RateLimitConfig, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if config.RequestsPerSecond <= 0 {
+			logger.Info("Rate limiting is disabled")
+			return next
+		}
+		if config.Burst < 1 {
+			config.Burst = 1
+		}
+		logger.Info("Rate limiting middleware enabled",
+			"requests_per_second", config.RequestsPerSecond,
+			"burst", config.Burst,
+			"per_bucket", config.PerBucket,
+		)
+
+		rl := &rateLimiter{
+			config:    config,
+			clients:   make(map[string]*clientLimiter),
+			lastSweep: time.Now(),
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, path := range config.ExcludedPaths {
+				if r.URL.Path == path {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			key := ClientIP(r, config.TrustedProxies)
+			if config.PerBucket {
+				if bucket, _ := bucketAndMethod(r); bucket != "" {
+					key += "|" + bucket
+				}
+			}
+
+			reservation := rl.limiterFor(key).Reserve()
+			if delay := reservation.Delay(); delay > 0 {
+				reservation.Cancel()
+				retryAfter := int(math.Ceil(delay.Seconds()))
+				logger.Warn("rate limit exceeded",
+					"client", key,
+					"retry_after", retryAfter,
+				)
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (rl *rateLimiter) limiterFor(key string) *rate.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(rl.lastSweep) > limiterIdleTimeout {
+		for k, c := range rl.clients {
+			if now.Sub(c.lastSeen) > limiterIdleTimeout {
+				delete(rl.clients, k)
+			}
+		}
+		rl.lastSweep = now
+	}
+
+	c, ok := rl.clients[key]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(rate.Limit(rl.config.RequestsPerSecond), rl.config.Burst)}
+		rl.clients[key] = c
+	}
+	c.lastSeen = now
+	return c.limiter
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newRateLimited(config RateLimitConfig) http.Handler {
+	return WithRateLimit(config, slog.New(slog.DiscardHandler))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func requestFrom(handler http.Handler, remoteAddr, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitBurstAndRecovery(t *testing.T) {
+	handler := newRateLimited(RateLimitConfig{RequestsPerSecond: 10, Burst: 3})
+
+	for i := range 3 {
+		if w := requestFrom(handler, "192.0.2.1:1000", "/objects/photos/a.jpg"); w.Code != http.StatusOK {
+			t.Fatalf("request %d within the burst: status = %d", i+1, w.Code)
+		}
+	}
+	w := requestFrom(handler, "192.0.2.1:1000", "/objects/photos/a.jpg")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request past the burst: status = %d, want 429", w.Code)
+	}
+	if retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || retryAfter < 1 {
+		t.Errorf("Retry-After = %q, want a positive number of seconds", w.Header().Get("Retry-After"))
+	}
+
+	// Other clients have their own bucket
+	if w := requestFrom(handler, "192.0.2.2:1000", "/objects/photos/a.jpg"); w.Code != http.StatusOK {
+		t.Errorf("another client: status = %d", w.Code)
+	}
+
+	// A token is back after 1/RequestsPerSecond
+	time.Sleep(150 * time.Millisecond)
+	if w := requestFrom(handler, "192.0.2.1:1000", "/objects/photos/a.jpg"); w.Code != http.StatusOK {
+		t.Errorf("after the window: status = %d, want 200", w.Code)
+	}
+}
+
+func TestRateLimitPerBucket(t *testing.T) {
+	handler := newRateLimited(RateLimitConfig{RequestsPerSecond: 0.1, Burst: 1, PerBucket: true})
+
+	if w := requestFrom(handler, "192.0.2.1:1000", "/objects/photos/a.jpg"); w.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d", w.Code)
+	}
+	if w := requestFrom(handler, "192.0.2.1:1000", "/objects/photos/b.jpg"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("same bucket: status = %d, want 429", w.Code)
+	}
+	if w := requestFrom(handler, "192.0.2.1:1000", "/objects/videos/a.mp4"); w.Code != http.StatusOK {
+		t.Errorf("another bucket: status = %d, want 200", w.Code)
+	}
+}
+
+func TestRateLimitExcludedPaths(t *testing.T) {
+	handler := newRateLimited(RateLimitConfig{RequestsPerSecond: 0.1, Burst: 1, ExcludedPaths: []string{"/health"}})
+	for i := range 5 {
+		if w := requestFrom(handler, "192.0.2.1:1000", "/health"); w.Code != http.StatusOK {
+			t.Fatalf("health check %d: status = %d", i+1, w.Code)
+		}
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	handler := newRateLimited(RateLimitConfig{})
+	for i := range 20 {
+		if w := requestFrom(handler, "192.0.2.1:1000", "/objects/photos/a.jpg"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d", i+1, w.Code)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// errorResponse mirrors handlers.ErrorResponse so clients see the same error shape
+type errorResponse struct {
+	Error   string `json:"error"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type recoveryResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (rw *recoveryResponseWriter) WriteHeader(code int) {
+	rw.wroteHeader = true
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recoveryResponseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(b)
+}
+
+// WithRecovery recovers from panics in handlers and the middleware it wraps,
+// logs them with the request ID and stack trace, and responds with a 500 JSON
+// error instead of dropping the connection. Wrapped around WithLogging, it
+// finds the request ID in the response headers.
+func WithRecovery(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := &recoveryResponseWriter{ResponseWriter: w}
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				// Let net/http handle deliberate aborts
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				requestID := RequestIDFromContext(r.Context())
+				if requestID == "" {
+					requestID = rw.Header().Get(RequestIDHeader)
+				}
+				logger.Error("panic recovered",
+					"request_id", requestID,
+					"method", r.Method,
+					"path", r.URL.Path,
+					"remote_addr", r.RemoteAddr,
+					"panic", fmt.Sprint(rec),
+					"stack", string(debug.Stack()),
+				)
+
+				// Too late to change the status once the response has started
+				if rw.wroteHeader {
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(errorResponse{
+					Error:   "internal server error",
+					Code:    http.StatusInternalServerError,
+					Message: "internal server error",
+				})
+			}()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoveryAnswersPanicsWith500(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]int
+		m["boom"]++
+	})
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("still up"))
+	})
+	server := httptest.NewServer(Chain(mux, WithRecovery(logger), WithLogging(slog.New(slog.DiscardHandler), nil)))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/panic")
+	if err != nil {
+		t.Fatalf("the connection was dropped: %v", err)
+	}
+	var body errorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding the error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError || body.Code != http.StatusInternalServerError || body.Error == "" {
+		t.Errorf("status = %d, body %+v, want a 500 error", resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("log line %q: %v", logs.String(), err)
+	}
+	if record["request_id"] != resp.Header.Get(RequestIDHeader) || !strings.Contains(record["stack"].(string), "recovery_test.go") {
+		t.Errorf("panic log = %v, want the request ID and the stack", record)
+	}
+
+	resp, err = http.Get(server.URL + "/ok")
+	if err != nil {
+		t.Fatalf("after a panic: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("after a panic: status = %d", resp.StatusCode)
+	}
+}
+
+func TestRecoveryKeepsStartedResponses(t *testing.T) {
+	handler := WithRecovery(slog.New(slog.DiscardHandler))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("late failure")
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusAccepted || w.Body.Len() != 0 {
+		t.Errorf("status = %d, body %q, want the started response untouched", w.Code, w.Body)
+	}
+}
+
+func TestRecoveryWrapsMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+	panicking := func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("middleware failure")
+		})
+	}
+	handler := Chain(http.NotFoundHandler(), panicking, WithLogging(slog.New(slog.DiscardHandler), nil), WithRecovery(logger))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/objects/b/k", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	var record map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("log line %q: %v", logs.String(), err)
+	}
+	if requestID := w.Header().Get(RequestIDHeader); requestID == "" || record["request_id"] != requestID {
+		t.Errorf("panic log = %v, want request ID %q", record, requestID)
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithSignatureAuth(t *testing.T) {
+	secret := []byte("shared-secret")
+	handler := WithSignatureAuth(SignatureConfig{
+		Secret:        secret,
+		MaxClockSkew:  5 * time.Minute,
+		ExcludedPaths: []string{"/health"},
+	}, slog.New(slog.DiscardHandler))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	stale := time.Now().Add(-10 * time.Minute).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name       string
+		path       string
+		date       string
+		signature  string
+		wantStatus int
+	}{
+		{"valid", "/objects/reports/a.txt", now, SignRequest(secret, http.MethodGet, "/objects/reports/a.txt", now), http.StatusOK},
+		{"expired timestamp", "/objects/reports/a.txt", stale, SignRequest(secret, http.MethodGet, "/objects/reports/a.txt", stale), http.StatusUnauthorized},
+		{"tampered path", "/objects/reports/b.txt", now, SignRequest(secret, http.MethodGet, "/objects/reports/a.txt", now), http.StatusUnauthorized},
+		{"tampered method", "/objects/reports/a.txt", now, SignRequest(secret, http.MethodDelete, "/objects/reports/a.txt", now), http.StatusUnauthorized},
+		{"wrong secret", "/objects/reports/a.txt", now, SignRequest([]byte("other"), http.MethodGet, "/objects/reports/a.txt", now), http.StatusUnauthorized},
+		{"missing signature", "/objects/reports/a.txt", now, "", http.StatusUnauthorized},
+		{"missing date", "/objects/reports/a.txt", "", SignRequest(secret, http.MethodGet, "/objects/reports/a.txt", ""), http.StatusUnauthorized},
+		{"excluded path", "/health", "", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.date != "" {
+				req.Header.Set(SignatureDateHeader, tt.date)
+			}
+			if tt.signature != "" {
+				req.Header.Set(SignatureHeader, tt.signature)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestSignRequest(t *testing.T) {
+	// printf 'GET\n/objects/b/k\n2024-01-02T03:04:05Z' | openssl dgst -sha256 -hmac key
+	const want = "4e121cc06273ee2e497b49cea3c32fbfe0678ca832eab9c49e3a53d211fa07a0"
+	if got := SignRequest([]byte("key"), http.MethodGet, "/objects/b/k", "2024-01-02T03:04:05Z"); got != want {
+		t.Errorf("SignRequest = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/muandane/estrois/internal/config"
+)
+
+type tenantKey struct{}
+
+// TenantFromContext returns the tenant a request acts for, or "" when its
+// object keys are not namespaced
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+type TenantConfig struct {
+	// Tenants maps API keys to the tenant they belong to
+	Tenants map[string]string
+	// Header names the tenant for requests whose API key has no tenant. The
+	// header is trusted as is, so it must be set by a proxy that overwrites
+	// whatever the client sent.
+	Header string
+	// ExcludedPaths are served without a tenant
+	ExcludedPaths []string
+}
+
+// WithTenant resolves the tenant of a request from its API key, or else from
+// the configured header, and stores it in the request context. Requests naming
+// an invalid tenant are rejected with 400, and requests resolving no tenant
+// with 403, so they cannot reach the keys of every tenant. With no tenants and
+// no header configured every request acts without a tenant.
+func WithTenant(tenantConfig TenantConfig, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(tenantConfig.Tenants) == 0 && tenantConfig.Header == "" {
+			return next
+		}
+		logger.Info("Tenant namespaces enabled",
+			"tenant_keys", len(tenantConfig.Tenants),
+			"header", tenantConfig.Header,
+		)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if slices.Contains(tenantConfig.ExcludedPaths, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tenant := lookupTenant(tenantConfig.Tenants, requestAPIKey(r))
+			if tenant == "" && tenantConfig.Header != "" {
+				tenant = r.Header.Get(tenantConfig.Header)
+			}
+			if tenant == "" {
+				logger.Warn("request without a tenant", "path", r.URL.Path)
+				http.Error(w, "tenant required", http.StatusForbidden)
+				return
+			}
+			if !config.ValidTenant(tenant) {
+				logger.Warn("invalid tenant", "tenant", tenant)
+				http.Error(w, "invalid tenant", http.StatusBadRequest)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenant)))
+		})
+	}
+}
+
+// lookupTenant compares against every key in constant time, like lookupAPIKey
+func lookupTenant(tenants map[string]string, key string) string {
+	if key == "" {
+		return ""
+	}
+	var tenant string
+	for candidate, name := range tenants {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			tenant = name
+		}
+	}
+	return tenant
+}
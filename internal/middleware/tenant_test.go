@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithTenant(t *testing.T) {
+	config := TenantConfig{
+		Tenants:       map[string]string{"acme-key": "acme", "globex-key": "globex"},
+		Header:        "X-Tenant",
+		ExcludedPaths: []string{"/health"},
+	}
+	handler := WithTenant(config, slog.New(slog.NewTextHandler(io.Discard, nil)))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, TenantFromContext(r.Context()))
+	}))
+
+	tests := []struct {
+		name       string
+		path       string
+		headers    map[string]string
+		wantStatus int
+		wantTenant string
+	}{
+		{"api key", "/objects/b/k", map[string]string{APIKeyHeader: "acme-key"}, http.StatusOK, "acme"},
+		{"bearer key wins over header", "/objects/b/k", map[string]string{"Authorization": "Bearer globex-key", "X-Tenant": "acme"}, http.StatusOK, "globex"},
+		{"header", "/objects/b/k", map[string]string{"X-Tenant": "initech"}, http.StatusOK, "initech"},
+		{"invalid header tenant", "/objects/b/k", map[string]string{"X-Tenant": "../acme"}, http.StatusBadRequest, ""},
+		{"no tenant", "/objects/b/k", nil, http.StatusForbidden, ""},
+		{"unknown key", "/objects/b/k", map[string]string{APIKeyHeader: "other-key"}, http.StatusForbidden, ""},
+		{"excluded path", "/health", nil, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && w.Body.String() != tt.wantTenant {
+				t.Errorf("tenant = %q, want %q", w.Body, tt.wantTenant)
+			}
+		})
+	}
+}
+
+func TestWithTenantDisabled(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := WithTenant(TenantConfig{}, slog.New(slog.NewTextHandler(io.Discard, nil)))(next)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/objects/b/k", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d without tenants configured, want 200", w.Code)
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/muandane/estrois/internal/tracing"
+)
+
+// WithTracing starts a server span for each request, continuing the trace of
+// an incoming traceparent header. Handlers name the span after their route.
+// Spans are no-ops unless OTEL_ENABLED is set.
+func WithTracing() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracing.Tracer().Start(ctx, r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", r.Method),
+					attribute.String("url.path", r.URL.Path),
+				),
+			)
+			defer span.End()
+
+			lrw := newLoggingResponseWriter(w)
+			next.ServeHTTP(lrw, r.WithContext(ctx))
+
+			span.SetAttributes(
+				attribute.Int("http.response.status_code", lrw.statusCode),
+				attribute.Int("http.response.body.size", lrw.length),
+			)
+			if cacheStatus := lrw.Header().Get("X-Cache"); cacheStatus != "" {
+				span.SetAttributes(attribute.String("cache_status", cacheStatus))
+			}
+			if lrw.statusCode >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", lrw.statusCode))
+			}
+		})
+	}
+}
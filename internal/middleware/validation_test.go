@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithValidation(t *testing.T) {
+	handler := WithValidation(ValidationConfig{
+		ExcludedPaths: []string{"/health"},
+		BucketAccess:  map[string]string{"public": "read", "uploads": "write", "private": "none"},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/objects/public/file.txt", http.StatusOK},
+		{http.MethodPut, "/objects/public/file.txt", http.StatusForbidden},
+		{http.MethodPut, "/objects/uploads/file.txt", http.StatusOK},
+		{http.MethodGet, "/objects/private/file.txt", http.StatusForbidden},
+		{http.MethodGet, "/objects/unknown/file.txt", http.StatusForbidden},
+		{http.MethodGet, "/presign/public/file.txt?method=GET", http.StatusOK},
+		{http.MethodGet, "/presign/public/file.txt?method=put", http.StatusForbidden},
+		{http.MethodGet, "/presign/uploads/file.txt?method=PUT", http.StatusOK},
+		{http.MethodPut, "/buckets/public", http.StatusForbidden},
+		{http.MethodHead, "/buckets/public", http.StatusOK},
+		{http.MethodPut, "/buckets/uploads", http.StatusOK},
+		{http.MethodPut, "/buckets/unknown", http.StatusForbidden},
+		{http.MethodGet, "/health", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.path, w.Code, tt.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
 )
 
@@ -23,12 +24,7 @@ func WithValidation(config ValidationConfig) func(http.Handler) http.Handler {
 				}
 			}
 
-			// Explicitly extract bucket from the path for "/objects/{bucket}/{key}"
-			pathParts := strings.Split(strings.TrimPrefix(r.URL.Path, "/objects/"), "/")
-			bucket := ""
-			if len(pathParts) > 0 {
-				bucket = pathParts[0]
-			}
+			bucket, method := bucketAndMethod(r)
 
 			// If no bucket is specified, allow the request
 			if bucket == "" {
@@ -45,23 +41,74 @@ func WithValidation(config ValidationConfig) func(http.Handler) http.Handler {
 				return
 			}
 
-			// Validate access based on HTTP method
-			switch r.Method {
-			case http.MethodGet, http.MethodHead:
-				if policy == "read" || policy == "all" || policy == "write" {
-					next.ServeHTTP(w, r)
-					return
-				}
-			case http.MethodPut, http.MethodDelete:
-				if policy == "write" || policy == "all" {
-					next.ServeHTTP(w, r)
+			if !isMethodAllowed(policy, method) {
+				log.Printf("Access denied for method %s on bucket %s", method, bucket)
+				http.Error(w, "access denied", http.StatusForbidden)
+				return
+			}
+
+			// A server-side copy also reads from the source bucket
+			if srcBucket := copySourceBucket(r); srcBucket != "" && method == http.MethodPut {
+				if srcPolicy, exists := config.BucketAccess[srcBucket]; !exists || !isMethodAllowed(srcPolicy, http.MethodGet) {
+					log.Printf("Access denied for copy from bucket %s", srcBucket)
+					http.Error(w, "access denied", http.StatusForbidden)
 					return
 				}
 			}
 
-			// If no condition is met, deny access
-			log.Printf("Access denied for method %s on bucket %s", r.Method, bucket)
-			http.Error(w, "access denied", http.StatusForbidden)
+			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// isMethodAllowed validates access based on HTTP method
+func isMethodAllowed(policy, method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return policy == "read" || policy == "all" || policy == "write"
+	case http.MethodPut, http.MethodDelete:
+		return policy == "write" || policy == "all"
+	}
+	// Other methods reach no data: handlers answer OPTIONS and reject the
+	// rest with 405
+	return true
+}
+
+// copySourceBucket returns the bucket named in an X-Copy-Source header, if any
+func copySourceBucket(r *http.Request) string {
+	source := r.Header.Get("X-Copy-Source")
+	if source == "" {
+		return ""
+	}
+	if unescaped, err := url.PathUnescape(source); err == nil {
+		source = unescaped
+	}
+	bucket, _, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	return bucket
+}
+
+// bucketAndMethod extracts the bucket from "/objects/{bucket}/{key}",
+// "/presign/{bucket}/{key}", "/buckets/{bucket}" or "/archive/{bucket}" paths
+// along with the operation to authorize.
+// Presigned URLs are authorized for the method they grant: PUT needs write
+// access and anything else is checked as a read, leaving the presign handler
+// to reject unsupported methods.
+func bucketAndMethod(r *http.Request) (string, string) {
+	path, method := r.URL.Path, r.Method
+	if rest, ok := strings.CutPrefix(path, "/presign/"); ok {
+		path = rest
+		method = http.MethodGet
+		if strings.EqualFold(r.URL.Query().Get("method"), http.MethodPut) {
+			method = http.MethodPut
+		}
+	} else if rest, ok := strings.CutPrefix(path, "/buckets/"); ok {
+		path = rest
+	} else if rest, ok := strings.CutPrefix(path, "/archive/"); ok {
+		path = rest
+	} else {
+		path = strings.TrimPrefix(path, "/objects/")
+	}
+
+	bucket, _, _ := strings.Cut(path, "/")
+	return bucket, method
+}
@@ -2,8 +2,10 @@ package router
 
 import (
 	"log/slog"
+	"net"
 	"net/http"
 
+	"github.com/muandane/estrois/internal/cache"
 	"github.com/muandane/estrois/internal/config"
 	"github.com/muandane/estrois/internal/handlers"
 	"github.com/muandane/estrois/internal/middleware"
@@ -12,6 +14,9 @@ import (
 type Router struct {
 	mux    *http.ServeMux
 	logger *slog.Logger
+	// admin serves the observability and cache admin endpoints when they
+	// are separated from object traffic with ADMIN_ADDR
+	admin http.Handler
 }
 
 func NewRouter(logger *slog.Logger) *Router {
@@ -21,36 +26,133 @@ func NewRouter(logger *slog.Logger) *Router {
 	}
 }
 
-func (r *Router) Setup(objectHandler *handlers.ObjectHandler) http.Handler {
+func (r *Router) Setup(objectHandler *handlers.ObjectHandler, statsHandler *handlers.StatsHandler, purgeHandler *handlers.PurgeHandler, readyHandler *handlers.ReadyHandler) http.Handler {
 	// Create middleware instances
 	validationConfig := middleware.ValidationConfig{
 		ExcludedPaths: []string{
 			"/health",
+			"/ready",
 			"/metrics",
 			"/stats",
 		},
 		BucketAccess: config.GetAllowedBuckets().AllowedBuckets,
 	}
 
-	metricsMiddleware := middleware.NewMetricsMiddleware()
-	statsHandler := handlers.NewStatsHandler()
+	trustedProxies, err := middleware.ParseCIDRs(config.GetTrustedProxies())
+	if err != nil {
+		r.logger.Error("invalid TRUSTED_PROXIES, ignoring X-Forwarded-For", "error", err)
+		trustedProxies = nil
+	}
+
+	// With ENABLE_BUCKET_POLICIES, buckets are only reached from the client
+	// IPs of BUCKET_ALLOWED_IPS, found behind TRUSTED_PROXIES
+	bucketPolicy := middleware.BucketPolicy{
+		AllowedOperations: middleware.BucketOperations(validationConfig.BucketAccess),
+		AllowedIPs:        make(map[string][]*net.IPNet),
+		TrustedProxies:    trustedProxies,
+		ExcludedPaths:     validationConfig.ExcludedPaths,
+	}
+	for bucket, ranges := range config.GetBucketAllowedIPs() {
+		if bucketPolicy.AllowedIPs[bucket], err = middleware.ParseCIDRs(ranges); err != nil {
+			r.logger.Error("invalid BUCKET_ALLOWED_IPS, denying the bucket", "bucket", bucket, "error", err)
+		}
+	}
+
+	rateLimit := config.GetRateLimitConfig()
+	rateLimitConfig := middleware.RateLimitConfig{
+		RequestsPerSecond: rateLimit.RequestsPerSecond,
+		Burst:             rateLimit.Burst,
+		PerBucket:         rateLimit.PerBucket,
+		ExcludedPaths:     validationConfig.ExcludedPaths,
+		TrustedProxies:    trustedProxies,
+	}
+
+	buckets := make([]string, 0, len(validationConfig.BucketAccess))
+	for bucket := range validationConfig.BucketAccess {
+		buckets = append(buckets, bucket)
+	}
+	apiKeyConfig := middleware.APIKeyConfig{
+		Keys: config.GetAPIKeys(),
+		// Health checks and Prometheus scrapes do not carry API keys
+		ExcludedPaths: []string{"/health", "/ready", "/metrics"},
+	}
+
+	tenantConfig := middleware.TenantConfig{
+		Tenants:       config.GetAPIKeyTenants(),
+		Header:        config.GetTenantHeader(),
+		ExcludedPaths: apiKeyConfig.ExcludedPaths,
+	}
+
+	signature := config.GetSignatureConfig()
+	signatureConfig := middleware.SignatureConfig{
+		Secret:        []byte(signature.Secret),
+		MaxClockSkew:  signature.MaxClockSkew,
+		ExcludedPaths: apiKeyConfig.ExcludedPaths,
+	}
+
+	responseCompression := config.GetResponseCompressionConfig()
+	compress := middleware.WithResponseCompression(middleware.CompressionConfig{
+		Enabled: responseCompression.Enabled,
+		MinSize: int(responseCompression.MinSize),
+	})
+
+	metricsMiddleware := middleware.NewMetricsMiddleware(buckets)
+	objectHandler.SetCacheRecorder(metricsMiddleware)
+	cache.SetMetricsSink(metricsMiddleware)
+
+	// Admin endpoints move to their own mux when ADMIN_ADDR is set. Health
+	// checks stay on both so either port can be probed.
+	adminMux := r.mux
+	if config.GetServerConfig().AdminAddr != "" {
+		adminMux = http.NewServeMux()
+		adminMux.Handle("/health", handlers.NewHealthHandler(r.logger))
+		adminMux.Handle("/ready", readyHandler)
+	}
 
 	// Register routes
 	r.mux.Handle("/health", handlers.NewHealthHandler(r.logger))
-	r.mux.Handle("/metrics", metricsMiddleware)
-	r.mux.Handle("/stats", statsHandler)
-	r.mux.HandleFunc("/objects/{bucket}/{key...}", func(w http.ResponseWriter, r *http.Request) {
-		bucket := r.PathValue("bucket")
-		key := r.PathValue("key")
-		r.URL.Path = bucket + "/" + key
-		objectHandler.ServeHTTP(w, r)
-	})
+	r.mux.Handle("/ready", readyHandler)
+	adminMux.Handle("/metrics", compress(metricsMiddleware))
+	adminMux.Handle("/stats", compress(statsHandler))
+	purgeHandler.RegisterRoutes(adminMux)
+	adminMux.Handle("POST /cache/warm", objectHandler.WarmHandler(validationConfig.BucketAccess))
+	r.mux.Handle("GET /objects/{bucket}", objectHandler.ListHandler())
+	r.mux.Handle("GET /presign/{bucket}/{key...}", objectHandler.PresignHandler())
+	r.mux.Handle("GET /archive/{bucket}", objectHandler.ArchiveHandler())
+	r.mux.Handle("GET /buckets", objectHandler.ListBucketsHandler(validationConfig.BucketAccess))
+	r.mux.Handle("PUT /buckets/{bucket}", objectHandler.BucketHandler())
+	r.mux.Handle("HEAD /buckets/{bucket}", objectHandler.BucketHandler())
+	objectHandler.RegisterRoutes(r.mux)
+
+	// Apply middleware chain; the last middleware runs first. Recovery wraps
+	// everything, so a panic in any middleware is answered with a 500 and
+	// logged with the request ID; tracing and logging come next, so every
+	// response carries a request ID. Tenants are resolved only once the API
+	// key has been checked. The admin port gets the same chain, so its
+	// endpoints keep their authentication.
+	chain := func(mux *http.ServeMux) http.Handler {
+		return middleware.Chain(
+			mux,
+			middleware.WithTenant(tenantConfig, r.logger),
+			middleware.WithBucketAccessControl(bucketPolicy, r.logger, config.GetBucketConfig().EnableBucketPolicies),
+			middleware.WithValidation(validationConfig),
+			middleware.WithAPIKeyAuth(apiKeyConfig, r.logger),
+			middleware.WithSignatureAuth(signatureConfig, r.logger),
+			middleware.WithRateLimit(rateLimitConfig, r.logger),
+			metricsMiddleware.WithMetrics,
+			middleware.WithLogging(r.logger, trustedProxies),
+			middleware.WithTracing(),
+			middleware.WithRecovery(r.logger),
+		)
+	}
+	if adminMux != r.mux {
+		r.admin = chain(adminMux)
+	}
+	return chain(r.mux)
+}
 
-	// Apply middleware chain
-	return middleware.Chain(
-		r.mux,
-		// middleware.WithLogging(r.logger),
-		middleware.WithValidation(validationConfig),
-		metricsMiddleware.WithMetrics,
-	)
+// AdminHandler returns the handler for the admin port, or nil when admin
+// endpoints are served with object traffic. It is only set once Setup has run.
+func (r *Router) AdminHandler() http.Handler {
+	return r.admin
 }
@@ -0,0 +1,120 @@
+package router
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/muandane/estrois/internal/cache"
+	"github.com/muandane/estrois/internal/handlers"
+)
+
+// offlineClients resolves every bucket to a client that is never contacted
+type offlineClients struct {
+	client *minio.Client
+}
+
+func (c offlineClients) ClientForBucket(string) *minio.Client { return c.client }
+func (c offlineClients) Allow(string) error                   { return nil }
+
+// setupRouter returns the main and admin handlers
+func setupRouter(t *testing.T) (http.Handler, http.Handler) {
+	t.Helper()
+	t.Setenv("ALLOWED_BUCKETS", "test-bucket:read")
+	logger := slog.New(slog.DiscardHandler)
+	client, err := minio.New("127.0.0.1:1", &minio.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := cache.NewMemoryStore(cache.MaxCacheSize)
+	stats := handlers.NewStatsHandler(store)
+	objectHandler, err := handlers.NewObjectHandler(offlineClients{client}, store, stats, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRouter(logger)
+	main := r.Setup(objectHandler, stats, handlers.NewPurgeHandler(store, logger), handlers.NewReadyHandler(map[string]handlers.BucketLister{"default": client}, logger))
+	return main, r.AdminHandler()
+}
+
+func statusOf(h http.Handler, path string) int {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w.Code
+}
+
+func TestAdminEndpointsMoveToAdminAddr(t *testing.T) {
+	t.Setenv("ADMIN_ADDR", ":9091")
+	main, admin := setupRouter(t)
+	if admin == nil {
+		t.Fatal("AdminHandler() = nil with ADMIN_ADDR set")
+	}
+	for _, path := range []string{"/metrics", "/stats"} {
+		if got := statusOf(admin, path); got != http.StatusOK {
+			t.Errorf("admin GET %s: status = %d, want 200", path, got)
+		}
+		if got := statusOf(main, path); got != http.StatusNotFound {
+			t.Errorf("main GET %s: status = %d, want 404", path, got)
+		}
+	}
+	for _, h := range []http.Handler{main, admin} {
+		if got := statusOf(h, "/health"); got != http.StatusOK {
+			t.Errorf("GET /health: status = %d, want 200 on both ports", got)
+		}
+	}
+}
+
+func TestAdminEndpointsStayOnMainPortByDefault(t *testing.T) {
+	t.Setenv("ADMIN_ADDR", "")
+	main, admin := setupRouter(t)
+	if admin != nil {
+		t.Error("AdminHandler() != nil without ADMIN_ADDR")
+	}
+	for _, path := range []string{"/metrics", "/stats", "/health"} {
+		if got := statusOf(main, path); got != http.StatusOK {
+			t.Errorf("GET %s: status = %d, want 200", path, got)
+		}
+	}
+}
+
+func TestBucketPoliciesCheckClientIP(t *testing.T) {
+	t.Setenv("BUCKET_ALLOWED_IPS", "test-bucket:10.1.0.0/16|2001:db8::1")
+	t.Setenv("TRUSTED_PROXIES", "192.0.2.1")
+
+	tests := []struct {
+		name          string
+		path          string
+		remoteAddr    string
+		forwardedFor  string
+		enabled, want bool
+	}{
+		{"allowed client", "/objects/test-bucket/a.txt", "10.1.2.3:1234", "", true, true},
+		{"allowed IPv6 client", "/objects/test-bucket/a.txt", "[2001:db8::1]:1234", "", true, true},
+		{"other client", "/objects/test-bucket/a.txt", "10.9.9.9:1234", "", true, false},
+		{"allowed client behind a trusted proxy", "/objects/test-bucket/a.txt", "192.0.2.1:1234", "10.1.2.3", true, true},
+		{"other client behind a trusted proxy", "/objects/test-bucket/a.txt", "192.0.2.1:1234", "10.9.9.9", true, false},
+		{"spoofed X-Forwarded-For", "/objects/test-bucket/a.txt", "10.9.9.9:1234", "10.1.2.3", true, false},
+		{"health check", "/health", "10.9.9.9:1234", "", true, true},
+		{"policies disabled", "/objects/test-bucket/a.txt", "10.9.9.9:1234", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENABLE_BUCKET_POLICIES", strconv.FormatBool(tt.enabled))
+			main, _ := setupRouter(t)
+			// OPTIONS is answered without contacting storage
+			req := httptest.NewRequest(http.MethodOptions, tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			w := httptest.NewRecorder()
+			main.ServeHTTP(w, req)
+			if allowed := w.Code != http.StatusForbidden; allowed != tt.want {
+				t.Errorf("status = %d, want allowed %v", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"fmt"
+	"maps"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// DefaultBackend names the backend configured by S3_ENDPOINT
+const DefaultBackend = "default"
+
+// Backends routes each bucket to the client of the S3 backend holding it.
+// Buckets without a route use the default backend. Backends are set up once
+// at startup and only read afterwards.
+type Backends struct {
+	clients  map[string]*minio.Client
+	breakers map[string]*Breaker
+	routes   map[string]string
+}
+
+func NewBackends(defaultClient *minio.Client) *Backends {
+	return &Backends{
+		clients:  map[string]*minio.Client{DefaultBackend: defaultClient},
+		breakers: make(map[string]*Breaker),
+		routes:   make(map[string]string),
+	}
+}
+
+// Add registers a named backend
+func (b *Backends) Add(name string, client *minio.Client) {
+	b.clients[name] = client
+}
+
+// SetBreaker guards the named backend with breaker; nil removes the guard
+func (b *Backends) SetBreaker(name string, breaker *Breaker) {
+	if breaker == nil {
+		delete(b.breakers, name)
+		return
+	}
+	b.breakers[name] = breaker
+}
+
+// Route sends requests for bucket to the named backend
+func (b *Backends) Route(bucket, name string) error {
+	if _, ok := b.clients[name]; !ok {
+		return fmt.Errorf("bucket %s is routed to unknown backend %s", bucket, name)
+	}
+	b.routes[bucket] = name
+	return nil
+}
+
+// ClientForBucket returns the client serving bucket
+func (b *Backends) ClientForBucket(bucket string) *minio.Client {
+	if name, ok := b.routes[bucket]; ok {
+		return b.clients[name]
+	}
+	return b.clients[DefaultBackend]
+}
+
+// Allow returns ErrCircuitOpen when the breaker of the backend serving
+// bucket is open, so the call can fail fast instead of waiting on storage
+func (b *Backends) Allow(bucket string) error {
+	name, ok := b.routes[bucket]
+	if !ok {
+		name = DefaultBackend
+	}
+	if breaker, ok := b.breakers[name]; ok {
+		return breaker.Allow()
+	}
+	return nil
+}
+
+// Default returns the client of the default backend
+func (b *Backends) Default() *minio.Client {
+	return b.clients[DefaultBackend]
+}
+
+// Clients returns the client of every backend by name
+func (b *Backends) Clients() map[string]*minio.Client {
+	return maps.Clone(b.clients)
+}
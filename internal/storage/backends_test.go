@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func newTestClient(t *testing.T, endpoint string) *minio.Client {
+	t.Helper()
+	client, err := minio.New(endpoint, &minio.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestBackendsRouteBuckets(t *testing.T) {
+	primary, archive := newTestClient(t, "primary:9000"), newTestClient(t, "archive:9000")
+	backends := NewBackends(primary)
+	backends.Add("archive", archive)
+	if err := backends.Route("old-logs", "archive"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := backends.ClientForBucket("old-logs"); got != archive {
+		t.Errorf("old-logs routed to %s, want the archive backend", got.EndpointURL().Host)
+	}
+	if got := backends.ClientForBucket("photos"); got != primary {
+		t.Errorf("unrouted bucket served by %s, want the default backend", got.EndpointURL().Host)
+	}
+	if backends.Default() != primary {
+		t.Error("Default() is not the default backend")
+	}
+	if err := backends.Route("photos", "missing"); err == nil {
+		t.Error("Route accepted an unknown backend")
+	}
+	if got := backends.ClientForBucket("photos"); got != primary {
+		t.Error("a failed Route changed the bucket's backend")
+	}
+}
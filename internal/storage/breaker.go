@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/muandane/estrois/internal/config"
+)
+
+// ErrCircuitOpen is returned instead of calling a backend whose circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("storage backend unavailable, circuit breaker is open")
+
+// BreakerThreshold is the number of consecutive failed storage requests that
+// opens a backend's circuit breaker, set by S3_BREAKER_THRESHOLD (default 5,
+// 0 disables the breaker)
+var BreakerThreshold = config.GetEnvWithDefaultInt("S3_BREAKER_THRESHOLD", 5)
+
+// BreakerCooldown is how long an open breaker fails calls before letting a
+// probe through, set by S3_BREAKER_COOLDOWN (default 10s)
+var BreakerCooldown = config.GetEnvWithDefaultDuration("S3_BREAKER_COOLDOWN", 10*time.Second)
+
+// BreakerState is the state of a circuit breaker, exported as the
+// storage_circuit_breaker_state metric
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker stops calls to a backend that keeps failing. After threshold
+// consecutive failures it opens and fails calls fast for the cooldown. It then
+// half-opens and lets a single probe through: success closes it, failure opens
+// it again.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	// changedAt is when the breaker opened, or when the probe was let
+	// through while half-open
+	changedAt time.Time
+}
+
+// NewBreaker returns a closed breaker and exports its state for backend
+func NewBreaker(backend string, threshold int, cooldown time.Duration) *Breaker {
+	b := &Breaker{threshold: threshold, cooldown: cooldown}
+	metrics.GetOrCreateGauge(fmt.Sprintf("storage_circuit_breaker_state{backend=%q}", backend), func() float64 {
+		return float64(b.State())
+	})
+	return b
+}
+
+// State returns the breaker's current state
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Allow returns ErrCircuitOpen when a call must not be made. Once the cooldown
+// has passed it lets one probe through; another is allowed if the probe never
+// reports back within the cooldown.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerClosed {
+		return nil
+	}
+	if time.Since(b.changedAt) < b.cooldown {
+		return ErrCircuitOpen
+	}
+	b.state, b.changedAt = BreakerHalfOpen, time.Now()
+	return nil
+}
+
+// Record reports the outcome of a storage request
+func (b *Breaker) Record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case !failed && b.state != BreakerOpen:
+		b.state, b.failures = BreakerClosed, 0
+	case failed && b.state == BreakerHalfOpen:
+		b.state, b.changedAt = BreakerOpen, time.Now()
+	case failed && b.state == BreakerClosed:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.state, b.changedAt = BreakerOpen, time.Now()
+		}
+	}
+}
+
+// breakerTransport reports the outcome of every request to a backend,
+// retries included, to its breaker. Network errors and 5xx responses other
+// than 501 count as failures. Requests whose context ended only count once
+// they waited OpTimeout, so cancelled requests and shorter client timeouts
+// do not open the breaker.
+type breakerTransport struct {
+	next    http.RoundTripper
+	breaker *Breaker
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil:
+		if req.Context().Err() == nil || time.Since(start) >= OpTimeout {
+			t.breaker.Record(true)
+		}
+	default:
+		t.breaker.Record(resp.StatusCode >= http.StatusInternalServerError && resp.StatusCode != http.StatusNotImplemented)
+	}
+	return resp, err
+}
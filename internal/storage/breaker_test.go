@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+	b := NewBreaker("breaker-test", 3, cooldown)
+
+	// Failures only open the breaker when they are consecutive
+	b.Record(true)
+	b.Record(true)
+	b.Record(false)
+	b.Record(true)
+	b.Record(true)
+	if state := b.State(); state != BreakerClosed {
+		t.Fatalf("state = %s after interrupted failures, want closed", state)
+	}
+	b.Record(true)
+	if state := b.State(); state != BreakerOpen {
+		t.Fatalf("state = %s after 3 consecutive failures, want open", state)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow() = %v while open, want ErrCircuitOpen", err)
+	}
+	// Late successes of requests started before the breaker opened do not close it
+	b.Record(false)
+	if state := b.State(); state != BreakerOpen {
+		t.Fatalf("state = %s after a late success, want open", state)
+	}
+
+	// After the cooldown a single probe is let through
+	time.Sleep(cooldown)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Allow() = %v after the cooldown, want the probe through", err)
+	}
+	if state := b.State(); state != BreakerHalfOpen {
+		t.Fatalf("state = %s while probing, want half-open", state)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Allow() = %v during the probe, want ErrCircuitOpen", err)
+	}
+
+	// A failed probe opens it again, a successful one closes it
+	b.Record(true)
+	if state := b.State(); state != BreakerOpen {
+		t.Fatalf("state = %s after a failed probe, want open", state)
+	}
+	time.Sleep(cooldown)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Allow() = %v after the second cooldown", err)
+	}
+	b.Record(false)
+	if state := b.State(); state != BreakerClosed {
+		t.Errorf("state = %s after a successful probe, want closed", state)
+	}
+	if err := b.Allow(); err != nil {
+		t.Errorf("Allow() = %v once closed", err)
+	}
+}
+
+func TestBreakerTransport(t *testing.T) {
+	var status atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hang" {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		status     int
+		wantFailed bool
+	}{
+		{"ok", http.StatusOK, false},
+		{"not found", http.StatusNotFound, false},
+		{"server error", http.StatusInternalServerError, true},
+		{"unavailable", http.StatusServiceUnavailable, true},
+		{"not implemented", http.StatusNotImplemented, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := NewBreaker("transport-test", 1, time.Hour)
+			client := &http.Client{Transport: &breakerTransport{next: http.DefaultTransport, breaker: breaker}}
+			status.Store(int32(tt.status))
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if failed := breaker.State() == BreakerOpen; failed != tt.wantFailed {
+				t.Errorf("counted as a failure = %v, want %v", failed, tt.wantFailed)
+			}
+		})
+	}
+
+	t.Run("connection refused", func(t *testing.T) {
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+		breaker := NewBreaker("transport-test", 1, time.Hour)
+		client := &http.Client{Transport: &breakerTransport{next: http.DefaultTransport, breaker: breaker}}
+		if _, err := client.Get(closed.URL); err == nil {
+			t.Fatal("expected a connection error")
+		}
+		if state := breaker.State(); state != BreakerOpen {
+			t.Errorf("state = %s after a refused connection, want open", state)
+		}
+	})
+
+	t.Run("client timeout", func(t *testing.T) {
+		breaker := NewBreaker("transport-test", 1, time.Hour)
+		client := &http.Client{Transport: &breakerTransport{next: http.DefaultTransport, breaker: breaker}}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/hang", nil)
+		if _, err := client.Do(req); err == nil {
+			t.Fatal("expected a timeout")
+		}
+		// A timeout shorter than OpTimeout is the client's, not the backend's fault
+		if state := breaker.State(); state != BreakerClosed {
+			t.Errorf("state = %s after a client timeout, want closed", state)
+		}
+	})
+}
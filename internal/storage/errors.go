@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// errorStatus maps S3 error codes to the HTTP status returned to clients
+var errorStatus = map[string]int{
+	"InvalidBucketName":          http.StatusBadRequest,
+	"InvalidRequest":             http.StatusBadRequest,
+	"InvalidArgument":            http.StatusBadRequest,
+	"InvalidObjectName":          http.StatusBadRequest,
+	"KeyTooLongError":            http.StatusBadRequest,
+	"AccessDenied":               http.StatusForbidden,
+	"AllAccessDisabled":          http.StatusForbidden,
+	"NoSuchBucket":               http.StatusNotFound,
+	"NoSuchKey":                  http.StatusNotFound,
+	"NoSuchVersion":              http.StatusNotFound,
+	"BucketAlreadyExists":        http.StatusConflict,
+	"BucketAlreadyOwnedByYou":    http.StatusConflict,
+	"BucketNotEmpty":             http.StatusConflict,
+	"PreconditionFailed":         http.StatusPreconditionFailed,
+	"EntityTooLarge":             http.StatusRequestEntityTooLarge,
+	"InvalidRange":               http.StatusRequestedRangeNotSatisfiable,
+	"NotImplemented":             http.StatusNotImplemented,
+	"SlowDown":                   http.StatusServiceUnavailable,
+	"ServiceUnavailable":         http.StatusServiceUnavailable,
+	"XMinioServerNotInitialized": http.StatusServiceUnavailable,
+}
+
+// MapError returns the HTTP status for an error returned by a storage call.
+// Unknown errors map to 500.
+func MapError(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrTooManyReads) {
+		return http.StatusServiceUnavailable
+	}
+	var errResp minio.ErrorResponse
+	if errors.As(err, &errResp) {
+		if status, ok := errorStatus[errResp.Code]; ok {
+			return status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// Error is a failed storage call together with the HTTP status it maps to
+type Error struct {
+	Status int
+	Err    error
+}
+
+// NewError wraps a non-nil storage error with its status from MapError
+func NewError(err error) *Error {
+	return &Error{Status: MapError(err), Err: err}
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the HTTP status for the error
+func (e *Error) StatusCode() int {
+	return e.Status
+}
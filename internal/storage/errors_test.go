@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestMapError(t *testing.T) {
+	s3Error := func(code string) error {
+		return minio.ErrorResponse{Code: code, StatusCode: http.StatusTeapot}
+	}
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{s3Error("InvalidBucketName"), http.StatusBadRequest},
+		{s3Error("InvalidRequest"), http.StatusBadRequest},
+		{s3Error("InvalidArgument"), http.StatusBadRequest},
+		{s3Error("InvalidObjectName"), http.StatusBadRequest},
+		{s3Error("KeyTooLongError"), http.StatusBadRequest},
+		{s3Error("AccessDenied"), http.StatusForbidden},
+		{s3Error("AllAccessDisabled"), http.StatusForbidden},
+		{s3Error("NoSuchBucket"), http.StatusNotFound},
+		{s3Error("NoSuchKey"), http.StatusNotFound},
+		{s3Error("NoSuchVersion"), http.StatusNotFound},
+		{s3Error("BucketAlreadyExists"), http.StatusConflict},
+		{s3Error("BucketAlreadyOwnedByYou"), http.StatusConflict},
+		{s3Error("BucketNotEmpty"), http.StatusConflict},
+		{s3Error("PreconditionFailed"), http.StatusPreconditionFailed},
+		{s3Error("EntityTooLarge"), http.StatusRequestEntityTooLarge},
+		{s3Error("InvalidRange"), http.StatusRequestedRangeNotSatisfiable},
+		{s3Error("NotImplemented"), http.StatusNotImplemented},
+		{s3Error("SlowDown"), http.StatusServiceUnavailable},
+		{s3Error("ServiceUnavailable"), http.StatusServiceUnavailable},
+		{s3Error("XMinioServerNotInitialized"), http.StatusServiceUnavailable},
+		{fmt.Errorf("failed to get object: %w", s3Error("AccessDenied")), http.StatusForbidden},
+		{fmt.Errorf("failed to get object: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{ErrCircuitOpen, http.StatusServiceUnavailable},
+		{ErrTooManyReads, http.StatusServiceUnavailable},
+		{s3Error("InternalError"), http.StatusInternalServerError},
+		{errors.New("connection reset"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := MapError(tt.err); got != tt.want {
+			t.Errorf("MapError(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+	for code := range errorStatus {
+		if MapError(s3Error(code)) == http.StatusInternalServerError {
+			t.Errorf("%s is mapped to 500", code)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/muandane/estrois/internal/config"
+)
+
+// ErrTooManyReads is returned instead of queueing a read from storage when
+// MaxQueuedReads reads are already waiting
+var ErrTooManyReads = errors.New("too many storage reads in progress")
+
+// MaxConcurrentReads bounds the object reads in progress against storage
+// across all backends, set by S3_MAX_CONCURRENT_READS (default 0, unlimited)
+var MaxConcurrentReads = config.GetEnvWithDefaultInt("S3_MAX_CONCURRENT_READS", 0)
+
+// MaxQueuedReads is how many reads may wait for a free slot once
+// MaxConcurrentReads is reached; further reads fail with ErrTooManyReads. Set
+// by S3_MAX_QUEUED_READS (default 100, 0 fails reads as soon as no slot is free).
+var MaxQueuedReads = config.GetEnvWithDefaultInt("S3_MAX_QUEUED_READS", 100)
+
+var reads = NewReadLimiter(int(MaxConcurrentReads), int(MaxQueuedReads))
+
+// AcquireRead waits for a slot to read an object from storage and returns the
+// function releasing it once the object has been read. Waiting ends with the
+// context's error when ctx is done first.
+func AcquireRead(ctx context.Context) (func(), error) {
+	return reads.Acquire(ctx)
+}
+
+// ReadLimiter caps concurrent reads and the queue of reads waiting for one,
+// exported as the storage_reads_in_flight and storage_reads_queued metrics
+type ReadLimiter struct {
+	slots     chan struct{}
+	queued    atomic.Int64
+	maxQueued int64
+}
+
+// NewReadLimiter returns a limiter allowing limit concurrent reads, or nil,
+// which allows any number, when limit is not positive
+func NewReadLimiter(limit, maxQueued int) *ReadLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	l := &ReadLimiter{slots: make(chan struct{}, limit), maxQueued: int64(maxQueued)}
+	metrics.GetOrCreateGauge("storage_reads_in_flight", func() float64 {
+		return float64(len(l.slots))
+	})
+	metrics.GetOrCreateGauge("storage_reads_queued", func() float64 {
+		return float64(l.queued.Load())
+	})
+	return l
+}
+
+// Acquire takes a slot, waiting in the queue when none is free. The returned
+// function releases the slot and may be called more than once.
+func (l *ReadLimiter) Acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return l.release(), nil
+	default:
+	}
+
+	if l.queued.Add(1) > l.maxQueued {
+		l.queued.Add(-1)
+		return nil, ErrTooManyReads
+	}
+	defer l.queued.Add(-1)
+	select {
+	case l.slots <- struct{}{}:
+		return l.release(), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *ReadLimiter) release() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-l.slots })
+	}
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadLimiterCapsConcurrentReads(t *testing.T) {
+	const limit = 3
+	limiter := NewReadLimiter(limit, 100)
+	var inFlight, peak atomic.Int64
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := limiter.Acquire(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer release()
+			// A slow read from storage
+			n := inFlight.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(2 * time.Millisecond)
+			inFlight.Add(-1)
+		}()
+	}
+	wg.Wait()
+	if got := peak.Load(); got > limit {
+		t.Errorf("peak concurrent reads = %d, want at most %d", got, limit)
+	}
+}
+
+func TestReadLimiterQueue(t *testing.T) {
+	limiter := NewReadLimiter(1, 1)
+	release, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The next read waits for the slot
+	acquired := make(chan error, 1)
+	go func() {
+		release, err := limiter.Acquire(context.Background())
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+	for limiter.queued.Load() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	// Past the queue depth reads fail fast
+	if _, err := limiter.Acquire(context.Background()); !errors.Is(err, ErrTooManyReads) {
+		t.Errorf("Acquire() with a full queue = %v, want ErrTooManyReads", err)
+	}
+
+	release()
+	release() // releasing twice frees a single slot
+	if err := <-acquired; err != nil {
+		t.Errorf("queued Acquire() = %v, want the released slot", err)
+	}
+	if n := len(limiter.slots); n != 0 {
+		t.Errorf("slots in use = %d after every release, want 0", n)
+	}
+}
+
+func TestReadLimiterWaitEndsWithContext(t *testing.T) {
+	limiter := NewReadLimiter(1, 10)
+	release, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() = %v, want context.DeadlineExceeded", err)
+	}
+	if queued := limiter.queued.Load(); queued != 0 {
+		t.Errorf("queued = %d after giving up, want 0", queued)
+	}
+}
+
+func TestUnlimitedReadLimiter(t *testing.T) {
+	limiter := NewReadLimiter(0, 0)
+	if limiter != nil {
+		t.Fatal("NewReadLimiter(0) != nil")
+	}
+	for range 100 {
+		if _, err := limiter.Acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// S3 naming limits
+const (
+	MinBucketNameLength = 3
+	MaxBucketNameLength = 63
+	MaxObjectKeyLength  = 1024
+)
+
+// ValidateName checks a bucket name and object key against the S3 naming
+// rules, so bad names are rejected before they reach storage
+func ValidateName(bucket, key string) error {
+	if err := ValidateBucketName(bucket); err != nil {
+		return err
+	}
+	return ValidateObjectKey(key)
+}
+
+// ValidateBucketName enforces the S3 bucket naming rules: 3 to 63 lowercase
+// letters, digits, dots and hyphens, starting and ending with a letter or
+// digit, without consecutive dots and not formatted as an IP address
+func ValidateBucketName(bucket string) error {
+	if len(bucket) < MinBucketNameLength || len(bucket) > MaxBucketNameLength {
+		return fmt.Errorf("bucket name must be between %d and %d characters", MinBucketNameLength, MaxBucketNameLength)
+	}
+	for i := 0; i < len(bucket); i++ {
+		c := bucket[i]
+		if !isBucketAlphanumeric(c) && c != '.' && c != '-' {
+			return fmt.Errorf("bucket name may only contain lowercase letters, digits, dots and hyphens")
+		}
+	}
+	if !isBucketAlphanumeric(bucket[0]) || !isBucketAlphanumeric(bucket[len(bucket)-1]) {
+		return fmt.Errorf("bucket name must start and end with a letter or digit")
+	}
+	if strings.Contains(bucket, "..") {
+		return fmt.Errorf("bucket name must not contain consecutive dots")
+	}
+	if _, err := netip.ParseAddr(bucket); err == nil {
+		return fmt.Errorf("bucket name must not be formatted as an IP address")
+	}
+	return nil
+}
+
+// ValidateObjectKey enforces the S3 object key limits and rejects keys that
+// could be read as a path outside the bucket: control characters, invalid
+// UTF-8, a leading slash, and "." or ".." path segments
+func ValidateObjectKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("object key must not be empty")
+	}
+	if len(key) > MaxObjectKeyLength {
+		return fmt.Errorf("object key must be at most %d bytes", MaxObjectKeyLength)
+	}
+	if !utf8.ValidString(key) {
+		return fmt.Errorf("object key must be valid UTF-8")
+	}
+	if strings.IndexFunc(key, unicode.IsControl) >= 0 {
+		return fmt.Errorf("object key must not contain control characters")
+	}
+	if strings.HasPrefix(key, "/") {
+		return fmt.Errorf("object key must not start with a slash")
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "." || segment == ".." {
+			return fmt.Errorf("object key must not contain relative path segments")
+		}
+	}
+	return nil
+}
+
+func isBucketAlphanumeric(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('0' <= c && c <= '9')
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name    string
+		bucket  string
+		key     string
+		wantErr bool
+	}{
+		{"valid", "my-bucket.logs", "reports/2024/summary.pdf", false},
+		{"unicode key", "photos", "vacances/été.jpg", false},
+		{"dots inside a segment", "photos", "a..b/.hidden", false},
+		{"longest key", "photos", strings.Repeat("k", MaxObjectKeyLength), false},
+		{"longest bucket", strings.Repeat("b", MaxBucketNameLength), "key", false},
+		{"path traversal", "photos", "../etc/passwd", true},
+		{"traversal mid key", "photos", "a/../../b", true},
+		{"dot segment", "photos", "a/./b", true},
+		{"leading slash", "photos", "/etc/passwd", true},
+		{"control character", "photos", "a\x00b", true},
+		{"newline", "photos", "a\nb", true},
+		{"invalid utf-8", "photos", "a\xffb", true},
+		{"overlong key", "photos", strings.Repeat("k", MaxObjectKeyLength+1), true},
+		{"empty key", "photos", "", true},
+		{"uppercase bucket", "Photos", "key", true},
+		{"underscore bucket", "my_bucket", "key", true},
+		{"short bucket", "ab", "key", true},
+		{"overlong bucket", strings.Repeat("b", MaxBucketNameLength+1), "key", true},
+		{"bucket starting with a hyphen", "-photos", "key", true},
+		{"bucket ending with a dot", "photos.", "key", true},
+		{"consecutive dots", "my..bucket", "key", true},
+		{"ip address bucket", "192.168.1.1", "key", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateName(tt.bucket, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateName(%q, %q) = %v, want error %v", tt.bucket, tt.key, err, tt.wantErr)
+			}
+		})
+	}
+}
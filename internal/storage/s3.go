@@ -2,27 +2,127 @@ package storage
 
 import (
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/muandane/estrois/internal/config"
 )
 
-var minioClient *minio.Client
+var backends *Backends
 
-// InitMinioClient initializes the MinIO client with the provided configuration
+// OpTimeout bounds each storage operation so a hung backend cannot hang requests
+var OpTimeout = config.GetEnvWithDefaultDuration("S3_OP_TIMEOUT", 30*time.Second)
+
+// InitMinioClient initializes the default MinIO client with the provided configuration
 func InitMinioClient(config *config.StorageConfig) {
-	var err error
-	minioClient, err = minio.New(config.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(config.AccessKeyID, config.SecretAccessKey, ""),
-		Secure: config.UseSSL,
-	})
+	client, breaker, err := newClient(DefaultBackend, config)
 	if err != nil {
 		panic(fmt.Sprintf("Failed to initialize Minio client: %v", err))
 	}
+	backends = NewBackends(client)
+	backends.SetBreaker(DefaultBackend, breaker)
+}
+
+// InitBackends adds the named backends next to the default one and routes
+// buckets to them. InitMinioClient must be called first.
+func InitBackends(configs map[string]*config.StorageConfig, routes map[string]string) error {
+	for name, backendConfig := range configs {
+		client, breaker, err := newClient(name, backendConfig)
+		if err != nil {
+			return fmt.Errorf("failed to initialize backend %s: %w", name, err)
+		}
+		backends.Add(name, client)
+		backends.SetBreaker(name, breaker)
+	}
+	for bucket, name := range routes {
+		if err := backends.Route(bucket, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetBackends returns the initialized storage backends
+func GetBackends() *Backends {
+	return backends
+}
+
+// ClientForBucket returns the MinIO client serving bucket
+func ClientForBucket(bucket string) *minio.Client {
+	return backends.ClientForBucket(bucket)
 }
 
-// GetMinioClient returns the initialized MinIO client
-func GetMinioClient() *minio.Client {
-	return minioClient
+// newClient creates the client of the named backend. Unless BreakerThreshold
+// is 0, its requests go through a circuit breaker, which is returned too.
+func newClient(name string, config *config.StorageConfig) (*minio.Client, *Breaker, error) {
+	opts, err := clientOptions(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	var breaker *Breaker
+	if BreakerThreshold > 0 {
+		transport, err := minio.DefaultTransport(config.UseSSL)
+		if err != nil {
+			return nil, nil, err
+		}
+		breaker = NewBreaker(name, int(BreakerThreshold), BreakerCooldown)
+		opts.Transport = &breakerTransport{next: transport, breaker: breaker}
+	}
+	client, err := minio.New(config.Endpoint, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, breaker, nil
+}
+
+// clientOptions maps a backend's configuration to the MinIO client options
+func clientOptions(cfg *config.StorageConfig) (*minio.Options, error) {
+	creds, err := newCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts := &minio.Options{
+		Creds:  creds,
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	}
+	switch cfg.BucketLookup {
+	case config.BucketLookupPath:
+		opts.BucketLookup = minio.BucketLookupPath
+	case config.BucketLookupDNS:
+		opts.BucketLookup = minio.BucketLookupDNS
+	default:
+		opts.BucketLookup = minio.BucketLookupAuto
+	}
+	return opts, nil
+}
+
+// newCredentials returns the credentials of the provider selected by
+// S3_CREDS_PROVIDER. Providers other than static fetch and renew temporary
+// credentials as they expire.
+func newCredentials(cfg *config.StorageConfig) (*credentials.Credentials, error) {
+	switch cfg.CredsProvider {
+	case config.CredsProviderIAM:
+		return credentials.NewIAM(""), nil
+	case config.CredsProviderEnv:
+		return credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+		}), nil
+	case config.CredsProviderSTS:
+		return credentials.NewSTSWebIdentity(cfg.STSEndpoint, func() (*credentials.WebIdentityToken, error) {
+			token, err := os.ReadFile(cfg.STSTokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read STS token file: %w", err)
+			}
+			return &credentials.WebIdentityToken{Token: strings.TrimSpace(string(token))}, nil
+		}, func(identity *credentials.STSWebIdentity) {
+			identity.RoleARN = cfg.STSRoleARN
+		})
+	default:
+		return credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""), nil
+	}
 }
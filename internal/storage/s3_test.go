@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/muandane/estrois/internal/config"
+)
+
+func TestClientOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        config.StorageConfig
+		wantRegion string
+		wantLookup minio.BucketLookupType
+	}{
+		{"defaults", config.StorageConfig{}, "", minio.BucketLookupAuto},
+		{"auto", config.StorageConfig{BucketLookup: config.BucketLookupAuto}, "", minio.BucketLookupAuto},
+		{"path style", config.StorageConfig{Region: "us-east-1", BucketLookup: config.BucketLookupPath}, "us-east-1", minio.BucketLookupPath},
+		{"virtual host", config.StorageConfig{Region: "eu-west-3", BucketLookup: config.BucketLookupDNS, UseSSL: true}, "eu-west-3", minio.BucketLookupDNS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := clientOptions(&tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts.Region != tt.wantRegion || opts.BucketLookup != tt.wantLookup || opts.Secure != tt.cfg.UseSSL {
+				t.Errorf("options = region %q, lookup %v, secure %v, want %q, %v, %v",
+					opts.Region, opts.BucketLookup, opts.Secure, tt.wantRegion, tt.wantLookup, tt.cfg.UseSSL)
+			}
+		})
+	}
+}
+
+func TestNewCredentials(t *testing.T) {
+	for _, key := range []string{"AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "MINIO_ROOT_USER", "MINIO_ACCESS_KEY"} {
+		t.Setenv(key, "")
+	}
+	expiration := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	// The container credentials endpoint used by the IAM provider
+	iam := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"AccessKeyId":"iam-key","SecretAccessKey":"iam-secret","Token":"iam-token","Expiration":%q}`, expiration)
+	}))
+	defer iam.Close()
+
+	// An STS endpoint that only accepts the expected token and role
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("Action") != "AssumeRoleWithWebIdentity" || r.Form.Get("WebIdentityToken") != "web-token" || r.Form.Get("RoleArn") != "arn:aws:iam::123:role/estrois" {
+			http.Error(w, "unexpected request "+r.Form.Encode(), http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleWithWebIdentityResult><Credentials>`+
+			`<AccessKeyId>sts-key</AccessKeyId><SecretAccessKey>sts-secret</SecretAccessKey><SessionToken>sts-token</SessionToken><Expiration>%s</Expiration>`+
+			`</Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`, expiration)
+	}))
+	defer sts.Close()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("web-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		cfg        config.StorageConfig
+		env        map[string]string
+		wantKey    string
+		wantSecret string
+		wantToken  string
+	}{
+		{
+			name:    "static",
+			cfg:     config.StorageConfig{CredsProvider: config.CredsProviderStatic, AccessKeyID: "static-key", SecretAccessKey: "static-secret"},
+			wantKey: "static-key", wantSecret: "static-secret",
+		},
+		{
+			name:    "default is static",
+			cfg:     config.StorageConfig{AccessKeyID: "static-key", SecretAccessKey: "static-secret"},
+			wantKey: "static-key", wantSecret: "static-secret",
+		},
+		{
+			name:    "env",
+			cfg:     config.StorageConfig{CredsProvider: config.CredsProviderEnv, AccessKeyID: "ignored"},
+			env:     map[string]string{"AWS_ACCESS_KEY_ID": "env-key", "AWS_SECRET_ACCESS_KEY": "env-secret"},
+			wantKey: "env-key", wantSecret: "env-secret",
+		},
+		{
+			name:    "iam",
+			cfg:     config.StorageConfig{CredsProvider: config.CredsProviderIAM, AccessKeyID: "ignored"},
+			env:     map[string]string{"AWS_CONTAINER_CREDENTIALS_FULL_URI": iam.URL},
+			wantKey: "iam-key", wantSecret: "iam-secret", wantToken: "iam-token",
+		},
+		{
+			name: "sts",
+			cfg: config.StorageConfig{
+				CredsProvider: config.CredsProviderSTS,
+				STSEndpoint:   sts.URL,
+				STSTokenFile:  tokenFile,
+				STSRoleARN:    "arn:aws:iam::123:role/estrois",
+			},
+			wantKey: "sts-key", wantSecret: "sts-secret", wantToken: "sts-token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			creds, err := newCredentials(&tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, err := creds.Get()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value.AccessKeyID != tt.wantKey || value.SecretAccessKey != tt.wantSecret || value.SessionToken != tt.wantToken {
+				t.Errorf("credentials = %q/%q/%q, want %q/%q/%q",
+					value.AccessKeyID, value.SecretAccessKey, value.SessionToken, tt.wantKey, tt.wantSecret, tt.wantToken)
+			}
+		})
+	}
+}